@@ -0,0 +1,64 @@
+package duitku
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PrimaryKeyID identifies Config.APIKey in CallbackData.SignedWith
+const PrimaryKeyID = "primary"
+
+// PreviousAPIKey is an API key that was rotated out but is still accepted on
+// callbacks, so orders created before the rotation can complete. Outgoing
+// requests are always signed with Config.APIKey.
+type PreviousAPIKey struct {
+	// ID names the key in CallbackData.SignedWith, defaults to "previous-1",
+	// "previous-2", ... in the order of Config.PreviousAPIKeys
+	ID string
+	// Key is the old API key
+	Key string
+	// ExpiresAt is when callbacks signed with the key stop being accepted.
+	// The zero value never expires.
+	ExpiresAt time.Time
+}
+
+// apiKey is a key that may have signed a callback
+type apiKey struct {
+	id  string
+	key string
+}
+
+// callbackKeys returns the primary key followed by the previous keys that have not expired at now
+func (c *Client) callbackKeys(now time.Time) []apiKey {
+	keys := []apiKey{{id: PrimaryKeyID, key: c.config.APIKey}}
+	for i, previous := range c.config.PreviousAPIKeys {
+		if previous.Key == "" {
+			continue
+		}
+		if !previous.ExpiresAt.IsZero() && !now.Before(previous.ExpiresAt) {
+			continue
+		}
+		id := previous.ID
+		if id == "" {
+			id = fmt.Sprintf("previous-%d", i+1)
+		}
+		keys = append(keys, apiKey{id: id, key: previous.Key})
+	}
+	return keys
+}
+
+// MatchCallbackSignature checks the callback signature against the primary
+// key and every previous key that has not expired, and returns the ID of the
+// key that matched
+func (c *Client) MatchCallbackSignature(data *CallbackData) (string, bool) {
+	signature := []byte(strings.ToLower(data.Signature))
+	for _, key := range c.callbackKeys(time.Now()) {
+		expected := SignatureMD5(key.key, data.MerchantCode, data.Amount, data.MerchantOrderID)
+		if subtle.ConstantTimeCompare([]byte(expected), signature) == 1 {
+			return key.id, true
+		}
+	}
+	return "", false
+}
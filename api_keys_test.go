@@ -0,0 +1,82 @@
+package duitku
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchCallbackSignature(t *testing.T) {
+	client := &Client{config: Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "NEWKEY",
+		PreviousAPIKeys: []PreviousAPIKey{
+			{ID: "2024-q1", Key: "OLDKEY", ExpiresAt: time.Now().Add(time.Hour)},
+			{Key: "EXPIREDKEY", ExpiresAt: time.Now().Add(-time.Hour)},
+			{Key: "FOREVERKEY"},
+		},
+	}}
+
+	tests := []struct {
+		name   string
+		key    string
+		upper  bool
+		wantID string
+		wantOK bool
+	}{
+		{name: "Primary Key", key: "NEWKEY", wantID: PrimaryKeyID, wantOK: true},
+		{name: "Primary Key Uppercase Signature", key: "NEWKEY", upper: true, wantID: PrimaryKeyID, wantOK: true},
+		{name: "Previous Key", key: "OLDKEY", wantID: "2024-q1", wantOK: true},
+		{name: "Expired Key", key: "EXPIREDKEY"},
+		{name: "Previous Key Without Expiry", key: "FOREVERKEY", wantID: "previous-3", wantOK: true},
+		{name: "Unknown Key", key: "OTHERKEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &CallbackData{
+				MerchantCode:    "DXXXX",
+				Amount:          "150000",
+				MerchantOrderID: "ORDER123",
+				Signature:       SignatureMD5(tt.key, "DXXXX", "150000", "ORDER123"),
+			}
+			if tt.upper {
+				data.Signature = strings.ToUpper(data.Signature)
+			}
+
+			id, ok := client.MatchCallbackSignature(data)
+			if ok != tt.wantOK || id != tt.wantID {
+				t.Errorf("MatchCallbackSignature() = %q, %v, want %q, %v", id, ok, tt.wantID, tt.wantOK)
+			}
+			if got := client.VerifyCallbackSignature(data); got != tt.wantOK {
+				t.Errorf("VerifyCallbackSignature() = %v, want %v", got, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseCallbackSignedWith(t *testing.T) {
+	oldClient := &Client{config: Config{MerchantCode: "DXXXX", APIKey: "OLDKEY"}}
+	client := &Client{config: Config{
+		MerchantCode:    "DXXXX",
+		APIKey:          "NEWKEY",
+		PreviousAPIKeys: []PreviousAPIKey{{ID: "old", Key: "OLDKEY"}},
+	}}
+
+	// An order created before the rotation is paid afterwards
+	form := oldClient.NewCallbackData("ORDER123", 40000, PaymentMethodBCA, CallbackStatusSuccess).FormValues()
+	req := httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	data, err := client.ParseCallback(req)
+	if err != nil {
+		t.Fatalf("ParseCallback() error = %v", err)
+	}
+	if data.SignedWith != "old" {
+		t.Errorf("SignedWith = %q, want old", data.SignedWith)
+	}
+	if got := client.createSignatureMD5("ORDER123"); got != SignatureMD5("NEWKEY", "ORDER123") {
+		t.Errorf("createSignatureMD5() = %s, want a signature with the primary key", got)
+	}
+}
@@ -1,12 +1,16 @@
 package duitku
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // CallbackData represents the data received in a Duitku callback
@@ -17,7 +21,7 @@ import (
 // - merchantOrderId: Transaction number from merchant. Example: abcde12345
 // - productDetail: Description about product/service on transaction. Example: Payment example for example merchant
 // - additionalParam: Additional parameters that you send at the beginning of the transaction request.
-// - paymentCode: Payment method code. Example: VC
+// - paymentCode: Payment method code. Example: VC. For redirect transactions this is the first place the method chosen by the customer is known.
 // - resultCode: Result code callback notification. Example: 00 - Success, 01 - Failed
 // - merchantUserId: Customer's username or email on your site. Example: your_customer@example.com
 // - reference: Transaction reference number from Duitku. Please keep it for the purposes of recording or tracking transactions. Example: DXXXXCX80TXXX5Q70QCI
@@ -26,6 +30,8 @@ import (
 // - spUserHash: Will be sent to your callback if the payment method using ShopeePay(QRIS, App, and Account Link). If this string parameter contains alphabet and numeric, then it might been paid by Shopee itself. Example: xxxyyyzzz
 // - settlementDate: Settlement date estimation information. Format: YYYY-MM-DD. Example: 2023-07-25
 // - issuerCode: QRIS issuer code information. Example: 93600523
+// - subscriptionId: Subscription identifier, only sent for recurring credit card charges. Example: SUB0001234
+// - cycleNumber: Subscription cycle being charged, only sent for recurring credit card charges. Example: 3
 type CallbackData struct {
 	MerchantCode     string `json:"merchantCode"`
 	Amount           string `json:"amount"`
@@ -41,29 +47,51 @@ type CallbackData struct {
 	SpUserHash       string `json:"spUserHash"`
 	SettlementDate   string `json:"settlementDate"`
 	IssuerCode       string `json:"issuerCode"`
+	SubscriptionID   string `json:"subscriptionId,omitempty"`
+	CycleNumber      string `json:"cycleNumber,omitempty"`
+
+	// SignedWith is the ID of the API key that matched the signature, set by
+	// ParseCallback: PrimaryKeyID or the ID of one of Config.PreviousAPIKeys
+	SignedWith string `json:"signedWith,omitempty"`
+
+	// CorrelationID is the TransactionRequest.CorrelationID of the
+	// transaction, read from AdditionalParam or MerchantUserID
+	CorrelationID string `json:"correlationId,omitempty"`
 }
 
-// ParseCallback parses the callback data from an HTTP request
+// maxCallbackBodySize limits the size of JSON callback bodies
+const maxCallbackBodySize = 1 << 20
+
+// ParseCallback parses the callback data from an HTTP request. Form encoded
+// bodies are used by the regular API; application/json bodies, as posted by
+// the POP and SNAP products, are decoded with the same field names.
 func (c *Client) ParseCallback(r *http.Request) (*CallbackData, error) {
-	if err := r.ParseForm(); err != nil {
-		return nil, fmt.Errorf("error parsing form: %w", err)
+	values, err := callbackValues(r)
+	if err != nil {
+		return nil, err
 	}
+	return c.callbackFromValues(values)
+}
 
-	// Extract callback data from form
-	merchantCode := r.FormValue("merchantCode")
-	amountStr := r.FormValue("amount")
-	merchantOrderID := r.FormValue("merchantOrderId")
-	productDetail := r.FormValue("productDetail")
-	additionalParam := r.FormValue("additionalParam")
-	paymentCode := r.FormValue("paymentCode")
-	resultCode := r.FormValue("resultCode")
-	merchantUserID := r.FormValue("merchantUserId")
-	reference := r.FormValue("reference")
-	signature := r.FormValue("signature")
-	publisherOrderId := r.FormValue("publisherOrderId")
-	spUserHash := r.FormValue("spUserHash")
-	settlementDate := r.FormValue("settlementDate")
-	issuerCode := r.FormValue("issuerCode")
+// callbackFromValues builds the callback data from the request fields and verifies its signature
+func (c *Client) callbackFromValues(values url.Values) (*CallbackData, error) {
+	// Extract callback data
+	merchantCode := values.Get("merchantCode")
+	amountStr := values.Get("amount")
+	merchantOrderID := values.Get("merchantOrderId")
+	productDetail := values.Get("productDetail")
+	additionalParam := values.Get("additionalParam")
+	paymentCode := values.Get("paymentCode")
+	resultCode := values.Get("resultCode")
+	merchantUserID := values.Get("merchantUserId")
+	reference := values.Get("reference")
+	signature := values.Get("signature")
+	publisherOrderId := values.Get("publisherOrderId")
+	spUserHash := values.Get("spUserHash")
+	settlementDate := values.Get("settlementDate")
+	issuerCode := values.Get("issuerCode")
+	subscriptionID := values.Get("subscriptionId")
+	cycleNumber := values.Get("cycleNumber")
 
 	// Validate required fields
 	if merchantCode == "" || amountStr == "" || merchantOrderID == "" || resultCode == "" || signature == "" {
@@ -86,32 +114,69 @@ func (c *Client) ParseCallback(r *http.Request) (*CallbackData, error) {
 		SpUserHash:       spUserHash,
 		SettlementDate:   settlementDate,
 		IssuerCode:       issuerCode,
+		SubscriptionID:   subscriptionID,
+		CycleNumber:      cycleNumber,
 	}
 
 	// Verify signature
-	if !c.VerifyCallbackSignature(callbackData) {
+	keyID, ok := c.MatchCallbackSignature(callbackData)
+	if !ok {
 		return nil, errors.New("invalid callback signature")
 	}
+	callbackData.SignedWith = keyID
+	callbackData.CorrelationID = callbackCorrelationID(callbackData)
 
 	return callbackData, nil
 }
 
-// VerifyCallbackSignature verifies the signature of a callback
+// callbackValues reads the callback fields from a form encoded or JSON body
+func callbackValues(r *http.Request) (url.Values, error) {
+	if !isJSONContentType(r.Header.Get("Content-Type")) {
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("error parsing form: %w", err)
+		}
+		return r.Form, nil
+	}
+
+	var body map[string]interface{}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxCallbackBodySize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("error parsing json: %w", err)
+	}
+
+	values := url.Values{}
+	for key, value := range body {
+		switch v := value.(type) {
+		case string:
+			values.Set(key, v)
+		case json.Number:
+			values.Set(key, v.String())
+		case bool:
+			values.Set(key, strconv.FormatBool(v))
+		case nil:
+			// Treat null as absent
+		default:
+			return nil, fmt.Errorf("error parsing json: field %s must be a string or number", key)
+		}
+	}
+	return values, nil
+}
+
+// isJSONContentType returns true for application/json and +json media types
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// VerifyCallbackSignature verifies the signature of a callback against the
+// primary API key and any previous keys that have not expired
 func (c *Client) VerifyCallbackSignature(data *CallbackData) bool {
-	// Create signature string
-	signatureStr := fmt.Sprintf("%s%s%s%s",
-		data.MerchantCode,
-		data.Amount,
-		data.MerchantOrderID,
-		c.config.APIKey,
-	)
-
-	// Calculate MD5 hash
-	hash := md5.Sum([]byte(signatureStr))
-	expectedSignature := hex.EncodeToString(hash[:])
-
-	// Compare signatures
-	return strings.EqualFold(expectedSignature, data.Signature)
+	_, ok := c.MatchCallbackSignature(data)
+	return ok
 }
 
 // IsSuccessful returns true if the callback indicates a successful payment
@@ -119,22 +184,67 @@ func (data *CallbackData) IsSuccessful() bool {
 	return data.ResultCode == "00"
 }
 
+// HasPaymentCode returns true if the callback reports the payment method used.
+// Redirect transactions are created without a method, so handlers should record
+// PaymentCode from the callback rather than from the original request.
+func (data *CallbackData) HasPaymentCode() bool {
+	return data.PaymentCode != ""
+}
+
 // HandleCallback is a helper function to handle Duitku callbacks
 func (c *Client) HandleCallback(w http.ResponseWriter, r *http.Request, handler func(*CallbackData) error) {
+	start := time.Now()
+
+	// Reject sources outside the allowlist before looking at the body
+	if err := c.VerifyCallbackSource(r); err != nil {
+		c.rejectCallback(start, CallbackOutcomeForbidden, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	c.serveCallback(w, start, func() (*CallbackData, error) { return c.ParseCallback(r) }, handler)
+}
+
+// callbackFailure is a handler error answered with its own outcome and HTTP
+// status instead of a handler error and 500
+type callbackFailure struct {
+	outcome string
+	status  int
+	err     error
+}
+
+// Error returns the message of the underlying error
+func (e *callbackFailure) Error() string {
+	return e.err.Error()
+}
+
+// serveCallback parses a callback from an allowed source, runs the handler
+// and writes the response
+func (c *Client) serveCallback(w http.ResponseWriter, start time.Time, parse func() (*CallbackData, error), handler func(*CallbackData) error) {
 	// Parse callback data
-	callbackData, err := c.ParseCallback(r)
+	callbackData, err := parse()
 	if err != nil {
+		c.rejectCallback(start, CallbackOutcomeInvalid, err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Call handler
+	span := c.startCallbackSpan(callbackData)
 	if err := handler(callbackData); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		outcome, status := CallbackOutcomeHandlerError, http.StatusInternalServerError
+		var failure *callbackFailure
+		if errors.As(err, &failure) {
+			outcome, status, err = failure.outcome, failure.status, failure.err
+		}
+		c.finishCallback(start, span, outcome, callbackData, err)
+		http.Error(w, err.Error(), status)
 		return
 	}
 
 	// Return success
+	c.recordCallback(callbackData)
+	c.finishCallback(start, span, CallbackOutcomeOK, callbackData, nil)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
@@ -0,0 +1,275 @@
+package duitku
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for AsyncCallbackOptions
+const (
+	DefaultCallbackWorkers     = 4
+	DefaultCallbackMaxAttempts = 5
+	DefaultCallbackQueueSize   = 1000
+)
+
+// AsyncCallbackOptions configures an AsyncCallbackProcessor
+type AsyncCallbackOptions struct {
+	// Queue stores verified callbacks, defaults to a MemoryQueue of DefaultCallbackQueueSize
+	Queue CallbackQueue
+	// Workers is the number of concurrent handlers, defaults to DefaultCallbackWorkers
+	Workers int
+	// MaxAttempts is the number of times a callback is handled before it is
+	// moved to the dead-letter store, defaults to DefaultCallbackMaxAttempts
+	MaxAttempts int
+	// Backoff returns the delay before the given retry, defaults to
+	// exponential backoff from one second capped at one minute
+	Backoff func(attempt int) time.Duration
+	// DeadLetter receives callbacks that failed every attempt, defaults to a MemoryDeadLetterStore
+	DeadLetter DeadLetterStore
+}
+
+// AsyncCallbackProcessor acknowledges Duitku callbacks as soon as they are
+// verified and stored, and runs the handler in a pool of workers. Slow work
+// no longer delays the response, so Duitku does not time out and retry.
+//
+// Because a callback can be handled more than once (after a crash, or when
+// Duitku delivers it twice), handlers must be idempotent.
+type AsyncCallbackProcessor struct {
+	client  *Client
+	handler CallbackHandlerFunc
+	opts    AsyncCallbackOptions
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	retries map[string]*time.Timer
+	pending map[string]*QueuedCallback
+}
+
+// NewAsyncCallbackProcessor creates a processor that runs handler for every
+// verified callback. Call Start before serving requests.
+func (c *Client) NewAsyncCallbackProcessor(handler CallbackHandlerFunc, opts AsyncCallbackOptions) *AsyncCallbackProcessor {
+	if opts.Queue == nil {
+		opts.Queue = NewMemoryQueue(DefaultCallbackQueueSize)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultCallbackWorkers
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultCallbackMaxAttempts
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = defaultCallbackBackoff
+	}
+	if opts.DeadLetter == nil {
+		opts.DeadLetter = &MemoryDeadLetterStore{}
+	}
+
+	return &AsyncCallbackProcessor{
+		client:  c,
+		handler: handler,
+		opts:    opts,
+		retries: make(map[string]*time.Timer),
+		pending: make(map[string]*QueuedCallback),
+	}
+}
+
+// defaultCallbackBackoff doubles the delay from one second up to one minute
+func defaultCallbackBackoff(attempt int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempt && delay < time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// Start launches the workers
+func (p *AsyncCallbackProcessor) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.opts.Workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+}
+
+// Stop waits for the callbacks being handled to finish and stops the
+// workers. Callbacks waiting for a retry are put back on the queue, so a
+// durable queue delivers them again after a restart.
+func (p *AsyncCallbackProcessor) Stop() {
+	p.mu.Lock()
+	cancel := p.cancel
+	p.cancel = nil
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requeueRetries()
+}
+
+// requeueRetries puts the callbacks waiting for a retry back on the queue.
+// A retry timer that already fired but waits for the lock has not requeued
+// its item yet and returns once the entry is gone, so every entry still in
+// retries is requeued here. The lock must be held.
+func (p *AsyncCallbackProcessor) requeueRetries() {
+	for id, timer := range p.retries {
+		timer.Stop()
+		item := p.pending[id]
+		if err := p.opts.Queue.Requeue(item); err != nil {
+			p.logf("error requeueing callback %s for order %s: %v", item.ID, item.Data.MerchantOrderID, err)
+		}
+		delete(p.retries, id)
+		delete(p.pending, id)
+	}
+}
+
+// Enqueue stores a verified callback for processing
+func (p *AsyncCallbackProcessor) Enqueue(data *CallbackData) error {
+	id, err := newCallbackID()
+	if err != nil {
+		return err
+	}
+	return p.opts.Queue.Enqueue(&QueuedCallback{
+		ID:         id,
+		Data:       *data,
+		EnqueuedAt: time.Now(),
+	})
+}
+
+// ServeHTTP verifies the callback, stores it and responds immediately
+func (p *AsyncCallbackProcessor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.client.HandleCallbackAsync(w, r, p)
+}
+
+// work handles queued callbacks until ctx is cancelled
+func (p *AsyncCallbackProcessor) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		item, err := p.opts.Queue.Dequeue(ctx)
+		if err != nil {
+			return
+		}
+		p.process(item)
+	}
+}
+
+// process runs the handler for one callback and schedules a retry or moves
+// it to the dead-letter store when the handler fails
+func (p *AsyncCallbackProcessor) process(item *QueuedCallback) {
+	item.Attempts++
+	err := p.run(item)
+	if err == nil {
+		p.ack(item.ID)
+		return
+	}
+	item.LastError = err.Error()
+
+	if item.Attempts >= p.opts.MaxAttempts {
+		if err := p.opts.DeadLetter.Put(item); err != nil {
+			p.logf("error storing dead letter %s for order %s: %v", item.ID, item.Data.MerchantOrderID, err)
+			// Leave the item unacknowledged so a durable queue keeps it
+			return
+		}
+		p.logf("callback %s for order %s moved to dead letters after %d attempts: %v",
+			item.ID, item.Data.MerchantOrderID, item.Attempts, err)
+		p.ack(item.ID)
+		return
+	}
+
+	p.scheduleRetry(item)
+}
+
+// run calls the handler, turning a panic into an error
+func (p *AsyncCallbackProcessor) run(item *QueuedCallback) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("callback handler panic: %v", r)
+		}
+	}()
+	data := item.Data
+	return p.handler(&data)
+}
+
+// scheduleRetry puts the item back on the queue after the backoff delay
+func (p *AsyncCallbackProcessor) scheduleRetry(item *QueuedCallback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending[item.ID] = item
+	p.retries[item.ID] = time.AfterFunc(p.opts.Backoff(item.Attempts), func() { p.retry(item) })
+}
+
+// retry puts the item back on the queue when its backoff delay has passed
+func (p *AsyncCallbackProcessor) retry(item *QueuedCallback) {
+	p.mu.Lock()
+	if _, ok := p.retries[item.ID]; !ok {
+		// Stop already requeued it
+		p.mu.Unlock()
+		return
+	}
+	delete(p.retries, item.ID)
+	delete(p.pending, item.ID)
+	p.mu.Unlock()
+
+	if err := p.opts.Queue.Requeue(item); err != nil {
+		p.logf("error requeueing callback %s for order %s: %v", item.ID, item.Data.MerchantOrderID, err)
+	}
+}
+
+func (p *AsyncCallbackProcessor) ack(id string) {
+	if err := p.opts.Queue.Ack(id); err != nil {
+		p.logf("error acknowledging callback %s: %v", id, err)
+	}
+}
+
+func (p *AsyncCallbackProcessor) logf(format string, args ...interface{}) {
+	if p.client.logger != nil {
+		p.client.logger.Printf(format, args...)
+	}
+}
+
+// newCallbackID returns a random queue item ID
+func newCallbackID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating callback id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HandleCallbackAsync is the asynchronous variant of HandleCallback. It
+// verifies the callback, stores it in the processor's queue and responds with
+// 200 OK without waiting for the handler. Sources outside the allowlist get
+// 403, invalid callbacks get 400 and a callback that cannot be stored gets
+// 503, so Duitku delivers it again.
+func (c *Client) HandleCallbackAsync(w http.ResponseWriter, r *http.Request, processor *AsyncCallbackProcessor) {
+	// Store for the workers
+	c.HandleCallback(w, r, func(data *CallbackData) error {
+		if err := processor.Enqueue(data); err != nil {
+			return &callbackFailure{outcome: CallbackOutcomeQueueFull, status: http.StatusServiceUnavailable, err: err}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,230 @@
+package duitku
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newAsyncTestClient() *Client {
+	return &Client{config: Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	}}
+}
+
+func TestHandleCallbackAsync(t *testing.T) {
+	client := newAsyncTestClient()
+
+	release := make(chan struct{})
+	handled := make(chan string, 1)
+	processor := client.NewAsyncCallbackProcessor(func(data *CallbackData) error {
+		<-release
+		handled <- data.MerchantOrderID
+		return nil
+	}, AsyncCallbackOptions{Workers: 1})
+	processor.Start()
+	defer processor.Stop()
+
+	// The response is sent while the handler is still blocked
+	w := httptest.NewRecorder()
+	processor.ServeHTTP(w, newRouterRequest(client, "ORDER-1", PaymentMethodBCA, CallbackStatusSuccess, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	close(release)
+	select {
+	case orderID := <-handled:
+		if orderID != "ORDER-1" {
+			t.Errorf("handled order = %s, want ORDER-1", orderID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+}
+
+func TestHandleCallbackAsyncRejects(t *testing.T) {
+	client := newAsyncTestClient()
+
+	t.Run("Invalid Signature", func(t *testing.T) {
+		processor := client.NewAsyncCallbackProcessor(func(*CallbackData) error { return nil }, AsyncCallbackOptions{})
+		req := newRouterRequest(client, "ORDER-1", PaymentMethodBCA, CallbackStatusSuccess, map[string]string{"signature": "bad"})
+
+		w := httptest.NewRecorder()
+		client.HandleCallbackAsync(w, req, processor)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if processor.opts.Queue.(*MemoryQueue).Len() != 0 {
+			t.Error("invalid callback was queued")
+		}
+	})
+
+	t.Run("Queue Full", func(t *testing.T) {
+		client := newAsyncTestClient()
+		tracer := &recordingTracer{}
+		client.config.Tracer = tracer
+		processor := client.NewAsyncCallbackProcessor(func(*CallbackData) error { return nil }, AsyncCallbackOptions{
+			Queue: NewMemoryQueue(0),
+		})
+		req := newRouterRequest(client, "ORDER-1", PaymentMethodBCA, CallbackStatusSuccess, nil)
+
+		w := httptest.NewRecorder()
+		client.HandleCallbackAsync(w, req, processor)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+		if !strings.Contains(w.Body.String(), ErrQueueFull.Error()) {
+			t.Errorf("body = %q, want %q", w.Body.String(), ErrQueueFull.Error())
+		}
+		if len(tracer.spans) != 1 || tracer.spans[0].attributes[AttrCallbackOutcome] != CallbackOutcomeQueueFull {
+			t.Errorf("spans = %+v, want one %s span", tracer.spans, CallbackOutcomeQueueFull)
+		}
+	})
+}
+
+func TestAsyncCallbackProcessorRetries(t *testing.T) {
+	client := newAsyncTestClient()
+
+	var mu sync.Mutex
+	attempts := 0
+	done := make(chan struct{})
+	processor := client.NewAsyncCallbackProcessor(func(data *CallbackData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			return errors.New("inventory unavailable")
+		}
+		close(done)
+		return nil
+	}, AsyncCallbackOptions{
+		Workers:     2,
+		MaxAttempts: 5,
+		Backoff:     func(int) time.Duration { return time.Millisecond },
+	})
+	processor.Start()
+	defer processor.Stop()
+
+	if err := processor.Enqueue(client.NewCallbackData("ORDER-1", 40000, PaymentMethodBCA, CallbackStatusSuccess)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callback was not retried until it succeeded")
+	}
+	if items := processor.opts.DeadLetter.(*MemoryDeadLetterStore).Items(); len(items) != 0 {
+		t.Errorf("dead letters = %+v, want none", items)
+	}
+}
+
+func TestAsyncCallbackProcessorDeadLetter(t *testing.T) {
+	client := newAsyncTestClient()
+	deadLetters := &MemoryDeadLetterStore{}
+
+	processor := client.NewAsyncCallbackProcessor(func(data *CallbackData) error {
+		panic("email server down")
+	}, AsyncCallbackOptions{
+		MaxAttempts: 3,
+		Backoff:     func(int) time.Duration { return time.Millisecond },
+		DeadLetter:  deadLetters,
+	})
+	processor.Start()
+	defer processor.Stop()
+
+	processor.Enqueue(client.NewCallbackData("ORDER-1", 40000, PaymentMethodBCA, CallbackStatusSuccess))
+
+	deadline := time.Now().Add(time.Second)
+	for len(deadLetters.Items()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	items := deadLetters.Items()
+	if len(items) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(items))
+	}
+	if items[0].Attempts != 3 {
+		t.Errorf("Attempts = %d, want 3", items[0].Attempts)
+	}
+	if items[0].Data.MerchantOrderID != "ORDER-1" {
+		t.Errorf("MerchantOrderID = %s, want ORDER-1", items[0].Data.MerchantOrderID)
+	}
+	if !strings.Contains(items[0].LastError, "email server down") {
+		t.Errorf("LastError = %q, want the panic message", items[0].LastError)
+	}
+}
+
+func TestAsyncCallbackProcessorStopRequeues(t *testing.T) {
+	client := newAsyncTestClient()
+	queue := NewMemoryQueue(10)
+
+	failed := make(chan struct{}, 1)
+	processor := client.NewAsyncCallbackProcessor(func(data *CallbackData) error {
+		failed <- struct{}{}
+		return errors.New("not yet")
+	}, AsyncCallbackOptions{
+		Queue:   queue,
+		Backoff: func(int) time.Duration { return time.Hour },
+	})
+	processor.Start()
+	processor.Enqueue(client.NewCallbackData("ORDER-1", 40000, PaymentMethodBCA, CallbackStatusSuccess))
+
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+	// Give the worker time to schedule the retry
+	time.Sleep(10 * time.Millisecond)
+	processor.Stop()
+
+	if queue.Len() != 1 {
+		t.Fatalf("Len() = %d, want the pending retry back on the queue", queue.Len())
+	}
+}
+
+func TestAsyncCallbackProcessorStopRequeuesFiredRetry(t *testing.T) {
+	client := newAsyncTestClient()
+	queue := NewMemoryQueue(10)
+	processor := client.NewAsyncCallbackProcessor(func(*CallbackData) error { return nil }, AsyncCallbackOptions{Queue: queue})
+
+	item := newQueuedCallback("1", "ORDER-1")
+	processor.mu.Lock()
+	processor.pending[item.ID] = item
+	processor.retries[item.ID] = time.AfterFunc(0, func() { processor.retry(item) })
+	// The timer fires and waits for the lock, so stopping it fails
+	time.Sleep(20 * time.Millisecond)
+	processor.requeueRetries()
+	processor.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	if queue.Len() != 1 {
+		t.Fatalf("Len() = %d, want the retry requeued exactly once", queue.Len())
+	}
+}
+
+func TestDefaultCallbackBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := defaultCallbackBackoff(tt.attempt); got != tt.want {
+			t.Errorf("defaultCallbackBackoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
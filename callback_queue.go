@@ -0,0 +1,446 @@
+package duitku
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by Enqueue when the queue cannot accept more callbacks
+var ErrQueueFull = errors.New("callback queue is full")
+
+// ErrQueueClosed is returned when using a closed queue
+var ErrQueueClosed = errors.New("callback queue is closed")
+
+// QueuedCallback is a verified callback waiting to be processed
+type QueuedCallback struct {
+	ID         string       `json:"id"`
+	Data       CallbackData `json:"data"`
+	Attempts   int          `json:"attempts"`
+	EnqueuedAt time.Time    `json:"enqueuedAt"`
+	LastError  string       `json:"lastError,omitempty"`
+}
+
+// CallbackQueue stores verified callbacks until a worker has processed them.
+// An item stays in the queue from Enqueue until Ack, so durable
+// implementations can redeliver items that were in flight during a crash.
+type CallbackQueue interface {
+	// Enqueue adds a new item
+	Enqueue(item *QueuedCallback) error
+	// Dequeue blocks until an item is available or ctx is done
+	Dequeue(ctx context.Context) (*QueuedCallback, error)
+	// Requeue makes an in-flight item available again with its updated attempt details
+	Requeue(item *QueuedCallback) error
+	// Ack removes a processed item
+	Ack(id string) error
+}
+
+// DeadLetterStore keeps callbacks that failed every processing attempt
+type DeadLetterStore interface {
+	Put(item *QueuedCallback) error
+}
+
+// MemoryQueue is a CallbackQueue backed by a buffered channel. Items are lost
+// when the process exits.
+type MemoryQueue struct {
+	items chan *QueuedCallback
+}
+
+// NewMemoryQueue creates a MemoryQueue holding up to capacity items
+func NewMemoryQueue(capacity int) *MemoryQueue {
+	return &MemoryQueue{items: make(chan *QueuedCallback, capacity)}
+}
+
+// Enqueue adds an item, returning ErrQueueFull instead of blocking
+func (q *MemoryQueue) Enqueue(item *QueuedCallback) error {
+	select {
+	case q.items <- item:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Dequeue blocks until an item is available or ctx is done
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*QueuedCallback, error) {
+	select {
+	case item := <-q.items:
+		return item, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Requeue makes an item available again
+func (q *MemoryQueue) Requeue(item *QueuedCallback) error {
+	return q.Enqueue(item)
+}
+
+// Ack is a no-op, items leave a MemoryQueue when they are dequeued
+func (q *MemoryQueue) Ack(id string) error {
+	return nil
+}
+
+// Len returns the number of items waiting
+func (q *MemoryQueue) Len() int {
+	return len(q.items)
+}
+
+// walRecord is one line of the FileQueue write-ahead log
+type walRecord struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id,omitempty"`
+	Item *QueuedCallback `json:"item,omitempty"`
+}
+
+const (
+	walEnqueue = "enqueue"
+	walRequeue = "requeue"
+	walAck     = "ack"
+)
+
+// walCompactMinRecords is the log size below which a FileQueue is not
+// compacted. It is a variable so tests can lower it.
+var walCompactMinRecords = 1000
+
+// FileQueue is a CallbackQueue backed by an append-only write-ahead log.
+// Every change is written and synced before it takes effect, and items that
+// were not acknowledged are delivered again after a restart. The log is
+// compacted when the queue is opened and whenever most of its records are
+// obsolete.
+type FileQueue struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	pending map[string]*QueuedCallback
+	ready   []string
+	records int
+	notify  chan struct{}
+	closed  bool
+}
+
+// OpenFileQueue opens or creates the log at path and replays it
+func OpenFileQueue(path string) (*FileQueue, error) {
+	q := &FileQueue{
+		path:    path,
+		pending: make(map[string]*QueuedCallback),
+		notify:  make(chan struct{}, 1),
+	}
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// replay rebuilds the pending items from the log
+func (q *FileQueue) replay() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening callback queue: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxCallbackBodySize)
+	for scanner.Scan() {
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn final write after a crash; everything before it is intact
+			break
+		}
+		switch record.Op {
+		case walEnqueue, walRequeue:
+			if record.Item == nil {
+				continue
+			}
+			if _, ok := q.pending[record.Item.ID]; !ok {
+				q.ready = append(q.ready, record.Item.ID)
+			}
+			q.pending[record.Item.ID] = record.Item
+		case walAck:
+			delete(q.pending, record.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading callback queue: %w", err)
+	}
+
+	// Keep log order, dropping acknowledged items
+	ready := q.ready[:0]
+	for _, id := range q.ready {
+		if _, ok := q.pending[id]; ok {
+			ready = append(ready, id)
+		}
+	}
+	q.ready = ready
+	return nil
+}
+
+// compact rewrites the log with only the pending items. The new log is
+// written to a temporary file that replaces the log once synced; the open
+// log is kept when anything fails.
+func (q *FileQueue) compact() error {
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error compacting callback queue: %w", err)
+	}
+	if err := q.writeSnapshot(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error compacting callback queue: %w", err)
+	}
+
+	// The handle follows the file through the rename, so it becomes the log
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("error compacting callback queue: %w", err)
+	}
+	if q.file != nil {
+		q.file.Close()
+	}
+	q.file = tmp
+	q.records = len(q.pending)
+	return nil
+}
+
+// writeSnapshot writes an enqueue record for every pending item to file and
+// syncs it
+func (q *FileQueue) writeSnapshot(file *os.File) error {
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	ready := make(map[string]bool, len(q.ready))
+	for _, id := range q.ready {
+		ready[id] = true
+		if err := encoder.Encode(walRecord{Op: walEnqueue, Item: q.pending[id]}); err != nil {
+			return err
+		}
+	}
+	// In-flight items are not in ready but must survive a restart too
+	for id, item := range q.pending {
+		if !ready[id] {
+			if err := encoder.Encode(walRecord{Op: walEnqueue, Item: item}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// append writes a record to the log and syncs it
+func (q *FileQueue) append(record walRecord) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding callback queue record: %w", err)
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing callback queue: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing callback queue: %w", err)
+	}
+	q.records++
+	return nil
+}
+
+// signal wakes a waiting Dequeue
+func (q *FileQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue writes the item to the log before making it available
+func (q *FileQueue) Enqueue(item *QueuedCallback) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.append(walRecord{Op: walEnqueue, Item: item}); err != nil {
+		return err
+	}
+	q.pending[item.ID] = item
+	q.ready = append(q.ready, item.ID)
+	q.signal()
+	return nil
+}
+
+// Requeue records the updated item and makes it available again
+func (q *FileQueue) Requeue(item *QueuedCallback) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.append(walRecord{Op: walRequeue, Item: item}); err != nil {
+		return err
+	}
+	q.pending[item.ID] = item
+	q.ready = append(q.ready, item.ID)
+	q.signal()
+	return nil
+}
+
+// Dequeue blocks until an item is available or ctx is done. The item stays
+// in the log until it is acknowledged.
+func (q *FileQueue) Dequeue(ctx context.Context) (*QueuedCallback, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+		if len(q.ready) > 0 {
+			id := q.ready[0]
+			q.ready = q.ready[1:]
+			item := *q.pending[id]
+			if len(q.ready) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return &item, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Ack records that the item was processed
+func (q *FileQueue) Ack(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.append(walRecord{Op: walAck, ID: id}); err != nil {
+		return err
+	}
+	delete(q.pending, id)
+
+	// Every record beyond one per pending item is obsolete
+	if q.records >= walCompactMinRecords && q.records-len(q.pending) > q.records/2 {
+		return q.compact()
+	}
+	return nil
+}
+
+// Len returns the number of items not yet acknowledged
+func (q *FileQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close closes the log file
+func (q *FileQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.notify)
+	return q.file.Close()
+}
+
+// MemoryDeadLetterStore keeps dead letters in memory
+type MemoryDeadLetterStore struct {
+	mu    sync.Mutex
+	items []QueuedCallback
+}
+
+// Put stores a dead letter
+func (s *MemoryDeadLetterStore) Put(item *QueuedCallback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, *item)
+	return nil
+}
+
+// Items returns the stored dead letters
+func (s *MemoryDeadLetterStore) Items() []QueuedCallback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]QueuedCallback(nil), s.items...)
+}
+
+// FileDeadLetterStore appends dead letters to a file as JSON lines
+type FileDeadLetterStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileDeadLetterStore creates a store appending to path
+func NewFileDeadLetterStore(path string) *FileDeadLetterStore {
+	return &FileDeadLetterStore{path: path}
+}
+
+// Put appends a dead letter to the file
+func (s *FileDeadLetterStore) Put(item *QueuedCallback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("error encoding dead letter: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening dead letter file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing dead letter: %w", err)
+	}
+	return file.Sync()
+}
+
+// Items reads the dead letters stored in the file
+func (s *FileDeadLetterStore) Items() ([]QueuedCallback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening dead letter file: %w", err)
+	}
+	defer file.Close()
+
+	var items []QueuedCallback
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxCallbackBodySize)
+	for scanner.Scan() {
+		var item QueuedCallback
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return items, fmt.Errorf("error decoding dead letter: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
@@ -0,0 +1,243 @@
+package duitku
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newQueuedCallback(id, orderID string) *QueuedCallback {
+	return &QueuedCallback{
+		ID:         id,
+		Data:       CallbackData{MerchantOrderID: orderID, Amount: "40000", ResultCode: CallbackStatusSuccess},
+		EnqueuedAt: time.Now(),
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	queue := NewMemoryQueue(2)
+
+	if err := queue.Enqueue(newQueuedCallback("1", "ORDER-1")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := queue.Enqueue(newQueuedCallback("2", "ORDER-2")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := queue.Enqueue(newQueuedCallback("3", "ORDER-3")); err != ErrQueueFull {
+		t.Errorf("Enqueue() on full queue error = %v, want ErrQueueFull", err)
+	}
+
+	item, err := queue.Dequeue(context.Background())
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if item.ID != "1" {
+		t.Errorf("Dequeue() ID = %s, want 1", item.ID)
+	}
+
+	queue.Dequeue(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := queue.Dequeue(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Dequeue() on empty queue error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFileQueueReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "callbacks.wal")
+
+	queue, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if err := queue.Enqueue(newQueuedCallback(id, "ORDER-"+id)); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	// 1 is processed, 2 is in flight when the process stops, 3 is never dequeued
+	first, _ := queue.Dequeue(context.Background())
+	if err := queue.Ack(first.ID); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	second, _ := queue.Dequeue(context.Background())
+	second.Attempts = 1
+	second.LastError = "inventory unavailable"
+	if err := queue.Requeue(second); err != nil {
+		t.Fatalf("Requeue() error = %v", err)
+	}
+	queue.Dequeue(context.Background())
+	if err := queue.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", reopened.Len())
+	}
+
+	got := map[string]*QueuedCallback{}
+	for i := 0; i < 2; i++ {
+		item, err := reopened.Dequeue(context.Background())
+		if err != nil {
+			t.Fatalf("Dequeue() error = %v", err)
+		}
+		got[item.ID] = item
+	}
+	if _, ok := got["1"]; ok {
+		t.Error("acknowledged item 1 was replayed")
+	}
+	if got["2"] == nil || got["2"].Attempts != 1 || got["2"].LastError != "inventory unavailable" {
+		t.Errorf("item 2 = %+v, want the requeued attempt details", got["2"])
+	}
+	if got["3"] == nil || got["3"].Data.MerchantOrderID != "ORDER-3" {
+		t.Errorf("item 3 = %+v, want ORDER-3", got["3"])
+	}
+}
+
+func TestFileQueueCompactsUnderTraffic(t *testing.T) {
+	saved := walCompactMinRecords
+	walCompactMinRecords = 10
+	defer func() { walCompactMinRecords = saved }()
+
+	path := filepath.Join(t.TempDir(), "callbacks.wal")
+	queue, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+
+	// One item stays pending while others come and go, so the queue is
+	// never empty
+	if err := queue.Enqueue(newQueuedCallback("held", "ORDER-0")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	queue.Dequeue(context.Background())
+	for i := 1; i <= 50; i++ {
+		id := fmt.Sprintf("%d", i)
+		if err := queue.Enqueue(newQueuedCallback(id, "ORDER-"+id)); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		item, _ := queue.Dequeue(context.Background())
+		if err := queue.Ack(item.ID); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+	if queue.records > 20 {
+		t.Errorf("records = %d, want the log compacted", queue.records)
+	}
+	queue.Close()
+
+	reopened, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != 1 {
+		t.Errorf("Len() = %d, want the held item only", reopened.Len())
+	}
+}
+
+func TestFileQueueCompactFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "callbacks.wal")
+	queue, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	defer queue.Close()
+	queue.Enqueue(newQueuedCallback("1", "ORDER-1"))
+
+	// A non-empty directory in place of the log makes the rename fail
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.compact(); err == nil {
+		t.Fatal("compact() error = nil")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// The open log is kept, so the queue still accepts changes
+	if err := queue.Enqueue(newQueuedCallback("2", "ORDER-2")); err != nil {
+		t.Errorf("Enqueue() after a failed compaction error = %v", err)
+	}
+}
+
+func TestFileQueueTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "callbacks.wal")
+
+	queue, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	queue.Enqueue(newQueuedCallback("1", "ORDER-1"))
+	queue.Close()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"enqueue","item":{"id":"2"`)
+	file.Close()
+
+	reopened, err := OpenFileQueue(path)
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", reopened.Len())
+	}
+}
+
+func TestFileQueueClosed(t *testing.T) {
+	queue, err := OpenFileQueue(filepath.Join(t.TempDir(), "callbacks.wal"))
+	if err != nil {
+		t.Fatalf("OpenFileQueue() error = %v", err)
+	}
+	queue.Close()
+
+	if err := queue.Enqueue(newQueuedCallback("1", "ORDER-1")); err != ErrQueueClosed {
+		t.Errorf("Enqueue() error = %v, want ErrQueueClosed", err)
+	}
+	if _, err := queue.Dequeue(context.Background()); err != ErrQueueClosed {
+		t.Errorf("Dequeue() error = %v, want ErrQueueClosed", err)
+	}
+}
+
+func TestFileDeadLetterStore(t *testing.T) {
+	store := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead.jsonl"))
+
+	items, err := store.Items()
+	if err != nil || len(items) != 0 {
+		t.Fatalf("Items() = %v, %v, want empty", items, err)
+	}
+
+	item := newQueuedCallback("1", "ORDER-1")
+	item.Attempts = 5
+	item.LastError = "boom"
+	if err := store.Put(item); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	items, err = store.Items()
+	if err != nil {
+		t.Fatalf("Items() error = %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "1" || items[0].Attempts != 5 || items[0].LastError != "boom" {
+		t.Errorf("Items() = %+v", items)
+	}
+}
@@ -0,0 +1,172 @@
+package duitku
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// CallbackHandlerFunc handles a verified callback
+type CallbackHandlerFunc func(*CallbackData) error
+
+// CallbackMiddleware wraps a CallbackHandlerFunc
+type CallbackMiddleware func(CallbackHandlerFunc) CallbackHandlerFunc
+
+// CallbackRouter dispatches verified callbacks to handlers registered per
+// outcome, payment method or subscription charge. It implements http.Handler.
+//
+// For each callback the most specific handler is called: OnSubscriptionCharge
+// for recurring charges, then OnPaymentMethod for the callback's payment code,
+// then OnSuccess or OnFailed. Callbacks without a matching handler are
+// acknowledged. Handlers should be registered before the router serves requests.
+type CallbackRouter struct {
+	handle       func(http.ResponseWriter, *http.Request, func(*CallbackData) error)
+	success      CallbackHandlerFunc
+	failed       CallbackHandlerFunc
+	methods      map[string]CallbackHandlerFunc
+	subscription func(*SubscriptionChargeEvent) error
+	middleware   []CallbackMiddleware
+}
+
+// NewCallbackRouter creates a router that verifies callbacks with the client's credentials
+func (c *Client) NewCallbackRouter() *CallbackRouter {
+	return &CallbackRouter{
+		handle:  c.HandleCallback,
+		methods: make(map[string]CallbackHandlerFunc),
+	}
+}
+
+// OnSuccess registers the handler for successful payments
+func (r *CallbackRouter) OnSuccess(handler CallbackHandlerFunc) *CallbackRouter {
+	r.success = handler
+	return r
+}
+
+// OnFailed registers the handler for failed payments
+func (r *CallbackRouter) OnFailed(handler CallbackHandlerFunc) *CallbackRouter {
+	r.failed = handler
+	return r
+}
+
+// OnPaymentMethod registers the handler for callbacks with the payment code,
+// whatever their outcome
+func (r *CallbackRouter) OnPaymentMethod(paymentCode string, handler CallbackHandlerFunc) *CallbackRouter {
+	r.methods[paymentCode] = handler
+	return r
+}
+
+// OnSubscriptionCharge registers the handler for recurring subscription charges
+func (r *CallbackRouter) OnSubscriptionCharge(handler func(*SubscriptionChargeEvent) error) *CallbackRouter {
+	r.subscription = handler
+	return r
+}
+
+// Use appends middleware. The first middleware registered is the outermost.
+func (r *CallbackRouter) Use(middleware ...CallbackMiddleware) *CallbackRouter {
+	r.middleware = append(r.middleware, middleware...)
+	return r
+}
+
+// Handler returns the dispatching handler wrapped in the registered middleware
+func (r *CallbackRouter) Handler() CallbackHandlerFunc {
+	handler := CallbackHandlerFunc(r.dispatch)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	return handler
+}
+
+// ServeHTTP verifies the callback and dispatches it
+func (r *CallbackRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handle(w, req, r.Handler())
+}
+
+// dispatch calls the most specific registered handler
+func (r *CallbackRouter) dispatch(data *CallbackData) error {
+	if r.subscription != nil && data.IsSubscriptionCharge() {
+		event, err := data.SubscriptionCharge()
+		if err != nil {
+			return err
+		}
+		return r.subscription(event)
+	}
+
+	if handler, ok := r.methods[data.PaymentCode]; ok && data.PaymentCode != "" {
+		return handler(data)
+	}
+
+	if data.IsSuccessful() {
+		if r.success != nil {
+			return r.success(data)
+		}
+		return nil
+	}
+
+	if r.failed != nil {
+		return r.failed(data)
+	}
+	return nil
+}
+
+// LoggingMiddleware logs every callback with its outcome and duration
+func LoggingMiddleware(logger *log.Logger) CallbackMiddleware {
+	return func(next CallbackHandlerFunc) CallbackHandlerFunc {
+		return func(data *CallbackData) error {
+			start := time.Now()
+			err := next(data)
+			if err != nil {
+				logger.Printf("callback order=%s reference=%s paymentCode=%s resultCode=%s duration=%s error=%v",
+					data.MerchantOrderID, data.Reference, data.PaymentCode, data.ResultCode, time.Since(start), err)
+			} else {
+				logger.Printf("callback order=%s reference=%s paymentCode=%s resultCode=%s duration=%s",
+					data.MerchantOrderID, data.Reference, data.PaymentCode, data.ResultCode, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// RecoveryMiddleware turns a panic in the handler into an error, so Duitku
+// receives a 500 response and retries the callback
+func RecoveryMiddleware() CallbackMiddleware {
+	return func(next CallbackHandlerFunc) CallbackHandlerFunc {
+		return func(data *CallbackData) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("callback handler panic: %v", p)
+				}
+			}()
+			return next(data)
+		}
+	}
+}
+
+// TimeoutMiddleware returns an error when the handler takes longer than
+// timeout. The handler keeps running in the background and its result is
+// discarded, so handlers must be safe to run again when Duitku retries.
+func TimeoutMiddleware(timeout time.Duration) CallbackMiddleware {
+	return func(next CallbackHandlerFunc) CallbackHandlerFunc {
+		return func(data *CallbackData) error {
+			done := make(chan error, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						done <- fmt.Errorf("callback handler panic: %v", p)
+					}
+				}()
+				done <- next(data)
+			}()
+
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+
+			select {
+			case err := <-done:
+				return err
+			case <-timer.C:
+				return fmt.Errorf("callback handler timed out after %s", timeout)
+			}
+		}
+	}
+}
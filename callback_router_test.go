@@ -0,0 +1,185 @@
+package duitku
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRouterRequest builds a signed form callback request
+func newRouterRequest(client *Client, orderID, paymentCode, resultCode string, extra map[string]string) *http.Request {
+	data := client.NewCallbackData(orderID, 40000, paymentCode, resultCode)
+	form := data.FormValues()
+	for key, value := range extra {
+		form.Set(key, value)
+	}
+	req := httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestCallbackRouterDispatch(t *testing.T) {
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	var called string
+	router := client.NewCallbackRouter().
+		OnSuccess(func(data *CallbackData) error { called = "success"; return nil }).
+		OnFailed(func(data *CallbackData) error { called = "failed"; return nil }).
+		OnPaymentMethod(PaymentMethodOVO, func(data *CallbackData) error { called = "ovo:" + data.ResultCode; return nil }).
+		OnSubscriptionCharge(func(event *SubscriptionChargeEvent) error {
+			called = "subscription:" + event.SubscriptionID
+			return nil
+		})
+
+	tests := []struct {
+		name        string
+		paymentCode string
+		resultCode  string
+		extra       map[string]string
+		want        string
+	}{
+		{name: "Success", paymentCode: PaymentMethodBCA, resultCode: CallbackStatusSuccess, want: "success"},
+		{name: "Failed", paymentCode: PaymentMethodBCA, resultCode: CallbackStatusFailed, want: "failed"},
+		{name: "Payment Method Success", paymentCode: PaymentMethodOVO, resultCode: CallbackStatusSuccess, want: "ovo:00"},
+		{name: "Payment Method Failed", paymentCode: PaymentMethodOVO, resultCode: CallbackStatusFailed, want: "ovo:01"},
+		{
+			name:        "Subscription Charge",
+			paymentCode: PaymentMethodCreditCard,
+			resultCode:  CallbackStatusSuccess,
+			extra:       map[string]string{"subscriptionId": "SUB001", "cycleNumber": "2"},
+			want:        "subscription:SUB001",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = ""
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newRouterRequest(client, "ORDER123", tt.paymentCode, tt.resultCode, tt.extra))
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("ServeHTTP() status = %d, want 200: %s", rr.Code, rr.Body.String())
+			}
+			if called != tt.want {
+				t.Errorf("dispatched to %q, want %q", called, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallbackRouterUnhandledAndErrors(t *testing.T) {
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	// No handlers: callbacks are acknowledged
+	rr := httptest.NewRecorder()
+	client.NewCallbackRouter().ServeHTTP(rr, newRouterRequest(client, "ORDER123", PaymentMethodBCA, CallbackStatusSuccess, nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("ServeHTTP() status = %d, want 200", rr.Code)
+	}
+
+	// Handler errors become 500 responses
+	router := client.NewCallbackRouter().OnSuccess(func(data *CallbackData) error {
+		return errors.New("database unavailable")
+	})
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newRouterRequest(client, "ORDER123", PaymentMethodBCA, CallbackStatusSuccess, nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("ServeHTTP() status = %d, want 500", rr.Code)
+	}
+
+	// Invalid signatures never reach the handlers
+	req := newRouterRequest(client, "ORDER123", PaymentMethodBCA, CallbackStatusSuccess, map[string]string{"signature": "forged"})
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("ServeHTTP() status = %d, want 400", rr.Code)
+	}
+}
+
+func TestCallbackRouterMiddleware(t *testing.T) {
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	var order []string
+	trace := func(name string) CallbackMiddleware {
+		return func(next CallbackHandlerFunc) CallbackHandlerFunc {
+			return func(data *CallbackData) error {
+				order = append(order, name)
+				return next(data)
+			}
+		}
+	}
+
+	router := client.NewCallbackRouter().
+		Use(trace("first"), trace("second")).
+		OnSuccess(func(data *CallbackData) error {
+			order = append(order, "handler")
+			return nil
+		})
+
+	router.ServeHTTP(httptest.NewRecorder(), newRouterRequest(client, "ORDER123", PaymentMethodBCA, CallbackStatusSuccess, nil))
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Errorf("middleware order = %v, want first,second,handler", order)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	handler := LoggingMiddleware(log.New(&buf, "", 0))(func(data *CallbackData) error {
+		return errors.New("boom")
+	})
+
+	if err := handler(&CallbackData{MerchantOrderID: "ORDER123", PaymentCode: "BC", ResultCode: "00"}); err == nil {
+		t.Errorf("handler error = nil, want boom")
+	}
+	if !strings.Contains(buf.String(), "order=ORDER123") || !strings.Contains(buf.String(), "error=boom") {
+		t.Errorf("log output = %q", buf.String())
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := RecoveryMiddleware()(func(data *CallbackData) error {
+		panic("nil map")
+	})
+
+	err := handler(&CallbackData{})
+	if err == nil || !strings.Contains(err.Error(), "panic: nil map") {
+		t.Errorf("handler error = %v, want recovered panic", err)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	slow := TimeoutMiddleware(10 * time.Millisecond)(func(data *CallbackData) error {
+		<-release
+		return nil
+	})
+	if err := slow(&CallbackData{}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow handler error = %v, want timeout", err)
+	}
+
+	fast := TimeoutMiddleware(time.Second)(func(data *CallbackData) error {
+		return errors.New("declined")
+	})
+	if err := fast(&CallbackData{}); err == nil || err.Error() != "declined" {
+		t.Errorf("fast handler error = %v, want declined", err)
+	}
+}
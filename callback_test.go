@@ -242,6 +242,146 @@ func TestParseCallbackWithAllOptionalFields(t *testing.T) {
 	}
 }
 
+func TestParseCallbackJSON(t *testing.T) {
+	// Create a client
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	// Calculate the actual expected signature
+	signatureStr := fmt.Sprintf("%s%s%s%s", "DXXXX", "40000", "ORDER123", "DXXXXCX80TZJ85Q70QCI")
+	hash := md5.Sum([]byte(signatureStr))
+	expectedSignature := hex.EncodeToString(hash[:])
+
+	tests := []struct {
+		name        string
+		contentType string
+		amount      string
+	}{
+		{
+			name:        "String Amount",
+			contentType: "application/json",
+			amount:      `"40000"`,
+		},
+		{
+			name:        "Numeric Amount",
+			contentType: "application/json",
+			amount:      `40000`,
+		},
+		{
+			name:        "Content Type With Charset",
+			contentType: "application/json; charset=utf-8",
+			amount:      `"40000"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{
+				"merchantCode": "DXXXX",
+				"amount": %s,
+				"merchantOrderId": "ORDER123",
+				"productDetail": "Test Product",
+				"paymentCode": "SP",
+				"resultCode": "00",
+				"reference": "DEV123456789",
+				"issuerCode": "93600523",
+				"spUserHash": null,
+				"signature": %q
+			}`, tt.amount, expectedSignature)
+
+			req, err := http.NewRequest("POST", "/callback", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Error creating request: %v", err)
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+
+			callbackData, err := client.ParseCallback(req)
+			if err != nil {
+				t.Fatalf("ParseCallback() error = %v, want nil", err)
+			}
+			if callbackData.Amount != "40000" {
+				t.Errorf("CallbackData Amount = %s, want 40000", callbackData.Amount)
+			}
+			if callbackData.PaymentCode != "SP" {
+				t.Errorf("CallbackData PaymentCode = %s, want SP", callbackData.PaymentCode)
+			}
+			if callbackData.IssuerCode != "93600523" {
+				t.Errorf("CallbackData IssuerCode = %s, want 93600523", callbackData.IssuerCode)
+			}
+			if callbackData.SpUserHash != "" {
+				t.Errorf("CallbackData SpUserHash = %s, want empty for null", callbackData.SpUserHash)
+			}
+		})
+	}
+}
+
+func TestParseCallbackJSONErrors(t *testing.T) {
+	// Create a client
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "Missing Fields",
+			body:    `{"merchantCode":"DXXXX","merchantOrderId":"ORDER123","signature":"d5df5a9d6807a8d7fae5b76e14c6bf4a"}`,
+			wantErr: "missing required callback parameters",
+		},
+		{
+			name:    "Invalid Signature",
+			body:    `{"merchantCode":"DXXXX","amount":"40000","merchantOrderId":"ORDER123","resultCode":"00","signature":"invalid_signature"}`,
+			wantErr: "invalid callback signature",
+		},
+		{
+			name:    "Syntax Error",
+			body:    `{"merchantCode":"DXXXX",`,
+			wantErr: "error parsing json",
+		},
+		{
+			name:    "Array Body",
+			body:    `[{"merchantCode":"DXXXX"}]`,
+			wantErr: "error parsing json",
+		},
+		{
+			name:    "Nested Object",
+			body:    `{"merchantCode":{"code":"DXXXX"},"amount":"40000"}`,
+			wantErr: "must be a string or number",
+		},
+		{
+			name:    "Empty Body",
+			body:    ``,
+			wantErr: "error parsing json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/callback", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Error creating request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+
+			_, err = client.ParseCallback(req)
+			if err == nil {
+				t.Fatalf("ParseCallback() error = nil, want error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCallback() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestVerifyCallbackSignature(t *testing.T) {
 	// Create a client
 	client := NewClient(Config{
@@ -306,6 +446,20 @@ func TestIsSuccessful(t *testing.T) {
 	}
 }
 
+func TestHasPaymentCode(t *testing.T) {
+	// Callback for a redirect transaction reports the method the customer chose
+	chosen := &CallbackData{PaymentCode: PaymentMethodBCA}
+	if !chosen.HasPaymentCode() {
+		t.Errorf("HasPaymentCode() = false, want true")
+	}
+
+	// Callback without a payment code
+	unknown := &CallbackData{}
+	if unknown.HasPaymentCode() {
+		t.Errorf("HasPaymentCode() = true, want false")
+	}
+}
+
 func TestHandleCallback(t *testing.T) {
 	// Create a client
 	client := NewClient(Config{
@@ -0,0 +1,440 @@
+// Package cassette records the HTTP traffic of a client to a file and
+// replays it, so bugs seen against the real Duitku API can be reproduced in
+// tests.
+//
+// A Recorder is an http.RoundTripper. In record mode it forwards requests
+// and appends every request/response pair, with secrets and customer
+// details redacted, to a JSON cassette file. In replay mode it serves the
+// recorded responses without touching the network, matching requests by
+// method, path and body. Fields that change on every call, such as the
+// signature and datetime, are ignored when matching:
+//
+//	recorder, err := cassette.New("testdata/create_transaction.json", cassette.Options{
+//		Mode: cassette.ModeReplay,
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	client := duitku.NewClient(duitku.Config{
+//		MerchantCode: "DXXXX",
+//		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+//		HTTPClient:   recorder.Client(),
+//	})
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects whether a Recorder records or replays
+type Mode int
+
+// Recorder modes
+const (
+	// ModeReplay serves responses from the cassette and never sends requests
+	ModeReplay Mode = iota
+	// ModeRecord sends requests and writes them to a new cassette
+	ModeRecord
+	// ModeReplayOrRecord replays an existing cassette and records one when
+	// the file does not exist
+	ModeReplayOrRecord
+)
+
+// Redacted replaces redacted header and field values
+const Redacted = "REDACTED"
+
+// DefaultRedactHeaders are the headers redacted when Options.RedactHeaders is nil
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Client-Key",
+	"X-Signature",
+}
+
+// DefaultRedactFields are the body fields redacted when Options.RedactFields
+// is nil: the request signature and the customer's personal details
+var DefaultRedactFields = []string{
+	"signature",
+	"email",
+	"phoneNumber",
+	"phone",
+	"customerVaName",
+	"firstName",
+	"lastName",
+	"address",
+	"billingAddress",
+	"shippingAddress",
+	"merchantUserInfo",
+	"accountName",
+	"bankAccount",
+}
+
+// DefaultIgnoreFields are the body fields ignored when matching requests
+// when Options.IgnoreFields is nil, as they differ on every call
+var DefaultIgnoreFields = []string{
+	"signature",
+	"datetime",
+	"timestamp",
+}
+
+// ErrNoInteraction is returned when replaying a request the cassette has no
+// recording for
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+// Options configures a Recorder
+type Options struct {
+	// Mode selects recording or replaying, ModeReplay by default
+	Mode Mode
+	// Transport sends requests while recording, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// RedactHeaders are the request and response headers written as Redacted
+	RedactHeaders []string
+	// RedactFields are the JSON and form fields written as Redacted, at any
+	// depth. Objects and arrays under these keys are replaced whole.
+	RedactFields []string
+	// IgnoreFields are the JSON and form fields ignored when matching
+	// requests, at any depth
+	IgnoreFields []string
+}
+
+// Request is a recorded request
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction is a recorded request/response pair
+type Interaction struct {
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// Cassette is the content of a cassette file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder records or replays HTTP interactions
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	redactH   map[string]bool
+	redactF   map[string]bool
+	ignoreF   map[string]bool
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New creates a Recorder for the cassette at path. Replaying requires the
+// file to exist; recording replaces it.
+func New(path string, opts Options) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      opts.Mode,
+		transport: opts.Transport,
+		redactH:   fieldSet(opts.RedactHeaders, DefaultRedactHeaders, http.CanonicalHeaderKey),
+		redactF:   fieldSet(opts.RedactFields, DefaultRedactFields, strings.ToLower),
+		ignoreF:   fieldSet(opts.IgnoreFields, DefaultIgnoreFields, strings.ToLower),
+	}
+	if r.transport == nil {
+		r.transport = http.DefaultTransport
+	}
+
+	if r.mode == ModeReplayOrRecord {
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		} else if os.IsNotExist(err) {
+			r.mode = ModeRecord
+		} else {
+			return nil, fmt.Errorf("error opening cassette: %w", err)
+		}
+	}
+
+	if r.mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("error decoding cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// fieldSet returns the names, or the defaults when names is nil, as a set
+func fieldSet(names, defaults []string, normalize func(string) string) map[string]bool {
+	if names == nil {
+		names = defaults
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[normalize(name)] = true
+	}
+	return set
+}
+
+// Mode returns the mode the recorder runs in, resolving ModeReplayOrRecord
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client using the recorder as its transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions returns the recorded interactions
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.cassette.Interactions...)
+}
+
+// RoundTrip records or replays one request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+// record sends the request and appends the redacted pair to the cassette
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	outgoing := req.Clone(req.Context())
+	outgoing.Body = io.NopCloser(bytes.NewReader(body))
+	outgoing.ContentLength = int64(len(body))
+
+	resp, err := r.transport.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     r.redactURL(req.URL),
+			Headers: r.redactHeaders(req.Header),
+			Body:    string(r.redactBody(body, req.Header.Get("Content-Type"))),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    r.redactHeaders(resp.Header),
+			Body:       string(r.redactBody(respBody, resp.Header.Get("Content-Type"))),
+		},
+		RecordedAt: time.Now().UTC(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save writes the cassette, replacing the file atomically. The lock must be held.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+	if dir := filepath.Dir(r.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("error writing cassette: %w", err)
+		}
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+	return nil
+}
+
+// replay serves the first unused interaction matching the request. Once
+// every match has been served the last one is repeated, so polling a
+// status replays its final recorded state.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	key := r.matchKey(req.Method, req.URL.Path, body, req.Header.Get("Content-Type"))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := -1
+	for i, interaction := range r.cassette.Interactions {
+		recorded, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			continue
+		}
+		contentType := http.Header(interaction.Request.Headers).Get("Content-Type")
+		if r.matchKey(interaction.Request.Method, recorded.Path, []byte(interaction.Request.Body), contentType) != key {
+			continue
+		}
+		found = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.Path)
+	}
+	r.used[found] = true
+
+	recorded := r.cassette.Interactions[found].Response
+	header := recorded.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// matchKey identifies a request by method, path and normalized body
+func (r *Recorder) matchKey(method, path string, body []byte, contentType string) string {
+	normalized := r.transformBody(r.redactBody(body, contentType), contentType, r.ignoreF, nil)
+	return strings.ToUpper(method) + " " + strings.TrimSuffix(path, "/") + "\n" + string(normalized)
+}
+
+// redactHeaders returns a copy of header with the redacted headers replaced
+func (r *Recorder) redactHeaders(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	redacted := header.Clone()
+	for name := range redacted {
+		if r.redactH[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{Redacted}
+		}
+	}
+	return redacted
+}
+
+// redactURL returns the URL with redacted query parameters replaced
+func (r *Recorder) redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	if u.RawQuery != "" {
+		redacted.RawQuery = string(r.transformBody([]byte(u.RawQuery), "application/x-www-form-urlencoded", nil, r.redactF))
+	}
+	return redacted.String()
+}
+
+// redactBody returns the body with redacted fields replaced
+func (r *Recorder) redactBody(body []byte, contentType string) []byte {
+	return r.transformBody(body, contentType, nil, r.redactF)
+}
+
+// transformBody removes the drop fields and redacts the redact fields of a
+// JSON or form body. JSON bodies are re-encoded with sorted keys; other
+// bodies are returned unchanged.
+func (r *Recorder) transformBody(body []byte, contentType string, drop, redact map[string]bool) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		for name := range values {
+			if drop[strings.ToLower(name)] {
+				values.Del(name)
+			} else if redact[strings.ToLower(name)] {
+				values.Set(name, Redacted)
+			}
+		}
+		return []byte(values.Encode())
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+	encoded, err := json.Marshal(transformJSON(value, drop, redact))
+	if err != nil {
+		return body
+	}
+	return encoded
+}
+
+// transformJSON applies transformBody to a decoded JSON value
+func transformJSON(value interface{}, drop, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			switch {
+			case drop[strings.ToLower(name)]:
+				delete(v, name)
+			case redact[strings.ToLower(name)]:
+				// Objects and arrays are replaced whole, so none of their
+				// fields are written
+				v[name] = Redacted
+			default:
+				v[name] = transformJSON(field, drop, redact)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = transformJSON(v[i], drop, redact)
+		}
+	}
+	return value
+}
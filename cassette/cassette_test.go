@@ -0,0 +1,205 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// post sends a JSON body through the client and returns the response body
+func post(t *testing.T, client *http.Client, url, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "john@example.com") {
+			t.Errorf("server received redacted body %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Write([]byte(`{"statusCode":"00","reference":"DXXXX-1","vaNumber":"7007014001444"}`))
+			return
+		}
+		w.Write([]byte(`{"statusCode":"00","reference":"DXXXX-2","vaNumber":"7007014001445"}`))
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassettes", "inquiry.json")
+	recorder, err := New(path, Options{Mode: ModeRecord})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	first := `{"merchantOrderId":"INV-1","email":"john@example.com","signature":"abc","datetime":"2024-03-01 10:00:00",` +
+		`"customerDetail":{"firstName":"John","billingAddress":{"address":"Jl. Sudirman 1","city":"Jakarta"}}}`
+	second := `{"merchantOrderId":"INV-2","email":"john@example.com","signature":"def"}`
+	if _, body := post(t, recorder.Client(), server.URL+"/webapi/api/merchant/v2/inquiry", first); !strings.Contains(body, "DXXXX-1") {
+		t.Errorf("recorded response = %s", body)
+	}
+	post(t, recorder.Client(), server.URL+"/webapi/api/merchant/v2/inquiry", second)
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cassette not written: %v", err)
+	}
+	for _, secret := range []string{"john@example.com", "secret-token", "abc", "Jl. Sudirman", "John"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+	if !strings.Contains(string(data), "INV-1") {
+		t.Error("cassette lost fields that are not redacted")
+	}
+	if got := len(recorder.Interactions()); got != 2 {
+		t.Errorf("Interactions() = %d, want 2", got)
+	}
+
+	// Replay with a new signature, datetime and key order
+	replayer, err := New(path, Options{Mode: ModeReplay})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	replayed := `{"signature":"xyz","datetime":"2025-01-01 00:00:00","email":"jane@example.com","merchantOrderId":"INV-1",` +
+		`"customerDetail":{"billingAddress":{"city":"Jakarta","address":"Elsewhere"},"firstName":"Jane"}}`
+	status, body := post(t, replayer.Client(), "http://127.0.0.1:1/webapi/api/merchant/v2/inquiry", replayed)
+	if status != http.StatusOK || !strings.Contains(body, "DXXXX-1") {
+		t.Errorf("replayed response = %d %s", status, body)
+	}
+	if _, body := post(t, replayer.Client(), "http://127.0.0.1:1/webapi/api/merchant/v2/inquiry", second); !strings.Contains(body, "DXXXX-2") {
+		t.Errorf("replayed response = %s", body)
+	}
+
+	// A request with a different order id was never recorded
+	_, err = replayer.Client().Post("http://127.0.0.1:1/webapi/api/merchant/v2/inquiry", "application/json",
+		strings.NewReader(`{"merchantOrderId":"INV-3"}`))
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Post() error = %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestReplayRepeatsLastMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	cassette := `{"interactions":[
+		{"request":{"method":"POST","url":"https://sandbox.duitku.com/webapi/api/merchant/transactionStatus","body":"{\"merchantOrderId\":\"INV-1\"}"},
+		 "response":{"statusCode":200,"body":"{\"statusCode\":\"01\"}"}},
+		{"request":{"method":"POST","url":"https://sandbox.duitku.com/webapi/api/merchant/transactionStatus","body":"{\"merchantOrderId\":\"INV-1\"}"},
+		 "response":{"statusCode":200,"body":"{\"statusCode\":\"00\"}"}}
+	]}`
+	if err := os.WriteFile(path, []byte(cassette), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := New(path, Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	want := []string{`{"statusCode":"01"}`, `{"statusCode":"00"}`, `{"statusCode":"00"}`}
+	for i, w := range want {
+		_, body := post(t, replayer.Client(), "http://localhost/webapi/api/merchant/transactionStatus", `{"merchantOrderId":"INV-1"}`)
+		if body != w {
+			t.Errorf("call %d body = %s, want %s", i, body, w)
+		}
+	}
+}
+
+func TestReplayOrRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auto.json")
+
+	recorder, err := New(path, Options{Mode: ModeReplayOrRecord})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if recorder.Mode() != ModeRecord {
+		t.Errorf("Mode() without a cassette = %d, want ModeRecord", recorder.Mode())
+	}
+
+	os.WriteFile(path, []byte(`{"interactions":[]}`), 0o600)
+	replayer, err := New(path, Options{Mode: ModeReplayOrRecord})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if replayer.Mode() != ModeReplay {
+		t.Errorf("Mode() with a cassette = %d, want ModeReplay", replayer.Mode())
+	}
+
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json"), Options{Mode: ModeReplay}); err == nil {
+		t.Error("New() replaying a missing cassette error = nil")
+	}
+}
+
+func TestRedactNestedValue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"statusCode":"00"}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "inquiry.json")
+	recorder, err := New(path, Options{Mode: ModeRecord, RedactFields: []string{"address", "items"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"merchantOrderId":"INV-1","address":{"city":"Jakarta","postalCode":"10220","geo":{"lat":-6.2}},` +
+		`"items":[{"name":"Gift for Jane"}]}`
+	post(t, recorder.Client(), server.URL+"/webapi/api/merchant/v2/inquiry", body)
+
+	recorded := recorder.Interactions()[0].Request.Body
+	for _, secret := range []string{"Jakarta", "10220", "-6.2", "Jane"} {
+		if strings.Contains(recorded, secret) {
+			t.Errorf("recorded body %s contains %q", recorded, secret)
+		}
+	}
+	if !strings.Contains(recorded, `"address":"REDACTED"`) || !strings.Contains(recorded, `"items":"REDACTED"`) {
+		t.Errorf("recorded body = %s, want whole values redacted", recorded)
+	}
+}
+
+func TestRedactFormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "callback.json")
+	recorder, err := New(path, Options{Mode: ModeRecord, RedactFields: []string{"signature"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := recorder.Client().PostForm(server.URL+"/callback?signature=q", map[string][]string{
+		"merchantOrderId": {"INV-1"},
+		"signature":       {"506f88f1000dfb4a6541ff94d9b8d1e6"},
+	})
+	if err != nil {
+		t.Fatalf("PostForm() error = %v", err)
+	}
+	resp.Body.Close()
+
+	interaction := recorder.Interactions()[0]
+	if interaction.Request.Body != "merchantOrderId=INV-1&signature=REDACTED" {
+		t.Errorf("recorded body = %s", interaction.Request.Body)
+	}
+	if !strings.HasSuffix(interaction.Request.URL, "/callback?signature=REDACTED") {
+		t.Errorf("recorded url = %s", interaction.Request.URL)
+	}
+}
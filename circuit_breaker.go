@@ -0,0 +1,255 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling Duitku while the circuit
+// breaker of an endpoint is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Defaults of a CircuitBreaker
+const (
+	DefaultCircuitFailureThreshold = 5
+	DefaultCircuitOpenTimeout      = 30 * time.Second
+	DefaultCircuitHalfOpenProbes   = 1
+)
+
+// CircuitState is the state of the circuit breaker of an endpoint
+type CircuitState int
+
+// Circuit states
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreakerOptions configures a CircuitBreaker
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// circuit. Defaults to DefaultCircuitFailureThreshold.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before it half-opens.
+	// Defaults to DefaultCircuitOpenTimeout.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of probe requests let through while the
+	// circuit is half-open. The circuit closes once they all succeed and
+	// opens again on the first failure. Defaults to
+	// DefaultCircuitHalfOpenProbes.
+	HalfOpenProbes int
+	// OnStateChange is called when the circuit of an endpoint changes state,
+	// for example to hide Duitku payment methods while it is open
+	OnStateChange func(endpoint string, from, to CircuitState)
+	// Now is an optional clock
+	Now func() time.Time
+}
+
+// CircuitBreaker fails requests fast while Duitku is unavailable. Every
+// endpoint has its own circuit; network errors and 5xx responses count as
+// failures, other responses as successes. A CircuitBreaker may be shared by
+// the clients of several merchants.
+type CircuitBreaker struct {
+	options CircuitBreakerOptions
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of one endpoint. generation changes on every state
+// change, so results of requests let through in an earlier state are ignored.
+type circuit struct {
+	state      CircuitState
+	generation uint64
+	failures   int
+	probes     int
+	successes  int
+	openedAt   time.Time
+}
+
+// stateChange is a state change reported to OnStateChange once the lock is released
+type stateChange struct {
+	endpoint string
+	from, to CircuitState
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with the options
+func NewCircuitBreaker(options CircuitBreakerOptions) *CircuitBreaker {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = DefaultCircuitFailureThreshold
+	}
+	if options.OpenTimeout <= 0 {
+		options.OpenTimeout = DefaultCircuitOpenTimeout
+	}
+	if options.HalfOpenProbes <= 0 {
+		options.HalfOpenProbes = DefaultCircuitHalfOpenProbes
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	return &CircuitBreaker{options: options, circuits: make(map[string]*circuit)}
+}
+
+// State returns the state of the endpoint's circuit
+func (b *CircuitBreaker) State(endpoint string) CircuitState {
+	b.mu.Lock()
+	circuit := b.circuit(endpoint)
+	change := b.halfOpenIfDue(endpoint, circuit)
+	state := circuit.state
+	b.mu.Unlock()
+
+	b.notify(change)
+	return state
+}
+
+// allow reports whether a request to the endpoint may be sent, returning
+// the generation to pass to record
+func (b *CircuitBreaker) allow(endpoint string) (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	circuit := b.circuit(endpoint)
+	change := b.halfOpenIfDue(endpoint, circuit)
+
+	var err error
+	switch circuit.state {
+	case CircuitOpen:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, endpoint)
+	case CircuitHalfOpen:
+		if circuit.probes+circuit.successes >= b.options.HalfOpenProbes {
+			err = fmt.Errorf("%w: %s", ErrCircuitOpen, endpoint)
+		} else {
+			circuit.probes++
+		}
+	}
+	generation := circuit.generation
+	b.mu.Unlock()
+
+	b.notify(change)
+	return generation, err
+}
+
+// record reports the result of a request let through by allow
+func (b *CircuitBreaker) record(endpoint string, generation uint64, success bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	circuit := b.circuit(endpoint)
+	if generation != circuit.generation {
+		b.mu.Unlock()
+		return
+	}
+
+	var change *stateChange
+	switch circuit.state {
+	case CircuitClosed:
+		if success {
+			circuit.failures = 0
+			break
+		}
+		circuit.failures++
+		if circuit.failures >= b.options.FailureThreshold {
+			change = b.setState(endpoint, circuit, CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		circuit.probes--
+		if !success {
+			change = b.setState(endpoint, circuit, CircuitOpen)
+			break
+		}
+		circuit.successes++
+		if circuit.successes >= b.options.HalfOpenProbes {
+			change = b.setState(endpoint, circuit, CircuitClosed)
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(change)
+}
+
+// release gives back the probe of a request let through by allow that was
+// never sent, without counting it as a success or a failure
+func (b *CircuitBreaker) release(endpoint string, generation uint64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit := b.circuit(endpoint)
+	if generation == circuit.generation && circuit.state == CircuitHalfOpen {
+		circuit.probes--
+	}
+}
+
+// circuit returns the endpoint's circuit, creating a closed one. b.mu must be held.
+func (b *CircuitBreaker) circuit(endpoint string) *circuit {
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		c = &circuit{}
+		b.circuits[endpoint] = c
+	}
+	return c
+}
+
+// halfOpenIfDue half-opens an open circuit once OpenTimeout has passed. b.mu must be held.
+func (b *CircuitBreaker) halfOpenIfDue(endpoint string, c *circuit) *stateChange {
+	if c.state != CircuitOpen || b.options.Now().Sub(c.openedAt) < b.options.OpenTimeout {
+		return nil
+	}
+	return b.setState(endpoint, c, CircuitHalfOpen)
+}
+
+// setState moves the circuit to state and resets its counters. b.mu must be held.
+func (b *CircuitBreaker) setState(endpoint string, c *circuit, state CircuitState) *stateChange {
+	change := &stateChange{endpoint: endpoint, from: c.state, to: state}
+	c.state = state
+	c.generation++
+	c.failures = 0
+	c.probes = 0
+	c.successes = 0
+	if state == CircuitOpen {
+		c.openedAt = b.options.Now()
+	}
+	return change
+}
+
+// notify calls OnStateChange for a state change
+func (b *CircuitBreaker) notify(change *stateChange) {
+	if change == nil || b.options.OnStateChange == nil {
+		return
+	}
+	b.options.OnStateChange(change.endpoint, change.from, change.to)
+}
+
+// isCircuitFailure reports whether a request result counts as a failure of
+// Duitku: a transport error or a 5xx response. Token errors are released
+// before this is consulted.
+func isCircuitFailure(resp *http.Response, err error) bool {
+	return err != nil || resp == nil || resp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,277 @@
+package duitku
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for CircuitBreakerOptions.Now
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var status int32 = http.StatusServiceUnavailable
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		w.Write([]byte(`{"responseCode":"00","responseMessage":"SUCCESS"}`))
+	}))
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var changes []string
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+		Now:              clock.Now,
+		OnStateChange: func(endpoint string, from, to CircuitState) {
+			changes = append(changes, endpoint+": "+from.String()+" -> "+to.String())
+		},
+	})
+	client := &Client{
+		config: Config{
+			MerchantCode:   "DXXXX",
+			APIKey:         "DXXXXCX80TZJ85Q70QCI",
+			CircuitBreaker: breaker,
+		},
+		baseURLs:   BaseURLs{Payment: server.URL},
+		httpClient: server.Client(),
+	}
+	request := func(endpoint string) error {
+		return client.doRequest("POST", endpoint, map[string]string{"key": "value"}, nil)
+	}
+
+	// Consecutive failures open the circuit
+	for i := 0; i < 3; i++ {
+		if err := request("test-endpoint"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d error = %v, want API error", i, err)
+		}
+	}
+	if state := breaker.State("test-endpoint"); state != CircuitOpen {
+		t.Fatalf("State() = %v, want open", state)
+	}
+
+	// An open circuit fails fast
+	if err := request("test-endpoint"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("error = %v, want ErrCircuitOpen", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+
+	// Other endpoints have their own circuit
+	if state := breaker.State("other-endpoint"); state != CircuitClosed {
+		t.Errorf("State(other-endpoint) = %v, want closed", state)
+	}
+
+	// A failed probe opens the circuit again
+	clock.Advance(time.Minute)
+	if err := request("test-endpoint"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("probe error = %v, want API error", err)
+	}
+	if state := breaker.State("test-endpoint"); state != CircuitOpen {
+		t.Errorf("State() = %v, want open", state)
+	}
+
+	// A successful probe closes it
+	atomic.StoreInt32(&status, http.StatusOK)
+	clock.Advance(time.Minute)
+	if err := request("test-endpoint"); err != nil {
+		t.Errorf("probe error = %v", err)
+	}
+	if state := breaker.State("test-endpoint"); state != CircuitClosed {
+		t.Errorf("State() = %v, want closed", state)
+	}
+
+	want := []string{
+		"test-endpoint: closed -> open",
+		"test-endpoint: open -> half-open",
+		"test-endpoint: half-open -> open",
+		"test-endpoint: open -> half-open",
+		"test-endpoint: half-open -> closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("changes[%d] = %s, want %s", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		closed   bool
+		wantOpen bool
+	}{
+		{name: "Server Error", status: http.StatusInternalServerError, wantOpen: true},
+		{name: "Network Error", closed: true, wantOpen: true},
+		{name: "Client Error", status: http.StatusBadRequest, wantOpen: false},
+		{name: "Success", status: http.StatusOK, wantOpen: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"responseCode":"00","responseMessage":"SUCCESS"}`))
+			}))
+			if tt.closed {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+
+			breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 2})
+			client := &Client{
+				config:     Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", CircuitBreaker: breaker},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			for i := 0; i < 2; i++ {
+				client.doRequest("POST", "test-endpoint", map[string]string{"key": "value"}, nil)
+			}
+			if got := breaker.State("test-endpoint") == CircuitOpen; got != tt.wantOpen {
+				t.Errorf("open = %v, want %v", got, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, HalfOpenProbes: 2, Now: clock.Now})
+
+	generation, _ := breaker.allow("test-endpoint")
+	breaker.record("test-endpoint", generation, false)
+	clock.Advance(DefaultCircuitOpenTimeout)
+
+	first, err := breaker.allow("test-endpoint")
+	if err != nil {
+		t.Fatalf("first probe error = %v", err)
+	}
+	second, err := breaker.allow("test-endpoint")
+	if err != nil {
+		t.Fatalf("second probe error = %v", err)
+	}
+	if _, err := breaker.allow("test-endpoint"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("third probe error = %v, want ErrCircuitOpen", err)
+	}
+
+	// The circuit closes once every probe succeeded
+	breaker.record("test-endpoint", first, true)
+	if state := breaker.State("test-endpoint"); state != CircuitHalfOpen {
+		t.Errorf("State() = %v, want half-open", state)
+	}
+	breaker.record("test-endpoint", second, true)
+	if state := breaker.State("test-endpoint"); state != CircuitClosed {
+		t.Errorf("State() = %v, want closed", state)
+	}
+
+	// Results from before the last state change are ignored
+	breaker.record("test-endpoint", generation, false)
+	if state := breaker.State("test-endpoint"); state != CircuitClosed {
+		t.Errorf("State() = %v, want closed", state)
+	}
+}
+
+// failingTokenSource fails every token request
+type failingTokenSource struct{}
+
+func (failingTokenSource) Token(merchantCode string) (*Token, error) {
+	return nil, errors.New("token endpoint unavailable")
+}
+
+func (failingTokenSource) Invalidate(merchantCode, accessToken string) {}
+
+func TestCircuitBreakerTokenError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, HalfOpenProbes: 1, Now: clock.Now})
+	client := &Client{
+		config:     Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", CircuitBreaker: breaker, TokenSource: failingTokenSource{}},
+		baseURLs:   BaseURLs{Payment: server.URL},
+		httpClient: server.Client(),
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := client.doRequest("POST", "test-endpoint", nil, nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("doRequest() error = %v, want token error", err)
+		}
+	}
+	if state := breaker.State("test-endpoint"); state != CircuitClosed {
+		t.Errorf("State() = %v, want closed", state)
+	}
+	if got := atomic.LoadInt32(&requests); got != 0 {
+		t.Errorf("requests = %d, want 0", got)
+	}
+
+	// A half-open probe failing on its token gives its slot back
+	generation, _ := breaker.allow("test-endpoint")
+	breaker.record("test-endpoint", generation, false)
+	clock.Advance(DefaultCircuitOpenTimeout)
+	client.doRequest("POST", "test-endpoint", nil, nil)
+	if _, err := breaker.allow("test-endpoint"); err != nil {
+		t.Errorf("probe after token error = %v, want allowed", err)
+	}
+}
+
+func TestCircuitBreakerOpenObserved(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1})
+	generation, _ := breaker.allow("test-endpoint")
+	breaker.record("test-endpoint", generation, false)
+
+	metrics := &recordingMetrics{}
+	tracer := &recordingTracer{}
+	client := &Client{
+		config:   Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", CircuitBreaker: breaker, Metrics: metrics, Tracer: tracer},
+		baseURLs: BaseURLs{Payment: "http://127.0.0.1:0"},
+	}
+
+	err := client.doRequest("POST", "test-endpoint", nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("doRequest() error = %v, want ErrCircuitOpen", err)
+	}
+	if len(metrics.counters) != 1 || len(metrics.observations) != 1 {
+		t.Fatalf("counters = %d, observations = %d, want 1", len(metrics.counters), len(metrics.observations))
+	}
+	if status := metrics.counters[0].labels["status"]; status != StatusCircuitOpen {
+		t.Errorf("status = %q, want %q", status, StatusCircuitOpen)
+	}
+	if len(tracer.spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if !span.ended || len(span.errs) != 1 || !errors.Is(span.errs[0], ErrCircuitOpen) {
+		t.Errorf("span ended = %v, errs = %v", span.ended, span.errs)
+	}
+}
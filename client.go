@@ -6,11 +6,13 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -27,20 +29,68 @@ type Config struct {
 	MerchantCode string
 	// APIKey is the API key provided by Duitku
 	APIKey string
+	// PreviousAPIKeys are rotated keys still accepted on callbacks
+	PreviousAPIKeys []PreviousAPIKey
 	// IsSandbox determines whether to use the sandbox or production environment
 	IsSandbox bool
+	// Environment selects the environment, overriding IsSandbox when set
+	Environment Environment
+	// BaseURLs overrides the base URL of individual APIs, for example to point
+	// the client at a local stand-in or a proxy. Empty fields use the
+	// environment's default.
+	BaseURLs BaseURLs
 	// HTTPClient is an optional custom HTTP client
 	HTTPClient *http.Client
+	// Timeout of the default HTTP client, 30 seconds when zero. Ignored when
+	// HTTPClient is set.
+	Timeout time.Duration
+	// MaxRetries is the number of times an idempotent request, such as a
+	// status check or the payment method list, is retried after a network
+	// error or a 502, 503 or 504 response. Creating a transaction is never
+	// retried: the first request may have gone through, and Duitku rejects a
+	// second one with the same merchantOrderId. CreateTransaction checks the
+	// status of the order instead, see TransactionExistsError.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled for each
+	// following retry. Defaults to 500 milliseconds.
+	RetryWait time.Duration
 	// Logger is an optional custom logger
 	Logger *log.Logger
 	// Log every request and response
 	LogEveryRequestAndResponse bool
+	// CallbackAllowlist optionally restricts the addresses callbacks are
+	// accepted from, see NewCallbackAllowlist
+	CallbackAllowlist *IPAllowlist
+	// TokenSource optionally provides access tokens for the merchant, sent
+	// as the Authorization header. A request rejected with 401 is retried
+	// once with a new token.
+	TokenSource TokenSource
+	// Metrics optionally receives request and callback counters and
+	// latencies, see NewPrometheusMetrics
+	Metrics Metrics
+	// Tracer optionally receives a span for every request and callback
+	Tracer Tracer
+	// CorrelationField selects the transaction field that carries the
+	// correlation ID of TransactionRequest.CorrelationID to the callback,
+	// AdditionalParam by default. The field is only set when the request
+	// leaves it empty; a field holding the merchant's own data is sent as is.
+	CorrelationField CorrelationField
+	// CircuitBreaker optionally fails requests fast with ErrCircuitOpen
+	// while an endpoint keeps failing, see NewCircuitBreaker
+	CircuitBreaker *CircuitBreaker
+	// TransactionStore optionally receives a record of every created
+	// transaction, status check and callback accepted by HandleCallback
+	TransactionStore TransactionStore
+	// OnStoreError is called when a record cannot be saved to
+	// TransactionStore. The call being recorded does not fail; without
+	// OnStoreError the error is logged.
+	OnStoreError func(record *TransactionRecord, err error)
 }
 
 // Client is the Duitku API client
 type Client struct {
 	config                     Config
-	baseURL                    string
+	baseURLs                   BaseURLs
 	httpClient                 *http.Client
 	logger                     *log.Logger
 	logEveryRequestAndResponse bool
@@ -48,15 +98,16 @@ type Client struct {
 
 // NewClient creates a new Duitku client with the provided configuration
 func NewClient(config Config) *Client {
-	baseURL := ProductionBaseURL
-	if config.IsSandbox {
-		baseURL = SandboxBaseURL
-	}
+	baseURLs := config.ResolveBaseURLs()
 
 	httpClient := config.HTTPClient
 	if httpClient == nil {
+		timeout := config.Timeout
+		if timeout == 0 {
+			timeout = 30 * time.Second
+		}
 		httpClient = &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
 		}
 	}
 
@@ -67,7 +118,7 @@ func NewClient(config Config) *Client {
 
 	return &Client{
 		config:                     config,
-		baseURL:                    baseURL,
+		baseURLs:                   baseURLs,
 		httpClient:                 httpClient,
 		logger:                     logger,
 		logEveryRequestAndResponse: config.LogEveryRequestAndResponse,
@@ -76,53 +127,119 @@ func NewClient(config Config) *Client {
 
 // createSignatureSHA256 creates a SHA256 signature from the provided parameters
 func (c *Client) createSignatureSHA256(params ...string) string {
-	var combined string
-	for _, param := range params {
-		combined += param
-	}
-	combined += c.config.APIKey
-
-	hash := sha256.Sum256([]byte(combined))
-	return hex.EncodeToString(hash[:])
+	return SignatureSHA256(c.config.APIKey, params...)
 }
 
 // createSignatureMD5 creates an MD5 signature from the provided parameters
 func (c *Client) createSignatureMD5(params ...string) string {
-	var combined string
-	for _, param := range params {
-		combined += param
-	}
-	combined += c.config.APIKey
+	return SignatureMD5(c.config.APIKey, params...)
+}
+
+// SignatureSHA256 returns the hex encoded SHA256 of the parameters followed by the API key
+func SignatureSHA256(apiKey string, params ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(params, "") + apiKey))
+	return hex.EncodeToString(hash[:])
+}
 
-	hash := md5.Sum([]byte(combined))
+// SignatureMD5 returns the hex encoded MD5 of the parameters followed by the API key
+func SignatureMD5(apiKey string, params ...string) string {
+	hash := md5.Sum([]byte(strings.Join(params, "") + apiKey))
 	return hex.EncodeToString(hash[:])
 }
 
-// doRequest performs an HTTP request to the Duitku API
+// doRequest performs an HTTP request to the Duitku payment API
 func (c *Client) doRequest(method, endpoint string, body interface{}, result interface{}) error {
-	url := fmt.Sprintf("%s/%s", c.baseURL, endpoint)
+	return c.doRequestTo(c.baseURLs.Payment, method, endpoint, nil, body, result)
+}
+
+// doRequestTo performs an HTTP request with the extra headers to the
+// endpoint of the API at baseURL
+func (c *Client) doRequestTo(baseURL, method, endpoint string, headers http.Header, body interface{}, result interface{}) error {
+	url := joinURL(baseURL, endpoint)
 
-	var reqBody io.Reader
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return fmt.Errorf("error marshaling request body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonBody)
 	}
 
-	req, err := http.NewRequest(method, url, reqBody)
+	start := time.Now()
+	span := c.startRequestSpan(method, endpoint, jsonBody)
+
+	generation, err := c.config.CircuitBreaker.allow(endpoint)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		c.observeRequest(endpoint, start, jsonBody, nil, nil, err)
+		c.endRequestSpan(span, nil, nil, err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	retries := 0
+	if idempotentEndpoints[endpoint] {
+		retries = c.config.MaxRetries
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, respBody, err := c.exchange(method, url, headers, jsonBody, retries)
+	var tokenErr *tokenError
+	if errors.As(err, &tokenErr) {
+		// The request never reached Duitku
+		c.config.CircuitBreaker.release(endpoint, generation)
+	} else {
+		c.config.CircuitBreaker.record(endpoint, generation, !isCircuitFailure(resp, err))
+	}
+	c.observeRequest(endpoint, start, jsonBody, resp, respBody, err)
+	if err == nil {
+		err = c.decodeResponse(method, url, body, resp, respBody, result)
+		if err != nil && isRetryableStatus(resp.StatusCode) {
+			err = &unconfirmedError{err: err}
+		}
+	}
+
+	c.endRequestSpan(span, resp, respBody, err)
+	return err
+}
+
+// exchange sends the request and reads the response body. A response
+// rejected with 401 invalidates the access token and is sent once more.
+func (c *Client) exchange(method, url string, headers http.Header, jsonBody []byte, retries int) (*http.Response, []byte, error) {
+	token, err := c.accessToken()
+	if err != nil {
+		return nil, nil, &tokenError{err: err}
+	}
+
+	resp, err := c.send(method, url, headers, jsonBody, token, retries)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The token may have been revoked before it expired
+	if resp.StatusCode == http.StatusUnauthorized && token != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		c.config.TokenSource.Invalidate(c.config.MerchantCode, token.AccessToken)
+		if token, err = c.accessToken(); err != nil {
+			return nil, nil, &tokenError{err: err}
+		}
+		if resp, err = c.send(method, url, headers, jsonBody, token, retries); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error making request: %w", err)
+		return resp, nil, fmt.Errorf("error reading response: %w", err)
 	}
+	return resp, respBody, nil
+}
 
+// decodeResponse logs the exchange when enabled and decodes the response
+// body into result, or into an error for non 200 responses
+func (c *Client) decodeResponse(method, url string, body interface{}, resp *http.Response, respBody []byte, result interface{}) error {
 	if c.logEveryRequestAndResponse {
 		c.logger.Println("-=-=-=-= [client.go][doRequest] -=-=-=-=")
 		c.logger.Printf("Request method: %s \n", method)
@@ -130,33 +247,20 @@ func (c *Client) doRequest(method, endpoint string, body interface{}, result int
 		c.logger.Printf("Request body: %+v \n", body)
 		c.logger.Printf("Response status code: %d \n", resp.StatusCode)
 		c.logger.Printf("Response status: %s \n", resp.Status)
-
-		// Read the response body
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			c.logger.Printf("Error reading response body: %v\n", err)
-		} else {
-			c.logger.Printf("Response body: %s\n", string(respBody))
-		}
-
-		// Create a new reader with the same data for further processing
-		resp.Body = io.NopCloser(bytes.NewBuffer(respBody))
-
+		c.logger.Printf("Response body: %s\n", string(respBody))
 		c.logger.Println("-=-=-=-= [client.go][doRequest] -=-=-=-=")
 	}
 
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
 		var errorResp ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
+		if err := json.NewDecoder(bytes.NewReader(respBody)).Decode(&errorResp); err != nil {
 			return fmt.Errorf("error decoding error response: %w", err)
 		}
 		return fmt.Errorf("API error: %s (code: %s)", errorResp.Message, errorResp.Code)
 	}
 
 	if result != nil {
-		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		if err := json.NewDecoder(bytes.NewReader(respBody)).Decode(result); err != nil {
 			return fmt.Errorf("error decoding response: %w", err)
 		}
 	}
@@ -164,6 +268,97 @@ func (c *Client) doRequest(method, endpoint string, body interface{}, result int
 	return nil
 }
 
+// accessToken returns the merchant's token from Config.TokenSource, or nil
+// when the client has none
+func (c *Client) accessToken() (*Token, error) {
+	if c.config.TokenSource == nil {
+		return nil, nil
+	}
+	token, err := c.config.TokenSource.Token(c.config.MerchantCode)
+	if err != nil {
+		return nil, fmt.Errorf("error getting access token: %w", err)
+	}
+	return token, nil
+}
+
+// send performs the request, retrying network errors and gateway errors up to retries times
+func (c *Client) send(method, url string, headers http.Header, jsonBody []byte, token *Token, retries int) (*http.Response, error) {
+	wait := c.config.RetryWait
+	if wait <= 0 {
+		wait = 500 * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if jsonBody != nil {
+			reqBody = bytes.NewReader(jsonBody)
+		}
+
+		req, err := http.NewRequest(method, url, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+		if token != nil {
+			req.Header.Set("Authorization", token.authorization())
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt >= retries || (err == nil && !isRetryableStatus(resp.StatusCode)) {
+			if err != nil {
+				return nil, &unconfirmedError{err: fmt.Errorf("error making request: %w", err)}
+			}
+			return resp, nil
+		}
+
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// idempotentEndpoints are the payment API endpoints that can be sent again
+// after a failure without side effects
+var idempotentEndpoints = map[string]bool{
+	"merchant/transactionStatus":              true,
+	"merchant/paymentmethod/getpaymentmethod": true,
+	"merchant/subscription/list":              true,
+	"merchant/subscription/cycles":            true,
+}
+
+// unconfirmedError is a failed request that may still have been processed,
+// because it got no response or only a gateway error
+type unconfirmedError struct {
+	err error
+}
+
+func (e *unconfirmedError) Error() string { return e.err.Error() }
+
+func (e *unconfirmedError) Unwrap() error { return e.err }
+
+// tokenError is a failure of Config.TokenSource, before any request was sent
+type tokenError struct {
+	err error
+}
+
+func (e *tokenError) Error() string { return e.err.Error() }
+
+func (e *tokenError) Unwrap() error { return e.err }
+
+// isRetryableStatus reports whether the response indicates a temporary gateway failure
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
 // ErrorResponse represents an error response from the Duitku API
 type ErrorResponse struct {
 	Code    string `json:"responseCode"`
@@ -73,8 +73,8 @@ func TestNewClient(t *testing.T) {
 			client := NewClient(tt.config)
 
 			// Check base URL
-			if client.baseURL != tt.want {
-				t.Errorf("NewClient() baseURL = %v, want %v", client.baseURL, tt.want)
+			if client.baseURLs.Payment != tt.want {
+				t.Errorf("NewClient() baseURL = %v, want %v", client.baseURLs.Payment, tt.want)
 			}
 
 			// Check config values
@@ -214,6 +214,24 @@ func TestCreateSignatureMD5(t *testing.T) {
 	}
 }
 
+func TestSignatureFunctions(t *testing.T) {
+	md5Sig := SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "ORDER123", "10000")
+	if md5Sig != "886d4509ec5bec908b0731e7bca2669e" {
+		t.Errorf("SignatureMD5() = %v, want 886d4509ec5bec908b0731e7bca2669e", md5Sig)
+	}
+
+	sha256Sig := SignatureSHA256("DXXXXCX80TZJ85Q70QCI", "DXXXX", "10000", "2022-01-25 16:23:08")
+	if sha256Sig != "db17b057dcde118100bd47f3fa0e54fa258ba15b40f932726188b9a8b7744dd2" {
+		t.Errorf("SignatureSHA256() = %v, want db17b057dcde118100bd47f3fa0e54fa258ba15b40f932726188b9a8b7744dd2", sha256Sig)
+	}
+
+	// The client methods use the configured API key
+	client := NewClient(Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI"})
+	if got := client.createSignatureMD5("DXXXX", "ORDER123", "10000"); got != md5Sig {
+		t.Errorf("createSignatureMD5() = %v, want %v", got, md5Sig)
+	}
+}
+
 func TestDoRequest(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -281,7 +299,7 @@ func TestDoRequest(t *testing.T) {
 					MerchantCode: "DXXXX",
 					APIKey:       "DXXXXCX80TZJ85Q70QCI",
 				},
-				baseURL:                    server.URL,
+				baseURLs:                   BaseURLs{Payment: server.URL},
 				httpClient:                 server.Client(),
 				logger:                     log.New(io.Discard, "", 0), // Suppress logging for tests
 				logEveryRequestAndResponse: true,
@@ -331,7 +349,7 @@ func TestDoRequestWithLogging(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:                    server.URL,
+		baseURLs:                   BaseURLs{Payment: server.URL},
 		httpClient:                 server.Client(),
 		logger:                     log.New(logBuffer, "", 0), // Capture logs
 		logEveryRequestAndResponse: true,                      // Enable logging
@@ -383,7 +401,7 @@ func TestDoRequestWithInvalidBody(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 		logger:     log.New(io.Discard, "", 0),
 	}
@@ -406,6 +424,71 @@ func TestDoRequestWithInvalidBody(t *testing.T) {
 	}
 }
 
+func TestDoRequestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		endpoint     string
+		maxRetries   int
+		failures     int
+		failStatus   int
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "No Retries", endpoint: "merchant/transactionStatus", maxRetries: 0, failures: 1, failStatus: http.StatusServiceUnavailable, wantRequests: 1, wantErr: true},
+		{name: "Recovers", endpoint: "merchant/transactionStatus", maxRetries: 2, failures: 2, failStatus: http.StatusBadGateway, wantRequests: 3},
+		{name: "Exhausted", endpoint: "merchant/transactionStatus", maxRetries: 2, failures: 5, failStatus: http.StatusGatewayTimeout, wantRequests: 3, wantErr: true},
+		{name: "Client Error Not Retried", endpoint: "merchant/transactionStatus", maxRetries: 2, failures: 5, failStatus: http.StatusBadRequest, wantRequests: 1, wantErr: true},
+		{name: "Create Not Retried", endpoint: "merchant/v2/inquiry", maxRetries: 2, failures: 5, failStatus: http.StatusBadGateway, wantRequests: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"key":"value"}` {
+					t.Errorf("request %d body = %s", requests, body)
+				}
+				if requests <= tt.failures {
+					w.WriteHeader(tt.failStatus)
+					w.Write([]byte(`{"responseCode":"99","responseMessage":"unavailable"}`))
+					return
+				}
+				w.Write([]byte(`{"status":"success"}`))
+			}))
+			defer server.Close()
+
+			client := &Client{
+				config: Config{
+					MerchantCode: "DXXXX",
+					APIKey:       "DXXXXCX80TZJ85Q70QCI",
+					MaxRetries:   tt.maxRetries,
+					RetryWait:    time.Millisecond,
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			var response map[string]string
+			err := client.doRequest("POST", tt.endpoint, map[string]string{"key": "value"}, &response)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("doRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	client := NewClient(Config{MerchantCode: "DXXXX", APIKey: "KEY", Timeout: 5 * time.Second})
+	if client.httpClient.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %s, want 5s", client.httpClient.Timeout)
+	}
+}
+
 func TestErrorResponse(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// newFlagSet creates a flag set for a subcommand that reports errors to stderr
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("duitku "+name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+// printJSON writes v as indented JSON
+func (a *app) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// runMethods lists the payment methods for an amount
+func runMethods(a *app, profile *profileFlags, args []string) error {
+	fs := a.newFlagSet("methods")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: methods [-json] <amount>")
+	}
+	amount, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid amount %q", fs.Arg(0))
+	}
+
+	client, err := a.client(profile)
+	if err != nil {
+		return err
+	}
+	methods, err := client.GetPaymentMethods(amount)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return a.printJSON(methods)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tNAME\tFEE")
+	for _, method := range methods {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", method.PaymentMethod, method.PaymentName, method.TotalFee)
+	}
+	return w.Flush()
+}
+
+// runCreate creates a transaction from flags or a JSON request file
+func runCreate(a *app, profile *profileFlags, args []string) error {
+	fs := a.newFlagSet("create")
+	file := fs.String("file", "", "JSON file with a TransactionRequest, - for stdin")
+	amount := fs.Int("amount", 0, "payment amount")
+	method := fs.String("method", "", "payment method code, empty for the hosted selection page")
+	orderID := fs.String("order", "", "merchant order ID, defaults to a timestamp")
+	product := fs.String("product", "Test transaction", "product details")
+	email := fs.String("email", "", "customer email")
+	name := fs.String("name", "", "customer name shown on the virtual account")
+	phone := fs.String("phone", "", "customer phone number")
+	callbackURL := fs.String("callback", "", "callback URL")
+	returnURL := fs.String("return", "", "return URL")
+	expiry := fs.Int("expiry", 60, "expiry period in minutes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var request duitku.TransactionRequest
+	if *file != "" {
+		data, err := a.readInput(*file)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &request); err != nil {
+			return fmt.Errorf("error parsing %s: %w", *file, err)
+		}
+	} else {
+		request = duitku.TransactionRequest{
+			PaymentAmount:   *amount,
+			PaymentMethod:   *method,
+			MerchantOrderID: *orderID,
+			ProductDetails:  *product,
+			Email:           *email,
+			CustomerVaName:  *name,
+			PhoneNumber:     *phone,
+			CallbackURL:     *callbackURL,
+			ReturnURL:       *returnURL,
+			ExpiryPeriod:    *expiry,
+		}
+	}
+	if request.MerchantOrderID == "" {
+		request.MerchantOrderID = fmt.Sprintf("CLI-%d", time.Now().Unix())
+	}
+	if request.PaymentAmount <= 0 {
+		return errors.New("a positive -amount is required")
+	}
+
+	client, err := a.client(profile)
+	if err != nil {
+		return err
+	}
+	response, err := client.CreateTransaction(request)
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+// runStatus checks the status of a transaction
+func runStatus(a *app, profile *profileFlags, args []string) error {
+	fs := a.newFlagSet("status")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: status [-json] <merchantOrderId>")
+	}
+
+	client, err := a.client(profile)
+	if err != nil {
+		return err
+	}
+	status, err := client.CheckTransaction(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return a.printJSON(status)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Order\t%s\n", status.MerchantOrderID)
+	fmt.Fprintf(w, "Reference\t%s\n", status.Reference)
+	fmt.Fprintf(w, "Amount\t%s\n", status.Amount)
+	fmt.Fprintf(w, "Fee\t%s\n", status.Fee)
+	fmt.Fprintf(w, "Status\t%s (%s)\n", status.StatusMessage, status.StatusCode)
+	return w.Flush()
+}
+
+// runSign prints the signature for the inputs of a Duitku request
+func runSign(a *app, profile *profileFlags, args []string) error {
+	fs := a.newFlagSet("sign")
+	fs.Usage = func() {
+		fmt.Fprintln(a.stderr, "Usage: duitku sign <kind> [inputs]")
+		fmt.Fprintln(a.stderr, "  transaction <merchantOrderId> <amount>  MD5(merchantCode + orderId + amount + apiKey)")
+		fmt.Fprintln(a.stderr, "  status <merchantOrderId>                MD5(merchantCode + orderId + apiKey)")
+		fmt.Fprintln(a.stderr, "  methods <amount> <datetime>             SHA256(merchantCode + amount + datetime + apiKey)")
+		fmt.Fprintln(a.stderr, "  callback <amount> <merchantOrderId>     MD5(merchantCode + amount + orderId + apiKey)")
+		fmt.Fprintln(a.stderr, "  raw [-algo md5|sha256] <inputs...>      hash(inputs... + apiKey)")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	config, err := a.config(profile)
+	if err != nil {
+		return err
+	}
+
+	kind, inputs := fs.Arg(0), fs.Args()[1:]
+	want := map[string]int{"transaction": 2, "status": 1, "methods": 2, "callback": 2}
+	if n, ok := want[kind]; ok && len(inputs) != n {
+		return fmt.Errorf("%s expects %d inputs, got %d", kind, n, len(inputs))
+	}
+
+	var signature string
+	switch kind {
+	case "transaction", "status", "callback":
+		signature = duitku.SignatureMD5(config.APIKey, append([]string{config.MerchantCode}, inputs...)...)
+	case "methods":
+		signature = duitku.SignatureSHA256(config.APIKey, append([]string{config.MerchantCode}, inputs...)...)
+	case "raw":
+		rawFlags := a.newFlagSet("sign raw")
+		rawAlgo := rawFlags.String("algo", "md5", "hash algorithm: md5 or sha256")
+		if err := rawFlags.Parse(inputs); err != nil {
+			return err
+		}
+		switch *rawAlgo {
+		case "md5":
+			signature = duitku.SignatureMD5(config.APIKey, rawFlags.Args()...)
+		case "sha256":
+			signature = duitku.SignatureSHA256(config.APIKey, rawFlags.Args()...)
+		default:
+			return fmt.Errorf("unknown algorithm %q", *rawAlgo)
+		}
+	default:
+		return fmt.Errorf("unknown signature kind %q", kind)
+	}
+
+	fmt.Fprintln(a.stdout, signature)
+	return nil
+}
+
+// runVerifyCallback validates a captured form or JSON callback body against the configured credentials
+func runVerifyCallback(a *app, profile *profileFlags, args []string) error {
+	fs := a.newFlagSet("verify-callback")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := "-"
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	body, err := a.readInput(path)
+	if err != nil {
+		return err
+	}
+
+	client, err := a.client(profile)
+	if err != nil {
+		return err
+	}
+
+	body = bytes.TrimSpace(body)
+	req, err := http.NewRequest("POST", "/callback", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if bytes.HasPrefix(body, []byte("{")) {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	data, err := client.ParseCallback(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "signature valid")
+	return a.printJSON(data)
+}
+
+// readInput reads a file, or stdin when path is "-"
+func (a *app) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(a.stdin)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// runSimulateCallback posts a correctly signed callback to a local handler
+func runSimulateCallback(a *app, profile *profileFlags, args []string) error {
+	fs := a.newFlagSet("simulate-callback")
+	opts := duitku.SimulateCallbackOptions{}
+	fs.StringVar(&opts.URL, "url", "", "callback URL to post to")
+	fs.StringVar(&opts.MerchantOrderID, "order", "", "merchant order ID")
+	fs.IntVar(&opts.Amount, "amount", 0, "transaction amount")
+	fs.StringVar(&opts.PaymentCode, "payment-code", duitku.PaymentMethodBCA, "payment method code")
+	fs.StringVar(&opts.ResultCode, "result-code", duitku.CallbackStatusSuccess, "result code, 00 success or 01 failed")
+	fs.StringVar(&opts.Reference, "reference", "", "Duitku reference, generated when empty")
+	fs.StringVar(&opts.AdditionalParam, "additional-param", "", "additional parameter echoed from the transaction")
+	fs.StringVar(&opts.MerchantUserID, "user", "", "merchant user ID")
+	fs.IntVar(&opts.Repeat, "repeat", 1, "number of deliveries, to test idempotency")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.URL == "" || opts.MerchantOrderID == "" || opts.Amount <= 0 {
+		return errors.New("-url, -order and a positive -amount are required")
+	}
+
+	client, err := a.client(profile)
+	if err != nil {
+		return err
+	}
+	deliveries, err := client.SimulateCallback(opts)
+	for _, delivery := range deliveries {
+		fmt.Fprintf(a.stdout, "#%d %d %s (%s)\n%s\n", delivery.Attempt, delivery.StatusCode,
+			http.StatusText(delivery.StatusCode), delivery.Duration.Round(time.Millisecond), delivery.Body)
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+// Command duitku is a command line tool for debugging Duitku integrations.
+//
+// Usage:
+//
+//	duitku [-profile name] [-config path] <command> [arguments]
+//
+// Commands:
+//
+//	methods <amount>          list payment methods available for an amount
+//	create [flags]            create a transaction from flags or a JSON file
+//	status <merchantOrderId>  check the status of a transaction
+//	sign <kind> [inputs]      print the signature Duitku expects for the inputs
+//	verify-callback [file]    validate a captured callback form or JSON body
+//	simulate-callback [flags] post a signed callback to a local handler
+//
+// Credentials are read from DUITKU_MERCHANT_CODE, DUITKU_API_KEY and
+// DUITKU_SANDBOX, or from a profile in the file given by -config, DUITKU_CONFIG
+// or ~/.duitku/profiles.json. Environment variables override profile values.
+// The file may be JSON or TOML; see duitku.LoadConfigProfile.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// app holds the dependencies of a command invocation
+type app struct {
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	getenv     func(string) string
+	httpClient *http.Client
+}
+
+// command is a subcommand entry point
+type command struct {
+	usage string
+	run   func(a *app, profile *profileFlags, args []string) error
+}
+
+var commands = map[string]command{
+	"methods":         {"methods [-json] <amount>", runMethods},
+	"create":          {"create [-file request.json | flags]", runCreate},
+	"status":          {"status [-json] <merchantOrderId>", runStatus},
+	"sign":            {"sign <transaction|status|methods|callback|raw> [inputs]", runSign},
+	"verify-callback": {"verify-callback [file]", runVerifyCallback},
+	"simulate-callback": {
+		"simulate-callback -url <url> -order <merchantOrderId> -amount <amount> [-payment-code BC] [-result-code 00] [-repeat n]",
+		runSimulateCallback,
+	},
+}
+
+var commandOrder = []string{"methods", "create", "status", "sign", "verify-callback", "simulate-callback"}
+
+func main() {
+	a := &app{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+	}
+	os.Exit(a.run(os.Args[1:]))
+}
+
+// run parses the global flags, dispatches to the subcommand and returns the exit code
+func (a *app) run(args []string) int {
+	fs := flag.NewFlagSet("duitku", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	profile := &profileFlags{}
+	fs.StringVar(&profile.name, "profile", "", "profile name in the config file")
+	fs.StringVar(&profile.path, "config", "", "path to the profiles file")
+	fs.Usage = func() { a.usage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		a.usage(fs)
+		return 2
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(a.stderr, "duitku: unknown command %q\n", fs.Arg(0))
+		a.usage(fs)
+		return 2
+	}
+
+	if err := cmd.run(a, profile, fs.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 2
+		}
+		fmt.Fprintf(a.stderr, "duitku %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+func (a *app) usage(fs *flag.FlagSet) {
+	fmt.Fprintln(a.stderr, "Usage: duitku [-profile name] [-config path] <command> [arguments]")
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "Commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(a.stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(a.stderr)
+	fmt.Fprintln(a.stderr, "Flags:")
+	fs.PrintDefaults()
+}
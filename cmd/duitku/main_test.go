@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// rewriteTransport sends every request to the test server
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestApp creates an app whose requests go to handler, with credentials in the environment
+func newTestApp(t *testing.T, handler http.HandlerFunc, env map[string]string) (*app, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	var httpClient *http.Client
+	if handler != nil {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		target, _ := url.Parse(server.URL)
+		httpClient = &http.Client{Transport: rewriteTransport{target: target}}
+	}
+
+	if env == nil {
+		env = map[string]string{
+			"DUITKU_MERCHANT_CODE": "DXXXX",
+			"DUITKU_API_KEY":       "DXXXXCX80TZJ85Q70QCI",
+		}
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &app{
+		stdin:      strings.NewReader(""),
+		stdout:     stdout,
+		stderr:     stderr,
+		getenv:     func(key string) string { return env[key] },
+		httpClient: httpClient,
+	}, stdout, stderr
+}
+
+func TestMethodsCommand(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/merchant/paymentmethod/getpaymentmethod") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"paymentFee":[{"paymentMethod":"BC","paymentName":"BCA VA","totalFee":"4000"},{"paymentMethod":"OV","paymentName":"OVO","totalFee":"1500"}],"responseCode":"00","responseMessage":"SUCCESS"}`))
+	}
+
+	a, stdout, stderr := newTestApp(t, handler, nil)
+	if code := a.run([]string{"methods", "10000"}); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), "BC    BCA VA  4000") {
+		t.Errorf("methods table output:\n%s", stdout)
+	}
+
+	a, stdout, _ = newTestApp(t, handler, nil)
+	if code := a.run([]string{"methods", "-json", "10000"}); code != 0 {
+		t.Fatalf("run() = %d", code)
+	}
+	var methods []duitku.PaymentMethod
+	if err := json.Unmarshal(stdout.Bytes(), &methods); err != nil || len(methods) != 2 {
+		t.Errorf("methods -json output = %s, err %v", stdout, err)
+	}
+}
+
+func TestCreateCommand(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["merchantOrderId"] != "ORDER123" || request["paymentMethod"] != "BC" {
+			t.Errorf("unexpected request %v", request)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"merchantCode":"DXXXX","reference":"DEV123","vaNumber":"7007014001444348","amount":"40000","statusCode":"00","statusMessage":"SUCCESS"}`))
+	}
+
+	// From flags
+	a, stdout, stderr := newTestApp(t, handler, nil)
+	code := a.run([]string{"create", "-amount", "40000", "-method", "BC", "-order", "ORDER123", "-email", "a@example.com"})
+	if code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), `"vaNumber": "7007014001444348"`) {
+		t.Errorf("create output:\n%s", stdout)
+	}
+
+	// From a JSON file
+	path := filepath.Join(t.TempDir(), "request.json")
+	os.WriteFile(path, []byte(`{"paymentAmount":40000,"paymentMethod":"BC","merchantOrderId":"ORDER123"}`), 0o600)
+	a, _, stderr = newTestApp(t, handler, nil)
+	if code := a.run([]string{"create", "-file", path}); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+
+	// Missing amount
+	a, _, stderr = newTestApp(t, handler, nil)
+	if code := a.run([]string{"create", "-method", "BC"}); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "-amount is required") {
+		t.Errorf("stderr = %s", stderr)
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"merchantOrderId":"ORDER123","reference":"DEV123","amount":"40000","fee":"0","statusCode":"01","statusMessage":"PENDING"}`))
+	}
+
+	a, stdout, stderr := newTestApp(t, handler, nil)
+	if code := a.run([]string{"status", "ORDER123"}); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), "Status     PENDING (01)") {
+		t.Errorf("status output:\n%s", stdout)
+	}
+}
+
+func TestSignCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "Transaction",
+			args: []string{"sign", "transaction", "ORDER123", "10000"},
+			want: duitku.SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "ORDER123", "10000"),
+		},
+		{
+			name: "Methods",
+			args: []string{"sign", "methods", "10000", "2022-01-25 16:23:08"},
+			want: duitku.SignatureSHA256("DXXXXCX80TZJ85Q70QCI", "DXXXX", "10000", "2022-01-25 16:23:08"),
+		},
+		{
+			name: "Callback",
+			args: []string{"sign", "callback", "40000", "ORDER123"},
+			want: duitku.SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER123"),
+		},
+		{
+			name: "Raw SHA256",
+			args: []string{"sign", "raw", "-algo", "sha256", "a", "b"},
+			want: duitku.SignatureSHA256("DXXXXCX80TZJ85Q70QCI", "a", "b"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, stdout, stderr := newTestApp(t, nil, nil)
+			if code := a.run(tt.args); code != 0 {
+				t.Fatalf("run() = %d, stderr: %s", code, stderr)
+			}
+			if got := strings.TrimSpace(stdout.String()); got != tt.want {
+				t.Errorf("sign = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	a, _, _ := newTestApp(t, nil, nil)
+	if code := a.run([]string{"sign", "status"}); code != 1 {
+		t.Errorf("run() with missing inputs = %d, want 1", code)
+	}
+}
+
+func TestVerifyCallbackCommand(t *testing.T) {
+	form := url.Values{}
+	form.Add("merchantCode", "DXXXX")
+	form.Add("amount", "40000")
+	form.Add("merchantOrderId", "ORDER123")
+	form.Add("resultCode", "00")
+	form.Add("signature", duitku.SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER123"))
+
+	a, stdout, stderr := newTestApp(t, nil, nil)
+	a.stdin = strings.NewReader(form.Encode() + "\n")
+	if code := a.run([]string{"verify-callback"}); code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout.String(), "signature valid") {
+		t.Errorf("verify-callback output:\n%s", stdout)
+	}
+
+	// JSON bodies are detected automatically
+	a, stdout, stderr = newTestApp(t, nil, nil)
+	a.stdin = strings.NewReader(`{"merchantCode":"DXXXX","amount":40000,"merchantOrderId":"ORDER123","resultCode":"00","signature":"` + form.Get("signature") + `"}`)
+	if code := a.run([]string{"verify-callback"}); code != 0 {
+		t.Fatalf("run() with JSON = %d, stderr: %s", code, stderr)
+	}
+
+	form.Set("signature", "tampered")
+	path := filepath.Join(t.TempDir(), "callback.txt")
+	os.WriteFile(path, []byte(form.Encode()), 0o600)
+	a, _, stderr = newTestApp(t, nil, nil)
+	if code := a.run([]string{"verify-callback", path}); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "invalid callback signature") {
+		t.Errorf("stderr = %s", stderr)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(path, []byte(`{
+		"default": "sandbox",
+		"profiles": {
+			"sandbox": {"merchantCode": "DSAND", "apiKey": "sandbox-key", "sandbox": true},
+			"production": {"merchantCode": "DPROD", "apiKey": "production-key", "sandbox": false}
+		}
+	}`), 0o600)
+
+	a, _, _ := newTestApp(t, nil, map[string]string{"DUITKU_CONFIG": path})
+	config, err := a.config(&profileFlags{})
+	if err != nil {
+		t.Fatalf("config() error = %v", err)
+	}
+	if config.MerchantCode != "DSAND" || !config.IsSandbox {
+		t.Errorf("default profile = %+v, want sandbox", config)
+	}
+
+	config, err = a.config(&profileFlags{name: "production"})
+	if err != nil {
+		t.Fatalf("config() error = %v", err)
+	}
+	if config.MerchantCode != "DPROD" || config.IsSandbox {
+		t.Errorf("production profile = %+v", config)
+	}
+
+	// Environment overrides the profile
+	a, _, _ = newTestApp(t, nil, map[string]string{"DUITKU_CONFIG": path, "DUITKU_API_KEY": "env-key"})
+	config, _ = a.config(&profileFlags{})
+	if config.APIKey != "env-key" {
+		t.Errorf("APIKey = %s, want env-key", config.APIKey)
+	}
+
+	if _, err := a.config(&profileFlags{name: "staging"}); err == nil {
+		t.Errorf("config() error = nil, want error for unknown profile")
+	}
+
+	// No credentials at all
+	a, _, stderr := newTestApp(t, nil, map[string]string{})
+	if code := a.run([]string{"status", "ORDER123"}); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "DUITKU_MERCHANT_CODE") {
+		t.Errorf("stderr = %s", stderr)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	a, _, stderr := newTestApp(t, nil, nil)
+	if code := a.run([]string{"refund"}); code != 2 {
+		t.Errorf("run() = %d, want 2", code)
+	}
+	if !strings.Contains(stderr.String(), `unknown command "refund"`) {
+		t.Errorf("stderr = %s", stderr)
+	}
+}
+
+func TestSimulateCallbackCommand(t *testing.T) {
+	client := duitku.NewClient(duitku.Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI"})
+	deliveries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.HandleCallback(w, r, func(data *duitku.CallbackData) error {
+			deliveries++
+			if data.ResultCode != duitku.CallbackStatusFailed {
+				t.Errorf("ResultCode = %s, want 01", data.ResultCode)
+			}
+			return nil
+		})
+	}))
+	defer server.Close()
+
+	a, stdout, stderr := newTestApp(t, nil, nil)
+	code := a.run([]string{"simulate-callback", "-url", server.URL, "-order", "ORDER123", "-amount", "40000", "-result-code", "01", "-repeat", "2"})
+	if code != 0 {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+	if deliveries != 2 {
+		t.Errorf("handler called %d times, want 2", deliveries)
+	}
+	if !strings.Contains(stdout.String(), "#2 200 OK") {
+		t.Errorf("simulate-callback output:\n%s", stdout)
+	}
+
+	a, _, _ = newTestApp(t, nil, nil)
+	if code := a.run([]string{"simulate-callback", "-order", "ORDER123"}); code != 1 {
+		t.Errorf("run() without url = %d, want 1", code)
+	}
+}
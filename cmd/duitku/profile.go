@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// profileFlags are the global flags selecting the credentials
+type profileFlags struct {
+	name string
+	path string
+}
+
+// config resolves the client configuration from the profiles file and the
+// environment. See duitku.LoadConfigProfile for the file format and
+// duitku.ConfigFromEnv for the variables; the CLI defaults to the sandbox.
+func (a *app) config(flags *profileFlags) (duitku.Config, error) {
+	config := duitku.Config{IsSandbox: true}
+
+	if err := a.applyProfile(flags, &config); err != nil {
+		return config, err
+	}
+	if err := config.ApplyEnv(a.getenv); err != nil {
+		return config, err
+	}
+
+	if config.MerchantCode == "" || config.APIKey == "" {
+		return config, errors.New("merchant code and API key are required: set DUITKU_MERCHANT_CODE and DUITKU_API_KEY or use -profile")
+	}
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+	config.HTTPClient = a.httpClient
+	return config, nil
+}
+
+// client creates a Duitku client from the resolved configuration
+func (a *app) client(flags *profileFlags) (*duitku.Client, error) {
+	config, err := a.config(flags)
+	if err != nil {
+		return nil, err
+	}
+	return duitku.NewClient(config), nil
+}
+
+// applyProfile applies the selected profile. A missing default file is not
+// an error, but a missing explicit file or profile is.
+func (a *app) applyProfile(flags *profileFlags, config *duitku.Config) error {
+	path := flags.path
+	explicit := path != ""
+	if path == "" {
+		path = a.getenv("DUITKU_CONFIG")
+		explicit = path != ""
+	}
+	if path == "" {
+		home := a.getenv("HOME")
+		if home == "" {
+			return nil
+		}
+		path = filepath.Join(home, ".duitku", "profiles.json")
+	}
+
+	name := flags.name
+	if name == "" {
+		name = a.getenv("DUITKU_PROFILE")
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) && !explicit && name == "" {
+		return nil
+	}
+	return config.ApplyProfile(path, name)
+}
@@ -0,0 +1,567 @@
+package duitku
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrProfileNotFound is returned when the selected profile is not in the config file
+var ErrProfileNotFound = errors.New("profile not found")
+
+// ConfigError reports an invalid or missing configuration value
+type ConfigError struct {
+	// Field is the Config field, for example "MerchantCode"
+	Field string
+	// Source is where the value came from, for example "DUITKU_TIMEOUT" or
+	// "duitku.toml [production] timeout", empty when it was set in code
+	Source string
+	// Reason describes the problem
+	Reason string
+}
+
+// Error returns the error message
+func (e *ConfigError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("invalid config %s (%s): %s", e.Field, e.Source, e.Reason)
+	}
+	return fmt.Sprintf("invalid config %s: %s", e.Field, e.Reason)
+}
+
+// Validate checks that the required fields are set and the settings are in range
+func (c Config) Validate() error {
+	if c.MerchantCode == "" {
+		return &ConfigError{Field: "MerchantCode", Reason: "is required"}
+	}
+	if c.APIKey == "" {
+		return &ConfigError{Field: "APIKey", Reason: "is required"}
+	}
+	if c.Timeout < 0 {
+		return &ConfigError{Field: "Timeout", Reason: "must not be negative"}
+	}
+	if c.MaxRetries < 0 {
+		return &ConfigError{Field: "MaxRetries", Reason: "must not be negative"}
+	}
+	if c.RetryWait < 0 {
+		return &ConfigError{Field: "RetryWait", Reason: "must not be negative"}
+	}
+	if c.Environment != "" && !c.Environment.Valid() {
+		return &ConfigError{Field: "Environment", Reason: fmt.Sprintf("unknown environment %q, want sandbox or production", c.Environment)}
+	}
+	return c.BaseURLs.validate()
+}
+
+// configSetting is a setting that can be read from a file or the environment
+type configSetting struct {
+	field string
+	env   string
+	apply func(c *Config, value string) error
+}
+
+// configSettings maps normalized setting names (lower case, without "_" or
+// "-") to the Config fields they set
+var configSettings = map[string]configSetting{
+	"merchantcode": {field: "MerchantCode", env: "DUITKU_MERCHANT_CODE", apply: func(c *Config, v string) error {
+		c.MerchantCode = v
+		return nil
+	}},
+	"apikey": {field: "APIKey", env: "DUITKU_API_KEY", apply: func(c *Config, v string) error {
+		c.APIKey = v
+		return nil
+	}},
+	"apikeyfile": {field: "APIKey", env: "DUITKU_API_KEY_FILE", apply: func(c *Config, v string) error {
+		key, err := readSecretFile(v)
+		if err != nil {
+			return err
+		}
+		c.APIKey = key
+		return nil
+	}},
+	"sandbox": {field: "IsSandbox", env: "DUITKU_SANDBOX", apply: func(c *Config, v string) error {
+		sandbox, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.IsSandbox = sandbox
+		return nil
+	}},
+	"environment": {field: "Environment", env: "DUITKU_ENVIRONMENT", apply: func(c *Config, v string) error {
+		environment := Environment(strings.ToLower(v))
+		if !environment.Valid() {
+			return fmt.Errorf("unknown environment %q, want sandbox or production", v)
+		}
+		c.Environment = environment
+		return nil
+	}},
+	"paymentbaseurl": {field: "BaseURLs.Payment", env: "DUITKU_PAYMENT_BASE_URL", apply: func(c *Config, v string) error {
+		c.BaseURLs.Payment = v
+		return nil
+	}},
+	"popbaseurl": {field: "BaseURLs.POP", env: "DUITKU_POP_BASE_URL", apply: func(c *Config, v string) error {
+		c.BaseURLs.POP = v
+		return nil
+	}},
+	"disbursementbaseurl": {field: "BaseURLs.Disbursement", env: "DUITKU_DISBURSEMENT_BASE_URL", apply: func(c *Config, v string) error {
+		c.BaseURLs.Disbursement = v
+		return nil
+	}},
+	"snapbaseurl": {field: "BaseURLs.SNAP", env: "DUITKU_SNAP_BASE_URL", apply: func(c *Config, v string) error {
+		c.BaseURLs.SNAP = v
+		return nil
+	}},
+	"timeout": {field: "Timeout", env: "DUITKU_TIMEOUT", apply: func(c *Config, v string) error {
+		timeout, err := parseConfigDuration(v)
+		if err != nil {
+			return err
+		}
+		c.Timeout = timeout
+		return nil
+	}},
+	"maxretries": {field: "MaxRetries", env: "DUITKU_MAX_RETRIES", apply: func(c *Config, v string) error {
+		retries, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		c.MaxRetries = retries
+		return nil
+	}},
+	"retrywait": {field: "RetryWait", env: "DUITKU_RETRY_WAIT", apply: func(c *Config, v string) error {
+		wait, err := parseConfigDuration(v)
+		if err != nil {
+			return err
+		}
+		c.RetryWait = wait
+		return nil
+	}},
+	"logrequests": {field: "LogEveryRequestAndResponse", env: "DUITKU_LOG_REQUESTS", apply: func(c *Config, v string) error {
+		logRequests, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		c.LogEveryRequestAndResponse = logRequests
+		return nil
+	}},
+	"logoutput": {field: "Logger", env: "DUITKU_LOG_OUTPUT", apply: func(c *Config, v string) error {
+		var out io.Writer
+		switch strings.ToLower(v) {
+		case "stdout":
+			out = os.Stdout
+		case "stderr":
+			out = os.Stderr
+		case "none", "discard":
+			out = io.Discard
+		default:
+			return fmt.Errorf("unknown log output %q, want stdout, stderr or none", v)
+		}
+		c.Logger = log.New(out, "github.com/fatkulnurk/duitku-go: ", log.LstdFlags)
+		return nil
+	}},
+}
+
+// configEnvOrder is the order environment variables are applied in, so the
+// _FILE variant of a secret is overridden by the plain one
+var configEnvOrder = []string{
+	"merchantcode", "apikeyfile", "apikey", "sandbox", "environment",
+	"paymentbaseurl", "popbaseurl", "disbursementbaseurl", "snapbaseurl",
+	"timeout", "maxretries", "retrywait", "logrequests", "logoutput",
+}
+
+// parseConfigDuration parses a Go duration such as "30s", or a number of seconds
+func parseConfigDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return duration, nil
+}
+
+// readSecretFile reads a secret from a file, as mounted by Docker or Kubernetes
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %w", err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// normalizeConfigKey lets files use merchantCode, merchant_code or merchant-code
+func normalizeConfigKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "_", "")
+	return strings.ReplaceAll(key, "-", "")
+}
+
+// ConfigFromEnv builds a Config from environment variables:
+//
+//	DUITKU_MERCHANT_CODE  merchant code
+//	DUITKU_API_KEY        API key
+//	DUITKU_API_KEY_FILE   file containing the API key
+//	DUITKU_SANDBOX        true for the sandbox environment, default false
+//	DUITKU_ENVIRONMENT    sandbox or production, overrides DUITKU_SANDBOX
+//	DUITKU_*_BASE_URL     base URL override for the PAYMENT, POP,
+//	                      DISBURSEMENT or SNAP API
+//	DUITKU_TIMEOUT        HTTP timeout, for example 30s
+//	DUITKU_MAX_RETRIES    retries for failed requests
+//	DUITKU_RETRY_WAIT     wait before the first retry, for example 500ms
+//	DUITKU_LOG_REQUESTS   true to log every request and response
+//	DUITKU_LOG_OUTPUT     stdout, stderr or none
+//
+// When DUITKU_CONFIG names a config file, the profile in DUITKU_PROFILE (or
+// the file's default profile) is loaded first and the variables above
+// override it.
+func ConfigFromEnv() (Config, error) {
+	var config Config
+
+	if path := os.Getenv("DUITKU_CONFIG"); path != "" {
+		if err := config.ApplyProfile(path, os.Getenv("DUITKU_PROFILE")); err != nil {
+			return config, err
+		}
+	}
+	if err := config.ApplyEnv(os.Getenv); err != nil {
+		return config, err
+	}
+	if err := config.Validate(); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			switch configErr.Field {
+			case "MerchantCode":
+				configErr.Source = "DUITKU_MERCHANT_CODE"
+			case "APIKey":
+				configErr.Source = "DUITKU_API_KEY or DUITKU_API_KEY_FILE"
+			}
+		}
+		return config, err
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides the fields set in the environment, see ConfigFromEnv.
+// It does not validate the result.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	for _, key := range configEnvOrder {
+		setting, ok := configSettings[key]
+		if !ok {
+			continue
+		}
+		value := getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		if err := setting.apply(c, value); err != nil {
+			return &ConfigError{Field: setting.field, Source: setting.env, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// LoadConfig loads the default profile of a config file and validates it
+func LoadConfig(path string) (Config, error) {
+	return LoadConfigProfile(path, "")
+}
+
+// LoadConfigProfile loads a named profile of a config file and validates it.
+// An empty name selects the file's default profile.
+//
+// JSON files list the profiles under "profiles" and may name a default:
+//
+//	{
+//	  "default": "sandbox",
+//	  "profiles": {
+//	    "sandbox": {"merchantCode": "DXXXX", "apiKey": "...", "sandbox": true},
+//	    "production": {"merchantCode": "DXXXX", "apiKeyFile": "/run/secrets/duitku", "timeout": "10s", "maxRetries": 2}
+//	  }
+//	}
+//
+// Files ending in .toml use one section per profile:
+//
+//	default = "sandbox"
+//
+//	[sandbox]
+//	merchant_code = "DXXXX"
+//	api_key = "..."
+//	sandbox = true
+//
+//	[production]
+//	merchant_code = "DXXXX"
+//	api_key_file = "/run/secrets/duitku"
+//	timeout = "10s"
+//	max_retries = 2
+//	log_output = "stderr"
+//
+// A file without profiles is a single profile. Setting names may be written
+// in camelCase or snake_case.
+func LoadConfigProfile(path, profile string) (Config, error) {
+	var config Config
+	if err := config.ApplyProfile(path, profile); err != nil {
+		return config, err
+	}
+	if err := config.Validate(); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			configErr.Source = filepath.Base(path)
+		}
+		return config, err
+	}
+	return config, nil
+}
+
+// ApplyProfile overrides the fields set in a profile of a config file, see
+// LoadConfigProfile. It does not validate the result.
+func (c *Config) ApplyProfile(path, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+
+	var file *configFile
+	trimmed := bytes.TrimSpace(data)
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(trimmed, []byte("{")) {
+		file, err = parseJSONConfig(trimmed)
+	} else {
+		file, err = parseTOMLConfig(trimmed)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	name, settings, err := file.profile(profile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Apply in a fixed order so errors are reported consistently
+	keys := make([]string, 0, len(settings))
+	secrets := 0
+	for key := range settings {
+		keys = append(keys, key)
+		if normalized := normalizeConfigKey(key); normalized == "apikey" || normalized == "apikeyfile" {
+			secrets++
+		}
+	}
+	sort.Strings(keys)
+	if secrets > 1 {
+		return &ConfigError{Field: "APIKey", Source: configSource(path, name, "apiKey"), Reason: "set only one of apiKey and apiKeyFile"}
+	}
+
+	for _, key := range keys {
+		setting, ok := configSettings[normalizeConfigKey(key)]
+		source := configSource(path, name, key)
+		if !ok {
+			return &ConfigError{Field: key, Source: source, Reason: "unknown setting"}
+		}
+		if err := setting.apply(c, settings[key]); err != nil {
+			return &ConfigError{Field: setting.field, Source: source, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+func configSource(path, profile, key string) string {
+	if profile == "" {
+		return fmt.Sprintf("%s %s", filepath.Base(path), key)
+	}
+	return fmt.Sprintf("%s [%s] %s", filepath.Base(path), profile, key)
+}
+
+// configFile is a parsed config file. A file without profiles is stored as
+// the single unnamed profile.
+type configFile struct {
+	defaultProfile string
+	profiles       map[string]map[string]string
+}
+
+// profile returns the settings of the named or default profile
+func (f *configFile) profile(name string) (string, map[string]string, error) {
+	if name == "" {
+		name = f.defaultProfile
+	}
+	if name == "" {
+		if settings, ok := f.profiles[""]; ok {
+			return "", settings, nil
+		}
+		if len(f.profiles) == 1 {
+			for only, settings := range f.profiles {
+				return only, settings, nil
+			}
+		}
+		return "", nil, errors.New("no profile selected and the file has no default profile")
+	}
+
+	settings, ok := f.profiles[name]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return name, settings, nil
+}
+
+// parseJSONConfig parses a JSON config file
+func parseJSONConfig(data []byte) (*configFile, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	file := &configFile{profiles: make(map[string]map[string]string)}
+	profiles, hasProfiles := raw["profiles"]
+	if !hasProfiles {
+		settings, err := jsonSettings(raw)
+		if err != nil {
+			return nil, err
+		}
+		file.profiles[""] = settings
+		return file, nil
+	}
+
+	if name, ok := raw["default"]; ok {
+		defaultProfile, ok := name.(string)
+		if !ok {
+			return nil, errors.New("default must be a string")
+		}
+		file.defaultProfile = defaultProfile
+	}
+	profileMap, ok := profiles.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("profiles must be an object")
+	}
+	for name, value := range profileMap {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("profile %s must be an object", name)
+		}
+		settings, err := jsonSettings(object)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		file.profiles[name] = settings
+	}
+	return file, nil
+}
+
+// jsonSettings converts the values of a JSON profile to strings
+func jsonSettings(object map[string]interface{}) (map[string]string, error) {
+	settings := make(map[string]string, len(object))
+	for key, value := range object {
+		switch v := value.(type) {
+		case string:
+			settings[key] = v
+		case json.Number:
+			settings[key] = v.String()
+		case bool:
+			settings[key] = strconv.FormatBool(v)
+		case nil:
+		default:
+			return nil, fmt.Errorf("%s must be a string, number or boolean", key)
+		}
+	}
+	return settings, nil
+}
+
+// parseTOMLConfig parses the subset of TOML used by config files: comments,
+// [profile] or [profiles.profile] sections and key = value pairs with
+// string, number or boolean values
+func parseTOMLConfig(data []byte) (*configFile, error) {
+	file := &configFile{profiles: make(map[string]map[string]string)}
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section", lineNumber)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			section = strings.Trim(strings.TrimPrefix(section, "profiles."), `"`)
+			if section == "" {
+				return nil, fmt.Errorf("line %d: empty section name", lineNumber)
+			}
+			if _, ok := file.profiles[section]; !ok {
+				file.profiles[section] = make(map[string]string)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		value, err := parseTOMLValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		if section == "" && key == "default" {
+			file.defaultProfile = value
+			continue
+		}
+		if _, ok := file.profiles[section]; !ok {
+			file.profiles[section] = make(map[string]string)
+		}
+		file.profiles[section][key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// stripTOMLComment removes a # comment that is not inside a string
+func stripTOMLComment(line string) string {
+	inString := false
+	for i, r := range line {
+		switch r {
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// parseTOMLValue unquotes strings and returns other values as written
+func parseTOMLValue(value string) (string, error) {
+	if value == "" {
+		return "", errors.New("missing value")
+	}
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return unquoted, nil
+	}
+	if strings.HasPrefix(value, "'") {
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
@@ -0,0 +1,308 @@
+package duitku
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	secret := writeConfigFile(t, "api_key", "PRODKEY\n")
+	path := writeConfigFile(t, "duitku.json", `{
+		"default": "sandbox",
+		"profiles": {
+			"sandbox": {"merchantCode": "DSAND", "apiKey": "SANDKEY", "sandbox": true},
+			"production": {
+				"merchantCode": "DPROD",
+				"apiKeyFile": "`+secret+`",
+				"timeout": "10s",
+				"maxRetries": 2,
+				"retryWait": 250,
+				"logRequests": true,
+				"logOutput": "none"
+			}
+		}
+	}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.MerchantCode != "DSAND" || config.APIKey != "SANDKEY" || !config.IsSandbox {
+		t.Errorf("default profile = %+v", config)
+	}
+
+	config, err = LoadConfigProfile(path, "production")
+	if err != nil {
+		t.Fatalf("LoadConfigProfile() error = %v", err)
+	}
+	if config.MerchantCode != "DPROD" || config.APIKey != "PRODKEY" || config.IsSandbox {
+		t.Errorf("production profile = %+v", config)
+	}
+	if config.Timeout != 10*time.Second || config.MaxRetries != 2 || config.RetryWait != 250*time.Second {
+		t.Errorf("Timeout = %s, MaxRetries = %d, RetryWait = %s", config.Timeout, config.MaxRetries, config.RetryWait)
+	}
+	if !config.LogEveryRequestAndResponse || config.Logger == nil || config.Logger.Writer() != io.Discard {
+		t.Errorf("logging settings not applied: %+v", config)
+	}
+
+	if _, err := LoadConfigProfile(path, "staging"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("LoadConfigProfile() error = %v, want ErrProfileNotFound", err)
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	path := writeConfigFile(t, "duitku.toml", `
+# Duitku merchants
+default = "brand-a"
+
+[profiles.brand-a]
+merchant_code = "DBRANDA"  # brand A
+api_key = "KEY#A"
+sandbox = true
+
+[brand-b]
+merchant-code = 'DBRANDB'
+api_key = "KEYB"
+max_retries = 3
+timeout = "1m30s"
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.MerchantCode != "DBRANDA" || config.APIKey != "KEY#A" || !config.IsSandbox {
+		t.Errorf("default profile = %+v", config)
+	}
+
+	config, err = LoadConfigProfile(path, "brand-b")
+	if err != nil {
+		t.Fatalf("LoadConfigProfile() error = %v", err)
+	}
+	if config.MerchantCode != "DBRANDB" || config.MaxRetries != 3 || config.Timeout != 90*time.Second {
+		t.Errorf("brand-b profile = %+v", config)
+	}
+}
+
+func TestLoadConfigSingleProfile(t *testing.T) {
+	path := writeConfigFile(t, "duitku.conf", `
+merchantCode = "DXXXX"
+apiKey = "KEY"
+`)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.MerchantCode != "DXXXX" || config.APIKey != "KEY" {
+		t.Errorf("LoadConfig() = %+v", config)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		wantField string
+		wantError string
+	}{
+		{
+			name:      "Missing API Key",
+			file:      "duitku.json",
+			content:   `{"merchantCode": "DXXXX"}`,
+			wantField: "APIKey",
+			wantError: "invalid config APIKey (duitku.json): is required",
+		},
+		{
+			name:      "Missing Merchant Code",
+			file:      "duitku.toml",
+			content:   "[prod]\napi_key = \"KEY\"\n",
+			wantField: "MerchantCode",
+			wantError: "invalid config MerchantCode (duitku.toml): is required",
+		},
+		{
+			name:      "Invalid Duration",
+			file:      "duitku.toml",
+			content:   "merchant_code = \"DXXXX\"\napi_key = \"KEY\"\ntimeout = \"soon\"\n",
+			wantField: "Timeout",
+			wantError: `invalid config Timeout (duitku.toml timeout): invalid duration "soon"`,
+		},
+		{
+			name:      "Unknown Setting",
+			file:      "duitku.json",
+			content:   `{"profiles": {"prod": {"merchantCode": "DXXXX", "apiKey": "KEY", "sandbx": true}}}`,
+			wantField: "sandbx",
+			wantError: "invalid config sandbx (duitku.json [prod] sandbx): unknown setting",
+		},
+		{
+			name:      "Missing Secret File",
+			file:      "duitku.json",
+			content:   `{"merchantCode": "DXXXX", "apiKeyFile": "/nonexistent/duitku"}`,
+			wantField: "APIKey",
+		},
+		{
+			name:      "Both Key And Key File",
+			file:      "duitku.json",
+			content:   `{"merchantCode": "DXXXX", "apiKey": "KEY", "apiKeyFile": "/run/secrets/duitku"}`,
+			wantField: "APIKey",
+		},
+		{
+			name:      "Negative Retries",
+			file:      "duitku.json",
+			content:   `{"merchantCode": "DXXXX", "apiKey": "KEY", "maxRetries": -1}`,
+			wantField: "MaxRetries",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfigFile(t, tt.file, tt.content))
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("LoadConfig() error = %v, want a ConfigError", err)
+			}
+			if configErr.Field != tt.wantField {
+				t.Errorf("Field = %s, want %s", configErr.Field, tt.wantField)
+			}
+			if tt.wantError != "" && err.Error() != tt.wantError {
+				t.Errorf("error = %q, want %q", err.Error(), tt.wantError)
+			}
+		})
+	}
+
+	if _, err := LoadConfig(writeConfigFile(t, "duitku.toml", "[prod\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("LoadConfig() error = %v, want a parse error with the line number", err)
+	}
+	multi := writeConfigFile(t, "duitku.json", `{"profiles": {"a": {}, "b": {}}}`)
+	if _, err := LoadConfig(multi); err == nil || !strings.Contains(err.Error(), "no default profile") {
+		t.Errorf("LoadConfig() error = %v, want no default profile", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	path := writeConfigFile(t, "duitku.json", `{
+		"default": "sandbox",
+		"profiles": {
+			"sandbox": {"merchantCode": "DSAND", "apiKey": "SANDKEY", "sandbox": true},
+			"production": {"merchantCode": "DPROD", "apiKey": "PRODKEY"}
+		}
+	}`)
+	secret := writeConfigFile(t, "api_key", "FILEKEY")
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		want      Config
+		wantField string
+		wantError string
+	}{
+		{
+			name: "Variables Only",
+			env:  map[string]string{"DUITKU_MERCHANT_CODE": "DXXXX", "DUITKU_API_KEY": "KEY", "DUITKU_SANDBOX": "true"},
+			want: Config{MerchantCode: "DXXXX", APIKey: "KEY", IsSandbox: true},
+		},
+		{
+			name: "Key From File",
+			env:  map[string]string{"DUITKU_MERCHANT_CODE": "DXXXX", "DUITKU_API_KEY_FILE": secret, "DUITKU_TIMEOUT": "5"},
+			want: Config{MerchantCode: "DXXXX", APIKey: "FILEKEY", Timeout: 5 * time.Second},
+		},
+		{
+			name: "Profile With Overrides",
+			env:  map[string]string{"DUITKU_CONFIG": path, "DUITKU_PROFILE": "production", "DUITKU_MAX_RETRIES": "4"},
+			want: Config{MerchantCode: "DPROD", APIKey: "PRODKEY", MaxRetries: 4},
+		},
+		{
+			name: "Environment And Base URL",
+			env: map[string]string{
+				"DUITKU_MERCHANT_CODE": "DXXXX", "DUITKU_API_KEY": "KEY",
+				"DUITKU_ENVIRONMENT": "Sandbox", "DUITKU_PAYMENT_BASE_URL": "http://localhost:9000/api",
+				"DUITKU_SNAP_BASE_URL": "http://localhost:9000/snap",
+			},
+			want: Config{MerchantCode: "DXXXX", APIKey: "KEY", Environment: EnvironmentSandbox,
+				BaseURLs: BaseURLs{Payment: "http://localhost:9000/api", SNAP: "http://localhost:9000/snap"}},
+		},
+		{
+			name:      "Invalid Base URL",
+			env:       map[string]string{"DUITKU_MERCHANT_CODE": "DXXXX", "DUITKU_API_KEY": "KEY", "DUITKU_POP_BASE_URL": "localhost:9000"},
+			wantField: "BaseURLs.POP",
+			wantError: `invalid config BaseURLs.POP: invalid URL "localhost:9000"`,
+		},
+		{
+			name:      "Missing Merchant Code",
+			env:       map[string]string{"DUITKU_API_KEY": "KEY"},
+			wantField: "MerchantCode",
+			wantError: "invalid config MerchantCode (DUITKU_MERCHANT_CODE): is required",
+		},
+		{
+			name:      "Invalid Boolean",
+			env:       map[string]string{"DUITKU_MERCHANT_CODE": "DXXXX", "DUITKU_API_KEY": "KEY", "DUITKU_SANDBOX": "maybe"},
+			wantField: "IsSandbox",
+			wantError: `invalid config IsSandbox (DUITKU_SANDBOX): invalid boolean "maybe"`,
+		},
+	}
+
+	names := []string{
+		"DUITKU_CONFIG", "DUITKU_PROFILE", "DUITKU_MERCHANT_CODE", "DUITKU_API_KEY", "DUITKU_API_KEY_FILE",
+		"DUITKU_SANDBOX", "DUITKU_ENVIRONMENT", "DUITKU_PAYMENT_BASE_URL", "DUITKU_POP_BASE_URL",
+		"DUITKU_DISBURSEMENT_BASE_URL", "DUITKU_SNAP_BASE_URL", "DUITKU_TIMEOUT", "DUITKU_MAX_RETRIES", "DUITKU_RETRY_WAIT", "DUITKU_LOG_REQUESTS", "DUITKU_LOG_OUTPUT",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range names {
+				t.Setenv(name, tt.env[name])
+			}
+
+			config, err := ConfigFromEnv()
+			if tt.wantField != "" {
+				var configErr *ConfigError
+				if !errors.As(err, &configErr) || configErr.Field != tt.wantField {
+					t.Fatalf("ConfigFromEnv() error = %v, want a ConfigError for %s", err, tt.wantField)
+				}
+				if err.Error() != tt.wantError {
+					t.Errorf("error = %q, want %q", err.Error(), tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfigFromEnv() error = %v", err)
+			}
+			if config.MerchantCode != tt.want.MerchantCode || config.APIKey != tt.want.APIKey ||
+				config.IsSandbox != tt.want.IsSandbox || config.Timeout != tt.want.Timeout ||
+				config.MaxRetries != tt.want.MaxRetries || config.Environment != tt.want.Environment ||
+				config.BaseURLs != tt.want.BaseURLs {
+				t.Errorf("ConfigFromEnv() = %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvUnknownKey(t *testing.T) {
+	defer func(order []string) { configEnvOrder = order }(configEnvOrder)
+	configEnvOrder = append([]string{"unknown"}, configEnvOrder...)
+
+	var config Config
+	err := config.ApplyEnv(func(name string) string {
+		if name == "" {
+			return "value"
+		}
+		return ""
+	})
+	if err != nil {
+		t.Errorf("ApplyEnv() error = %v", err)
+	}
+}
@@ -74,3 +74,11 @@ const (
 	FrequencyMonthly = 3 // Monthly
 	FrequencyYearly  = 4 // Yearly
 )
+
+// Subscription status values
+const (
+	SubscriptionStatusActive    = "ACTIVE"    // Charging on schedule
+	SubscriptionStatusPaused    = "PAUSED"    // Temporarily not charging
+	SubscriptionStatusCancelled = "CANCELLED" // Stopped by the merchant
+	SubscriptionStatusCompleted = "COMPLETED" // All cycles charged
+)
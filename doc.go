@@ -14,6 +14,42 @@ Initialize a client with your merchant code and API key:
 		IsSandbox:    true, // Set to false for production
 	})
 
+# Loading Configuration
+
+ConfigFromEnv reads the merchant code, API key and client settings from
+DUITKU_* environment variables, and LoadConfig reads them from a JSON or
+TOML file with named profiles. The API key can come from a secret file, and
+missing or invalid values are reported as a ConfigError naming the field:
+
+	config, err := duitku.LoadConfigProfile("/etc/shop/duitku.toml", "production")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := duitku.NewClient(config)
+
+Timeout, MaxRetries and RetryWait control the HTTP client; idempotent
+requests, such as status checks, are retried after network errors and 502,
+503 or 504 responses. Creating a transaction is never retried: when it fails
+without a definite answer, CreateTransaction checks the order's status and
+returns a TransactionExistsError if the transaction was created after all.
+
+# Environments and Base URLs
+
+Environment selects the sandbox or production hosts of every Duitku API
+(payment, POP, disbursement and SNAP). BaseURLs overrides individual hosts,
+for example to point the client at a local stand-in or an egress proxy:
+
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode: "YOUR_MERCHANT_CODE",
+		APIKey:       "YOUR_API_KEY",
+		Environment:  duitku.EnvironmentSandbox,
+		BaseURLs:     duitku.BaseURLs{Payment: "http://localhost:9000/webapi/api"},
+	})
+
+The SNAP (Standar Nasional Open API Pembayaran) endpoints use their own
+token and signature scheme and live in the snap sub-package, which reads
+its host from the same Environment and BaseURLs.
+
 # Getting Available Payment Methods
 
 Get available payment methods for a specific amount:
@@ -108,6 +144,30 @@ Create a transaction with additional details like customer information and item
 		},
 	}
 
+# Letting the Customer Choose the Payment Method
+
+Leave PaymentMethod empty and use CreateRedirectTransaction to create the
+invoice with Duitku POP and send the customer to the hosted page, where they
+pick the payment method:
+
+	result, err := client.CreateRedirectTransaction(duitku.TransactionRequest{
+		PaymentAmount:   40000,
+		MerchantOrderID: "ORDER123",
+		ProductDetails:  "Test Product",
+		Email:           "customer@example.com",
+		CallbackURL:     "https://example.com/callback",
+		ReturnURL:       "https://example.com/return",
+		ExpiryPeriod:    60,
+	})
+	if err != nil {
+		log.Fatalf("Error creating transaction: %v", err)
+	}
+
+	http.Redirect(w, r, result.PaymentURL, http.StatusSeeOther)
+
+The chosen method is only known once the callback arrives, in
+CallbackData.PaymentCode.
+
 # Creating a Subscription Transaction
 
 Create a recurring subscription transaction (only supported for credit card payments):
@@ -137,6 +197,56 @@ Create a recurring subscription transaction (only supported for credit card paym
 		},
 	}
 
+# Rendering QRIS Codes
+
+For QRIS payment methods the response carries a QR string that can be
+rendered directly, without calling an external service:
+
+	result, err := client.CreateTransaction(transaction)
+	if err != nil {
+		log.Fatalf("Error creating transaction: %v", err)
+	}
+
+	png, err := result.QRCodePNG(&duitku.QRCodeOptions{Size: 320})
+	if err != nil {
+		log.Fatalf("Error rendering QR code: %v", err)
+	}
+
+QRCodeSVG renders the same code as an SVG document. Passing nil uses the
+default size, quiet zone and error correction level.
+
+# Virtual Account Instructions
+
+Virtual account numbers can be grouped the way the bank prints them and
+turned into step by step payment instructions in Indonesian or English:
+
+	formatted := duitku.FormatVANumber(duitku.PaymentMethodBCA, result.VANumber)
+
+	instructions, err := result.PaymentInstructions(duitku.PaymentMethodBCA, duitku.LanguageIndonesian)
+	if err != nil {
+		log.Fatalf("Error building instructions: %v", err)
+	}
+
+	fmt.Print(instructions.Text())
+	html, _ := instructions.HTML()
+
+# Managing Subscriptions
+
+The response of a subscription transaction carries a SubscriptionID that can
+be used to manage the subscription afterwards:
+
+	subscription, err := client.PauseSubscription(result.SubscriptionID)
+	if err != nil {
+		log.Fatalf("Error pausing subscription: %v", err)
+	}
+
+	cycles, err := client.GetSubscriptionCycles(subscription.SubscriptionID)
+
+ListSubscriptions, GetSubscription, ResumeSubscription and CancelSubscription
+are also available. Recurring charges arrive as regular callbacks with a
+subscriptionId; use CallbackData.SubscriptionCharge or
+Client.ParseSubscriptionCharge to read them as a SubscriptionChargeEvent.
+
 # Checking Transaction Status
 
 Check the status of a transaction:
@@ -167,6 +277,249 @@ Handle callbacks from Duitku in your HTTP handler:
 		})
 	})
 
+To route callbacks by outcome or payment method, mount a CallbackRouter:
+
+	router := client.NewCallbackRouter().
+		Use(duitku.RecoveryMiddleware(), duitku.TimeoutMiddleware(10*time.Second)).
+		OnSuccess(markOrderPaid).
+		OnFailed(releaseStock).
+		OnSubscriptionCharge(func(event *duitku.SubscriptionChargeEvent) error {
+			return extendSubscription(event.SubscriptionID, event.CycleNumber)
+		})
+
+	http.Handle("/callback", router)
+
+ParseCallback and HandleCallback accept both form encoded bodies and
+application/json bodies, as posted by the POP and SNAP products.
+
+When rotating the API key, keep the old key in PreviousAPIKeys until orders
+created with it have completed. Requests are signed with APIKey, callbacks
+are accepted with any key that has not expired, and CallbackData.SignedWith
+reports which one matched:
+
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode: "YOUR_MERCHANT_CODE",
+		APIKey:       "YOUR_NEW_API_KEY",
+		PreviousAPIKeys: []duitku.PreviousAPIKey{
+			{ID: "2024", Key: "YOUR_OLD_API_KEY", ExpiresAt: time.Now().Add(7 * 24 * time.Hour)},
+		},
+	})
+
+To accept callbacks only from Duitku's published addresses, set an
+allowlist. Requests from other sources are rejected with 403 before the
+signature is checked. Behind a load balancer, list it as a trusted proxy so
+the client address is read from X-Forwarded-For:
+
+	allowlist, err := duitku.NewCallbackAllowlist(false, []string{"10.0.0.0/8"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode:      "YOUR_MERCHANT_CODE",
+		APIKey:            "YOUR_API_KEY",
+		CallbackAllowlist: allowlist,
+	})
+
+When the handler does slow work, process callbacks asynchronously so Duitku
+gets its response before it times out. The callback is verified and stored
+in a queue, then handled by a pool of workers with retries; callbacks that
+fail every attempt go to a dead-letter store:
+
+	queue, err := duitku.OpenFileQueue("/var/lib/shop/callbacks.wal")
+	if err != nil {
+		log.Fatal(err)
+	}
+	processor := client.NewAsyncCallbackProcessor(router.Handler(), duitku.AsyncCallbackOptions{
+		Queue:      queue,
+		Workers:    8,
+		DeadLetter: duitku.NewFileDeadLetterStore("/var/lib/shop/callbacks.dead"),
+	})
+	processor.Start()
+	defer processor.Stop()
+
+	http.Handle("/callback", processor)
+
+Handlers must be idempotent, because a callback may be handled again after
+a restart.
+
+# Access Tokens
+
+Token based APIs take a TokenSource. TokenManager caches tokens per merchant
+code, refreshes them in the background ahead of expiry and shares one
+request between concurrent callers. A request rejected with 401 invalidates
+the token and is retried once with a new one:
+
+	tokens := duitku.NewTokenManager(func(merchantCode string) (*duitku.Token, error) {
+		return requestToken(merchantCode)
+	}, duitku.TokenManagerOptions{AutoRefresh: true})
+	defer tokens.Stop()
+
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode: "YOUR_MERCHANT_CODE",
+		APIKey:       "YOUR_API_KEY",
+		TokenSource:  tokens,
+	})
+
+# Multiple Merchant Codes
+
+A MerchantRegistry holds a client per merchant code. Outgoing calls are
+routed by merchant code, and a single callback endpoint verifies each
+callback with the credentials of the merchant code it carries:
+
+	registry, err := duitku.NewMerchantRegistry(
+		duitku.Config{MerchantCode: "DBRAND1", APIKey: "BRAND1_API_KEY"},
+		duitku.Config{MerchantCode: "DBRAND2", APIKey: "BRAND2_API_KEY"},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := registry.CreateTransaction("DBRAND2", transaction)
+
+	http.Handle("/callback", registry.NewCallbackRouter().OnSuccess(markOrderPaid))
+
+# Circuit Breaker
+
+Config.CircuitBreaker fails requests fast while Duitku is unavailable,
+instead of waiting for the HTTP timeout. Each endpoint opens after
+consecutive network errors or 5xx responses and then fails with
+ErrCircuitOpen until OpenTimeout passes, when probe requests decide whether
+it closes again. TokenSource errors never reach Duitku and are not counted.
+Rejected requests are reported to Metrics with the StatusCircuitOpen status
+label and to Tracer as failed spans. OnStateChange reports every change:
+
+	breaker := duitku.NewCircuitBreaker(duitku.CircuitBreakerOptions{
+		OnStateChange: func(endpoint string, from, to duitku.CircuitState) {
+			checkout.SetDuitkuAvailable(to != duitku.CircuitOpen)
+		},
+	})
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode:   "YOUR_MERCHANT_CODE",
+		APIKey:         "YOUR_API_KEY",
+		CircuitBreaker: breaker,
+	})
+
+	_, err := client.CreateTransaction(request)
+	if errors.Is(err, duitku.ErrCircuitOpen) {
+		// Offer another payment option
+	}
+
+# Tracing
+
+Config.Tracer starts a span around every API request and callback, with
+attributes such as the merchant order ID, reference and payment method.
+Set TransactionRequest.CorrelationID to the ID of the current trace and the
+client sends it to Duitku as "cid:<id>" in AdditionalParam, or in
+MerchantUserInfo when Config.CorrelationField says so. The field is only
+written when the request leaves it empty, so the merchant's own data there is
+never changed. Duitku echoes it back in the callback, where
+CallbackData.CorrelationID and the callback span carry it, so the callback
+can be stitched back to the trace that created the transaction:
+
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode: "YOUR_MERCHANT_CODE",
+		APIKey:       "YOUR_API_KEY",
+		Tracer:       tracer,
+	})
+
+	resp, err := client.CreateTransaction(duitku.TransactionRequest{
+		MerchantOrderID: "ORDER-123",
+		PaymentAmount:   40000,
+		PaymentMethod:   "VC",
+		CorrelationID:   traceID,
+	})
+
+# Metrics
+
+Config.Metrics receives a counter and a latency histogram for every API
+request, labelled by endpoint, HTTP status, response code and payment
+method, and for every callback, labelled by outcome, result code and
+payment method. PrometheusMetrics serves them in the Prometheus text format:
+
+	metrics := duitku.NewPrometheusMetrics()
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode: "YOUR_MERCHANT_CODE",
+		APIKey:       "YOUR_API_KEY",
+		Metrics:      metrics,
+	})
+	http.Handle("/metrics", metrics)
+
+# Transaction Audit Trail
+
+Config.TransactionStore receives a TransactionRecord for every
+CreateTransaction and CheckTransaction call, failed or not, and for every
+verified callback accepted by its handler, giving one audit trail per
+merchant order ID. ParseCallback on its own records nothing. A store
+error does not fail the call; it is passed to Config.OnStoreError. The
+sqlstore sub-package keeps the records in a database/sql database:
+
+	store, err := sqlstore.New(db, sqlstore.Options{Placeholder: sqlstore.PlaceholderDollar})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := store.CreateTable(); err != nil {
+		log.Fatal(err)
+	}
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode:     "YOUR_MERCHANT_CODE",
+		APIKey:           "YOUR_API_KEY",
+		TransactionStore: store,
+	})
+
+	records, err := store.Records("ORDER-123")
+
+# Ledger
+
+The ledger sub-package keeps a double-entry record of every money movement:
+orders owed by customers, payments collected by Duitku, settlements net of
+fees, and disbursements. Each transaction must balance, and Verify checks
+the whole ledger:
+
+	l := ledger.New(ledger.NewMemoryStore(), ledger.Options{})
+
+	resp, err := l.CreateTransaction(client, request)
+
+	router := client.NewCallbackRouter().
+		Use(l.CallbackMiddleware()).
+		OnSuccess(markOrderPaid)
+
+	if err := l.Verify(); err != nil {
+		log.Printf("ledger is inconsistent: %v", err)
+	}
+
+# Reconciling Settlement Reports
+
+The reconcile sub-package parses the settlement and transaction reports
+exported from the Duitku dashboard as CSV and compares them with the
+merchant's orders, listing missing orders, rows without an order, and rows
+whose amount or fee differs:
+
+	rows, err := reconcile.ParseReport(f, reconcile.ParseOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	result := reconcile.Reconcile(rows, orders, reconcile.Options{})
+	if !result.OK() {
+		log.Printf("%d missing, %d extra", len(result.Missing), len(result.Extra))
+	}
+
+# Recording and Replaying Traffic
+
+The cassette sub-package captures what the client sends and receives, with
+signatures and customer details redacted, and replays it in tests:
+
+	recorder, err := cassette.New("testdata/checkout.json", cassette.Options{
+		Mode: cassette.ModeRecord,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode: "YOUR_MERCHANT_CODE",
+		APIKey:       "YOUR_API_KEY",
+		HTTPClient:   recorder.Client(),
+	})
+
 # Payment Methods
 
 The package provides constants for all payment methods supported by Duitku:
@@ -246,5 +599,12 @@ For credit card subscription transactions, the package provides constants for fr
 	duitku.FrequencyWeekly  // Weekly (2)
 	duitku.FrequencyMonthly // Monthly (3)
 	duitku.FrequencyYearly  // Yearly (4)
+
+# Subscription Status Values
+
+	duitku.SubscriptionStatusActive    // ACTIVE
+	duitku.SubscriptionStatusPaused    // PAUSED
+	duitku.SubscriptionStatusCancelled // CANCELLED
+	duitku.SubscriptionStatusCompleted // COMPLETED
 */
 package duitku
@@ -0,0 +1,131 @@
+package duitku
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Environment selects the Duitku hosts a client talks to
+type Environment string
+
+const (
+	// EnvironmentSandbox is the Duitku test environment
+	EnvironmentSandbox Environment = "sandbox"
+	// EnvironmentProduction is the Duitku live environment
+	EnvironmentProduction Environment = "production"
+)
+
+// Base URLs of the Duitku APIs that are not served by the payment host
+const (
+	SandboxPOPBaseURL             = "https://api-sandbox.duitku.com/api/merchant"
+	ProductionPOPBaseURL          = "https://api-prod.duitku.com/api/merchant"
+	SandboxDisbursementBaseURL    = "https://sandbox.duitku.com/webapi/api/disbursement"
+	ProductionDisbursementBaseURL = "https://passport.duitku.com/webapi/api/disbursement"
+	SandboxSNAPBaseURL            = "https://snapdev.duitku.com"
+	ProductionSNAPBaseURL         = "https://snap.duitku.com"
+)
+
+// BaseURLs holds the base URL of each Duitku API. Endpoint paths are appended
+// to them, so they must not end with a slash.
+type BaseURLs struct {
+	// Payment is the payment API: transactions, payment methods and subscriptions
+	Payment string
+	// POP is the Duitku POP API, used by CreateRedirectTransaction
+	POP string
+	// Disbursement is the disbursement API
+	Disbursement string
+	// SNAP is the Bank Indonesia SNAP API, used by the snap sub-package
+	SNAP string
+}
+
+// BaseURLs returns the default base URLs of the environment
+func (e Environment) BaseURLs() BaseURLs {
+	if e == EnvironmentSandbox {
+		return BaseURLs{
+			Payment:      SandboxBaseURL,
+			POP:          SandboxPOPBaseURL,
+			Disbursement: SandboxDisbursementBaseURL,
+			SNAP:         SandboxSNAPBaseURL,
+		}
+	}
+	return BaseURLs{
+		Payment:      ProductionBaseURL,
+		POP:          ProductionPOPBaseURL,
+		Disbursement: ProductionDisbursementBaseURL,
+		SNAP:         ProductionSNAPBaseURL,
+	}
+}
+
+// Valid reports whether e is a known environment
+func (e Environment) Valid() bool {
+	return e == EnvironmentSandbox || e == EnvironmentProduction
+}
+
+// merge returns u with the empty fields taken from defaults
+func (u BaseURLs) merge(defaults BaseURLs) BaseURLs {
+	if u.Payment == "" {
+		u.Payment = defaults.Payment
+	}
+	if u.POP == "" {
+		u.POP = defaults.POP
+	}
+	if u.Disbursement == "" {
+		u.Disbursement = defaults.Disbursement
+	}
+	if u.SNAP == "" {
+		u.SNAP = defaults.SNAP
+	}
+	return u
+}
+
+// validate checks that the set URLs are absolute http(s) URLs
+func (u BaseURLs) validate() error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"BaseURLs.Payment", u.Payment},
+		{"BaseURLs.POP", u.POP},
+		{"BaseURLs.Disbursement", u.Disbursement},
+		{"BaseURLs.SNAP", u.SNAP},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		parsed, err := url.Parse(field.value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return &ConfigError{Field: field.name, Reason: fmt.Sprintf("invalid URL %q", field.value)}
+		}
+	}
+	return nil
+}
+
+// GetEnvironment returns Config.Environment, or the environment selected by
+// IsSandbox when it is not set
+func (c Config) GetEnvironment() Environment {
+	if c.Environment != "" {
+		return c.Environment
+	}
+	if c.IsSandbox {
+		return EnvironmentSandbox
+	}
+	return EnvironmentProduction
+}
+
+// ResolveBaseURLs returns the base URLs the config points at: the defaults of
+// its environment, overridden by the fields set in Config.BaseURLs
+func (c Config) ResolveBaseURLs() BaseURLs {
+	return c.BaseURLs.merge(c.GetEnvironment().BaseURLs())
+}
+
+// BaseURLs returns the base URLs the client sends requests to
+func (c *Client) BaseURLs() BaseURLs {
+	return c.baseURLs
+}
+
+// joinURL appends the endpoint to the base URL
+func joinURL(baseURL, endpoint string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(endpoint, "/")
+}
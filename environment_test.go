@@ -0,0 +1,105 @@
+package duitku
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfigResolveBaseURLs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   BaseURLs
+	}{
+		{
+			name:   "Sandbox Flag",
+			config: Config{IsSandbox: true},
+			want:   EnvironmentSandbox.BaseURLs(),
+		},
+		{
+			name:   "Production Default",
+			config: Config{},
+			want:   EnvironmentProduction.BaseURLs(),
+		},
+		{
+			name:   "Environment Overrides Flag",
+			config: Config{IsSandbox: true, Environment: EnvironmentProduction},
+			want:   EnvironmentProduction.BaseURLs(),
+		},
+		{
+			name: "Partial Override",
+			config: Config{
+				Environment: EnvironmentSandbox,
+				BaseURLs:    BaseURLs{POP: "http://localhost:9001/pop"},
+			},
+			want: BaseURLs{
+				Payment:      SandboxBaseURL,
+				POP:          "http://localhost:9001/pop",
+				Disbursement: SandboxDisbursementBaseURL,
+				SNAP:         SandboxSNAPBaseURL,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.ResolveBaseURLs(); got != tt.want {
+				t.Errorf("ResolveBaseURLs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironmentBaseURLs(t *testing.T) {
+	if got := EnvironmentSandbox.BaseURLs().Payment; got != SandboxBaseURL {
+		t.Errorf("sandbox Payment = %s, want %s", got, SandboxBaseURL)
+	}
+	if got := EnvironmentProduction.BaseURLs().Payment; got != ProductionBaseURL {
+		t.Errorf("production Payment = %s, want %s", got, ProductionBaseURL)
+	}
+	if Environment("staging").Valid() {
+		t.Error("Valid() = true for an unknown environment")
+	}
+}
+
+func TestNewClientBaseURLOverride(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"merchantOrderId":"ORDER123","statusCode":"00"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "KEY",
+		Environment:  EnvironmentSandbox,
+		BaseURLs:     BaseURLs{Payment: server.URL + "/stand-in/"},
+	})
+
+	if got := client.BaseURLs().POP; got != SandboxPOPBaseURL {
+		t.Errorf("POP = %s, want %s", got, SandboxPOPBaseURL)
+	}
+	if _, err := client.CheckTransaction("ORDER123"); err != nil {
+		t.Fatalf("CheckTransaction() error = %v", err)
+	}
+	if path != "/stand-in/merchant/transactionStatus" {
+		t.Errorf("path = %s, want /stand-in/merchant/transactionStatus", path)
+	}
+}
+
+func TestValidateBaseURLs(t *testing.T) {
+	config := Config{MerchantCode: "DXXXX", APIKey: "KEY", BaseURLs: BaseURLs{POP: "ftp://example.com"}}
+	err := config.Validate()
+	configErr, ok := err.(*ConfigError)
+	if !ok || configErr.Field != "BaseURLs.POP" {
+		t.Errorf("Validate() error = %v, want a ConfigError for BaseURLs.POP", err)
+	}
+
+	config.BaseURLs.POP = "https://pop.example.com"
+	config.Environment = "staging"
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() error = nil for an unknown environment")
+	}
+}
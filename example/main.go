@@ -12,21 +12,20 @@ import (
 )
 
 func main() {
-	// Get merchant code and API key from environment variables
-	merchantCode := os.Getenv("DUITKU_MERCHANT_CODE")
-	apiKey := os.Getenv("DUITKU_API_KEY")
+	// Read merchant code, API key and settings from DUITKU_* environment variables
+	config, err := duitku.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading Duitku config: %v", err)
+	}
 
-	if merchantCode == "" || apiKey == "" {
-		log.Fatal("DUITKU_MERCHANT_CODE and DUITKU_API_KEY environment variables must be set")
+	// Use sandbox environment for testing unless DUITKU_SANDBOX says otherwise
+	if os.Getenv("DUITKU_SANDBOX") == "" {
+		config.IsSandbox = true
 	}
+	config.LogEveryRequestAndResponse = true
 
 	// Initialize Duitku client
-	client := duitku.NewClient(duitku.Config{
-		MerchantCode:               merchantCode,
-		APIKey:                     apiKey,
-		IsSandbox:                  true, // Use sandbox environment for testing
-		LogEveryRequestAndResponse: true,
-	})
+	client := duitku.NewClient(config)
 
 	// Set up HTTP server to handle routes
 	http.HandleFunc("/", homeHandler)
@@ -0,0 +1,159 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrCallbackSourceNotAllowed is returned when a callback comes from an address outside the allowlist
+var ErrCallbackSourceNotAllowed = errors.New("callback source not allowed")
+
+// SandboxCallbackIPs are the addresses Duitku sends sandbox callbacks from.
+// Duitku announces changes to these lists in its documentation; pass extra
+// addresses to NewCallbackAllowlist if they change before this package does.
+var SandboxCallbackIPs = []string{
+	"182.23.85.11",
+	"182.23.85.12",
+	"103.177.101.187",
+	"103.177.101.188",
+}
+
+// ProductionCallbackIPs are the addresses Duitku sends production callbacks from
+var ProductionCallbackIPs = []string{
+	"182.23.85.8",
+	"182.23.85.9",
+	"182.23.85.10",
+	"182.23.85.13",
+	"182.23.85.14",
+	"103.177.101.184",
+	"103.177.101.185",
+	"103.177.101.186",
+	"103.177.101.189",
+	"103.177.101.190",
+}
+
+// CallbackIPs returns the published Duitku callback addresses for the environment
+func CallbackIPs(isSandbox bool) []string {
+	if isSandbox {
+		return append([]string(nil), SandboxCallbackIPs...)
+	}
+	return append([]string(nil), ProductionCallbackIPs...)
+}
+
+// IPAllowlist restricts the addresses callbacks are accepted from
+type IPAllowlist struct {
+	allowed        []*net.IPNet
+	trustedProxies []*net.IPNet
+}
+
+// NewIPAllowlist creates an allowlist from IP addresses or CIDR ranges.
+//
+// When the request comes from one of the trusted proxies, the client address
+// is taken from X-Forwarded-For: the entries are read from right to left and
+// the first address that is not a trusted proxy is checked. Without trusted
+// proxies X-Forwarded-For is ignored, since any client can send it.
+func NewIPAllowlist(allowed, trustedProxies []string) (*IPAllowlist, error) {
+	allowedNets, err := parseNetworks(allowed)
+	if err != nil {
+		return nil, err
+	}
+	proxyNets, err := parseNetworks(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &IPAllowlist{allowed: allowedNets, trustedProxies: proxyNets}, nil
+}
+
+// NewCallbackAllowlist creates an allowlist of Duitku's published callback
+// addresses for the environment, plus any extra addresses
+func NewCallbackAllowlist(isSandbox bool, trustedProxies []string, extra ...string) (*IPAllowlist, error) {
+	return NewIPAllowlist(append(CallbackIPs(isSandbox), extra...), trustedProxies)
+}
+
+// parseNetworks parses IP addresses and CIDR ranges
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "/") {
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+			}
+			networks = append(networks, network)
+			continue
+		}
+
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address the request originates from, following
+// X-Forwarded-For through trusted proxies
+func (a *IPAllowlist) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(a.trustedProxies, ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			// A malformed entry cannot be trusted, nor anything left of it
+			return nil
+		}
+		ip = hop
+		if !containsIP(a.trustedProxies, hop) {
+			return hop
+		}
+	}
+	return ip
+}
+
+// Allowed reports whether the request comes from an allowed address
+func (a *IPAllowlist) Allowed(r *http.Request) bool {
+	ip := a.ClientIP(r)
+	return ip != nil && containsIP(a.allowed, ip)
+}
+
+// VerifyCallbackSource checks the request against Config.CallbackAllowlist.
+// Every source is allowed when no allowlist is configured.
+func (c *Client) VerifyCallbackSource(r *http.Request) error {
+	allowlist := c.config.CallbackAllowlist
+	if allowlist == nil || allowlist.Allowed(r) {
+		return nil
+	}
+	if ip := allowlist.ClientIP(r); ip != nil {
+		return fmt.Errorf("%w: %s", ErrCallbackSourceNotAllowed, ip)
+	}
+	return ErrCallbackSourceNotAllowed
+}
@@ -0,0 +1,188 @@
+package duitku
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewIPAllowlistInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		proxies []string
+	}{
+		{name: "Invalid IP", allowed: []string{"182.23.85.256"}},
+		{name: "Invalid CIDR", allowed: []string{"10.0.0.0/33"}},
+		{name: "Invalid Proxy", allowed: []string{"10.0.0.1"}, proxies: []string{"proxy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewIPAllowlist(tt.allowed, tt.proxies); err == nil {
+				t.Error("NewIPAllowlist() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestIPAllowlistClientIP(t *testing.T) {
+	allowlist, err := NewIPAllowlist([]string{"182.23.85.0/24", "2001:db8::1"}, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewIPAllowlist() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantIP       string
+		wantAllowed  bool
+	}{
+		{name: "Direct Allowed", remoteAddr: "182.23.85.11:41000", wantIP: "182.23.85.11", wantAllowed: true},
+		{name: "Direct Disallowed", remoteAddr: "203.0.113.5:41000", wantIP: "203.0.113.5"},
+		{name: "Direct IPv6", remoteAddr: "[2001:db8::1]:41000", wantIP: "2001:db8::1", wantAllowed: true},
+		{
+			name:         "Spoofed Header From Untrusted Client",
+			remoteAddr:   "203.0.113.5:41000",
+			forwardedFor: []string{"182.23.85.11"},
+			wantIP:       "203.0.113.5",
+		},
+		{
+			name:         "Through Trusted Proxy",
+			remoteAddr:   "10.0.0.2:41000",
+			forwardedFor: []string{"182.23.85.11"},
+			wantIP:       "182.23.85.11",
+			wantAllowed:  true,
+		},
+		{
+			name:         "Spoofed Entry Left Of Real Client",
+			remoteAddr:   "10.0.0.2:41000",
+			forwardedFor: []string{"182.23.85.11, 203.0.113.5"},
+			wantIP:       "203.0.113.5",
+		},
+		{
+			name:         "Chain Of Trusted Proxies",
+			remoteAddr:   "10.0.0.2:41000",
+			forwardedFor: []string{"182.23.85.12", "10.1.1.1, 10.0.0.3"},
+			wantIP:       "182.23.85.12",
+			wantAllowed:  true,
+		},
+		{name: "Trusted Proxy Without Header", remoteAddr: "10.0.0.2:41000", wantIP: "10.0.0.2"},
+		{
+			name:         "Malformed Header",
+			remoteAddr:   "10.0.0.2:41000",
+			forwardedFor: []string{"182.23.85.11, unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/callback", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			ip := allowlist.ClientIP(req)
+			if tt.wantIP == "" {
+				if ip != nil {
+					t.Errorf("ClientIP() = %s, want nil", ip)
+				}
+			} else if ip.String() != tt.wantIP {
+				t.Errorf("ClientIP() = %s, want %s", ip, tt.wantIP)
+			}
+			if got := allowlist.Allowed(req); got != tt.wantAllowed {
+				t.Errorf("Allowed() = %v, want %v", got, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestNewCallbackAllowlist(t *testing.T) {
+	sandbox, err := NewCallbackAllowlist(true, nil)
+	if err != nil {
+		t.Fatalf("NewCallbackAllowlist() error = %v", err)
+	}
+	production, err := NewCallbackAllowlist(false, nil, "192.0.2.0/24")
+	if err != nil {
+		t.Fatalf("NewCallbackAllowlist() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		allowlist *IPAllowlist
+		addr      string
+		want      bool
+	}{
+		{name: "Sandbox Address In Sandbox", allowlist: sandbox, addr: SandboxCallbackIPs[0], want: true},
+		{name: "Production Address In Sandbox", allowlist: sandbox, addr: ProductionCallbackIPs[0], want: false},
+		{name: "Production Address In Production", allowlist: production, addr: ProductionCallbackIPs[0], want: true},
+		{name: "Extra Range", allowlist: production, addr: "192.0.2.10", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/callback", nil)
+			req.RemoteAddr = tt.addr + ":443"
+			if got := tt.allowlist.Allowed(req); got != tt.want {
+				t.Errorf("Allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCallbackAllowlist(t *testing.T) {
+	allowlist, err := NewCallbackAllowlist(true, nil)
+	if err != nil {
+		t.Fatalf("NewCallbackAllowlist() error = %v", err)
+	}
+	client := &Client{config: Config{
+		MerchantCode:      "DXXXX",
+		APIKey:            "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:         true,
+		CallbackAllowlist: allowlist,
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		signature  string
+		wantStatus int
+	}{
+		{name: "Allowed Source", remoteAddr: "182.23.85.11:41000", wantStatus: http.StatusOK},
+		{name: "Allowed Source Bad Signature", remoteAddr: "182.23.85.11:41000", signature: "bad", wantStatus: http.StatusBadRequest},
+		// The signature is not checked for disallowed sources
+		{name: "Disallowed Source", remoteAddr: "203.0.113.5:41000", signature: "bad", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var extra map[string]string
+			if tt.signature != "" {
+				extra = map[string]string{"signature": tt.signature}
+			}
+			req := newRouterRequest(client, "ORDER-1", PaymentMethodBCA, CallbackStatusSuccess, extra)
+			req.RemoteAddr = tt.remoteAddr
+
+			called := false
+			w := httptest.NewRecorder()
+			client.HandleCallback(w, req, func(*CallbackData) error {
+				called = true
+				return nil
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("handler called = %v", called)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/callback", nil)
+	req.RemoteAddr = "203.0.113.5:41000"
+	if err := client.VerifyCallbackSource(req); !errors.Is(err, ErrCallbackSourceNotAllowed) {
+		t.Errorf("VerifyCallbackSource() error = %v, want ErrCallbackSourceNotAllowed", err)
+	}
+}
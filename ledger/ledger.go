@@ -0,0 +1,270 @@
+// Package ledger keeps an auditable, double-entry record of the money
+// movements of Duitku payments.
+//
+// Every movement is a Transaction of balanced postings: the debits equal the
+// credits. The Record methods derive the transactions from created
+// transactions, callbacks, settlements and disbursements:
+//
+//	order placed       debit customer_receivable   credit revenue
+//	payment callback   debit duitku_clearing       credit customer_receivable
+//	failed callback    debit revenue               credit customer_receivable
+//	settlement         debit merchant_settlement   credit duitku_clearing
+//	                   debit fee_expense
+//	disbursement       debit disbursements         credit duitku_clearing
+//	                   debit fee_expense
+//
+// Transactions have IDs derived from the merchant order ID and, for
+// subscriptions, the cycle number, so recording a retried callback twice is a
+// no-op. Storage is pluggable through Store:
+//
+//	l := ledger.New(ledger.NewMemoryStore(), ledger.Options{})
+//
+//	resp, err := l.CreateTransaction(client, request)
+//
+//	router := client.NewCallbackRouter().
+//		Use(l.CallbackMiddleware()).
+//		OnSuccess(markOrderPaid)
+//
+//	clearing, err := l.Balance(ledger.AccountDuitkuClearing)
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Accounts of the postings derived from Duitku payments
+const (
+	// AccountCustomerReceivable is what customers owe for placed orders
+	AccountCustomerReceivable = "customer_receivable"
+	// AccountRevenue is the revenue of placed orders
+	AccountRevenue = "revenue"
+	// AccountDuitkuClearing is the money Duitku collected and has not yet
+	// settled or disbursed
+	AccountDuitkuClearing = "duitku_clearing"
+	// AccountFeeExpense is the fees charged by Duitku
+	AccountFeeExpense = "fee_expense"
+	// AccountMerchantSettlement is the money settled to the merchant's bank account
+	AccountMerchantSettlement = "merchant_settlement"
+	// AccountDisbursements is the money disbursed to third party bank accounts
+	AccountDisbursements = "disbursements"
+)
+
+// Transaction kinds
+const (
+	KindOrder        = "ORDER"
+	KindPayment      = "PAYMENT"
+	KindCancellation = "CANCELLATION"
+	KindSettlement   = "SETTLEMENT"
+	KindDisbursement = "DISBURSEMENT"
+)
+
+var (
+	// ErrDuplicateTransaction is returned when a transaction with the same ID is already recorded
+	ErrDuplicateTransaction = errors.New("ledger: duplicate transaction")
+	// ErrTransactionNotFound is returned when a transaction does not exist in the store
+	ErrTransactionNotFound = errors.New("ledger: transaction not found")
+	// ErrUnbalanced is returned for transactions whose debits and credits differ
+	ErrUnbalanced = errors.New("ledger: transaction does not balance")
+	// ErrConflictingCallback is returned for a successful callback of an
+	// order already cancelled by a failed one
+	ErrConflictingCallback = errors.New("ledger: payment of a cancelled order")
+	// ErrAmountMismatch is returned for a callback whose amount differs
+	// from the amount of its recorded order
+	ErrAmountMismatch = errors.New("ledger: callback amount differs from the order")
+)
+
+// Posting is one side of a transaction on an account. Exactly one of Debit
+// and Credit is set, in rupiah.
+type Posting struct {
+	Account string
+	Debit   int64
+	Credit  int64
+}
+
+// Transaction is a balanced set of postings
+type Transaction struct {
+	// ID identifies the transaction; recording the same ID twice fails with
+	// ErrDuplicateTransaction
+	ID string
+	// Kind is one of the Kind constants, or a kind of the caller's own
+	Kind            string
+	MerchantOrderID string
+	Reference       string
+	// Time is when the money moved, the ledger's clock when zero
+	Time     time.Time
+	Memo     string
+	Postings []Posting
+}
+
+// Options configures a Ledger
+type Options struct {
+	// Now is an optional clock
+	Now func() time.Time
+}
+
+// Ledger records transactions in a Store
+type Ledger struct {
+	store Store
+	now   func() time.Time
+	// mu serializes the callbacks, which check for earlier transactions
+	// before posting
+	mu sync.Mutex
+}
+
+// New creates a Ledger over the store
+func New(store Store, options Options) *Ledger {
+	now := options.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &Ledger{store: store, now: now}
+}
+
+// Post validates and stores a transaction
+func (l *Ledger) Post(tx *Transaction) error {
+	if err := Validate(tx); err != nil {
+		return err
+	}
+	t := *tx
+	t.Postings = append([]Posting(nil), tx.Postings...)
+	if t.Time.IsZero() {
+		t.Time = l.now()
+	}
+	if err := l.store.Append(&t); err != nil {
+		return err
+	}
+	tx.Time = t.Time
+	return nil
+}
+
+// post stores a transaction, ignoring one that is already recorded
+func (l *Ledger) post(tx *Transaction) error {
+	if err := l.Post(tx); err != nil && !errors.Is(err, ErrDuplicateTransaction) {
+		return fmt.Errorf("error recording %s: %w", tx.ID, err)
+	}
+	return nil
+}
+
+// Transaction returns the transaction with the ID or ErrTransactionNotFound
+func (l *Ledger) Transaction(id string) (*Transaction, error) {
+	return l.store.Get(id)
+}
+
+// Transactions returns the transactions matching the filter in the order they were recorded
+func (l *Ledger) Transactions(filter Filter) ([]*Transaction, error) {
+	return l.store.Transactions(filter)
+}
+
+// Balance returns the debits minus the credits of an account
+func (l *Ledger) Balance(account string) (int64, error) {
+	balances, err := l.Balances(Filter{Account: account})
+	if err != nil {
+		return 0, err
+	}
+	return balances[account], nil
+}
+
+// Balances returns the debits minus the credits of every account in the
+// transactions matching the filter
+func (l *Ledger) Balances(filter Filter) (map[string]int64, error) {
+	transactions, err := l.store.Transactions(filter)
+	if err != nil {
+		return nil, fmt.Errorf("error loading transactions: %w", err)
+	}
+
+	balances := make(map[string]int64)
+	for _, tx := range transactions {
+		for _, posting := range tx.Postings {
+			balances[posting.Account] += posting.Debit - posting.Credit
+		}
+	}
+	return balances, nil
+}
+
+// InvariantError lists the stored transactions that break the ledger's invariants
+type InvariantError struct {
+	// Violations describe each broken invariant
+	Violations []string
+}
+
+// Error returns the violations
+func (e *InvariantError) Error() string {
+	if len(e.Violations) == 1 {
+		return "ledger: " + e.Violations[0]
+	}
+	return fmt.Sprintf("ledger: %d invariant violations, first: %s", len(e.Violations), e.Violations[0])
+}
+
+// Verify checks that every stored transaction is valid and that the
+// balances of all accounts sum to zero. Broken invariants are reported as
+// an *InvariantError.
+func (l *Ledger) Verify() error {
+	transactions, err := l.store.Transactions(Filter{})
+	if err != nil {
+		return fmt.Errorf("error loading transactions: %w", err)
+	}
+
+	var violations []string
+	seen := make(map[string]bool)
+	balances := make(map[string]int64)
+	for _, tx := range transactions {
+		if seen[tx.ID] {
+			violations = append(violations, fmt.Sprintf("transaction %s is stored twice", tx.ID))
+		}
+		seen[tx.ID] = true
+		if err := Validate(tx); err != nil {
+			violations = append(violations, err.Error())
+		}
+		for _, posting := range tx.Postings {
+			balances[posting.Account] += posting.Debit - posting.Credit
+		}
+	}
+
+	var total int64
+	accounts := make([]string, 0, len(balances))
+	for account, balance := range balances {
+		accounts = append(accounts, account)
+		total += balance
+	}
+	if total != 0 {
+		sort.Strings(accounts)
+		violations = append(violations, fmt.Sprintf("account balances sum to %d over %v", total, accounts))
+	}
+
+	if len(violations) > 0 {
+		return &InvariantError{Violations: violations}
+	}
+	return nil
+}
+
+// Validate checks that a transaction has an ID and at least two postings,
+// that every posting has an account and exactly one positive side, and that
+// the debits equal the credits
+func Validate(tx *Transaction) error {
+	if tx.ID == "" {
+		return errors.New("ledger: transaction has no ID")
+	}
+	if len(tx.Postings) < 2 {
+		return fmt.Errorf("ledger: transaction %s has %d postings, want at least 2", tx.ID, len(tx.Postings))
+	}
+
+	var debits, credits int64
+	for i, posting := range tx.Postings {
+		if posting.Account == "" {
+			return fmt.Errorf("ledger: posting %d of transaction %s has no account", i, tx.ID)
+		}
+		if posting.Debit < 0 || posting.Credit < 0 || (posting.Debit == 0) == (posting.Credit == 0) {
+			return fmt.Errorf("ledger: posting %d of transaction %s must have either a positive debit or credit", i, tx.ID)
+		}
+		debits += posting.Debit
+		credits += posting.Credit
+	}
+	if debits != credits {
+		return fmt.Errorf("%w: %s has debits %d and credits %d", ErrUnbalanced, tx.ID, debits, credits)
+	}
+	return nil
+}
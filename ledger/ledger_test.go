@@ -0,0 +1,151 @@
+package ledger
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tx      Transaction
+		wantErr string
+	}{
+		{
+			name: "Balanced",
+			tx: Transaction{ID: "t1", Postings: []Posting{
+				{Account: AccountDuitkuClearing, Debit: 40000},
+				{Account: AccountFeeExpense, Debit: 1200},
+				{Account: AccountCustomerReceivable, Credit: 41200},
+			}},
+		},
+		{name: "No ID", tx: Transaction{}, wantErr: "no ID"},
+		{name: "One Posting", tx: Transaction{ID: "t1", Postings: []Posting{{Account: "a", Debit: 1}}}, wantErr: "1 postings"},
+		{
+			name:    "No Account",
+			tx:      Transaction{ID: "t1", Postings: []Posting{{Debit: 1}, {Account: "b", Credit: 1}}},
+			wantErr: "no account",
+		},
+		{
+			name:    "Both Sides",
+			tx:      Transaction{ID: "t1", Postings: []Posting{{Account: "a", Debit: 1, Credit: 1}, {Account: "b", Credit: 1}}},
+			wantErr: "either",
+		},
+		{
+			name:    "Negative",
+			tx:      Transaction{ID: "t1", Postings: []Posting{{Account: "a", Debit: -1}, {Account: "b", Credit: -1}}},
+			wantErr: "either",
+		},
+		{
+			name:    "Unbalanced",
+			tx:      Transaction{ID: "t1", Postings: []Posting{{Account: "a", Debit: 40000}, {Account: "b", Credit: 38800}}},
+			wantErr: "does not balance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.tx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPostAndBalances(t *testing.T) {
+	now := time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)
+	l := New(NewMemoryStore(), Options{Now: func() time.Time { return now }})
+
+	tx := &Transaction{ID: "t1", Kind: KindOrder, MerchantOrderID: "ORDER-1", Postings: []Posting{
+		{Account: AccountCustomerReceivable, Debit: 40000},
+		{Account: AccountRevenue, Credit: 40000},
+	}}
+	if err := l.Post(tx); err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	if !tx.Time.Equal(now) {
+		t.Errorf("Time = %v, want %v", tx.Time, now)
+	}
+	if err := l.Post(tx); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Errorf("Post() duplicate error = %v", err)
+	}
+	if err := l.Post(&Transaction{ID: "t2", Postings: []Posting{{Account: "a", Debit: 1}, {Account: "b", Credit: 2}}}); !errors.Is(err, ErrUnbalanced) {
+		t.Errorf("Post() unbalanced error = %v", err)
+	}
+
+	if err := l.Post(&Transaction{ID: "t3", MerchantOrderID: "ORDER-1", Postings: []Posting{
+		{Account: AccountDuitkuClearing, Debit: 40000},
+		{Account: AccountCustomerReceivable, Credit: 40000},
+	}}); err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+
+	balance, err := l.Balance(AccountCustomerReceivable)
+	if err != nil || balance != 0 {
+		t.Errorf("Balance(receivable) = %d, %v, want 0", balance, err)
+	}
+	balances, err := l.Balances(Filter{})
+	if err != nil {
+		t.Fatalf("Balances() error = %v", err)
+	}
+	want := map[string]int64{AccountCustomerReceivable: 0, AccountRevenue: -40000, AccountDuitkuClearing: 40000}
+	if len(balances) != len(want) {
+		t.Errorf("Balances() = %v, want %v", balances, want)
+	}
+	for account, balance := range want {
+		if balances[account] != balance {
+			t.Errorf("balance of %s = %d, want %d", account, balances[account], balance)
+		}
+	}
+
+	if got, err := l.Transaction("t1"); err != nil || got.MerchantOrderID != "ORDER-1" {
+		t.Errorf("Transaction(t1) = %+v, %v", got, err)
+	}
+	if _, err := l.Transaction("t2"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Transaction(t2) error = %v", err)
+	}
+	if err := l.Verify(); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+// corruptStore is a Store that returns its transactions without checks
+type corruptStore struct {
+	MemoryStore
+	transactions []*Transaction
+}
+
+func (s *corruptStore) Transactions(filter Filter) ([]*Transaction, error) {
+	return s.transactions, nil
+}
+
+func TestVerify(t *testing.T) {
+	balanced := &Transaction{ID: "t1", Postings: []Posting{{Account: "a", Debit: 10}, {Account: "b", Credit: 10}}}
+	unbalanced := &Transaction{ID: "t2", Postings: []Posting{{Account: "a", Debit: 10}, {Account: "b", Credit: 5}}}
+
+	store := &corruptStore{transactions: []*Transaction{balanced, balanced, unbalanced}}
+	err := New(store, Options{}).Verify()
+
+	var invariantErr *InvariantError
+	if !errors.As(err, &invariantErr) {
+		t.Fatalf("Verify() error = %v, want *InvariantError", err)
+	}
+	want := []string{"stored twice", "does not balance", "sum to 5"}
+	if len(invariantErr.Violations) != len(want) {
+		t.Fatalf("Violations = %v", invariantErr.Violations)
+	}
+	for i, violation := range invariantErr.Violations {
+		if !strings.Contains(violation, want[i]) {
+			t.Errorf("Violations[%d] = %s, want %q", i, violation, want[i])
+		}
+	}
+}
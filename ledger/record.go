@@ -0,0 +1,306 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// TransactionCreator creates Duitku transactions, implemented by
+// *duitku.Client
+type TransactionCreator interface {
+	CreateTransaction(request duitku.TransactionRequest) (*duitku.TransactionResponse, error)
+}
+
+// Settlement is money Duitku settled to the merchant's bank account for an order
+type Settlement struct {
+	MerchantOrderID string
+	// CycleNumber is the subscription cycle settled, empty for other orders
+	CycleNumber string
+	Reference   string
+	// Amount is the amount the customer paid, in rupiah
+	Amount int64
+	// Fee is the fee Duitku deducted from the amount, in rupiah
+	Fee int64
+	// Date is when the money was settled
+	Date time.Time
+}
+
+// Disbursement is money Duitku transferred from the merchant's balance to a bank account
+type Disbursement struct {
+	// ID is the disbursement ID, used to record each disbursement once
+	ID string
+	// Amount is the amount transferred, in rupiah
+	Amount int64
+	// Fee is the transfer fee charged on top of the amount, in rupiah
+	Fee           int64
+	BankCode      string
+	AccountNumber string
+	Time          time.Time
+}
+
+// CreateTransaction creates a transaction with creator and records the
+// order. When the transaction is created but cannot be recorded, the
+// response is returned with the error. A *duitku.TransactionExistsError
+// means the order was created despite the error, so it is recorded as well
+// and the error returned, joined with the recording error if any.
+func (l *Ledger) CreateTransaction(creator TransactionCreator, request duitku.TransactionRequest) (*duitku.TransactionResponse, error) {
+	response, err := creator.CreateTransaction(request)
+	var exists *duitku.TransactionExistsError
+	if errors.As(err, &exists) {
+		created := &duitku.TransactionResponse{Reference: exists.Status.Reference}
+		if recordErr := l.RecordOrder(request, created); recordErr != nil {
+			return nil, errors.Join(err, recordErr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := l.RecordOrder(request, response); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// RecordOrder records a created transaction as owed by the customer.
+// response may be nil.
+func (l *Ledger) RecordOrder(request duitku.TransactionRequest, response *duitku.TransactionResponse) error {
+	amount := int64(request.PaymentAmount)
+	tx := &Transaction{
+		ID:              "order:" + request.MerchantOrderID,
+		Kind:            KindOrder,
+		MerchantOrderID: request.MerchantOrderID,
+		Memo:            request.ProductDetails,
+		Postings: []Posting{
+			{Account: AccountCustomerReceivable, Debit: amount},
+			{Account: AccountRevenue, Credit: amount},
+		},
+	}
+	if response != nil {
+		tx.Reference = response.Reference
+	}
+	return l.post(tx)
+}
+
+// RecordCallback records a payment for a successful callback and cancels
+// the order for a failed one. Callbacks are recorded once per merchant
+// order ID and subscription cycle, so retried callbacks are ignored.
+//
+// Subscription cycles share the merchant order ID of the first order, so
+// the order of each cycle is recorded with its first callback. A failed
+// callback after the payment is ignored; a successful callback after the
+// cancellation fails with ErrConflictingCallback, since money arrived for
+// an order the ledger considers cancelled. A callback whose amount differs
+// from the recorded order fails with ErrAmountMismatch.
+func (l *Ledger) RecordCallback(data *duitku.CallbackData) error {
+	amount, err := parseAmount(data.Amount)
+	if err != nil {
+		return fmt.Errorf("error parsing callback amount: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := cycleID(data.MerchantOrderID, data.CycleNumber)
+	if data.CycleNumber != "" {
+		if err := l.recordCycleOrder(data, id, amount); err != nil {
+			return err
+		}
+	}
+
+	paid, err := l.exists("payment:" + id)
+	if err != nil {
+		return err
+	}
+	cancelled, err := l.exists("cancellation:" + id)
+	if err != nil {
+		return err
+	}
+	if data.IsSuccessful() && cancelled {
+		return fmt.Errorf("error recording payment:%s: %w", id, ErrConflictingCallback)
+	}
+	if !data.IsSuccessful() && paid {
+		return nil
+	}
+	if err := l.checkOrderAmount(data, id, amount); err != nil {
+		return err
+	}
+
+	tx := &Transaction{
+		MerchantOrderID: data.MerchantOrderID,
+		Reference:       data.Reference,
+	}
+	if data.IsSuccessful() {
+		tx.ID = "payment:" + id
+		tx.Kind = KindPayment
+		tx.Memo = "paid with " + data.PaymentCode
+		tx.Postings = []Posting{
+			{Account: AccountDuitkuClearing, Debit: amount},
+			{Account: AccountCustomerReceivable, Credit: amount},
+		}
+	} else {
+		tx.ID = "cancellation:" + id
+		tx.Kind = KindCancellation
+		tx.Memo = "result code " + data.ResultCode
+		tx.Postings = []Posting{
+			{Account: AccountRevenue, Debit: amount},
+			{Account: AccountCustomerReceivable, Credit: amount},
+		}
+	}
+	return l.post(tx)
+}
+
+// RecordSettlement records the settlement of an order, net of Duitku's fee
+func (l *Ledger) RecordSettlement(settlement Settlement) error {
+	if settlement.Fee < 0 || settlement.Fee > settlement.Amount {
+		return fmt.Errorf("ledger: settlement fee %d is outside the amount %d", settlement.Fee, settlement.Amount)
+	}
+
+	tx := &Transaction{
+		ID:              "settlement:" + cycleID(settlement.MerchantOrderID, settlement.CycleNumber),
+		Kind:            KindSettlement,
+		MerchantOrderID: settlement.MerchantOrderID,
+		Reference:       settlement.Reference,
+		Time:            settlement.Date,
+	}
+	tx.Postings = appendPosting(tx.Postings, Posting{Account: AccountMerchantSettlement, Debit: settlement.Amount - settlement.Fee})
+	tx.Postings = appendPosting(tx.Postings, Posting{Account: AccountFeeExpense, Debit: settlement.Fee})
+	tx.Postings = appendPosting(tx.Postings, Posting{Account: AccountDuitkuClearing, Credit: settlement.Amount})
+	return l.post(tx)
+}
+
+// RecordDisbursement records a transfer from the merchant's Duitku balance
+// and its fee
+func (l *Ledger) RecordDisbursement(disbursement Disbursement) error {
+	if disbursement.ID == "" {
+		return fmt.Errorf("ledger: disbursement has no ID")
+	}
+
+	tx := &Transaction{
+		ID:   "disbursement:" + disbursement.ID,
+		Kind: KindDisbursement,
+		Time: disbursement.Time,
+		Memo: strings.TrimSpace(disbursement.BankCode + " " + disbursement.AccountNumber),
+	}
+	tx.Postings = appendPosting(tx.Postings, Posting{Account: AccountDisbursements, Debit: disbursement.Amount})
+	tx.Postings = appendPosting(tx.Postings, Posting{Account: AccountFeeExpense, Debit: disbursement.Fee})
+	tx.Postings = appendPosting(tx.Postings, Posting{Account: AccountDuitkuClearing, Credit: disbursement.Amount + disbursement.Fee})
+	return l.post(tx)
+}
+
+// CallbackMiddleware records every callback before the handler runs. A
+// callback that cannot be recorded fails, so Duitku sends it again.
+func (l *Ledger) CallbackMiddleware() duitku.CallbackMiddleware {
+	return func(next duitku.CallbackHandlerFunc) duitku.CallbackHandlerFunc {
+		return func(data *duitku.CallbackData) error {
+			if err := l.RecordCallback(data); err != nil {
+				return err
+			}
+			return next(data)
+		}
+	}
+}
+
+// recordCycleOrder records the order of a subscription cycle unless it is
+// already recorded
+func (l *Ledger) recordCycleOrder(data *duitku.CallbackData, id string, amount int64) error {
+	for _, orderID := range orderIDs(data, id) {
+		found, err := l.exists(orderID)
+		if err != nil || found {
+			return err
+		}
+	}
+
+	return l.post(&Transaction{
+		ID:              "order:" + id,
+		Kind:            KindOrder,
+		MerchantOrderID: data.MerchantOrderID,
+		Reference:       data.Reference,
+		Memo:            "subscription " + data.SubscriptionID + " cycle " + data.CycleNumber,
+		Postings: []Posting{
+			{Account: AccountCustomerReceivable, Debit: amount},
+			{Account: AccountRevenue, Credit: amount},
+		},
+	})
+}
+
+// checkOrderAmount compares the amount of a callback with the amount owed
+// by its recorded order. Callbacks of orders that are not recorded pass.
+func (l *Ledger) checkOrderAmount(data *duitku.CallbackData, id string, amount int64) error {
+	for _, orderID := range orderIDs(data, id) {
+		order, err := l.store.Get(orderID)
+		if errors.Is(err, ErrTransactionNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", orderID, err)
+		}
+
+		var owed int64
+		for _, posting := range order.Postings {
+			if posting.Account == AccountCustomerReceivable {
+				owed += posting.Debit - posting.Credit
+			}
+		}
+		if amount != owed {
+			return fmt.Errorf("error recording callback:%s: amount %d, order %d: %w", id, amount, owed, ErrAmountMismatch)
+		}
+		return nil
+	}
+	return nil
+}
+
+// orderIDs returns the transaction IDs the order of a callback may be
+// recorded under. The first subscription cycle is the order RecordOrder
+// recorded under the plain merchant order ID, if any.
+func orderIDs(data *duitku.CallbackData, id string) []string {
+	ids := []string{"order:" + id}
+	if data.CycleNumber == "1" {
+		ids = append(ids, "order:"+data.MerchantOrderID)
+	}
+	return ids
+}
+
+// exists reports whether the transaction with the ID is recorded
+func (l *Ledger) exists(id string) (bool, error) {
+	_, err := l.store.Get(id)
+	if errors.Is(err, ErrTransactionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %w", id, err)
+	}
+	return true, nil
+}
+
+// cycleID returns the merchant order ID, suffixed with the subscription
+// cycle number when set
+func cycleID(merchantOrderID, cycleNumber string) string {
+	if cycleNumber == "" {
+		return merchantOrderID
+	}
+	return merchantOrderID + "#" + cycleNumber
+}
+
+// appendPosting appends a posting that moves money, skipping zero amounts
+// such as a settlement without a fee
+func appendPosting(postings []Posting, posting Posting) []Posting {
+	if posting.Debit == 0 && posting.Credit == 0 {
+		return postings
+	}
+	return append(postings, posting)
+}
+
+// parseAmount parses a callback amount such as "40000" or "40000.00"
+func parseAmount(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if whole, fraction, ok := strings.Cut(value, "."); ok && strings.Trim(fraction, "0") == "" {
+		value = whole
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
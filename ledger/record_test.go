@@ -0,0 +1,231 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// fakeCreator answers CreateTransaction with a fixed reference
+type fakeCreator struct {
+	fail bool
+	// exists fails the create with a TransactionExistsError
+	exists bool
+}
+
+func (f *fakeCreator) CreateTransaction(request duitku.TransactionRequest) (*duitku.TransactionResponse, error) {
+	if f.fail {
+		return nil, errors.New("service unavailable")
+	}
+	if f.exists {
+		return nil, &duitku.TransactionExistsError{
+			MerchantOrderID: request.MerchantOrderID,
+			Status:          &duitku.TransactionStatusResponse{Reference: "REF-" + request.MerchantOrderID},
+			Err:             errors.New("gateway timeout"),
+		}
+	}
+	return &duitku.TransactionResponse{Reference: "REF-" + request.MerchantOrderID, StatusCode: "00"}, nil
+}
+
+func TestRecordPaymentFlow(t *testing.T) {
+	l := New(NewMemoryStore(), Options{})
+
+	resp, err := l.CreateTransaction(&fakeCreator{}, duitku.TransactionRequest{MerchantOrderID: "ORDER-1", PaymentAmount: 40000})
+	if err != nil || resp.Reference != "REF-ORDER-1" {
+		t.Fatalf("CreateTransaction() = %+v, %v", resp, err)
+	}
+	if _, err := l.CreateTransaction(&fakeCreator{fail: true}, duitku.TransactionRequest{MerchantOrderID: "ORDER-2", PaymentAmount: 10000}); err == nil {
+		t.Error("CreateTransaction() error = nil")
+	}
+	if err := l.RecordOrder(duitku.TransactionRequest{MerchantOrderID: "ORDER-3", PaymentAmount: 25000}, nil); err != nil {
+		t.Fatalf("RecordOrder() error = %v", err)
+	}
+
+	paid := &duitku.CallbackData{MerchantOrderID: "ORDER-1", Amount: "40000", ResultCode: "00", PaymentCode: "VC", Reference: "REF-ORDER-1"}
+	var handled int
+	handler := l.CallbackMiddleware()(func(*duitku.CallbackData) error {
+		handled++
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		if err := handler(paid); err != nil {
+			t.Fatalf("callback %d error = %v", i, err)
+		}
+	}
+	if handled != 2 {
+		t.Errorf("handled = %d, want 2", handled)
+	}
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-3", Amount: "25000.00", ResultCode: "01"}); err != nil {
+		t.Fatalf("RecordCallback() error = %v", err)
+	}
+	if err := handler(&duitku.CallbackData{MerchantOrderID: "ORDER-4", Amount: "abc", ResultCode: "00"}); err == nil {
+		t.Error("callback with invalid amount error = nil")
+	}
+
+	settled := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	if err := l.RecordSettlement(Settlement{MerchantOrderID: "ORDER-1", Amount: 40000, Fee: 1200, Date: settled}); err != nil {
+		t.Fatalf("RecordSettlement() error = %v", err)
+	}
+	if err := l.RecordSettlement(Settlement{MerchantOrderID: "ORDER-9", Amount: 1000, Fee: 2000}); err == nil {
+		t.Error("RecordSettlement() with fee above amount error = nil")
+	}
+	if err := l.RecordDisbursement(Disbursement{ID: "DISB-1", Amount: 10000, Fee: 500, BankCode: "014"}); err != nil {
+		t.Fatalf("RecordDisbursement() error = %v", err)
+	}
+	if err := l.RecordDisbursement(Disbursement{Amount: 10000}); err == nil {
+		t.Error("RecordDisbursement() without ID error = nil")
+	}
+
+	balances, err := l.Balances(Filter{})
+	if err != nil {
+		t.Fatalf("Balances() error = %v", err)
+	}
+	want := map[string]int64{
+		AccountCustomerReceivable: 0,
+		AccountRevenue:            -40000,
+		AccountDuitkuClearing:     40000 - 40000 - 10500,
+		AccountFeeExpense:         1200 + 500,
+		AccountMerchantSettlement: 38800,
+		AccountDisbursements:      10000,
+	}
+	for account, balance := range want {
+		if balances[account] != balance {
+			t.Errorf("balance of %s = %d, want %d", account, balances[account], balance)
+		}
+	}
+
+	settlement, err := l.Transaction("settlement:ORDER-1")
+	if err != nil || !settlement.Time.Equal(settled) || settlement.Kind != KindSettlement {
+		t.Errorf("settlement = %+v, %v", settlement, err)
+	}
+	if err := l.Verify(); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestRecordCallbackSubscriptionCycles(t *testing.T) {
+	l := New(NewMemoryStore(), Options{})
+
+	// The first cycle is the order created by the merchant
+	if err := l.RecordOrder(duitku.TransactionRequest{MerchantOrderID: "SUB-1", PaymentAmount: 99000}, nil); err != nil {
+		t.Fatalf("RecordOrder() error = %v", err)
+	}
+	for _, cycle := range []string{"1", "2", "2", "3"} {
+		data := &duitku.CallbackData{MerchantOrderID: "SUB-1", Amount: "99000", ResultCode: "00", SubscriptionID: "SUB0001", CycleNumber: cycle}
+		if err := l.RecordCallback(data); err != nil {
+			t.Fatalf("RecordCallback() error = %v", err)
+		}
+	}
+	for _, cycle := range []string{"1", "2", "2"} {
+		settlement := Settlement{MerchantOrderID: "SUB-1", CycleNumber: cycle, Amount: 99000, Fee: 1000}
+		if err := l.RecordSettlement(settlement); err != nil {
+			t.Fatalf("RecordSettlement() error = %v", err)
+		}
+	}
+
+	payments, err := l.Transactions(Filter{Kind: KindPayment})
+	if err != nil {
+		t.Fatalf("Transactions() error = %v", err)
+	}
+	if len(payments) != 3 || payments[0].ID != "payment:SUB-1#1" || payments[1].ID != "payment:SUB-1#2" || payments[2].ID != "payment:SUB-1#3" {
+		t.Errorf("payments = %+v", payments)
+	}
+	orders, err := l.Transactions(Filter{Kind: KindOrder})
+	if err != nil || len(orders) != 3 {
+		t.Errorf("orders = %+v, %v", orders, err)
+	}
+
+	balances, err := l.Balances(Filter{})
+	if err != nil {
+		t.Fatalf("Balances() error = %v", err)
+	}
+	want := map[string]int64{
+		AccountCustomerReceivable: 0,
+		AccountRevenue:            -3 * 99000,
+		AccountDuitkuClearing:     99000,
+		AccountMerchantSettlement: 2 * 98000,
+		AccountFeeExpense:         2 * 1000,
+	}
+	for account, balance := range want {
+		if balances[account] != balance {
+			t.Errorf("balance of %s = %d, want %d", account, balances[account], balance)
+		}
+	}
+	if err := l.Verify(); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestRecordCallbackConflicts(t *testing.T) {
+	l := New(NewMemoryStore(), Options{})
+	for _, id := range []string{"ORDER-1", "ORDER-2"} {
+		if err := l.RecordOrder(duitku.TransactionRequest{MerchantOrderID: id, PaymentAmount: 40000}, nil); err != nil {
+			t.Fatalf("RecordOrder() error = %v", err)
+		}
+	}
+
+	// A failed callback after the payment is ignored
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-1", Amount: "40000", ResultCode: "00"}); err != nil {
+		t.Fatalf("RecordCallback() error = %v", err)
+	}
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-1", Amount: "40000", ResultCode: "01"}); err != nil {
+		t.Fatalf("RecordCallback() failed after paid error = %v", err)
+	}
+	if _, err := l.Transaction("cancellation:ORDER-1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("cancellation of paid order error = %v, want ErrTransactionNotFound", err)
+	}
+
+	// A payment after the cancellation fails
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-2", Amount: "40000", ResultCode: "01"}); err != nil {
+		t.Fatalf("RecordCallback() error = %v", err)
+	}
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-2", Amount: "40000", ResultCode: "00"}); !errors.Is(err, ErrConflictingCallback) {
+		t.Errorf("RecordCallback() paid after cancelled error = %v, want ErrConflictingCallback", err)
+	}
+	if _, err := l.Transaction("payment:ORDER-2"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("payment of cancelled order error = %v, want ErrTransactionNotFound", err)
+	}
+
+	// A callback for another amount than the order is rejected
+	if err := l.RecordOrder(duitku.TransactionRequest{MerchantOrderID: "ORDER-3", PaymentAmount: 40000}, nil); err != nil {
+		t.Fatalf("RecordOrder() error = %v", err)
+	}
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-3", Amount: "4000", ResultCode: "00"}); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("RecordCallback() with another amount error = %v, want ErrAmountMismatch", err)
+	}
+	if _, err := l.Transaction("payment:ORDER-3"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("payment with another amount error = %v, want ErrTransactionNotFound", err)
+	}
+	if err := l.RecordCallback(&duitku.CallbackData{MerchantOrderID: "ORDER-3", Amount: "40000.00", ResultCode: "00"}); err != nil {
+		t.Fatalf("RecordCallback() error = %v", err)
+	}
+
+	if balance, err := l.Balance(AccountCustomerReceivable); err != nil || balance != 0 {
+		t.Errorf("customer receivable = %d, %v, want 0", balance, err)
+	}
+}
+
+func TestCreateTransactionExists(t *testing.T) {
+	l := New(NewMemoryStore(), Options{})
+
+	request := duitku.TransactionRequest{MerchantOrderID: "ORDER-1", PaymentAmount: 40000}
+	_, err := l.CreateTransaction(&fakeCreator{exists: true}, request)
+	var exists *duitku.TransactionExistsError
+	if !errors.As(err, &exists) {
+		t.Fatalf("CreateTransaction() error = %v, want TransactionExistsError", err)
+	}
+	order, err := l.Transaction("order:ORDER-1")
+	if err != nil || order.Reference != "REF-ORDER-1" {
+		t.Fatalf("order = %+v, %v", order, err)
+	}
+
+	// Creating the order again records it once
+	if _, err := l.CreateTransaction(&fakeCreator{exists: true}, request); !errors.As(err, &exists) {
+		t.Errorf("CreateTransaction() again error = %v, want TransactionExistsError", err)
+	}
+	if balance, err := l.Balance(AccountCustomerReceivable); err != nil || balance != 40000 {
+		t.Errorf("customer receivable = %d, %v, want 40000", balance, err)
+	}
+}
@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"sync"
+	"time"
+)
+
+// Filter selects transactions. Zero fields match every transaction.
+type Filter struct {
+	// Account matches transactions with a posting on the account
+	Account         string
+	MerchantOrderID string
+	Kind            string
+	// From and To bound the transaction time, To excluded
+	From, To time.Time
+}
+
+// Match reports whether the transaction matches the filter
+func (f Filter) Match(tx *Transaction) bool {
+	if f.MerchantOrderID != "" && tx.MerchantOrderID != f.MerchantOrderID {
+		return false
+	}
+	if f.Kind != "" && tx.Kind != f.Kind {
+		return false
+	}
+	if !f.From.IsZero() && tx.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !tx.Time.Before(f.To) {
+		return false
+	}
+	if f.Account == "" {
+		return true
+	}
+	for _, posting := range tx.Postings {
+		if posting.Account == f.Account {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists ledger transactions. Transactions are append-only: they
+// are never changed, a mistake is corrected by a new transaction.
+type Store interface {
+	// Append stores a transaction, or fails with ErrDuplicateTransaction
+	// when its ID is already stored
+	Append(tx *Transaction) error
+	// Get returns the transaction with the ID or ErrTransactionNotFound
+	Get(id string) (*Transaction, error)
+	// Transactions returns the transactions matching the filter in the order they were appended
+	Transactions(filter Filter) ([]*Transaction, error)
+}
+
+// MemoryStore is an in-memory Store, useful for tests and single process deployments
+type MemoryStore struct {
+	mu           sync.Mutex
+	transactions []*Transaction
+	byID         map[string]*Transaction
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byID: make(map[string]*Transaction)}
+}
+
+// Append stores a transaction, or fails with ErrDuplicateTransaction when its ID is already stored
+func (s *MemoryStore) Append(tx *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byID[tx.ID]; ok {
+		return ErrDuplicateTransaction
+	}
+	t := copyTransaction(tx)
+	s.transactions = append(s.transactions, t)
+	s.byID[t.ID] = t
+	return nil
+}
+
+// Get returns the transaction with the ID or ErrTransactionNotFound
+func (s *MemoryStore) Get(id string) (*Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.byID[id]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	return copyTransaction(tx), nil
+}
+
+// Transactions returns the transactions matching the filter in the order they were appended
+func (s *MemoryStore) Transactions(filter Filter) ([]*Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var transactions []*Transaction
+	for _, tx := range s.transactions {
+		if filter.Match(tx) {
+			transactions = append(transactions, copyTransaction(tx))
+		}
+	}
+	return transactions, nil
+}
+
+func copyTransaction(tx *Transaction) *Transaction {
+	t := *tx
+	t.Postings = append([]Posting(nil), tx.Postings...)
+	return &t
+}
@@ -0,0 +1,69 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	transactions := []*Transaction{
+		{ID: "order:ORDER-1", Kind: KindOrder, MerchantOrderID: "ORDER-1", Time: day(30), Postings: []Posting{
+			{Account: AccountCustomerReceivable, Debit: 40000}, {Account: AccountRevenue, Credit: 40000},
+		}},
+		{ID: "payment:ORDER-1", Kind: KindPayment, MerchantOrderID: "ORDER-1", Time: day(31), Postings: []Posting{
+			{Account: AccountDuitkuClearing, Debit: 40000}, {Account: AccountCustomerReceivable, Credit: 40000},
+		}},
+		{ID: "order:ORDER-2", Kind: KindOrder, MerchantOrderID: "ORDER-2", Time: day(31), Postings: []Posting{
+			{Account: AccountCustomerReceivable, Debit: 10000}, {Account: AccountRevenue, Credit: 10000},
+		}},
+	}
+	for _, tx := range transactions {
+		if err := store.Append(tx); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if err := store.Append(transactions[0]); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Errorf("Append() duplicate error = %v", err)
+	}
+
+	// Stored transactions are copies
+	transactions[0].Postings[0].Debit = 1
+	got, err := store.Get("order:ORDER-1")
+	if err != nil || got.Postings[0].Debit != 40000 {
+		t.Errorf("Get() = %+v, %v", got, err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "All", filter: Filter{}, want: []string{"order:ORDER-1", "payment:ORDER-1", "order:ORDER-2"}},
+		{name: "Account", filter: Filter{Account: AccountDuitkuClearing}, want: []string{"payment:ORDER-1"}},
+		{name: "Merchant Order ID", filter: Filter{MerchantOrderID: "ORDER-1"}, want: []string{"order:ORDER-1", "payment:ORDER-1"}},
+		{name: "Kind", filter: Filter{Kind: KindOrder}, want: []string{"order:ORDER-1", "order:ORDER-2"}},
+		{name: "Period", filter: Filter{From: day(31), To: day(32)}, want: []string{"payment:ORDER-1", "order:ORDER-2"}},
+		{name: "Before", filter: Filter{To: day(31)}, want: []string{"order:ORDER-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Transactions(tt.filter)
+			if err != nil {
+				t.Fatalf("Transactions() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Transactions() = %d transactions, want %v", len(got), tt.want)
+			}
+			for i, id := range tt.want {
+				if got[i].ID != id {
+					t.Errorf("Transactions()[%d] = %s, want %s", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
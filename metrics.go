@@ -0,0 +1,96 @@
+package duitku
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metric names reported to Config.Metrics
+const (
+	// MetricRequests counts API requests by endpoint, status, response_code
+	// and payment_method
+	MetricRequests = "duitku_requests_total"
+	// MetricRequestDuration observes API request latency in seconds, with
+	// the labels of MetricRequests
+	MetricRequestDuration = "duitku_request_duration_seconds"
+	// MetricCallbacks counts callbacks by outcome, result_code and
+	// payment_method
+	MetricCallbacks = "duitku_callbacks_total"
+	// MetricCallbackDuration observes callback handling time in seconds,
+	// with the labels of MetricCallbacks
+	MetricCallbackDuration = "duitku_callback_duration_seconds"
+)
+
+// Callback outcomes reported in the outcome label
+const (
+	CallbackOutcomeOK           = "ok"
+	CallbackOutcomeForbidden    = "forbidden"
+	CallbackOutcomeInvalid      = "invalid"
+	CallbackOutcomeHandlerError = "handler_error"
+	CallbackOutcomeQueueFull    = "queue_full"
+)
+
+// Status labels of requests that got no response
+const (
+	// StatusNetworkError is the status label of requests that failed on the network
+	StatusNetworkError = "error"
+	// StatusCircuitOpen is the status label of requests rejected with ErrCircuitOpen
+	StatusCircuitOpen = "circuit_open"
+)
+
+// Labels are the label values of a metric sample
+type Labels map[string]string
+
+// Metrics receives the counters and histograms of API calls and callbacks
+type Metrics interface {
+	// IncCounter adds one to the counter with the labels
+	IncCounter(name string, labels Labels)
+	// ObserveHistogram records value in the histogram with the labels
+	ObserveHistogram(name string, value float64, labels Labels)
+}
+
+// observeRequest reports one API request. resp is nil after a network
+// error or an open circuit; respBody is the response body when it was read.
+func (c *Client) observeRequest(endpoint string, start time.Time, reqBody []byte, resp *http.Response, respBody []byte, err error) {
+	if c.config.Metrics == nil {
+		return
+	}
+
+	status := StatusNetworkError
+	switch {
+	case resp != nil:
+		status = strconv.Itoa(resp.StatusCode)
+	case errors.Is(err, ErrCircuitOpen):
+		status = StatusCircuitOpen
+	}
+
+	request := parseRequestFields(reqBody)
+	response := parseResponseFields(respBody)
+
+	labels := Labels{
+		"endpoint":       endpoint,
+		"status":         status,
+		"response_code":  response.ResponseCode,
+		"payment_method": request.PaymentMethod,
+	}
+	c.config.Metrics.IncCounter(MetricRequests, labels)
+	c.config.Metrics.ObserveHistogram(MetricRequestDuration, time.Since(start).Seconds(), labels)
+}
+
+// observeCallback reports one callback. data is nil when the callback was
+// rejected before it was parsed.
+func (c *Client) observeCallback(start time.Time, outcome string, data *CallbackData) {
+	if c.config.Metrics == nil {
+		return
+	}
+
+	labels := Labels{"outcome": outcome, "result_code": "", "payment_method": ""}
+	if data != nil {
+		labels["result_code"] = data.ResultCode
+		labels["payment_method"] = data.PaymentCode
+	}
+	c.config.Metrics.IncCounter(MetricCallbacks, labels)
+	c.config.Metrics.ObserveHistogram(MetricCallbackDuration, time.Since(start).Seconds(), labels)
+}
@@ -0,0 +1,181 @@
+package duitku
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sample is one call to a recordingMetrics
+type sample struct {
+	name   string
+	value  float64
+	labels Labels
+}
+
+// recordingMetrics keeps every counter increment and observation
+type recordingMetrics struct {
+	mu           sync.Mutex
+	counters     []sample
+	observations []sample
+}
+
+func (m *recordingMetrics) IncCounter(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = append(m.counters, sample{name: name, value: 1, labels: labels})
+}
+
+func (m *recordingMetrics) ObserveHistogram(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, sample{name: name, value: value, labels: labels})
+}
+
+func TestDoRequestMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		closed     bool
+		wantLabels Labels
+	}{
+		{
+			name:   "Success",
+			status: http.StatusOK,
+			body:   `{"merchantCode":"DXXXX","reference":"REF","statusCode":"00","statusMessage":"SUCCESS"}`,
+			wantLabels: Labels{
+				"endpoint": "merchant/v2/inquiry", "status": "200", "response_code": "00", "payment_method": "M2",
+			},
+		},
+		{
+			name:   "API Error",
+			status: http.StatusBadRequest,
+			body:   `{"responseCode":"01","responseMessage":"Invalid signature"}`,
+			wantLabels: Labels{
+				"endpoint": "merchant/v2/inquiry", "status": "400", "response_code": "01", "payment_method": "M2",
+			},
+		},
+		{
+			name:   "Network Error",
+			closed: true,
+			wantLabels: Labels{
+				"endpoint": "merchant/v2/inquiry", "status": StatusNetworkError, "response_code": "", "payment_method": "M2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			if tt.closed {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+
+			metrics := &recordingMetrics{}
+			client := &Client{
+				config: Config{
+					MerchantCode: "DXXXX",
+					APIKey:       "DXXXXCX80TZJ85Q70QCI",
+					Metrics:      metrics,
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			client.CreateTransaction(TransactionRequest{PaymentAmount: 40000, PaymentMethod: "M2", MerchantOrderID: "ORDER123"})
+
+			// A create failing without a response is followed by a status check
+			want := 1
+			if tt.closed {
+				want = 2
+			}
+			if len(metrics.counters) != want || len(metrics.observations) != want {
+				t.Fatalf("counters = %d, observations = %d, want %d", len(metrics.counters), len(metrics.observations), want)
+			}
+			counter, observation := metrics.counters[0], metrics.observations[0]
+			if counter.name != MetricRequests || observation.name != MetricRequestDuration {
+				t.Errorf("names = %s, %s", counter.name, observation.name)
+			}
+			if observation.value < 0 {
+				t.Errorf("duration = %v", observation.value)
+			}
+			for name, want := range tt.wantLabels {
+				if got, ok := counter.labels[name]; !ok || got != want {
+					t.Errorf("label %s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleCallbackMetrics(t *testing.T) {
+	signature := SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER123")
+	validForm := url.Values{
+		"merchantCode":    {"DXXXX"},
+		"amount":          {"40000"},
+		"merchantOrderId": {"ORDER123"},
+		"paymentCode":     {"VC"},
+		"resultCode":      {"00"},
+		"signature":       {signature},
+	}
+
+	tests := []struct {
+		name        string
+		form        url.Values
+		remoteAddr  string
+		handlerErr  error
+		wantOutcome string
+		wantResult  string
+	}{
+		{name: "OK", form: validForm, wantOutcome: CallbackOutcomeOK, wantResult: "00"},
+		{name: "Invalid", form: url.Values{"merchantCode": {"DXXXX"}}, wantOutcome: CallbackOutcomeInvalid},
+		{name: "Forbidden", form: validForm, remoteAddr: "10.0.0.1:1234", wantOutcome: CallbackOutcomeForbidden},
+		{name: "Handler Error", form: validForm, handlerErr: errors.New("database down"), wantOutcome: CallbackOutcomeHandlerError, wantResult: "00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &recordingMetrics{}
+			config := Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", Metrics: metrics}
+			if tt.remoteAddr != "" {
+				allowlist, err := NewIPAllowlist([]string{"182.23.85.11"}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				config.CallbackAllowlist = allowlist
+			}
+			client := &Client{config: config}
+
+			req := httptest.NewRequest("POST", "/callback", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			client.HandleCallback(httptest.NewRecorder(), req, func(*CallbackData) error { return tt.handlerErr })
+
+			if len(metrics.counters) != 1 || len(metrics.observations) != 1 {
+				t.Fatalf("counters = %d, observations = %d, want 1 and 1", len(metrics.counters), len(metrics.observations))
+			}
+			labels := metrics.counters[0].labels
+			if metrics.counters[0].name != MetricCallbacks || metrics.observations[0].name != MetricCallbackDuration {
+				t.Errorf("names = %s, %s", metrics.counters[0].name, metrics.observations[0].name)
+			}
+			if labels["outcome"] != tt.wantOutcome || labels["result_code"] != tt.wantResult {
+				t.Errorf("labels = %v, want outcome %s and result_code %s", labels, tt.wantOutcome, tt.wantResult)
+			}
+			if tt.wantResult != "" && labels["payment_method"] != "VC" {
+				t.Errorf("payment_method = %q, want VC", labels["payment_method"])
+			}
+		})
+	}
+}
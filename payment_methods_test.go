@@ -2,11 +2,14 @@ package duitku
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/fatkulnurk/duitku-go/cassette"
 )
 
 func TestGetPaymentMethods(t *testing.T) {
@@ -74,7 +77,7 @@ func TestGetPaymentMethods(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -125,7 +128,7 @@ func TestGetPaymentMethodsError(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -157,7 +160,7 @@ func TestGetPaymentMethodsServerError(t *testing.T) {
 		IsSandbox:    true,
 	})
 	// Override the base URL to use the test server
-	client.baseURL = server.URL
+	client.baseURLs.Payment = server.URL
 
 	// Test getting payment methods with server error
 	_, err := client.GetPaymentMethods(10000)
@@ -187,7 +190,7 @@ func TestGetPaymentMethodsInvalidJSON(t *testing.T) {
 		IsSandbox:    true,
 	})
 	// Override the base URL to use the test server
-	client.baseURL = server.URL
+	client.baseURLs.Payment = server.URL
 
 	// Test getting payment methods with invalid JSON response
 	_, err := client.GetPaymentMethods(10000)
@@ -213,7 +216,7 @@ func TestGetPaymentMethodsWithNetworkError(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    "http://invalid-url-that-will-cause-error",
+		baseURLs:   BaseURLs{Payment: "http://invalid-url-that-will-cause-error"},
 		httpClient: &http.Client{Timeout: 1 * time.Second}, // Short timeout to fail quickly
 	}
 
@@ -230,3 +233,29 @@ func TestGetPaymentMethodsWithNetworkError(t *testing.T) {
 		t.Errorf("Expected error about request or connection, got: %v", err)
 	}
 }
+
+func TestGetPaymentMethodsReplay(t *testing.T) {
+	// The recorded datetime and signature differ from the replayed request
+	recorder, err := cassette.New("testdata/cassettes/get_payment_methods.json", cassette.Options{})
+	if err != nil {
+		t.Fatalf("cassette.New() error = %v", err)
+	}
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+		HTTPClient:   recorder.Client(),
+	})
+
+	paymentMethods, err := client.GetPaymentMethods(10000)
+	if err != nil {
+		t.Fatalf("GetPaymentMethods() error = %v", err)
+	}
+	if len(paymentMethods) != 3 || paymentMethods[2].PaymentMethod != "SP" || paymentMethods[2].TotalFee != "70" {
+		t.Errorf("GetPaymentMethods() = %+v", paymentMethods)
+	}
+
+	if _, err := client.GetPaymentMethods(20000); !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("GetPaymentMethods() of an unrecorded amount error = %v, want ErrNoInteraction", err)
+	}
+}
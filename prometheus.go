@@ -0,0 +1,273 @@
+package duitku
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultHistogramBuckets are the upper bounds, in seconds, of the latency
+// histograms of NewPrometheusMetrics
+var DefaultHistogramBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metricHelp is the HELP text of the metrics the client reports
+var metricHelp = map[string]string{
+	MetricRequests:         "Duitku API requests.",
+	MetricRequestDuration:  "Duitku API request latency in seconds.",
+	MetricCallbacks:        "Duitku callbacks received.",
+	MetricCallbackDuration: "Duitku callback handling time in seconds.",
+}
+
+// PrometheusMetrics is a Metrics implementation that keeps the samples in
+// memory and serves them in the Prometheus text exposition format
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]map[string]*counterSeries
+	histograms map[string]map[string]*histogramSeries
+}
+
+// counterSeries is one labelled counter
+type counterSeries struct {
+	labels Labels
+	value  float64
+}
+
+// histogramSeries is one labelled histogram. counts are per bucket, not
+// cumulative.
+type histogramSeries struct {
+	labels Labels
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics with the histogram
+// bucket upper bounds, DefaultHistogramBuckets when none are given
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return &PrometheusMetrics{
+		buckets:    sorted,
+		counters:   make(map[string]map[string]*counterSeries),
+		histograms: make(map[string]map[string]*histogramSeries),
+	}
+}
+
+// IncCounter adds one to the counter with the labels
+func (m *PrometheusMetrics) IncCounter(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]*counterSeries)
+		m.counters[name] = series
+	}
+	key := labelKey(labels)
+	counter, ok := series[key]
+	if !ok {
+		counter = &counterSeries{labels: copyLabels(labels)}
+		series[key] = counter
+	}
+	counter.value++
+}
+
+// ObserveHistogram records value in the histogram with the labels
+func (m *PrometheusMetrics) ObserveHistogram(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.histograms[name]
+	if !ok {
+		series = make(map[string]*histogramSeries)
+		m.histograms[name] = series
+	}
+	key := labelKey(labels)
+	histogram, ok := series[key]
+	if !ok {
+		histogram = &histogramSeries{labels: copyLabels(labels), counts: make([]uint64, len(m.buckets))}
+		series[key] = histogram
+	}
+
+	for i, bound := range m.buckets {
+		if value <= bound {
+			histogram.counts[i]++
+			break
+		}
+	}
+	histogram.sum += value
+	histogram.count++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := &countingWriter{w: bufio.NewWriter(w)}
+
+	counterNames := make([]string, 0, len(m.counters))
+	for name := range m.counters {
+		counterNames = append(counterNames, name)
+	}
+	sort.Strings(counterNames)
+	for _, name := range counterNames {
+		writeHeader(out, name, "counter")
+		series := m.counters[name]
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			counter := series[key]
+			fmt.Fprintf(out, "%s%s %s\n", name, formatLabels(counter.labels, ""), formatFloat(counter.value))
+		}
+	}
+
+	histogramNames := make([]string, 0, len(m.histograms))
+	for name := range m.histograms {
+		histogramNames = append(histogramNames, name)
+	}
+	sort.Strings(histogramNames)
+	for _, name := range histogramNames {
+		writeHeader(out, name, "histogram")
+		series := m.histograms[name]
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			histogram := series[key]
+			var cumulative uint64
+			for i, bound := range m.buckets {
+				cumulative += histogram.counts[i]
+				fmt.Fprintf(out, "%s_bucket%s %d\n", name, formatLabels(histogram.labels, formatFloat(bound)), cumulative)
+			}
+			fmt.Fprintf(out, "%s_bucket%s %d\n", name, formatLabels(histogram.labels, "+Inf"), histogram.count)
+			fmt.Fprintf(out, "%s_sum%s %s\n", name, formatLabels(histogram.labels, ""), formatFloat(histogram.sum))
+			fmt.Fprintf(out, "%s_count%s %d\n", name, formatLabels(histogram.labels, ""), histogram.count)
+		}
+	}
+
+	if err := out.w.Flush(); err != nil {
+		return out.n, err
+	}
+	return out.n, out.err
+}
+
+// countingWriter counts the bytes written and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, metricType string) {
+	if help, ok := metricHelp[name]; ok {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// formatLabels formats labels sorted by name, adding le when it is not empty
+func formatLabels(labels Labels, le string) string {
+	names := labelNames(labels)
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[name]))
+		b.WriteByte('"')
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`le="`)
+		b.WriteString(le)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelValueEscaper escapes label values as the text format requires
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// formatFloat formats a sample value
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// labelKey identifies a label set independent of map order
+func labelKey(labels Labels) string {
+	var b strings.Builder
+	for _, name := range labelNames(labels) {
+		b.WriteString(name)
+		b.WriteByte(0xff)
+		b.WriteString(labels[name])
+		b.WriteByte(0xfe)
+	}
+	return b.String()
+}
+
+// copyLabels copies labels so callers may reuse their map
+func copyLabels(labels Labels) Labels {
+	copied := make(Labels, len(labels))
+	for name, value := range labels {
+		copied[name] = value
+	}
+	return copied
+}
+
+// labelNames returns the label names in order
+func labelNames(labels Labels) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,68 @@
+package duitku
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := NewPrometheusMetrics(0.1, 1)
+
+	labels := Labels{"endpoint": "merchant/v2/inquiry", "status": "200"}
+	metrics.IncCounter(MetricRequests, labels)
+	metrics.IncCounter(MetricRequests, Labels{"status": "200", "endpoint": "merchant/v2/inquiry"})
+	metrics.IncCounter(MetricRequests, Labels{"endpoint": "merchant/transactionStatus", "status": "503"})
+	metrics.ObserveHistogram(MetricRequestDuration, 0.05, labels)
+	metrics.ObserveHistogram(MetricRequestDuration, 0.5, labels)
+	metrics.ObserveHistogram(MetricRequestDuration, 3, labels)
+	metrics.IncCounter("custom_total", Labels{"note": "say \"hi\"\\\n"})
+
+	// Callers may reuse their label maps
+	labels["status"] = "500"
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", contentType)
+	}
+
+	want := `# TYPE custom_total counter
+custom_total{note="say \"hi\"\\\n"} 1
+# HELP duitku_requests_total Duitku API requests.
+# TYPE duitku_requests_total counter
+duitku_requests_total{endpoint="merchant/transactionStatus",status="503"} 1
+duitku_requests_total{endpoint="merchant/v2/inquiry",status="200"} 2
+# HELP duitku_request_duration_seconds Duitku API request latency in seconds.
+# TYPE duitku_request_duration_seconds histogram
+duitku_request_duration_seconds_bucket{endpoint="merchant/v2/inquiry",status="200",le="0.1"} 1
+duitku_request_duration_seconds_bucket{endpoint="merchant/v2/inquiry",status="200",le="1"} 2
+duitku_request_duration_seconds_bucket{endpoint="merchant/v2/inquiry",status="200",le="+Inf"} 3
+duitku_request_duration_seconds_sum{endpoint="merchant/v2/inquiry",status="200"} 3.55
+duitku_request_duration_seconds_count{endpoint="merchant/v2/inquiry",status="200"} 3
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrometheusMetricsWithClient(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	client := &Client{config: Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", Metrics: metrics}}
+
+	req := httptest.NewRequest("POST", "/callback", strings.NewReader("merchantCode=DXXXX"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client.HandleCallback(httptest.NewRecorder(), req, func(*CallbackData) error { return nil })
+
+	var b strings.Builder
+	if _, err := metrics.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if !strings.Contains(b.String(), `duitku_callbacks_total{outcome="invalid",payment_method="",result_code=""} 1`) {
+		t.Errorf("metrics =\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), `duitku_callback_duration_seconds_count{outcome="invalid",payment_method="",result_code=""} 1`) {
+		t.Errorf("metrics =\n%s", b.String())
+	}
+}
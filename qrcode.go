@@ -0,0 +1,78 @@
+package duitku
+
+import (
+	"errors"
+
+	"github.com/fatkulnurk/duitku-go/qrcode"
+)
+
+// Default QR code rendering options
+const (
+	DefaultQRCodeSize  = 256
+	DefaultQRCodeLevel = qrcode.LevelMedium
+)
+
+// ErrNoQRString is returned when rendering a QR code for a response without a QR string
+var ErrNoQRString = errors.New("transaction response has no QR string")
+
+// QRCodeOptions controls how a QRIS payload is rendered
+type QRCodeOptions struct {
+	// Size is the width and height of the image in pixels. Defaults to DefaultQRCodeSize.
+	Size int
+	// QuietZone is the light border in modules. Defaults to qrcode.DefaultQuietZone.
+	QuietZone int
+	// NoQuietZone renders the symbol without a border, for pages that
+	// already surround it with enough light space. QuietZone is ignored.
+	NoQuietZone bool
+	// Level is the error correction level. Defaults to DefaultQRCodeLevel.
+	Level qrcode.Level
+}
+
+// withDefaults returns a copy of the options with zero values replaced by defaults
+func (o *QRCodeOptions) withDefaults() QRCodeOptions {
+	var opts QRCodeOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Size <= 0 {
+		opts.Size = DefaultQRCodeSize
+	}
+	if opts.NoQuietZone {
+		opts.QuietZone = 0
+	} else if opts.QuietZone <= 0 {
+		opts.QuietZone = qrcode.DefaultQuietZone
+	}
+	if opts.Level == 0 {
+		opts.Level = DefaultQRCodeLevel
+	}
+	return opts
+}
+
+// QRCode encodes the QR string of the response. Options may be nil.
+func (r *TransactionResponse) QRCode(opts *QRCodeOptions) (*qrcode.Code, error) {
+	if r.QrString == "" {
+		return nil, ErrNoQRString
+	}
+	o := opts.withDefaults()
+	return qrcode.Encode([]byte(r.QrString), o.Level)
+}
+
+// QRCodePNG renders the QR string of the response as a PNG image. Options may be nil.
+func (r *TransactionResponse) QRCodePNG(opts *QRCodeOptions) ([]byte, error) {
+	code, err := r.QRCode(opts)
+	if err != nil {
+		return nil, err
+	}
+	o := opts.withDefaults()
+	return code.PNG(o.Size, o.QuietZone)
+}
+
+// QRCodeSVG renders the QR string of the response as an SVG document. Options may be nil.
+func (r *TransactionResponse) QRCodeSVG(opts *QRCodeOptions) ([]byte, error) {
+	code, err := r.QRCode(opts)
+	if err != nil {
+		return nil, err
+	}
+	o := opts.withDefaults()
+	return code.SVG(o.Size, o.QuietZone), nil
+}
@@ -0,0 +1,353 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// sampleQRIS is the QR string from the Duitku transaction response documentation
+const sampleQRIS = "00020101021226660014ID.DANA.WWW011893600911002151500102152006170915150010303UME51450015ID.OR.GPNQR.WWW02150000000000000000303UME520454995802ID5911Toko Jualan6013Jakarta Barat61051153062210117LQKI2LPMJQPKCIIS553033605405400006304502A"
+
+// decode reads a symbol back into its payload, verifying the format
+// information, version information and every Reed-Solomon block on the way
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+
+	// Format information from the copy around the top-left finder
+	format := 0
+	read := func(x, y, i int) {
+		if c.Black(x, y) {
+			format |= 1 << uint(i)
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(8, i, i)
+	}
+	read(8, 7, 6)
+	read(8, 8, 7)
+	read(7, 8, 8)
+	for i := 9; i < 15; i++ {
+		read(14-i, 8, i)
+	}
+
+	var level Level
+	mask := -1
+	for _, l := range []Level{LevelLow, LevelMedium, LevelQuartile, LevelHigh} {
+		for m := 0; m < 8; m++ {
+			if formatInfo(l, m) == format {
+				level, mask = l, m
+			}
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("decode() format bits %015b do not match any level/mask", format)
+	}
+	if level != c.Level || mask != c.Mask {
+		t.Fatalf("decode() format = %v/%d, want %v/%d", level, mask, c.Level, c.Mask)
+	}
+
+	version := (c.Size - 17) / 4
+	if version >= 7 {
+		info := 0
+		for i := 0; i < 18; i++ {
+			if c.Black(c.Size-11+i%3, i/3) {
+				info |= 1 << uint(i)
+			}
+		}
+		if info != versionInfo(version) {
+			t.Fatalf("decode() version bits %018b, want %018b", info, versionInfo(version))
+		}
+	}
+
+	// Read the codewords through a fresh function pattern map
+	template := newCode(version, level)
+	rawCodewords := numRawDataModules(version) / 8
+	raw := make([]byte, rawCodewords)
+	i := 0
+	template.walkDataModules(func(x, y int) {
+		if i < rawCodewords*8 {
+			if c.Black(x, y) != maskBit(mask, x, y) {
+				raw[i>>3] |= 1 << uint(7-i&7)
+			}
+			i++
+		}
+	})
+
+	// De-interleave and check each block
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortBlockLen; i++ {
+		for j := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+
+	divisor := reedSolomonDivisor(eccLen)
+	var data []byte
+	for j, block := range blocks {
+		dataLen := len(block) - eccLen
+		if got := reedSolomonRemainder(block[:dataLen], divisor); !bytes.Equal(got, block[dataLen:]) {
+			t.Fatalf("decode() block %d ecc = %v, want %v", j, block[dataLen:], got)
+		}
+		data = append(data, block[:dataLen]...)
+	}
+
+	// Parse the byte mode segment
+	var bits []bool
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, b>>uint(i)&1 != 0)
+		}
+	}
+	pos := 0
+	take := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v <<= 1
+			if bits[pos] {
+				v |= 1
+			}
+			pos++
+		}
+		return v
+	}
+	if mode := take(4); mode != 0x4 {
+		t.Fatalf("decode() mode = %04b, want 0100", mode)
+	}
+	n := take(charCountBits(version))
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(take(8))
+	}
+	return payload
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		level   Level
+		version int
+	}{
+		{name: "Short Low", data: "hello", level: LevelLow, version: 1},
+		{name: "Full Version 1 Medium", data: strings.Repeat("x", 14), level: LevelMedium, version: 1},
+		{name: "Overflow Version 1 Medium", data: strings.Repeat("x", 15), level: LevelMedium, version: 2},
+		{name: "QRIS Medium", data: sampleQRIS, level: LevelMedium, version: 11},
+		{name: "QRIS High", data: sampleQRIS, level: LevelHigh, version: 16},
+		{name: "Version 10 Boundary", data: strings.Repeat("a", 213), level: LevelMedium, version: 10},
+		{name: "Large Quartile", data: strings.Repeat("0123456789", 100), level: LevelQuartile, version: 31},
+		{name: "Empty", data: "", level: LevelLow, version: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode([]byte(tt.data), tt.level)
+			if err != nil {
+				t.Fatalf("Encode() error = %v, want nil", err)
+			}
+			if code.Version != tt.version {
+				t.Errorf("Encode() version = %d, want %d", code.Version, tt.version)
+			}
+			if code.Size != tt.version*4+17 {
+				t.Errorf("Encode() size = %d, want %d", code.Size, tt.version*4+17)
+			}
+			if got := decode(t, code); string(got) != tt.data {
+				t.Errorf("decode() = %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	_, err := Encode(make([]byte, 2954), LevelLow)
+	if !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("Encode() error = %v, want ErrDataTooLong", err)
+	}
+
+	// The largest payload that fits must still encode
+	code, err := Encode(make([]byte, 2953), LevelLow)
+	if err != nil {
+		t.Fatalf("Encode() error = %v, want nil", err)
+	}
+	if code.Version != 40 {
+		t.Errorf("Encode() version = %d, want 40", code.Version)
+	}
+}
+
+func TestEncodeInvalidLevel(t *testing.T) {
+	if _, err := Encode([]byte("x"), Level(0)); err == nil {
+		t.Errorf("Encode() error = nil, want error for invalid level")
+	}
+}
+
+func TestByteCapacity(t *testing.T) {
+	// Byte mode capacities from ISO/IEC 18004 table 7
+	tests := []struct {
+		version int
+		level   Level
+		want    int
+	}{
+		{1, LevelLow, 17},
+		{1, LevelMedium, 14},
+		{1, LevelQuartile, 11},
+		{1, LevelHigh, 7},
+		{10, LevelLow, 271},
+		{10, LevelMedium, 213},
+		{10, LevelQuartile, 151},
+		{10, LevelHigh, 119},
+		{40, LevelLow, 2953},
+		{40, LevelMedium, 2331},
+		{40, LevelQuartile, 1663},
+		{40, LevelHigh, 1273},
+	}
+
+	for _, tt := range tests {
+		got := (numDataCodewords(tt.version, tt.level)*8 - 4 - charCountBits(tt.version)) / 8
+		if got != tt.want {
+			t.Errorf("capacity(%d-%v) = %d, want %d", tt.version, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestFormatInfo(t *testing.T) {
+	// Format information strings from ISO/IEC 18004 table C.1
+	tests := []struct {
+		level Level
+		mask  int
+		want  string
+	}{
+		{LevelLow, 0, "111011111000100"},
+		{LevelLow, 1, "111001011110011"},
+		{LevelLow, 7, "110100101110110"},
+		{LevelMedium, 0, "101010000010010"},
+		{LevelMedium, 5, "100000011001110"},
+		{LevelQuartile, 0, "011010101011111"},
+		{LevelHigh, 0, "001011010001001"},
+		{LevelHigh, 7, "000100000111011"},
+	}
+
+	for _, tt := range tests {
+		got := formatInfo(tt.level, tt.mask)
+		if want := parseBits(tt.want); got != want {
+			t.Errorf("formatInfo(%v, %d) = %015b, want %s", tt.level, tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	// Version information strings from ISO/IEC 18004 table D.1
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{7, "000111110010010100"},
+		{8, "001000010110111100"},
+		{21, "010101011010000011"},
+		{40, "101000110001101001"},
+	}
+
+	for _, tt := range tests {
+		got := versionInfo(tt.version)
+		if want := parseBits(tt.want); got != want {
+			t.Errorf("versionInfo(%d) = %018b, want %s", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	tests := []struct {
+		version int
+		want    []int
+	}{
+		{1, nil},
+		{2, []int{6, 18}},
+		{7, []int{6, 22, 38}},
+		{32, []int{6, 34, 60, 86, 112, 138}},
+		{36, []int{6, 24, 50, 76, 102, 128, 154}},
+		{40, []int{6, 30, 58, 86, 114, 142, 170}},
+	}
+
+	for _, tt := range tests {
+		got := alignmentPatternPositions(tt.version)
+		if len(got) != len(tt.want) {
+			t.Errorf("alignmentPatternPositions(%d) = %v, want %v", tt.version, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("alignmentPatternPositions(%d) = %v, want %v", tt.version, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// "HELLO WORLD" at 1-M, the worked example from the thonky.com QR tutorial
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Errorf("reedSolomonRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	// "Hi" at 1-L: mode 0100, count 00000010, 'H', 'i', terminator, then pad bytes
+	got := encodeData([]byte("Hi"), 1, LevelLow)
+	want := []byte{0x40, 0x24, 0x86, 0x90, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeData() = % X, want % X", got, want)
+	}
+}
+
+func TestFunctionPatterns(t *testing.T) {
+	code, err := Encode([]byte(sampleQRIS), LevelMedium)
+	if err != nil {
+		t.Fatalf("Encode() error = %v, want nil", err)
+	}
+
+	// Finder pattern centers and the dark module
+	for _, p := range [][2]int{{3, 3}, {code.Size - 4, 3}, {3, code.Size - 4}, {8, code.Size - 8}} {
+		if !code.Black(p[0], p[1]) {
+			t.Errorf("Black(%d, %d) = false, want true", p[0], p[1])
+		}
+	}
+
+	// Separators are light
+	if code.Black(7, 7) || code.Black(code.Size-8, 7) || code.Black(7, code.Size-8) {
+		t.Errorf("separator modules should be light")
+	}
+
+	// Timing pattern alternates
+	for i := 8; i < code.Size-8; i++ {
+		if code.Black(i, 6) != (i%2 == 0) || code.Black(6, i) != (i%2 == 0) {
+			t.Errorf("timing pattern broken at %d", i)
+		}
+	}
+
+	if code.Black(-1, 0) || code.Black(0, code.Size) {
+		t.Errorf("Black() outside the symbol should be false")
+	}
+}
+
+func parseBits(s string) int {
+	v := 0
+	for _, ch := range s {
+		v <<= 1
+		if ch == '1' {
+			v |= 1
+		}
+	}
+	return v
+}
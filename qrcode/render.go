@@ -0,0 +1,86 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// DefaultQuietZone is the light border, in modules, required by the standard
+const DefaultQuietZone = 4
+
+// Image renders the symbol as a size x size pixel image surrounded by
+// quietZone light modules. Each module is drawn with the largest whole
+// number of pixels that fits, and the symbol is centered in the image.
+// A size smaller than the module count is raised to one pixel per module.
+func (c *Code) Image(size, quietZone int) image.Image {
+	if quietZone < 0 {
+		quietZone = 0
+	}
+	modules := c.Size + 2*quietZone
+	if size < modules {
+		size = modules
+	}
+	scale := size / modules
+	offset := (size-modules*scale)/2 + quietZone*scale
+
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				row := (offset+y*scale+py)*img.Stride + offset + x*scale
+				for px := 0; px < scale; px++ {
+					img.Pix[row+px] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG renders the symbol as a PNG image, see Image for the sizing rules
+func (c *Code) PNG(size, quietZone int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.Image(size, quietZone)); err != nil {
+		return nil, fmt.Errorf("qrcode: error encoding png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the symbol as a standalone SVG document of size x size pixels.
+// Modules are drawn in a viewBox of one unit per module so the output scales
+// without blurring.
+func (c *Code) SVG(size, quietZone int) []byte {
+	if quietZone < 0 {
+		quietZone = 0
+	}
+	modules := c.Size + 2*quietZone
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	buf.WriteString(`<path fill="#000000" d="`)
+	first := true
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			if !first {
+				buf.WriteByte(' ')
+			}
+			first = false
+			fmt.Fprintf(&buf, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone)
+		}
+	}
+	buf.WriteString(`"/>` + "\n</svg>\n")
+	return buf.Bytes()
+}
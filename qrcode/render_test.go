@@ -0,0 +1,87 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestPNG(t *testing.T) {
+	code, err := Encode([]byte("https://sandbox.duitku.com"), LevelMedium)
+	if err != nil {
+		t.Fatalf("Encode() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name      string
+		size      int
+		quietZone int
+		wantSize  int
+	}{
+		{name: "Exact Multiple", size: (code.Size + 8) * 4, quietZone: 4, wantSize: (code.Size + 8) * 4},
+		{name: "Uneven Size", size: 300, quietZone: 4, wantSize: 300},
+		{name: "No Quiet Zone", size: 200, quietZone: 0, wantSize: 200},
+		{name: "Too Small", size: 10, quietZone: 2, wantSize: code.Size + 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := code.PNG(tt.size, tt.quietZone)
+			if err != nil {
+				t.Fatalf("PNG() error = %v, want nil", err)
+			}
+
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("png.Decode() error = %v", err)
+			}
+			bounds := img.Bounds()
+			if bounds.Dx() != tt.wantSize || bounds.Dy() != tt.wantSize {
+				t.Fatalf("PNG() size = %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), tt.wantSize, tt.wantSize)
+			}
+
+			// Sample the center of every module and compare with the symbol
+			modules := code.Size + 2*tt.quietZone
+			scale := tt.wantSize / modules
+			offset := (tt.wantSize-modules*scale)/2 + tt.quietZone*scale
+			for y := -tt.quietZone; y < code.Size+tt.quietZone; y++ {
+				for x := -tt.quietZone; x < code.Size+tt.quietZone; x++ {
+					r, _, _, _ := img.At(offset+x*scale+scale/2, offset+y*scale+scale/2).RGBA()
+					if dark := r == 0; dark != code.Black(x, y) {
+						t.Fatalf("pixel for module (%d, %d) dark = %v, want %v", x, y, dark, code.Black(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSVG(t *testing.T) {
+	code, err := Encode([]byte("hello"), LevelLow)
+	if err != nil {
+		t.Fatalf("Encode() error = %v, want nil", err)
+	}
+
+	svg := string(code.SVG(128, 4))
+	if !strings.Contains(svg, `width="128" height="128" viewBox="0 0 29 29"`) {
+		t.Errorf("SVG() missing dimensions, got %s", svg[:200])
+	}
+
+	dark := 0
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				dark++
+			}
+		}
+	}
+	if got := strings.Count(svg, "h1v1h-1z"); got != dark {
+		t.Errorf("SVG() dark modules = %d, want %d", got, dark)
+	}
+
+	// Top-left finder corner, offset by the quiet zone
+	if !strings.Contains(svg, `d="M4,4h1v1h-1z`) {
+		t.Errorf("SVG() path should start at the finder corner")
+	}
+}
@@ -0,0 +1,117 @@
+package duitku
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/fatkulnurk/duitku-go/qrcode"
+)
+
+const testQrString = "00020101021226660014ID.DANA.WWW011893600911002151500102152006170915150010303UME51450015ID.OR.GPNQR.WWW02150000000000000000303UME520454995802ID5911Toko Jualan6013Jakarta Barat61051153062210117LQKI2LPMJQPKCIIS553033605405400006304502A"
+
+func TestQRCodePNG(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *QRCodeOptions
+		wantSize int
+	}{
+		{
+			name:     "Default Options",
+			opts:     nil,
+			wantSize: DefaultQRCodeSize,
+		},
+		{
+			name:     "Custom Size",
+			opts:     &QRCodeOptions{Size: 512, QuietZone: 2, Level: qrcode.LevelHigh},
+			wantSize: 512,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &TransactionResponse{QrString: testQrString}
+
+			data, err := response.QRCodePNG(tt.opts)
+			if err != nil {
+				t.Fatalf("QRCodePNG() error = %v, want nil", err)
+			}
+
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("png.Decode() error = %v", err)
+			}
+			if img.Bounds().Dx() != tt.wantSize {
+				t.Errorf("QRCodePNG() width = %d, want %d", img.Bounds().Dx(), tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestQRCodeQuietZone(t *testing.T) {
+	response := &TransactionResponse{QrString: testQrString}
+	code, err := response.QRCode(nil)
+	if err != nil {
+		t.Fatalf("QRCode() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     *QRCodeOptions
+		wantSize int
+	}{
+		{name: "Default", opts: &QRCodeOptions{Size: 1}, wantSize: code.Size + 2*qrcode.DefaultQuietZone},
+		{name: "Custom", opts: &QRCodeOptions{Size: 1, QuietZone: 1}, wantSize: code.Size + 2},
+		{name: "None", opts: &QRCodeOptions{Size: 1, QuietZone: 2, NoQuietZone: true}, wantSize: code.Size},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A size below the module count renders one pixel per module
+			data, err := response.QRCodePNG(tt.opts)
+			if err != nil {
+				t.Fatalf("QRCodePNG() error = %v, want nil", err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("png.Decode() error = %v", err)
+			}
+			if img.Bounds().Dx() != tt.wantSize {
+				t.Errorf("QRCodePNG() width = %d, want %d", img.Bounds().Dx(), tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestQRCodeSVG(t *testing.T) {
+	response := &TransactionResponse{QrString: testQrString}
+
+	svg, err := response.QRCodeSVG(&QRCodeOptions{Size: 300})
+	if err != nil {
+		t.Fatalf("QRCodeSVG() error = %v, want nil", err)
+	}
+	if !strings.Contains(string(svg), `width="300" height="300"`) {
+		t.Errorf("QRCodeSVG() missing size attributes")
+	}
+
+	code, err := response.QRCode(nil)
+	if err != nil {
+		t.Fatalf("QRCode() error = %v, want nil", err)
+	}
+	if code.Level != DefaultQRCodeLevel {
+		t.Errorf("QRCode() level = %v, want %v", code.Level, DefaultQRCodeLevel)
+	}
+}
+
+func TestQRCodeWithoutQrString(t *testing.T) {
+	response := &TransactionResponse{VANumber: "7007014001444348"}
+
+	if _, err := response.QRCodePNG(nil); !errors.Is(err, ErrNoQRString) {
+		t.Errorf("QRCodePNG() error = %v, want ErrNoQRString", err)
+	}
+	if _, err := response.QRCodeSVG(nil); !errors.Is(err, ErrNoQRString) {
+		t.Errorf("QRCodeSVG() error = %v, want ErrNoQRString", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package reconcile matches Duitku settlement and transaction reports to
+// the merchant's own orders.
+//
+// ParseReport reads a report exported from the Duitku dashboard as CSV,
+// including spreadsheets saved as CSV, into typed rows. Reconcile compares
+// the rows with the orders and reports the orders missing from the report,
+// the rows without an order, and the rows whose amount or fee differs:
+//
+//	f, err := os.Open("settlement-2024-01-31.csv")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer f.Close()
+//
+//	rows, err := reconcile.ParseReport(f, reconcile.ParseOptions{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	result, err := reconcile.ReconcileSource(rows, orderStore, reconcile.Options{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	for _, order := range result.Missing {
+//		log.Printf("%s is not in the report", order.MerchantOrderID)
+//	}
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNoPeriod is returned by ReconcileSource when neither the options nor
+// the rows give the period to load orders for
+var ErrNoPeriod = errors.New("reconcile: no period to load orders for")
+
+// DefaultLookback is how far before the earliest transaction date of a
+// report ReconcileSource loads orders, for orders paid the day after they
+// were placed
+const DefaultLookback = 24 * time.Hour
+
+// Order is a payment the merchant expects to find in the report
+type Order struct {
+	MerchantOrderID string
+	// Amount is the amount the customer pays, in rupiah
+	Amount int64
+	// Fee is the fee the merchant expects Duitku to charge, in rupiah
+	Fee int64
+	// CreatedAt is when the order was placed, used to select the orders of
+	// a period
+	CreatedAt time.Time
+}
+
+// OrderSource loads the orders of a period, for example from the
+// merchant's database
+type OrderSource interface {
+	// Orders returns the orders created from from up to, not including, to
+	Orders(from, to time.Time) ([]Order, error)
+}
+
+// Orders is an OrderSource over a slice of orders
+type Orders []Order
+
+// Orders returns the orders created from from up to, not including, to
+func (o Orders) Orders(from, to time.Time) ([]Order, error) {
+	var orders []Order
+	for _, order := range o {
+		if !order.CreatedAt.Before(from) && order.CreatedAt.Before(to) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// Options configures Reconcile
+type Options struct {
+	// From and To bound the period whose orders ReconcileSource loads. When
+	// zero they are taken from the earliest and latest transaction dates of
+	// the rows, To extended to the end of its day.
+	From, To time.Time
+	// Lookback is how far before the earliest transaction date of the rows
+	// ReconcileSource also loads orders when From is zero, since the rows
+	// are dated by payment and an order is placed before it is paid. Orders
+	// of the lookback missing from the report are left out of the result,
+	// as they belong to the previous report. Defaults to DefaultLookback; a
+	// negative Lookback loads no earlier orders.
+	Lookback time.Duration
+	// IgnoreFees skips the fee comparison, for orders whose fee is unknown
+	IgnoreFees bool
+	// Include selects the rows to reconcile, for example to leave out failed
+	// transactions of a transaction report. All rows when nil.
+	Include func(row Row) bool
+}
+
+// Match is an order and its row in the report
+type Match struct {
+	Order Order
+	Row   Row
+}
+
+// Result lists the differences between a report and the orders
+type Result struct {
+	// Matched are the orders found in the report with the expected amount and fee
+	Matched []Match
+	// Missing are the orders not in the report
+	Missing []Order
+	// Extra are the rows without an order
+	Extra []Row
+	// Duplicates are rows repeating the merchant order ID of an earlier row
+	Duplicates []Row
+	// AmountMismatches are the rows whose amount differs from the order
+	AmountMismatches []Match
+	// FeeMismatches are the rows whose fee differs from the order, when the
+	// amount matches
+	FeeMismatches []Match
+}
+
+// OK reports whether the report matches the orders exactly
+func (r *Result) OK() bool {
+	return len(r.Missing) == 0 &&
+		len(r.Extra) == 0 &&
+		len(r.Duplicates) == 0 &&
+		len(r.AmountMismatches) == 0 &&
+		len(r.FeeMismatches) == 0
+}
+
+// Reconcile compares the rows of a report with the orders. Rows are matched
+// by merchant order ID; the result lists orders and rows in report order,
+// missing orders sorted by merchant order ID.
+func Reconcile(rows []Row, orders []Order, options Options) *Result {
+	byID := make(map[string]Order, len(orders))
+	for _, order := range orders {
+		byID[order.MerchantOrderID] = order
+	}
+
+	result := &Result{}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if options.Include != nil && !options.Include(row) {
+			continue
+		}
+		if seen[row.MerchantOrderID] {
+			result.Duplicates = append(result.Duplicates, row)
+			continue
+		}
+		seen[row.MerchantOrderID] = true
+
+		order, ok := byID[row.MerchantOrderID]
+		if !ok {
+			result.Extra = append(result.Extra, row)
+			continue
+		}
+
+		match := Match{Order: order, Row: row}
+		switch {
+		case row.Amount != order.Amount:
+			result.AmountMismatches = append(result.AmountMismatches, match)
+		case !options.IgnoreFees && row.Fee != order.Fee:
+			result.FeeMismatches = append(result.FeeMismatches, match)
+		default:
+			result.Matched = append(result.Matched, match)
+		}
+	}
+
+	for id, order := range byID {
+		if !seen[id] {
+			result.Missing = append(result.Missing, order)
+		}
+	}
+	sort.Slice(result.Missing, func(i, j int) bool {
+		return result.Missing[i].MerchantOrderID < result.Missing[j].MerchantOrderID
+	})
+
+	return result
+}
+
+// ReconcileSource compares the rows of a report with the orders of the
+// report's period loaded from source
+func ReconcileSource(rows []Row, source OrderSource, options Options) (*Result, error) {
+	from, to := options.From, options.To
+	var lookbackFrom time.Time
+	if from.IsZero() || to.IsZero() {
+		first, last := reportPeriod(rows, options.Include)
+		if from.IsZero() && !first.IsZero() {
+			from = first
+			lookbackFrom = first
+			lookback := options.Lookback
+			if lookback == 0 {
+				lookback = DefaultLookback
+			}
+			if lookback > 0 {
+				lookbackFrom = first.Add(-lookback)
+			}
+		}
+		if to.IsZero() && !last.IsZero() {
+			to = time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, last.Location())
+		}
+	}
+	if from.IsZero() || to.IsZero() {
+		return nil, ErrNoPeriod
+	}
+
+	if lookbackFrom.IsZero() {
+		lookbackFrom = from
+	}
+	orders, err := source.Orders(lookbackFrom, to)
+	if err != nil {
+		return nil, fmt.Errorf("error loading orders: %w", err)
+	}
+	return Reconcile(rows, withinPeriod(orders, rows, from), options), nil
+}
+
+// withinPeriod drops the orders placed before from that have no row
+func withinPeriod(orders []Order, rows []Row, from time.Time) []Order {
+	ids := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		ids[row.MerchantOrderID] = true
+	}
+
+	kept := orders[:0:0]
+	for _, order := range orders {
+		if !order.CreatedAt.Before(from) || ids[order.MerchantOrderID] {
+			kept = append(kept, order)
+		}
+	}
+	return kept
+}
+
+// reportPeriod returns the earliest and latest transaction dates of the
+// included rows
+func reportPeriod(rows []Row, include func(Row) bool) (time.Time, time.Time) {
+	var first, last time.Time
+	for _, row := range rows {
+		if row.TransactionDate.IsZero() || (include != nil && !include(row)) {
+			continue
+		}
+		if first.IsZero() || row.TransactionDate.Before(first) {
+			first = row.TransactionDate
+		}
+		if last.IsZero() || row.TransactionDate.After(last) {
+			last = row.TransactionDate
+		}
+	}
+	return first, last
+}
@@ -0,0 +1,133 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	rows := []Row{
+		{MerchantOrderID: "ORDER-1", Amount: 40000, Fee: 1200},
+		{MerchantOrderID: "ORDER-2", Amount: 50000, Fee: 1200},
+		{MerchantOrderID: "ORDER-3", Amount: 40000, Fee: 4000},
+		{MerchantOrderID: "ORDER-9", Amount: 10000},
+		{MerchantOrderID: "ORDER-1", Amount: 40000, Fee: 1200},
+		{MerchantOrderID: "ORDER-7", Amount: 40000, Status: "FAILED"},
+	}
+	orders := []Order{
+		{MerchantOrderID: "ORDER-1", Amount: 40000, Fee: 1200},
+		{MerchantOrderID: "ORDER-2", Amount: 40000, Fee: 1200},
+		{MerchantOrderID: "ORDER-3", Amount: 40000, Fee: 1200},
+		{MerchantOrderID: "ORDER-5", Amount: 40000},
+		{MerchantOrderID: "ORDER-4", Amount: 40000},
+	}
+	include := func(row Row) bool { return row.Status != "FAILED" }
+
+	result := Reconcile(rows, orders, Options{Include: include})
+
+	if result.OK() {
+		t.Error("OK() = true")
+	}
+	if len(result.Matched) != 1 || result.Matched[0].Order.MerchantOrderID != "ORDER-1" {
+		t.Errorf("Matched = %+v", result.Matched)
+	}
+	if len(result.AmountMismatches) != 1 || result.AmountMismatches[0].Row.Amount != 50000 {
+		t.Errorf("AmountMismatches = %+v", result.AmountMismatches)
+	}
+	if len(result.FeeMismatches) != 1 || result.FeeMismatches[0].Row.MerchantOrderID != "ORDER-3" {
+		t.Errorf("FeeMismatches = %+v", result.FeeMismatches)
+	}
+	if len(result.Extra) != 1 || result.Extra[0].MerchantOrderID != "ORDER-9" {
+		t.Errorf("Extra = %+v", result.Extra)
+	}
+	if len(result.Duplicates) != 1 || result.Duplicates[0].MerchantOrderID != "ORDER-1" {
+		t.Errorf("Duplicates = %+v", result.Duplicates)
+	}
+	if len(result.Missing) != 2 || result.Missing[0].MerchantOrderID != "ORDER-4" || result.Missing[1].MerchantOrderID != "ORDER-5" {
+		t.Errorf("Missing = %+v", result.Missing)
+	}
+
+	result = Reconcile(rows[2:3], orders[2:3], Options{IgnoreFees: true})
+	if !result.OK() || len(result.Matched) != 1 {
+		t.Errorf("IgnoreFees result = %+v", result)
+	}
+}
+
+// failingSource is an OrderSource that cannot load orders
+type failingSource struct{}
+
+func (failingSource) Orders(from, to time.Time) ([]Order, error) {
+	return nil, errors.New("database down")
+}
+
+// recordingSource records the period it was asked for
+type recordingSource struct {
+	orders   Orders
+	from, to time.Time
+}
+
+func (s *recordingSource) Orders(from, to time.Time) ([]Order, error) {
+	s.from, s.to = from, to
+	return s.orders.Orders(from, to)
+}
+
+func TestReconcileSource(t *testing.T) {
+	day := func(d, hour int) time.Time { return time.Date(2024, 1, d, hour, 0, 0, 0, time.UTC) }
+	rows := []Row{
+		{MerchantOrderID: "ORDER-1", Amount: 40000, TransactionDate: day(30, 10)},
+		{MerchantOrderID: "ORDER-2", Amount: 40000, TransactionDate: day(31, 9)},
+	}
+	source := &recordingSource{orders: Orders{
+		{MerchantOrderID: "ORDER-0", Amount: 40000, CreatedAt: day(29, 23)},
+		{MerchantOrderID: "ORDER-1", Amount: 40000, CreatedAt: day(30, 10)},
+		{MerchantOrderID: "ORDER-2", Amount: 40000, CreatedAt: day(31, 9)},
+		{MerchantOrderID: "ORDER-3", Amount: 40000, CreatedAt: day(31, 22)},
+		{MerchantOrderID: "ORDER-4", Amount: 40000, CreatedAt: day(32, 0)},
+	}}
+
+	result, err := ReconcileSource(rows, source, Options{})
+	if err != nil {
+		t.Fatalf("ReconcileSource() error = %v", err)
+	}
+	if !source.from.Equal(day(29, 10)) || !source.to.Equal(day(32, 0)) {
+		t.Errorf("period = %v to %v", source.from, source.to)
+	}
+	if len(result.Matched) != 2 || len(result.Missing) != 1 || result.Missing[0].MerchantOrderID != "ORDER-3" {
+		t.Errorf("result = %+v", result)
+	}
+
+	// An order placed the day before it was paid is found with the lookback
+	paidNextDay := []Row{
+		{MerchantOrderID: "ORDER-0", Amount: 40000, TransactionDate: day(30, 1)},
+		{MerchantOrderID: "ORDER-1", Amount: 40000, TransactionDate: day(30, 10)},
+	}
+	result, err = ReconcileSource(paidNextDay, source, Options{})
+	if err != nil {
+		t.Fatalf("ReconcileSource() error = %v", err)
+	}
+	if len(result.Matched) != 2 || len(result.Extra) != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	result, err = ReconcileSource(paidNextDay, source, Options{Lookback: -1})
+	if err != nil {
+		t.Fatalf("ReconcileSource() error = %v", err)
+	}
+	if !source.from.Equal(day(30, 1)) || len(result.Extra) != 1 || result.Extra[0].MerchantOrderID != "ORDER-0" {
+		t.Errorf("period from %v, result = %+v", source.from, result)
+	}
+
+	if _, err := ReconcileSource(rows, source, Options{From: day(29, 0), To: day(33, 0)}); err != nil {
+		t.Fatalf("ReconcileSource() error = %v", err)
+	}
+	if !source.from.Equal(day(29, 0)) || !source.to.Equal(day(33, 0)) {
+		t.Errorf("period = %v to %v", source.from, source.to)
+	}
+
+	if _, err := ReconcileSource([]Row{{MerchantOrderID: "ORDER-1"}}, source, Options{}); !errors.Is(err, ErrNoPeriod) {
+		t.Errorf("error = %v, want ErrNoPeriod", err)
+	}
+	if _, err := ReconcileSource(rows, failingSource{}, Options{}); err == nil {
+		t.Error("ReconcileSource() error = nil")
+	}
+}
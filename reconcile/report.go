@@ -0,0 +1,373 @@
+package reconcile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoHeader is returned when no row of the report has the required columns
+var ErrNoHeader = errors.New("reconcile: report has no header row with merchant order ID and amount columns")
+
+// Report columns
+const (
+	ColumnMerchantOrderID = "merchantOrderId"
+	ColumnReference       = "reference"
+	ColumnPaymentMethod   = "paymentMethod"
+	ColumnAmount          = "amount"
+	ColumnFee             = "fee"
+	ColumnNetAmount       = "netAmount"
+	ColumnTransactionDate = "transactionDate"
+	ColumnSettlementDate  = "settlementDate"
+	ColumnStatus          = "status"
+)
+
+// DefaultColumnNames are the header names recognised for each column,
+// compared case-insensitively and ignoring spaces, underscores, dots and
+// dashes. They are common English and Indonesian names; add the headers of
+// other exports with ParseOptions.Columns.
+var DefaultColumnNames = map[string][]string{
+	ColumnMerchantOrderID: {"merchantOrderId", "merchant order id", "order id", "orderId", "no order"},
+	ColumnReference:       {"reference", "reference no", "duitku reference", "referensi"},
+	ColumnPaymentMethod:   {"paymentMethod", "payment method", "paymentCode", "payment code", "metode pembayaran"},
+	ColumnAmount:          {"amount", "payment amount", "transaction amount", "jumlah", "nominal"},
+	ColumnFee:             {"fee", "total fee", "transaction fee", "biaya", "mdr"},
+	ColumnNetAmount:       {"netAmount", "net amount", "settlement amount", "nett", "jumlah bersih"},
+	ColumnTransactionDate: {"transactionDate", "transaction date", "created date", "tanggal transaksi", "date"},
+	ColumnSettlementDate:  {"settlementDate", "settlement date", "tanggal settlement", "tanggal pencairan"},
+	ColumnStatus:          {"status", "transaction status", "status transaksi"},
+}
+
+// DateLayouts are the date formats tried for the date columns, after Excel
+// serial dates
+var DateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"20060102",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	"02-01-2006 15:04:05",
+	"02-01-2006",
+	"02 Jan 2006 15:04:05",
+	"02 Jan 2006",
+}
+
+// excelEpoch is day zero of Excel serial dates
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Excel serial dates are only taken between minExcelSerial, 1970-01-01, and
+// maxExcelSerial, 2100-01-01. Smaller numbers such as 2024 or 31 are not
+// dates, and larger ones such as 20240131 are parsed with DateLayouts.
+const (
+	minExcelSerial = 25569
+	maxExcelSerial = 73051
+)
+
+// Row is one transaction of a settlement or transaction report
+type Row struct {
+	// Line is the line of the row in the report, starting at 1
+	Line            int
+	MerchantOrderID string
+	Reference       string
+	PaymentMethod   string
+	// Amount is the amount paid by the customer, in rupiah
+	Amount int64
+	// Fee is the fee charged by Duitku, in rupiah
+	Fee int64
+	// NetAmount is the amount settled to the merchant, in rupiah
+	NetAmount       int64
+	TransactionDate time.Time
+	SettlementDate  time.Time
+	Status          string
+}
+
+// ParseOptions configures ParseReport
+type ParseOptions struct {
+	// Columns adds header names per column to DefaultColumnNames
+	Columns map[string][]string
+	// Comma is the field delimiter. When zero it is detected from the
+	// header row, so semicolon separated exports of spreadsheets with an
+	// Indonesian locale are read as well.
+	Comma rune
+	// Location of dates without a time zone, Asia/Jakarta when nil and
+	// available, UTC otherwise
+	Location *time.Location
+}
+
+// ParseReport reads the rows of a CSV report. Title rows before the header
+// row, empty rows and rows without a merchant order ID, such as totals, are
+// skipped. Amounts may carry a currency and thousands separators.
+func ParseReport(r io.Reader, options ParseOptions) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading report: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	comma := options.Comma
+	if comma == 0 {
+		comma = detectComma(data)
+	}
+	location := options.Location
+	if location == nil {
+		location = defaultLocation()
+	}
+	names := columnNames(options.Columns)
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var (
+		columns map[string]int
+		rows    []Row
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading report: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if columns == nil {
+			columns = headerColumns(record, names)
+			continue
+		}
+
+		row, ok, err := parseRow(record, columns, location)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing report line %d: %w", line, err)
+		}
+		if ok {
+			row.Line = line
+			rows = append(rows, row)
+		}
+	}
+
+	if columns == nil {
+		return nil, ErrNoHeader
+	}
+	return rows, nil
+}
+
+// parseRow parses a record, reporting false for rows to skip
+func parseRow(record []string, columns map[string]int, location *time.Location) (Row, bool, error) {
+	value := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row := Row{
+		MerchantOrderID: value(ColumnMerchantOrderID),
+		Reference:       value(ColumnReference),
+		PaymentMethod:   value(ColumnPaymentMethod),
+		Status:          value(ColumnStatus),
+	}
+	if row.MerchantOrderID == "" {
+		return Row{}, false, nil
+	}
+
+	var err error
+	if row.Amount, err = ParseAmount(value(ColumnAmount)); err != nil {
+		return Row{}, false, fmt.Errorf("error parsing amount: %w", err)
+	}
+	if row.Fee, err = ParseAmount(value(ColumnFee)); err != nil {
+		return Row{}, false, fmt.Errorf("error parsing fee: %w", err)
+	}
+	if row.NetAmount, err = ParseAmount(value(ColumnNetAmount)); err != nil {
+		return Row{}, false, fmt.Errorf("error parsing net amount: %w", err)
+	}
+	if row.TransactionDate, err = ParseDate(value(ColumnTransactionDate), location); err != nil {
+		return Row{}, false, fmt.Errorf("error parsing transaction date: %w", err)
+	}
+	if row.SettlementDate, err = ParseDate(value(ColumnSettlementDate), location); err != nil {
+		return Row{}, false, fmt.Errorf("error parsing settlement date: %w", err)
+	}
+	return row, true, nil
+}
+
+// headerColumns returns the index of each known column in record, or nil
+// when record is not the header row
+func headerColumns(record []string, names map[string]string) map[string]int {
+	columns := make(map[string]int)
+	for i, field := range record {
+		column, ok := names[normalizeHeader(field)]
+		if !ok {
+			continue
+		}
+		if _, seen := columns[column]; !seen {
+			columns[column] = i
+		}
+	}
+
+	_, hasOrderID := columns[ColumnMerchantOrderID]
+	_, hasAmount := columns[ColumnAmount]
+	if !hasOrderID || !hasAmount {
+		return nil
+	}
+	return columns
+}
+
+// columnNames maps normalized header names to columns
+func columnNames(extra map[string][]string) map[string]string {
+	names := make(map[string]string)
+	for _, columns := range []map[string][]string{DefaultColumnNames, extra} {
+		for column, headers := range columns {
+			for _, header := range headers {
+				names[normalizeHeader(header)] = column
+			}
+		}
+	}
+	return names
+}
+
+// normalizeHeader lowercases a header name and removes spaces, underscores, dots and dashes
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.NewReplacer(" ", "", "_", "", ".", "", "-", "").Replace(header)
+}
+
+// detectComma picks the delimiter that occurs most often in the first
+// lines, comma when there is none
+func detectComma(data []byte) rune {
+	counts := make(map[rune]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lines := 0; lines < 10 && scanner.Scan(); lines++ {
+		for _, r := range scanner.Text() {
+			if r == ',' || r == ';' || r == '\t' {
+				counts[r]++
+			}
+		}
+	}
+
+	comma := ','
+	for _, r := range []rune{';', '\t'} {
+		if counts[r] > counts[comma] {
+			comma = r
+		}
+	}
+	return comma
+}
+
+// defaultLocation returns Asia/Jakarta, the time zone of Duitku reports
+func defaultLocation() *time.Location {
+	location, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// ParseAmount parses a rupiah amount such as "40000", "Rp 40.000",
+// "40,000.00" or "IDR 1.250.000,00". An empty value is zero. Fractions must
+// be zero, since rupiah amounts are whole.
+func ParseAmount(value string) (int64, error) {
+	original := value
+	value = strings.TrimSpace(value)
+	for _, prefix := range []string{"IDR", "Rp.", "Rp"} {
+		if len(value) >= len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+			value = value[len(prefix):]
+			break
+		}
+	}
+	value = strings.NewReplacer(" ", "", "\u00a0", "").Replace(value)
+	if value == "" || value == "-" {
+		return 0, nil
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	} else if strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	}
+
+	whole, fraction := splitDecimal(value)
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if strings.Trim(fraction, "0") != "" {
+		return 0, fmt.Errorf("amount %q has a fraction", original)
+	}
+
+	amount, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", original)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// splitDecimal splits an amount at its decimal separator. A separator
+// followed by exactly three digits, or one that occurs more than once, is
+// a thousands separator.
+func splitDecimal(value string) (string, string) {
+	last := strings.LastIndexAny(value, ".,")
+	if last < 0 {
+		return value, ""
+	}
+	separator := value[last : last+1]
+	other := ","
+	if separator == "," {
+		other = "."
+	}
+
+	digits := len(value) - last - 1
+	switch {
+	case strings.Contains(value[:last], other):
+		// Both separators: the last one is decimal
+		return value[:last], value[last+1:]
+	case strings.Count(value, separator) > 1, digits == 3:
+		return value, ""
+	default:
+		return value[:last], value[last+1:]
+	}
+}
+
+// ParseDate parses a report date in one of DateLayouts, or an Excel serial
+// date from 1970 to 2100 as left by spreadsheets that export dates as
+// numbers. An empty value is the zero time.
+func ParseDate(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if location == nil {
+		location = time.UTC
+	}
+
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial >= minExcelSerial && serial < maxExcelSerial {
+		days := math.Floor(serial)
+		seconds := math.Round((serial - days) * 86400)
+		t := excelEpoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location), nil
+	}
+
+	for _, layout := range DateLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", value)
+}
@@ -0,0 +1,164 @@
+package reconcile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		options ParseOptions
+		want    []Row
+	}{
+		{
+			name: "Comma Separated",
+			report: "Merchant Order Id,Reference,Payment Method,Amount,Fee,Net Amount,Transaction Date,Settlement Date,Status\n" +
+				"ORDER-1,DS1001,VC,40000,1200,38800,2024-01-30 10:15:00,2024-01-31,SUCCESS\n" +
+				"ORDER-2,DS1002,M2,\"125,000\",\"4,000\",\"121,000\",2024-01-30 11:00:00,2024-01-31,SUCCESS\n",
+			want: []Row{
+				{Line: 2, MerchantOrderID: "ORDER-1", Reference: "DS1001", PaymentMethod: "VC", Amount: 40000, Fee: 1200, NetAmount: 38800, Status: "SUCCESS"},
+				{Line: 3, MerchantOrderID: "ORDER-2", Reference: "DS1002", PaymentMethod: "M2", Amount: 125000, Fee: 4000, NetAmount: 121000, Status: "SUCCESS"},
+			},
+		},
+		{
+			name: "Spreadsheet Export",
+			report: "\xef\xbb\xbfLaporan Settlement;;;\n" +
+				"Periode 30/01/2024;;;\n" +
+				";;;\n" +
+				"No Order;Referensi;Jumlah;Biaya;Tanggal Transaksi\n" +
+				"ORDER-1;DS1001;Rp 40.000;Rp 1.200;45321.4270833333\n" +
+				";;;\n" +
+				";Total;Rp 40.000;Rp 1.200;\n",
+			want: []Row{
+				{Line: 5, MerchantOrderID: "ORDER-1", Reference: "DS1001", Amount: 40000, Fee: 1200},
+			},
+		},
+		{
+			name:    "Custom Columns",
+			report:  "Invoice\tGross\n" + "ORDER-1\t40000.00\n",
+			options: ParseOptions{Columns: map[string][]string{ColumnMerchantOrderID: {"invoice"}, ColumnAmount: {"gross"}}},
+			want:    []Row{{Line: 2, MerchantOrderID: "ORDER-1", Amount: 40000}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.Location = time.UTC
+			rows, err := ParseReport(strings.NewReader(tt.report), tt.options)
+			if err != nil {
+				t.Fatalf("ParseReport() error = %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("rows = %+v, want %d rows", rows, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := rows[i]
+				got.TransactionDate, got.SettlementDate = time.Time{}, time.Time{}
+				if got != want {
+					t.Errorf("rows[%d] = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseReportDates(t *testing.T) {
+	report := "merchantOrderId,amount,transactionDate,settlementDate\n" +
+		"ORDER-1,40000,2024-01-30 10:15:00,31/01/2024\n" +
+		"ORDER-2,40000,45321.5,\n" +
+		"ORDER-3,40000,20240131,\n"
+
+	rows, err := ParseReport(strings.NewReader(report), ParseOptions{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("ParseReport() error = %v", err)
+	}
+
+	tests := []struct {
+		got  time.Time
+		want time.Time
+	}{
+		{rows[0].TransactionDate, time.Date(2024, 1, 30, 10, 15, 0, 0, time.UTC)},
+		{rows[0].SettlementDate, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{rows[1].TransactionDate, time.Date(2024, 1, 30, 12, 0, 0, 0, time.UTC)},
+		{rows[1].SettlementDate, time.Time{}},
+		{rows[2].TransactionDate, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for i, tt := range tests {
+		if !tt.got.Equal(tt.want) {
+			t.Errorf("date %d = %v, want %v", i, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseReportErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		wantErr error
+		wantMsg string
+	}{
+		{name: "No Header", report: "a,b\n1,2\n", wantErr: ErrNoHeader},
+		{name: "Invalid Amount", report: "merchantOrderId,amount\nORDER-1,forty\n", wantMsg: "line 2"},
+		{name: "Fractional Amount", report: "merchantOrderId,amount\nORDER-1,\"40000,50\"\n", wantMsg: "fraction"},
+		{name: "Invalid Date", report: "merchantOrderId,amount,transactionDate\nORDER-1,40000,yesterday\n", wantMsg: "date"},
+		{name: "Implausible Serial Date", report: "merchantOrderId,amount,transactionDate\nORDER-1,40000,2024013\n", wantMsg: "date"},
+		{name: "Year As Serial Date", report: "merchantOrderId,amount,transactionDate\nORDER-1,40000,2024\n", wantMsg: "date"},
+		{name: "Day As Serial Date", report: "merchantOrderId,amount,transactionDate\nORDER-1,40000,31\n", wantMsg: "date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseReport(strings.NewReader(tt.report), ParseOptions{})
+			if err == nil {
+				t.Fatal("ParseReport() error = nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error = %v, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "-", want: 0},
+		{value: "40000", want: 40000},
+		{value: "40.000", want: 40000},
+		{value: "40,000", want: 40000},
+		{value: "40000.00", want: 40000},
+		{value: "40000,00", want: 40000},
+		{value: "1.250.000", want: 1250000},
+		{value: "1,250,000.00", want: 1250000},
+		{value: "1.250.000,00", want: 1250000},
+		{value: "Rp 40.000", want: 40000},
+		{value: "Rp. 40.000", want: 40000},
+		{value: "IDR 40,000", want: 40000},
+		{value: "-1.200", want: -1200},
+		{value: "(1.200)", want: -1200},
+		{value: "40000.5", wantErr: true},
+		{value: "forty", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownMerchant is returned when no client is registered for a merchant code
+var ErrUnknownMerchant = errors.New("unknown merchant code")
+
+// MerchantRegistry holds a client per Duitku merchant code, for businesses
+// that run several merchant codes (for example one per brand) in one service.
+// Outgoing calls go through the client for the merchant code, and callbacks
+// are verified with the credentials of the merchant code they carry.
+type MerchantRegistry struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+// NewMerchantRegistry creates a registry with a client for each config
+func NewMerchantRegistry(configs ...Config) (*MerchantRegistry, error) {
+	registry := &MerchantRegistry{clients: make(map[string]*Client)}
+	for _, config := range configs {
+		if _, err := registry.Register(config); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Register creates a client for the config and adds it to the registry
+func (r *MerchantRegistry) Register(config Config) (*Client, error) {
+	if config.MerchantCode == "" {
+		return nil, errors.New("merchant code is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clients[config.MerchantCode]; ok {
+		return nil, fmt.Errorf("merchant code %s is already registered", config.MerchantCode)
+	}
+	client := NewClient(config)
+	r.clients[config.MerchantCode] = client
+	return client, nil
+}
+
+// Remove removes the client for the merchant code
+func (r *MerchantRegistry) Remove(merchantCode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, merchantCode)
+}
+
+// Client returns the client for the merchant code
+func (r *MerchantRegistry) Client(merchantCode string) (*Client, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	client, ok := r.clients[merchantCode]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMerchant, merchantCode)
+	}
+	return client, nil
+}
+
+// MerchantCodes returns the registered merchant codes in sorted order
+func (r *MerchantRegistry) MerchantCodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	codes := make([]string, 0, len(r.clients))
+	for code := range r.clients {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// CreateTransaction creates a transaction with the client for the merchant code
+func (r *MerchantRegistry) CreateTransaction(merchantCode string, request TransactionRequest) (*TransactionResponse, error) {
+	client, err := r.Client(merchantCode)
+	if err != nil {
+		return nil, err
+	}
+	return client.CreateTransaction(request)
+}
+
+// CheckTransaction checks a transaction with the client for the merchant code
+func (r *MerchantRegistry) CheckTransaction(merchantCode, merchantOrderID string) (*TransactionStatusResponse, error) {
+	client, err := r.Client(merchantCode)
+	if err != nil {
+		return nil, err
+	}
+	return client.CheckTransaction(merchantOrderID)
+}
+
+// ParseCallback parses the callback and verifies it with the credentials of
+// the merchant code in the callback
+func (r *MerchantRegistry) ParseCallback(req *http.Request) (*CallbackData, error) {
+	values, err := callbackValues(req)
+	if err != nil {
+		return nil, err
+	}
+	client, err := r.Client(values.Get("merchantCode"))
+	if err != nil {
+		return nil, err
+	}
+	return client.callbackFromValues(values)
+}
+
+// HandleCallback handles a callback for any registered merchant code.
+// Sources allowed by no merchant's allowlist get 403 before the body is
+// read; the rejection is reported by the first such merchant in
+// MerchantCodes order, since the callback's merchant is not known yet.
+// Unreadable bodies and unknown merchant codes get 400, reported by the
+// first merchant. The allowlist of the callback's merchant is then checked
+// before the signature.
+func (r *MerchantRegistry) HandleCallback(w http.ResponseWriter, req *http.Request, handler func(*CallbackData) error) {
+	start := time.Now()
+
+	if rejecting, err := r.verifyCallbackSource(req); err != nil {
+		rejecting.rejectCallback(start, CallbackOutcomeForbidden, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Select the merchant's client
+	values, err := callbackValues(req)
+	if err != nil {
+		r.rejectCallback(w, start, err)
+		return
+	}
+	client, err := r.Client(values.Get("merchantCode"))
+	if err != nil {
+		r.rejectCallback(w, start, err)
+		return
+	}
+
+	if err := client.VerifyCallbackSource(req); err != nil {
+		client.rejectCallback(start, CallbackOutcomeForbidden, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	client.serveCallback(w, start, func() (*CallbackData, error) { return client.callbackFromValues(values) }, handler)
+}
+
+// rejectCallback answers an invalid callback whose merchant is not known
+// with 400, reporting it with the first merchant's client
+func (r *MerchantRegistry) rejectCallback(w http.ResponseWriter, start time.Time, err error) {
+	if codes := r.MerchantCodes(); len(codes) > 0 {
+		if client, clientErr := r.Client(codes[0]); clientErr == nil {
+			client.rejectCallback(start, CallbackOutcomeInvalid, err)
+		}
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// verifyCallbackSource checks the source against the union of the
+// merchants' allowlists. When no merchant allows it, it returns the first
+// rejecting client in merchant code order with its error.
+func (r *MerchantRegistry) verifyCallbackSource(req *http.Request) (*Client, error) {
+	codes := r.MerchantCodes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var rejecting *Client
+	var rejectErr error
+	for _, code := range codes {
+		client, ok := r.clients[code]
+		if !ok {
+			continue
+		}
+		err := client.VerifyCallbackSource(req)
+		if err == nil {
+			return nil, nil
+		}
+		if rejecting == nil {
+			rejecting, rejectErr = client, err
+		}
+	}
+	return rejecting, rejectErr
+}
+
+// NewCallbackRouter creates a router that verifies callbacks for every
+// registered merchant code. Handlers can tell merchants apart by
+// CallbackData.MerchantCode.
+func (r *MerchantRegistry) NewCallbackRouter() *CallbackRouter {
+	return &CallbackRouter{
+		handle:  r.HandleCallback,
+		methods: make(map[string]CallbackHandlerFunc),
+	}
+}
@@ -0,0 +1,215 @@
+package duitku
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRegistry(t *testing.T) *MerchantRegistry {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	registry, err := NewMerchantRegistry(
+		Config{MerchantCode: "DBRAND1", APIKey: "KEY1", IsSandbox: true, Logger: logger},
+		Config{MerchantCode: "DBRAND2", APIKey: "KEY2", IsSandbox: true, Logger: logger},
+	)
+	if err != nil {
+		t.Fatalf("NewMerchantRegistry() error = %v", err)
+	}
+	return registry
+}
+
+func TestMerchantRegistryRegister(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	if got := registry.MerchantCodes(); !reflect.DeepEqual(got, []string{"DBRAND1", "DBRAND2"}) {
+		t.Errorf("MerchantCodes() = %v", got)
+	}
+	if _, err := registry.Register(Config{MerchantCode: "DBRAND1", APIKey: "OTHER"}); err == nil {
+		t.Error("Register() duplicate error = nil, want error")
+	}
+	if _, err := registry.Register(Config{APIKey: "KEY3"}); err == nil {
+		t.Error("Register() without merchant code error = nil, want error")
+	}
+	if _, err := registry.Client("DBRAND3"); !errors.Is(err, ErrUnknownMerchant) {
+		t.Errorf("Client() error = %v, want ErrUnknownMerchant", err)
+	}
+
+	registry.Remove("DBRAND2")
+	if _, err := registry.Client("DBRAND2"); !errors.Is(err, ErrUnknownMerchant) {
+		t.Errorf("Client() after Remove error = %v, want ErrUnknownMerchant", err)
+	}
+}
+
+func TestMerchantRegistryCheckTransaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request CheckTransactionRequest
+		json.NewDecoder(r.Body).Decode(&request)
+
+		key := map[string]string{"DBRAND1": "KEY1", "DBRAND2": "KEY2"}[request.MerchantCode]
+		if request.Signature != SignatureMD5(key, request.MerchantCode, request.MerchantOrderID) {
+			t.Errorf("request for %s not signed with its own key", request.MerchantCode)
+		}
+
+		json.NewEncoder(w).Encode(TransactionStatusResponse{
+			MerchantOrderID: request.MerchantOrderID,
+			Reference:       request.MerchantCode + "-REF",
+			StatusCode:      CheckTransactionStatusSuccess,
+		})
+	}))
+	defer server.Close()
+
+	registry := newTestRegistry(t)
+	for _, code := range registry.MerchantCodes() {
+		client, _ := registry.Client(code)
+		client.baseURLs.Payment = server.URL
+	}
+
+	status, err := registry.CheckTransaction("DBRAND2", "ORDER123")
+	if err != nil {
+		t.Fatalf("CheckTransaction() error = %v", err)
+	}
+	if status.Reference != "DBRAND2-REF" {
+		t.Errorf("Reference = %s, want DBRAND2-REF", status.Reference)
+	}
+
+	if _, err := registry.CheckTransaction("DBRAND3", "ORDER123"); !errors.Is(err, ErrUnknownMerchant) {
+		t.Errorf("CheckTransaction() error = %v, want ErrUnknownMerchant", err)
+	}
+}
+
+func TestMerchantRegistryHandleCallback(t *testing.T) {
+	registry := newTestRegistry(t)
+	brand1, _ := registry.Client("DBRAND1")
+	brand2, _ := registry.Client("DBRAND2")
+	unknown := &Client{config: Config{MerchantCode: "DBRAND3", APIKey: "KEY3"}}
+
+	newRequest := func(client *Client, override map[string]string) *http.Request {
+		form := client.NewCallbackData("ORDER123", 40000, PaymentMethodBCA, CallbackStatusSuccess).FormValues()
+		for key, value := range override {
+			form.Set(key, value)
+		}
+		req := httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	tests := []struct {
+		name         string
+		req          *http.Request
+		wantStatus   int
+		wantMerchant string
+	}{
+		{name: "First Merchant", req: newRequest(brand1, nil), wantStatus: http.StatusOK, wantMerchant: "DBRAND1"},
+		{name: "Second Merchant", req: newRequest(brand2, nil), wantStatus: http.StatusOK, wantMerchant: "DBRAND2"},
+		{name: "Unknown Merchant", req: newRequest(unknown, nil), wantStatus: http.StatusBadRequest},
+		// Signed by brand 2 but claiming to be brand 1
+		{name: "Wrong Merchant Key", req: newRequest(brand2, map[string]string{
+			"merchantCode": "DBRAND1",
+			"signature":    SignatureMD5("KEY2", "DBRAND1", "40000", "ORDER123"),
+		}), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			router := registry.NewCallbackRouter().OnSuccess(func(data *CallbackData) error {
+				got = data.MerchantCode
+				return nil
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got != tt.wantMerchant {
+				t.Errorf("handled merchant = %q, want %q", got, tt.wantMerchant)
+			}
+		})
+	}
+}
+
+func TestMerchantRegistryHandleCallbackAllowlist(t *testing.T) {
+	allowlist := func(ip string) *IPAllowlist {
+		list, err := NewIPAllowlist([]string{ip}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	metrics := &recordingMetrics{}
+	logger := log.New(io.Discard, "", 0)
+	registry, err := NewMerchantRegistry(
+		Config{MerchantCode: "DBRAND1", APIKey: "KEY1", Logger: logger, Metrics: metrics, CallbackAllowlist: allowlist("10.0.0.1")},
+		Config{MerchantCode: "DBRAND2", APIKey: "KEY2", Logger: logger, Metrics: metrics, CallbackAllowlist: allowlist("10.0.0.2")},
+	)
+	if err != nil {
+		t.Fatalf("NewMerchantRegistry() error = %v", err)
+	}
+	brand1, _ := registry.Client("DBRAND1")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		body       string
+		wantStatus int
+	}{
+		{name: "Allowed", remoteAddr: "10.0.0.1:443", body: brand1.NewCallbackData("ORDER123", 40000, PaymentMethodBCA, CallbackStatusSuccess).FormValues().Encode(), wantStatus: http.StatusOK},
+		// The body is not looked at for sources no merchant allows
+		{name: "No Merchant Allows", remoteAddr: "192.0.2.1:443", body: "%zz", wantStatus: http.StatusForbidden},
+		{name: "Other Merchant Allows", remoteAddr: "10.0.0.2:443", body: brand1.NewCallbackData("ORDER123", 40000, PaymentMethodBCA, CallbackStatusSuccess).FormValues().Encode(), wantStatus: http.StatusForbidden},
+		{name: "Unreadable Body", remoteAddr: "10.0.0.1:443", body: "%zz", wantStatus: http.StatusBadRequest},
+		{name: "Unknown Merchant", remoteAddr: "10.0.0.1:443", body: "merchantCode=DBRAND9&merchantOrderId=ORDER123", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.counters = nil
+			req := httptest.NewRequest("POST", "/callback", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.RemoteAddr = tt.remoteAddr
+
+			w := httptest.NewRecorder()
+			registry.HandleCallback(w, req, func(*CallbackData) error { return nil })
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			wantOutcome := CallbackOutcomeOK
+			switch tt.wantStatus {
+			case http.StatusForbidden:
+				wantOutcome = CallbackOutcomeForbidden
+			case http.StatusBadRequest:
+				wantOutcome = CallbackOutcomeInvalid
+			}
+			if len(metrics.counters) != 1 || metrics.counters[0].labels["outcome"] != wantOutcome {
+				t.Errorf("counters = %+v, want one %s outcome", metrics.counters, wantOutcome)
+			}
+		})
+	}
+}
+
+func TestMerchantRegistryParseCallback(t *testing.T) {
+	registry := newTestRegistry(t)
+	brand2, _ := registry.Client("DBRAND2")
+
+	body, _ := json.Marshal(brand2.NewCallbackData("ORDER123", 40000, PaymentMethodOVO, CallbackStatusSuccess))
+	req := httptest.NewRequest("POST", "/callback", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	data, err := registry.ParseCallback(req)
+	if err != nil {
+		t.Fatalf("ParseCallback() error = %v", err)
+	}
+	if data.MerchantCode != "DBRAND2" || data.SignedWith != PrimaryKeyID {
+		t.Errorf("ParseCallback() = %+v", data)
+	}
+}
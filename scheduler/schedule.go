@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// NextRunDate returns the date of the given cycle of a schedule that starts at
+// anchor. Cycle 0 is the anchor itself. Dates are always computed from the
+// anchor so month-end and leap day anchors do not drift: a plan anchored on
+// January 31st runs on February 28th (29th in leap years) and again on March
+// 31st, and a yearly plan anchored on February 29th runs on February 28th in
+// common years.
+func NextRunDate(anchor time.Time, frequencyType, frequencyInterval, cycle int) (time.Time, error) {
+	if frequencyInterval < 1 {
+		return time.Time{}, fmt.Errorf("invalid frequency interval: %d", frequencyInterval)
+	}
+	if cycle < 0 {
+		return time.Time{}, fmt.Errorf("invalid cycle: %d", cycle)
+	}
+
+	steps := cycle * frequencyInterval
+	switch frequencyType {
+	case duitku.FrequencyDaily:
+		return anchor.AddDate(0, 0, steps), nil
+	case duitku.FrequencyWeekly:
+		return anchor.AddDate(0, 0, 7*steps), nil
+	case duitku.FrequencyMonthly:
+		return addMonthsClamped(anchor, steps), nil
+	case duitku.FrequencyYearly:
+		return addMonthsClamped(anchor, 12*steps), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid frequency type: %d", frequencyType)
+}
+
+// addMonthsClamped adds months to t, clamping the day to the end of the target month
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	total := int(month) - 1 + months
+	year += total / 12
+	month = time.Month(total%12 + 1)
+
+	if last := daysIn(year, month); day > last {
+		day = last
+	}
+
+	hour, minute, sec := t.Clock()
+	return time.Date(year, month, day, hour, minute, sec, t.Nanosecond(), t.Location())
+}
+
+// daysIn returns the number of days in the month
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
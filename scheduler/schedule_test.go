@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+func TestNextRunDate(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		anchor    time.Time
+		frequency int
+		interval  int
+		cycle     int
+		want      time.Time
+	}{
+		{"Anchor Itself", date(2024, 1, 31), duitku.FrequencyMonthly, 1, 0, date(2024, 1, 31)},
+		{"Daily", date(2024, 2, 28), duitku.FrequencyDaily, 1, 2, date(2024, 3, 1)},
+		{"Every Three Days", date(2024, 1, 1), duitku.FrequencyDaily, 3, 4, date(2024, 1, 13)},
+		{"Weekly", date(2024, 1, 1), duitku.FrequencyWeekly, 1, 3, date(2024, 1, 22)},
+		{"Biweekly", date(2024, 12, 25), duitku.FrequencyWeekly, 2, 1, date(2025, 1, 8)},
+		{"Month End Leap February", date(2024, 1, 31), duitku.FrequencyMonthly, 1, 1, date(2024, 2, 29)},
+		{"Month End Common February", date(2023, 1, 31), duitku.FrequencyMonthly, 1, 1, date(2023, 2, 28)},
+		{"Month End Does Not Drift", date(2024, 1, 31), duitku.FrequencyMonthly, 1, 2, date(2024, 3, 31)},
+		{"Month End Thirty Days", date(2024, 1, 31), duitku.FrequencyMonthly, 1, 3, date(2024, 4, 30)},
+		{"Quarterly Across Year", date(2024, 11, 30), duitku.FrequencyMonthly, 3, 1, date(2025, 2, 28)},
+		{"Yearly Leap Day To Common Year", date(2024, 2, 29), duitku.FrequencyYearly, 1, 1, date(2025, 2, 28)},
+		{"Yearly Leap Day To Leap Year", date(2024, 2, 29), duitku.FrequencyYearly, 1, 4, date(2028, 2, 29)},
+		{"Yearly Regular", date(2024, 7, 15), duitku.FrequencyYearly, 2, 1, date(2026, 7, 15)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextRunDate(tt.anchor, tt.frequency, tt.interval, tt.cycle)
+			if err != nil {
+				t.Fatalf("NextRunDate() error = %v, want nil", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextRunDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRunDateErrors(t *testing.T) {
+	anchor := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := NextRunDate(anchor, 9, 1, 1); err == nil {
+		t.Errorf("NextRunDate() error = nil, want error for invalid frequency type")
+	}
+	if _, err := NextRunDate(anchor, duitku.FrequencyDaily, 0, 1); err == nil {
+		t.Errorf("NextRunDate() error = nil, want error for zero interval")
+	}
+	if _, err := NextRunDate(anchor, duitku.FrequencyDaily, 1, -1); err == nil {
+		t.Errorf("NextRunDate() error = nil, want error for negative cycle")
+	}
+}
@@ -0,0 +1,424 @@
+// Package scheduler bills recurring plans with any Duitku payment method.
+//
+// Duitku's native subscriptions only cover credit cards. The scheduler keeps
+// plans in a pluggable Store, creates a fresh transaction through
+// CreateTransaction for every billing cycle, and retries cycles that are still
+// unpaid when the next one falls due (dunning).
+//
+//	s := scheduler.New(client, scheduler.NewMemoryStore(), scheduler.Options{})
+//	s.AddPlan(&scheduler.Plan{
+//		ID:                "PLAN-42",
+//		FrequencyType:     duitku.FrequencyMonthly,
+//		FrequencyInterval: 1,
+//		Anchor:            time.Date(2024, 1, 31, 9, 0, 0, 0, time.Local),
+//		Template: duitku.TransactionRequest{
+//			PaymentAmount: 99000,
+//			PaymentMethod: duitku.PaymentMethodBCA,
+//			// ...
+//		},
+//	})
+//
+//	// From a cron job or ticker
+//	results, err := s.RunDue()
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// DefaultMaxRetries is the number of dunning retries before a plan is suspended
+const DefaultMaxRetries = 3
+
+// Plan status values
+const (
+	StatusActive    = "ACTIVE"    // Billing on schedule
+	StatusPastDue   = "PAST_DUE"  // The latest cycle is unpaid and being retried
+	StatusSuspended = "SUSPENDED" // Retries were exhausted
+	StatusCancelled = "CANCELLED" // Stopped by the merchant
+	StatusCompleted = "COMPLETED" // All cycles billed
+)
+
+// Plan is a recurring billing schedule
+type Plan struct {
+	// ID identifies the plan and prefixes generated merchant order IDs
+	ID string
+	// FrequencyType is one of the duitku.Frequency constants
+	FrequencyType int
+	// FrequencyInterval is the number of frequency units between cycles
+	FrequencyInterval int
+	// TotalNoOfCycles is the number of cycles to bill, zero for no limit
+	TotalNoOfCycles int
+	// Anchor is the date of the first cycle; later cycles are computed from it
+	Anchor time.Time
+	// Template is copied for every cycle with a generated MerchantOrderID
+	Template duitku.TransactionRequest
+
+	// Status is one of the Status constants
+	Status string
+	// CyclesBilled is the number of cycles for which a transaction was created
+	CyclesBilled int
+	// NextRun is when the scheduler next needs to act on the plan
+	NextRun time.Time
+}
+
+// Attempt is one transaction created for a cycle
+type Attempt struct {
+	MerchantOrderID string
+	Reference       string
+	CreatedAt       time.Time
+	// Failed is set when the transaction could not be created. Its
+	// merchant order ID is not used again.
+	Failed bool
+}
+
+// Cycle is one billing period of a plan
+type Cycle struct {
+	PlanID string
+	// Number starts at 1 for the cycle billed on the anchor date
+	Number int
+	// DueDate is the scheduled date of the cycle
+	DueDate time.Time
+	// Attempts lists the original transaction followed by dunning retries,
+	// including the ones that failed to be created
+	Attempts []Attempt
+	// Paid is set once any attempt is paid
+	Paid   bool
+	PaidAt time.Time
+}
+
+// Retries returns the number of dunning retries made for the cycle
+func (c *Cycle) Retries() int {
+	if len(c.Attempts) == 0 {
+		return 0
+	}
+	return len(c.Attempts) - 1
+}
+
+// LatestAttempt returns the most recent attempt
+func (c *Cycle) LatestAttempt() Attempt {
+	if len(c.Attempts) == 0 {
+		return Attempt{}
+	}
+	return c.Attempts[len(c.Attempts)-1]
+}
+
+// Client is the subset of *duitku.Client used by the scheduler
+type Client interface {
+	CreateTransaction(request duitku.TransactionRequest) (*duitku.TransactionResponse, error)
+	CheckTransaction(merchantOrderID string) (*duitku.TransactionStatusResponse, error)
+}
+
+// Options configures a Scheduler
+type Options struct {
+	// MaxRetries is the number of dunning retries before a plan is
+	// suspended, zero to suspend it as soon as a cycle is found unpaid.
+	// Defaults to DefaultMaxRetries when nil.
+	MaxRetries *int
+	// RetryInterval is the delay between dunning retries. Defaults to 24 hours.
+	RetryInterval time.Duration
+	// OrderID generates the merchant order ID of an attempt, numbered from
+	// zero within the cycle. Every attempt needs its own ID, as Duitku
+	// rejects a merchant order ID used before. Defaults to "<plan ID>-<cycle>"
+	// for the first attempt and "<plan ID>-<cycle>-R<retry>" for the others.
+	OrderID func(plan *Plan, cycle, retry int) string
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Scheduler creates transactions for due plans
+type Scheduler struct {
+	client        Client
+	store         Store
+	maxRetries    int
+	retryInterval time.Duration
+	orderID       func(plan *Plan, cycle, retry int) string
+	now           func() time.Time
+}
+
+// New creates a Scheduler
+func New(client Client, store Store, opts Options) *Scheduler {
+	maxRetries := DefaultMaxRetries
+	if opts.MaxRetries != nil {
+		maxRetries = *opts.MaxRetries
+	}
+
+	retryInterval := opts.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = 24 * time.Hour
+	}
+
+	orderID := opts.OrderID
+	if orderID == nil {
+		orderID = defaultOrderID
+	}
+
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Scheduler{
+		client:        client,
+		store:         store,
+		maxRetries:    maxRetries,
+		retryInterval: retryInterval,
+		orderID:       orderID,
+		now:           now,
+	}
+}
+
+func defaultOrderID(plan *Plan, cycle, retry int) string {
+	if retry == 0 {
+		return fmt.Sprintf("%s-%d", plan.ID, cycle)
+	}
+	return fmt.Sprintf("%s-%d-R%d", plan.ID, cycle, retry)
+}
+
+// Action describes what RunDue did for a plan
+type Action string
+
+// Actions reported in a Result
+const (
+	ActionBilled    Action = "billed"    // A new cycle was billed
+	ActionRetried   Action = "retried"   // An unpaid cycle was billed again
+	ActionSuspended Action = "suspended" // Retries were exhausted
+	ActionCompleted Action = "completed" // All cycles were billed
+	ActionWaiting   Action = "waiting"   // The previous cycle was paid, the next one is not due yet
+)
+
+// Result reports the outcome of processing one plan
+type Result struct {
+	PlanID   string
+	Action   Action
+	Cycle    int
+	Response *duitku.TransactionResponse
+	Err      error
+}
+
+// AddPlan validates a plan, schedules its first cycle on the anchor date and saves it
+func (s *Scheduler) AddPlan(plan *Plan) error {
+	if plan.ID == "" {
+		return errors.New("scheduler: plan ID is required")
+	}
+	if plan.Anchor.IsZero() {
+		return errors.New("scheduler: plan anchor is required")
+	}
+	if _, err := NextRunDate(plan.Anchor, plan.FrequencyType, plan.FrequencyInterval, 0); err != nil {
+		return fmt.Errorf("scheduler: %w", err)
+	}
+	if plan.TotalNoOfCycles < 0 {
+		return fmt.Errorf("scheduler: invalid total number of cycles: %d", plan.TotalNoOfCycles)
+	}
+
+	plan.Status = StatusActive
+	plan.CyclesBilled = 0
+	plan.NextRun = plan.Anchor
+	return s.store.SavePlan(plan)
+}
+
+// CancelPlan stops billing a plan
+func (s *Scheduler) CancelPlan(planID string) error {
+	plan, err := s.store.GetPlan(planID)
+	if err != nil {
+		return err
+	}
+	plan.Status = StatusCancelled
+	return s.store.SavePlan(plan)
+}
+
+// MarkPaid records that the transaction with the merchant order ID was paid
+func (s *Scheduler) MarkPaid(merchantOrderID string) error {
+	cycle, err := s.store.CycleByOrderID(merchantOrderID)
+	if err != nil {
+		return err
+	}
+	if cycle.Paid {
+		return nil
+	}
+	return s.store.MarkCyclePaid(cycle.PlanID, cycle.Number, s.now())
+}
+
+// HandleCallback marks the cycle paid for a successful callback. It ignores
+// callbacks for orders the scheduler did not create, so it can be chained
+// inside a regular duitku callback handler.
+func (s *Scheduler) HandleCallback(data *duitku.CallbackData) error {
+	if !data.IsSuccessful() {
+		return nil
+	}
+	err := s.MarkPaid(data.MerchantOrderID)
+	if errors.Is(err, ErrCycleNotFound) {
+		return nil
+	}
+	return err
+}
+
+// RunDue processes every plan whose NextRun has passed. Errors for
+// individual plans are reported in the results; the returned error is only
+// set when the due plans cannot be loaded.
+func (s *Scheduler) RunDue() ([]Result, error) {
+	now := s.now()
+	plans, err := s.store.DuePlans(now)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: error loading due plans: %w", err)
+	}
+
+	results := make([]Result, 0, len(plans))
+	for _, plan := range plans {
+		results = append(results, s.runPlan(plan, now))
+	}
+	return results, nil
+}
+
+// runPlan advances a single plan
+func (s *Scheduler) runPlan(plan *Plan, now time.Time) Result {
+	result := Result{PlanID: plan.ID}
+
+	latest, err := s.store.LatestCycle(plan.ID)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if latest != nil && !latest.Paid {
+		if err := s.refreshPaid(latest); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	// Dunning: the previous cycle is still unpaid
+	if latest != nil && !latest.Paid && latest.Number <= plan.CyclesBilled {
+		result.Cycle = latest.Number
+		if latest.Retries() >= s.maxRetries {
+			plan.Status = StatusSuspended
+			result.Action = ActionSuspended
+			result.Err = s.store.SavePlan(plan)
+			return result
+		}
+
+		response, err := s.bill(plan, latest, now)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		plan.Status = StatusPastDue
+		plan.NextRun = now.Add(s.retryInterval)
+		result.Action = ActionRetried
+		result.Response = response
+		result.Err = s.store.SavePlan(plan)
+		return result
+	}
+
+	if plan.TotalNoOfCycles > 0 && plan.CyclesBilled >= plan.TotalNoOfCycles {
+		plan.Status = StatusCompleted
+		result.Action = ActionCompleted
+		result.Err = s.store.SavePlan(plan)
+		return result
+	}
+
+	number := plan.CyclesBilled + 1
+	dueDate, err := NextRunDate(plan.Anchor, plan.FrequencyType, plan.FrequencyInterval, number-1)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// A paid retry can bring a plan back before its next cycle is due
+	if dueDate.After(now) {
+		plan.Status = StatusActive
+		plan.NextRun = dueDate
+		result.Action = ActionWaiting
+		result.Err = s.store.SavePlan(plan)
+		return result
+	}
+
+	// A cycle whose transaction could not be created is billed again
+	cycle := latest
+	if cycle == nil || cycle.Number != number {
+		cycle = &Cycle{PlanID: plan.ID, Number: number, DueDate: dueDate}
+	}
+	response, err := s.bill(plan, cycle, now)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	nextRun, err := NextRunDate(plan.Anchor, plan.FrequencyType, plan.FrequencyInterval, number)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	plan.Status = StatusActive
+	plan.CyclesBilled = number
+	plan.NextRun = nextRun
+	result.Action = ActionBilled
+	result.Cycle = number
+	result.Response = response
+	result.Err = s.store.SavePlan(plan)
+	return result
+}
+
+// refreshPaid asks Duitku whether any attempt of an unpaid cycle was paid.
+// Earlier attempts stay payable after a retry, so each of them is checked,
+// latest first.
+func (s *Scheduler) refreshPaid(cycle *Cycle) error {
+	for i := len(cycle.Attempts) - 1; i >= 0; i-- {
+		attempt := cycle.Attempts[i]
+		if attempt.MerchantOrderID == "" || attempt.Failed {
+			continue
+		}
+
+		status, err := s.client.CheckTransaction(attempt.MerchantOrderID)
+		if err != nil {
+			return fmt.Errorf("scheduler: error checking %s: %w", attempt.MerchantOrderID, err)
+		}
+		if status.IsSuccessful() {
+			cycle.Paid = true
+			cycle.PaidAt = s.now()
+			return s.store.MarkCyclePaid(cycle.PlanID, cycle.Number, cycle.PaidAt)
+		}
+	}
+	return nil
+}
+
+// bill creates a transaction for the cycle and records the attempt. A
+// failed attempt is recorded too, so the next one gets a new merchant order
+// ID. A new cycle is saved with its first attempt; later attempts are added
+// on their own, so a concurrent MarkPaid is not overwritten.
+func (s *Scheduler) bill(plan *Plan, cycle *Cycle, now time.Time) (*duitku.TransactionResponse, error) {
+	request := plan.Template
+	request.MerchantOrderID = s.orderID(plan, cycle.Number, len(cycle.Attempts))
+	request.IsSubscription = nil
+	request.SubscriptionDetail = nil
+
+	response, err := s.client.CreateTransaction(request)
+	var exists *duitku.TransactionExistsError
+	if errors.As(err, &exists) {
+		// The transaction was created although the request failed
+		response = &duitku.TransactionResponse{Reference: exists.Status.Reference, Amount: exists.Status.Amount}
+		err = nil
+	}
+
+	attempt := Attempt{MerchantOrderID: request.MerchantOrderID, CreatedAt: now, Failed: err != nil}
+	if response != nil {
+		attempt.Reference = response.Reference
+	}
+	cycle.Attempts = append(cycle.Attempts, attempt)
+	var saveErr error
+	if len(cycle.Attempts) == 1 {
+		saveErr = s.store.SaveCycle(cycle)
+	} else {
+		saveErr = s.store.AddAttempt(cycle.PlanID, cycle.Number, attempt)
+	}
+	if saveErr != nil && err == nil {
+		return nil, saveErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: error creating transaction %s: %w", request.MerchantOrderID, err)
+	}
+	return response, nil
+}
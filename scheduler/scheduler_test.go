@@ -0,0 +1,413 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// fakeClient records created transactions and reports the configured paid orders
+type fakeClient struct {
+	created []duitku.TransactionRequest
+	paid    map[string]bool
+	fail    bool
+}
+
+func (f *fakeClient) CreateTransaction(request duitku.TransactionRequest) (*duitku.TransactionResponse, error) {
+	if f.fail {
+		return nil, errors.New("service unavailable")
+	}
+	f.created = append(f.created, request)
+	return &duitku.TransactionResponse{Reference: "REF-" + request.MerchantOrderID, StatusCode: "00"}, nil
+}
+
+func (f *fakeClient) CheckTransaction(merchantOrderID string) (*duitku.TransactionStatusResponse, error) {
+	status := duitku.CheckTransactionStatusPending
+	if f.paid[merchantOrderID] {
+		status = duitku.CheckTransactionStatusSuccess
+	}
+	return &duitku.TransactionStatusResponse{MerchantOrderID: merchantOrderID, StatusCode: status}, nil
+}
+
+// clock is a settable time source
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+// retries returns a MaxRetries option
+func retries(n int) *int { return &n }
+
+func newTestScheduler(client *fakeClient, maxRetries *int) (*Scheduler, *MemoryStore, *clock) {
+	store := NewMemoryStore()
+	clk := &clock{now: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)}
+	s := New(client, store, Options{
+		MaxRetries:    maxRetries,
+		RetryInterval: 48 * time.Hour,
+		Now:           clk.Now,
+	})
+	return s, store, clk
+}
+
+func monthlyPlan(total int) *Plan {
+	isSubscription := true
+	return &Plan{
+		ID:                "PLAN",
+		FrequencyType:     duitku.FrequencyMonthly,
+		FrequencyInterval: 1,
+		TotalNoOfCycles:   total,
+		Anchor:            time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+		Template: duitku.TransactionRequest{
+			PaymentAmount:  99000,
+			PaymentMethod:  duitku.PaymentMethodBCA,
+			ProductDetails: "Monthly plan",
+			IsSubscription: &isSubscription,
+		},
+	}
+}
+
+func runOne(t *testing.T, s *Scheduler) Result {
+	t.Helper()
+	results, err := s.RunDue()
+	if err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("RunDue() returned %d results, want 1", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("RunDue() result error = %v", results[0].Err)
+	}
+	return results[0]
+}
+
+func TestSchedulerBillsEachCycle(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}}
+	s, store, clk := newTestScheduler(client, retries(0))
+
+	if err := s.AddPlan(monthlyPlan(2)); err != nil {
+		t.Fatalf("AddPlan() error = %v", err)
+	}
+
+	// First cycle on the anchor date
+	result := runOne(t, s)
+	if result.Action != ActionBilled || result.Cycle != 1 {
+		t.Fatalf("first run = %s cycle %d, want billed cycle 1", result.Action, result.Cycle)
+	}
+	if client.created[0].MerchantOrderID != "PLAN-1" {
+		t.Errorf("MerchantOrderID = %s, want PLAN-1", client.created[0].MerchantOrderID)
+	}
+	if client.created[0].IsSubscription != nil {
+		t.Errorf("IsSubscription should be cleared for scheduler transactions")
+	}
+
+	// Nothing is due before the next cycle, clamped to the end of February
+	plan, _ := store.GetPlan("PLAN")
+	if want := time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC); !plan.NextRun.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", plan.NextRun, want)
+	}
+	clk.now = time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)
+	if results, _ := s.RunDue(); len(results) != 0 {
+		t.Errorf("RunDue() before due date returned %d results, want 0", len(results))
+	}
+
+	// Paying through the callback lets the second cycle bill
+	if err := s.HandleCallback(&duitku.CallbackData{MerchantOrderID: "PLAN-1", ResultCode: duitku.CallbackStatusSuccess}); err != nil {
+		t.Fatalf("HandleCallback() error = %v", err)
+	}
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	result = runOne(t, s)
+	if result.Action != ActionBilled || result.Cycle != 2 {
+		t.Fatalf("second run = %s cycle %d, want billed cycle 2", result.Action, result.Cycle)
+	}
+
+	// After the last cycle is paid the plan completes
+	client.paid["PLAN-2"] = true
+	clk.now = time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC)
+	result = runOne(t, s)
+	if result.Action != ActionCompleted {
+		t.Fatalf("third run = %s, want completed", result.Action)
+	}
+	plan, _ = store.GetPlan("PLAN")
+	if plan.Status != StatusCompleted {
+		t.Errorf("plan status = %s, want %s", plan.Status, StatusCompleted)
+	}
+}
+
+func TestSchedulerDunning(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}}
+	s, store, clk := newTestScheduler(client, retries(2))
+	s.AddPlan(monthlyPlan(0))
+	runOne(t, s)
+
+	// The first cycle is unpaid when the second falls due: retry it
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	result := runOne(t, s)
+	if result.Action != ActionRetried || result.Cycle != 1 {
+		t.Fatalf("run = %s cycle %d, want retried cycle 1", result.Action, result.Cycle)
+	}
+	if got := client.created[len(client.created)-1].MerchantOrderID; got != "PLAN-1-R1" {
+		t.Errorf("retry MerchantOrderID = %s, want PLAN-1-R1", got)
+	}
+	plan, _ := store.GetPlan("PLAN")
+	if plan.Status != StatusPastDue {
+		t.Errorf("plan status = %s, want %s", plan.Status, StatusPastDue)
+	}
+	if want := clk.now.Add(48 * time.Hour); !plan.NextRun.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", plan.NextRun, want)
+	}
+
+	// Second retry
+	clk.now = clk.now.Add(48 * time.Hour)
+	if result := runOne(t, s); result.Action != ActionRetried {
+		t.Fatalf("run = %s, want retried", result.Action)
+	}
+
+	// Retries exhausted
+	clk.now = clk.now.Add(48 * time.Hour)
+	if result := runOne(t, s); result.Action != ActionSuspended {
+		t.Fatalf("run = %s, want suspended", result.Action)
+	}
+	plan, _ = store.GetPlan("PLAN")
+	if plan.Status != StatusSuspended {
+		t.Errorf("plan status = %s, want %s", plan.Status, StatusSuspended)
+	}
+	if results, _ := s.RunDue(); len(results) != 0 {
+		t.Errorf("suspended plan should not be due, got %d results", len(results))
+	}
+}
+
+func TestSchedulerRetryPaidBeforeNextCycle(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}}
+	s, store, clk := newTestScheduler(client, retries(3))
+	s.AddPlan(monthlyPlan(0))
+	runOne(t, s)
+
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	runOne(t, s) // retry PLAN-1-R1
+
+	// The retry is paid, found through CheckTransaction on the next run
+	client.paid["PLAN-1-R1"] = true
+	clk.now = clk.now.Add(48 * time.Hour)
+	result := runOne(t, s)
+	if result.Action != ActionBilled || result.Cycle != 2 {
+		t.Fatalf("run = %s cycle %d, want billed cycle 2", result.Action, result.Cycle)
+	}
+
+	cycle, err := store.CycleByOrderID("PLAN-1-R1")
+	if err != nil {
+		t.Fatalf("CycleByOrderID() error = %v", err)
+	}
+	if !cycle.Paid {
+		t.Errorf("cycle 1 should be marked paid")
+	}
+
+	plan, _ := store.GetPlan("PLAN")
+	if plan.Status != StatusActive {
+		t.Errorf("plan status = %s, want %s", plan.Status, StatusActive)
+	}
+	if want := time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC); !plan.NextRun.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", plan.NextRun, want)
+	}
+}
+
+func TestSchedulerFailedCreate(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}, fail: true}
+	s, store, _ := newTestScheduler(client, retries(0))
+	s.AddPlan(monthlyPlan(0))
+
+	results, _ := s.RunDue()
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("RunDue() results = %+v, want one failed result", results)
+	}
+
+	// The next attempt uses a new merchant order ID, as Duitku rejects the
+	// one of a transaction that may have been created
+	client.fail = false
+	result := runOne(t, s)
+	if result.Action != ActionBilled || result.Cycle != 1 {
+		t.Fatalf("run = %s cycle %d, want billed cycle 1", result.Action, result.Cycle)
+	}
+	if got := client.created[0].MerchantOrderID; got != "PLAN-1-R1" {
+		t.Errorf("MerchantOrderID = %s, want PLAN-1-R1", got)
+	}
+	cycle, err := store.CycleByOrderID("PLAN-1-R1")
+	if err != nil {
+		t.Fatalf("CycleByOrderID() error = %v", err)
+	}
+	if len(cycle.Attempts) != 2 || !cycle.Attempts[0].Failed || cycle.Attempts[1].Failed {
+		t.Errorf("attempts = %+v, want a failed attempt followed by a created one", cycle.Attempts)
+	}
+	if plan, _ := store.GetPlan("PLAN"); plan.CyclesBilled != 1 || plan.Status != StatusActive {
+		t.Errorf("plan = %+v, want cycle 1 billed", plan)
+	}
+}
+
+func TestSchedulerTransactionExists(t *testing.T) {
+	client := &existingClient{}
+	store := NewMemoryStore()
+	s := New(client, store, Options{Now: func() time.Time { return time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC) }})
+	s.AddPlan(monthlyPlan(0))
+
+	result := runOne(t, s)
+	if result.Action != ActionBilled || result.Response.Reference != "REF-PLAN-1" {
+		t.Fatalf("run = %s, response %+v, want billed with the existing reference", result.Action, result.Response)
+	}
+	cycle, err := store.CycleByOrderID("PLAN-1")
+	if err != nil {
+		t.Fatalf("CycleByOrderID() error = %v", err)
+	}
+	if attempt := cycle.LatestAttempt(); attempt.Failed || attempt.Reference != "REF-PLAN-1" {
+		t.Errorf("attempt = %+v, want the existing transaction", attempt)
+	}
+}
+
+// existingClient fails every create of a transaction that was created anyway
+type existingClient struct{ fakeClient }
+
+func (c *existingClient) CreateTransaction(request duitku.TransactionRequest) (*duitku.TransactionResponse, error) {
+	return nil, &duitku.TransactionExistsError{
+		MerchantOrderID: request.MerchantOrderID,
+		Status:          &duitku.TransactionStatusResponse{MerchantOrderID: request.MerchantOrderID, Reference: "REF-" + request.MerchantOrderID},
+		Err:             errors.New("bad gateway"),
+	}
+}
+
+func TestSchedulerDefaultMaxRetries(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}}
+	s, _, clk := newTestScheduler(client, nil)
+	s.AddPlan(monthlyPlan(0))
+	runOne(t, s)
+
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	for i := 1; i <= DefaultMaxRetries; i++ {
+		if result := runOne(t, s); result.Action != ActionRetried {
+			t.Fatalf("retry %d = %s, want retried", i, result.Action)
+		}
+		clk.now = clk.now.Add(48 * time.Hour)
+	}
+	if result := runOne(t, s); result.Action != ActionSuspended {
+		t.Fatalf("run = %s, want suspended after %d retries", result.Action, DefaultMaxRetries)
+	}
+}
+
+func TestSchedulerNoRetries(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}}
+	s, _, clk := newTestScheduler(client, retries(0))
+	s.AddPlan(monthlyPlan(0))
+	runOne(t, s)
+
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	if result := runOne(t, s); result.Action != ActionSuspended {
+		t.Fatalf("run = %s, want suspended without retries", result.Action)
+	}
+	if len(client.created) != 1 {
+		t.Errorf("created %d transactions, want 1", len(client.created))
+	}
+}
+
+func TestSchedulerEarlierAttemptPaid(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}}
+	s, store, clk := newTestScheduler(client, retries(3))
+	s.AddPlan(monthlyPlan(0))
+	runOne(t, s)
+
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	runOne(t, s) // retry PLAN-1-R1
+
+	// The customer pays the payment code of the first attempt
+	client.paid["PLAN-1"] = true
+	clk.now = clk.now.Add(48 * time.Hour)
+	result := runOne(t, s)
+	if result.Action != ActionBilled || result.Cycle != 2 {
+		t.Fatalf("run = %s cycle %d, want billed cycle 2", result.Action, result.Cycle)
+	}
+	if cycle, _ := store.CycleByOrderID("PLAN-1"); !cycle.Paid {
+		t.Errorf("cycle 1 should be marked paid")
+	}
+}
+
+// payingClient marks the cycle paid while a retry is being created
+type payingClient struct {
+	fakeClient
+	s *Scheduler
+}
+
+func (c *payingClient) CreateTransaction(request duitku.TransactionRequest) (*duitku.TransactionResponse, error) {
+	if request.MerchantOrderID == "PLAN-1-R1" {
+		if err := c.s.MarkPaid("PLAN-1"); err != nil {
+			return nil, err
+		}
+	}
+	return c.fakeClient.CreateTransaction(request)
+}
+
+func TestSchedulerPaidDuringRetry(t *testing.T) {
+	client := &payingClient{fakeClient: fakeClient{paid: map[string]bool{}}}
+	store := NewMemoryStore()
+	clk := &clock{now: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)}
+	s := New(client, store, Options{RetryInterval: 48 * time.Hour, Now: clk.Now})
+	client.s = s
+	s.AddPlan(monthlyPlan(0))
+	runOne(t, s)
+
+	clk.now = time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)
+	if result := runOne(t, s); result.Action != ActionRetried {
+		t.Fatalf("run = %s, want retried", result.Action)
+	}
+
+	// Recording the retry keeps the payment, so the next cycle is billed
+	cycle, err := store.CycleByOrderID("PLAN-1-R1")
+	if err != nil {
+		t.Fatalf("CycleByOrderID() error = %v", err)
+	}
+	if !cycle.Paid || len(cycle.Attempts) != 2 {
+		t.Errorf("cycle = %+v, want paid with 2 attempts", cycle)
+	}
+	clk.now = clk.now.Add(48 * time.Hour)
+	if result := runOne(t, s); result.Action != ActionBilled || result.Cycle != 2 {
+		t.Fatalf("run = %s cycle %d, want billed cycle 2", result.Action, result.Cycle)
+	}
+}
+
+func TestSchedulerErrors(t *testing.T) {
+	client := &fakeClient{paid: map[string]bool{}, fail: true}
+	s, store, _ := newTestScheduler(client, retries(0))
+
+	invalid := monthlyPlan(0)
+	invalid.FrequencyType = 0
+	if err := s.AddPlan(invalid); err == nil {
+		t.Errorf("AddPlan() error = nil, want error for invalid frequency")
+	}
+	if err := s.AddPlan(&Plan{ID: "NO-ANCHOR", FrequencyType: duitku.FrequencyDaily, FrequencyInterval: 1}); err == nil {
+		t.Errorf("AddPlan() error = nil, want error for missing anchor")
+	}
+
+	// A failed transaction keeps the plan due
+	s.AddPlan(monthlyPlan(0))
+	results, err := s.RunDue()
+	if err != nil {
+		t.Fatalf("RunDue() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("RunDue() results = %+v, want one failed result", results)
+	}
+	plan, _ := store.GetPlan("PLAN")
+	if plan.CyclesBilled != 0 {
+		t.Errorf("CyclesBilled = %d, want 0 after failure", plan.CyclesBilled)
+	}
+
+	// Cancelled plans are no longer due
+	if err := s.CancelPlan("PLAN"); err != nil {
+		t.Fatalf("CancelPlan() error = %v", err)
+	}
+	if results, _ := s.RunDue(); len(results) != 0 {
+		t.Errorf("cancelled plan should not be due")
+	}
+
+	// Callbacks for unknown orders are ignored
+	if err := s.HandleCallback(&duitku.CallbackData{MerchantOrderID: "OTHER", ResultCode: "00"}); err != nil {
+		t.Errorf("HandleCallback() error = %v, want nil for unknown order", err)
+	}
+}
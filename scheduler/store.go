@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPlanNotFound is returned when a plan does not exist in the store
+	ErrPlanNotFound = errors.New("scheduler: plan not found")
+	// ErrCycleNotFound is returned when no cycle matches a merchant order ID
+	ErrCycleNotFound = errors.New("scheduler: cycle not found")
+)
+
+// Store persists plans and their billing cycles
+type Store interface {
+	// SavePlan inserts or replaces a plan
+	SavePlan(plan *Plan) error
+	// GetPlan returns the plan with the ID or ErrPlanNotFound
+	GetPlan(id string) (*Plan, error)
+	// DuePlans returns the active and past due plans whose NextRun is not after now
+	DuePlans(now time.Time) ([]*Plan, error)
+	// SaveCycle inserts or replaces a cycle, keyed by plan ID and cycle number
+	SaveCycle(cycle *Cycle) error
+	// AddAttempt appends an attempt to a saved cycle, leaving the rest of it
+	// unchanged, or returns ErrCycleNotFound
+	AddAttempt(planID string, number int, attempt Attempt) error
+	// MarkCyclePaid sets Paid and PaidAt of a saved cycle that is not paid
+	// yet, leaving the rest of it unchanged, or returns ErrCycleNotFound
+	MarkCyclePaid(planID string, number int, paidAt time.Time) error
+	// LatestCycle returns the cycle with the highest number for the plan, or nil if there is none
+	LatestCycle(planID string) (*Cycle, error)
+	// CycleByOrderID returns the cycle that issued the merchant order ID or ErrCycleNotFound
+	CycleByOrderID(merchantOrderID string) (*Cycle, error)
+}
+
+// MemoryStore is an in-memory Store, useful for tests and single process deployments
+type MemoryStore struct {
+	mu     sync.Mutex
+	plans  map[string]*Plan
+	cycles map[string][]*Cycle
+	orders map[string]*Cycle
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		plans:  make(map[string]*Plan),
+		cycles: make(map[string][]*Cycle),
+		orders: make(map[string]*Cycle),
+	}
+}
+
+// SavePlan inserts or replaces a plan
+func (s *MemoryStore) SavePlan(plan *Plan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := *plan
+	s.plans[plan.ID] = &p
+	return nil
+}
+
+// GetPlan returns the plan with the ID or ErrPlanNotFound
+func (s *MemoryStore) GetPlan(id string) (*Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan, ok := s.plans[id]
+	if !ok {
+		return nil, ErrPlanNotFound
+	}
+	p := *plan
+	return &p, nil
+}
+
+// DuePlans returns the active and past due plans whose NextRun is not after now,
+// ordered by NextRun
+func (s *MemoryStore) DuePlans(now time.Time) ([]*Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*Plan
+	for _, plan := range s.plans {
+		if (plan.Status == StatusActive || plan.Status == StatusPastDue) && !plan.NextRun.After(now) {
+			p := *plan
+			due = append(due, &p)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].NextRun.Equal(due[j].NextRun) {
+			return due[i].ID < due[j].ID
+		}
+		return due[i].NextRun.Before(due[j].NextRun)
+	})
+	return due, nil
+}
+
+// SaveCycle inserts or replaces a cycle, keyed by plan ID and cycle number
+func (s *MemoryStore) SaveCycle(cycle *Cycle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *cycle
+	c.Attempts = append([]Attempt(nil), cycle.Attempts...)
+
+	cycles := s.cycles[cycle.PlanID]
+	replaced := false
+	for i, existing := range cycles {
+		if existing.Number == cycle.Number {
+			cycles[i] = &c
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		cycles = append(cycles, &c)
+		sort.Slice(cycles, func(i, j int) bool { return cycles[i].Number < cycles[j].Number })
+	}
+	s.cycles[cycle.PlanID] = cycles
+
+	for _, attempt := range c.Attempts {
+		s.orders[attempt.MerchantOrderID] = &c
+	}
+	return nil
+}
+
+// AddAttempt appends an attempt to a saved cycle
+func (s *MemoryStore) AddAttempt(planID string, number int, attempt Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cycle := s.cycle(planID, number)
+	if cycle == nil {
+		return ErrCycleNotFound
+	}
+	cycle.Attempts = append(cycle.Attempts, attempt)
+	s.orders[attempt.MerchantOrderID] = cycle
+	return nil
+}
+
+// MarkCyclePaid sets Paid and PaidAt of a saved cycle that is not paid yet
+func (s *MemoryStore) MarkCyclePaid(planID string, number int, paidAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cycle := s.cycle(planID, number)
+	if cycle == nil {
+		return ErrCycleNotFound
+	}
+	if !cycle.Paid {
+		cycle.Paid = true
+		cycle.PaidAt = paidAt
+	}
+	return nil
+}
+
+// cycle returns the stored cycle of the plan with the number, or nil. The
+// lock must be held.
+func (s *MemoryStore) cycle(planID string, number int) *Cycle {
+	for _, cycle := range s.cycles[planID] {
+		if cycle.Number == number {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// LatestCycle returns the cycle with the highest number for the plan, or nil if there is none
+func (s *MemoryStore) LatestCycle(planID string) (*Cycle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cycles := s.cycles[planID]
+	if len(cycles) == 0 {
+		return nil, nil
+	}
+	return copyCycle(cycles[len(cycles)-1]), nil
+}
+
+// CycleByOrderID returns the cycle that issued the merchant order ID or ErrCycleNotFound
+func (s *MemoryStore) CycleByOrderID(merchantOrderID string) (*Cycle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cycle, ok := s.orders[merchantOrderID]
+	if !ok {
+		return nil, ErrCycleNotFound
+	}
+	return copyCycle(cycle), nil
+}
+
+func copyCycle(cycle *Cycle) *Cycle {
+	c := *cycle
+	c.Attempts = append([]Attempt(nil), cycle.Attempts...)
+	return &c
+}
@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorePlans(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	plans := []*Plan{
+		{ID: "due-later", Status: StatusActive, NextRun: now.Add(-time.Hour)},
+		{ID: "due-first", Status: StatusActive, NextRun: now.Add(-48 * time.Hour)},
+		{ID: "past-due", Status: StatusPastDue, NextRun: now},
+		{ID: "future", Status: StatusActive, NextRun: now.Add(time.Hour)},
+		{ID: "suspended", Status: StatusSuspended, NextRun: now.Add(-time.Hour)},
+	}
+	for _, plan := range plans {
+		if err := store.SavePlan(plan); err != nil {
+			t.Fatalf("SavePlan() error = %v", err)
+		}
+	}
+
+	due, err := store.DuePlans(now)
+	if err != nil {
+		t.Fatalf("DuePlans() error = %v", err)
+	}
+	var ids []string
+	for _, plan := range due {
+		ids = append(ids, plan.ID)
+	}
+	want := []string{"due-first", "due-later", "past-due"}
+	if len(ids) != len(want) {
+		t.Fatalf("DuePlans() = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("DuePlans() = %v, want %v", ids, want)
+			break
+		}
+	}
+
+	// Returned plans are copies
+	due[0].Status = StatusCancelled
+	plan, err := store.GetPlan("due-first")
+	if err != nil {
+		t.Fatalf("GetPlan() error = %v", err)
+	}
+	if plan.Status != StatusActive {
+		t.Errorf("GetPlan() status = %s, stored plan was modified through a copy", plan.Status)
+	}
+
+	if _, err := store.GetPlan("missing"); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("GetPlan() error = %v, want ErrPlanNotFound", err)
+	}
+}
+
+func TestMemoryStoreCycles(t *testing.T) {
+	store := NewMemoryStore()
+
+	latest, err := store.LatestCycle("PLAN")
+	if err != nil || latest != nil {
+		t.Fatalf("LatestCycle() = %v, %v, want nil, nil", latest, err)
+	}
+
+	store.SaveCycle(&Cycle{PlanID: "PLAN", Number: 2, Attempts: []Attempt{{MerchantOrderID: "PLAN-2"}}})
+	store.SaveCycle(&Cycle{PlanID: "PLAN", Number: 1, Attempts: []Attempt{{MerchantOrderID: "PLAN-1"}}})
+
+	// Replacing a cycle adds the retry order ID to the index
+	store.SaveCycle(&Cycle{PlanID: "PLAN", Number: 2, Attempts: []Attempt{{MerchantOrderID: "PLAN-2"}, {MerchantOrderID: "PLAN-2-R1"}}})
+
+	latest, err = store.LatestCycle("PLAN")
+	if err != nil {
+		t.Fatalf("LatestCycle() error = %v", err)
+	}
+	if latest.Number != 2 || latest.Retries() != 1 {
+		t.Errorf("LatestCycle() = cycle %d with %d retries, want cycle 2 with 1 retry", latest.Number, latest.Retries())
+	}
+
+	for _, orderID := range []string{"PLAN-2", "PLAN-2-R1"} {
+		cycle, err := store.CycleByOrderID(orderID)
+		if err != nil {
+			t.Fatalf("CycleByOrderID(%s) error = %v", orderID, err)
+		}
+		if cycle.Number != 2 {
+			t.Errorf("CycleByOrderID(%s) = cycle %d, want 2", orderID, cycle.Number)
+		}
+	}
+
+	if _, err := store.CycleByOrderID("unknown"); !errors.Is(err, ErrCycleNotFound) {
+		t.Errorf("CycleByOrderID() error = %v, want ErrCycleNotFound", err)
+	}
+}
+
+func TestMemoryStoreUpdateCycle(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.AddAttempt("PLAN", 1, Attempt{MerchantOrderID: "PLAN-1"}); !errors.Is(err, ErrCycleNotFound) {
+		t.Errorf("AddAttempt() error = %v, want ErrCycleNotFound", err)
+	}
+	if err := store.MarkCyclePaid("PLAN", 1, time.Now()); !errors.Is(err, ErrCycleNotFound) {
+		t.Errorf("MarkCyclePaid() error = %v, want ErrCycleNotFound", err)
+	}
+
+	store.SaveCycle(&Cycle{PlanID: "PLAN", Number: 1, Attempts: []Attempt{{MerchantOrderID: "PLAN-1"}}})
+	paidAt := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.MarkCyclePaid("PLAN", 1, paidAt); err != nil {
+		t.Fatalf("MarkCyclePaid() error = %v", err)
+	}
+	if err := store.AddAttempt("PLAN", 1, Attempt{MerchantOrderID: "PLAN-1-R1"}); err != nil {
+		t.Fatalf("AddAttempt() error = %v", err)
+	}
+	store.MarkCyclePaid("PLAN", 1, paidAt.Add(time.Hour))
+
+	cycle, err := store.CycleByOrderID("PLAN-1-R1")
+	if err != nil {
+		t.Fatalf("CycleByOrderID() error = %v", err)
+	}
+	if !cycle.Paid || !cycle.PaidAt.Equal(paidAt) || len(cycle.Attempts) != 2 {
+		t.Errorf("cycle = %+v, want paid at %v with 2 attempts", cycle, paidAt)
+	}
+}
@@ -0,0 +1,141 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SimulateCallbackOptions describes a callback to deliver to a local handler
+type SimulateCallbackOptions struct {
+	// URL is the callback endpoint to post to
+	URL string
+	// MerchantOrderID is the order the callback is for
+	MerchantOrderID string
+	// Amount is the transaction amount
+	Amount int
+	// PaymentCode is the payment method code, e.g. PaymentMethodBCA
+	PaymentCode string
+	// ResultCode is the callback result. Defaults to CallbackStatusSuccess.
+	ResultCode string
+	// Reference is the Duitku reference. Defaults to a generated value.
+	Reference string
+	// ProductDetail, AdditionalParam and MerchantUserID are copied into the callback
+	ProductDetail   string
+	AdditionalParam string
+	MerchantUserID  string
+	// Repeat is the number of times the callback is delivered, to test
+	// idempotency. Defaults to 1.
+	Repeat int
+}
+
+// SimulatedDelivery is the handler's answer to one simulated callback
+type SimulatedDelivery struct {
+	Attempt    int
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+}
+
+// NewCallbackData builds callback data signed with the client's credentials,
+// as Duitku would send it for the order
+func (c *Client) NewCallbackData(merchantOrderID string, amount int, paymentCode, resultCode string) *CallbackData {
+	amountStr := strconv.Itoa(amount)
+	return &CallbackData{
+		MerchantCode:    c.config.MerchantCode,
+		Amount:          amountStr,
+		MerchantOrderID: merchantOrderID,
+		PaymentCode:     paymentCode,
+		ResultCode:      resultCode,
+		Signature:       c.createSignatureMD5(c.config.MerchantCode, amountStr, merchantOrderID),
+	}
+}
+
+// FormValues encodes the callback data the way Duitku posts it, omitting empty fields
+func (data *CallbackData) FormValues() url.Values {
+	form := url.Values{}
+	add := func(key, value string) {
+		if value != "" {
+			form.Set(key, value)
+		}
+	}
+	add("merchantCode", data.MerchantCode)
+	add("amount", data.Amount)
+	add("merchantOrderId", data.MerchantOrderID)
+	add("productDetail", data.ProductDetail)
+	add("additionalParam", data.AdditionalParam)
+	add("paymentCode", data.PaymentCode)
+	add("resultCode", data.ResultCode)
+	add("merchantUserId", data.MerchantUserID)
+	add("reference", data.Reference)
+	add("signature", data.Signature)
+	add("publisherOrderId", data.PublisherOrderId)
+	add("spUserHash", data.SpUserHash)
+	add("settlementDate", data.SettlementDate)
+	add("issuerCode", data.IssuerCode)
+	add("subscriptionId", data.SubscriptionID)
+	add("cycleNumber", data.CycleNumber)
+	return form
+}
+
+// SimulateCallback posts a correctly signed, form encoded callback to a local
+// handler and returns the handler's responses. It is meant for development;
+// the callback is signed with the client's own API key.
+func (c *Client) SimulateCallback(opts SimulateCallbackOptions) ([]SimulatedDelivery, error) {
+	if opts.URL == "" {
+		return nil, errors.New("callback URL is required")
+	}
+	if opts.MerchantOrderID == "" {
+		return nil, errors.New("merchant order ID is required")
+	}
+	if opts.ResultCode == "" {
+		opts.ResultCode = CallbackStatusSuccess
+	}
+	if opts.Reference == "" {
+		opts.Reference = fmt.Sprintf("SIM%s%d", c.config.MerchantCode, time.Now().UnixNano())
+	}
+	if opts.Repeat < 1 {
+		opts.Repeat = 1
+	}
+
+	data := c.NewCallbackData(opts.MerchantOrderID, opts.Amount, opts.PaymentCode, opts.ResultCode)
+	data.Reference = opts.Reference
+	data.ProductDetail = opts.ProductDetail
+	data.AdditionalParam = opts.AdditionalParam
+	data.MerchantUserID = opts.MerchantUserID
+	body := data.FormValues().Encode()
+
+	deliveries := make([]SimulatedDelivery, 0, opts.Repeat)
+	for attempt := 1; attempt <= opts.Repeat; attempt++ {
+		req, err := http.NewRequest("POST", opts.URL, strings.NewReader(body))
+		if err != nil {
+			return deliveries, fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		start := time.Now()
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return deliveries, fmt.Errorf("error delivering callback: %w", err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return deliveries, fmt.Errorf("error reading response body: %w", err)
+		}
+
+		deliveries = append(deliveries, SimulatedDelivery{
+			Attempt:    attempt,
+			StatusCode: resp.StatusCode,
+			Body:       string(respBody),
+			Duration:   time.Since(start),
+		})
+	}
+
+	return deliveries, nil
+}
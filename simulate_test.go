@@ -0,0 +1,104 @@
+package duitku
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewCallbackData(t *testing.T) {
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	data := client.NewCallbackData("ORDER123", 40000, PaymentMethodBCA, CallbackStatusSuccess)
+	if data.Amount != "40000" || data.MerchantCode != "DXXXX" {
+		t.Errorf("NewCallbackData() = %+v", data)
+	}
+	if !client.VerifyCallbackSignature(data) {
+		t.Errorf("NewCallbackData() signature does not verify")
+	}
+
+	form := data.FormValues()
+	if form.Get("paymentCode") != PaymentMethodBCA {
+		t.Errorf("FormValues() paymentCode = %s, want %s", form.Get("paymentCode"), PaymentMethodBCA)
+	}
+	if _, ok := form["spUserHash"]; ok {
+		t.Errorf("FormValues() should omit empty fields")
+	}
+}
+
+func TestSimulateCallback(t *testing.T) {
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	// A handler that processes each order only once
+	seen := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.HandleCallback(w, r, func(data *CallbackData) error {
+			if data.PaymentCode != PaymentMethodOVO || data.AdditionalParam != "cart=42" {
+				t.Errorf("unexpected callback data %+v", data)
+			}
+			if seen[data.Reference] {
+				return nil
+			}
+			seen[data.Reference] = true
+			return nil
+		})
+	}))
+	defer server.Close()
+
+	deliveries, err := client.SimulateCallback(SimulateCallbackOptions{
+		URL:             server.URL,
+		MerchantOrderID: "ORDER123",
+		Amount:          40000,
+		PaymentCode:     PaymentMethodOVO,
+		AdditionalParam: "cart=42",
+		Repeat:          3,
+	})
+	if err != nil {
+		t.Fatalf("SimulateCallback() error = %v, want nil", err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("SimulateCallback() deliveries = %d, want 3", len(deliveries))
+	}
+	for i, delivery := range deliveries {
+		if delivery.Attempt != i+1 || delivery.StatusCode != http.StatusOK || delivery.Body != "OK" {
+			t.Errorf("delivery %d = %+v, want 200 OK", i, delivery)
+		}
+	}
+	if len(seen) != 1 {
+		t.Errorf("repeated deliveries should reuse the same reference, saw %d", len(seen))
+	}
+}
+
+func TestSimulateCallbackErrors(t *testing.T) {
+	client := NewClient(Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI"})
+
+	if _, err := client.SimulateCallback(SimulateCallbackOptions{MerchantOrderID: "ORDER123"}); err == nil {
+		t.Errorf("SimulateCallback() error = nil, want error without URL")
+	}
+	if _, err := client.SimulateCallback(SimulateCallbackOptions{URL: "http://localhost"}); err == nil {
+		t.Errorf("SimulateCallback() error = nil, want error without order ID")
+	}
+
+	// The handler rejects the callback: the response is still reported
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "order not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	deliveries, err := client.SimulateCallback(SimulateCallbackOptions{URL: server.URL, MerchantOrderID: "ORDER123", Amount: 1000})
+	if err != nil {
+		t.Fatalf("SimulateCallback() error = %v, want nil", err)
+	}
+	if deliveries[0].StatusCode != http.StatusNotFound || !strings.Contains(deliveries[0].Body, "order not found") {
+		t.Errorf("delivery = %+v, want 404 order not found", deliveries[0])
+	}
+}
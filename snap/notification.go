@@ -0,0 +1,302 @@
+package snap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Paths Duitku calls on the merchant for virtual account notifications
+const (
+	InquiryNotificationPath = "/v1.0/transfer-va/inquiry"
+	PaymentNotificationPath = "/v1.0/transfer-va/payment"
+)
+
+// SNAP service codes of the inbound virtual account services, the middle two
+// digits of a response code
+const (
+	InquiryServiceCode = "24"
+	PaymentServiceCode = "25"
+)
+
+// maxNotificationBodySize limits the size of inbound notification bodies
+const maxNotificationBodySize = 1 << 20
+
+// InquiryNotification is Duitku asking the merchant for the bill behind a
+// virtual account, sent when the customer enters the number at their bank
+type InquiryNotification struct {
+	PartnerServiceID string                 `json:"partnerServiceId"`
+	CustomerNo       string                 `json:"customerNo"`
+	VirtualAccountNo string                 `json:"virtualAccountNo"`
+	TrxDateInit      string                 `json:"trxDateInit,omitempty"`
+	ChannelCode      int                    `json:"channelCode,omitempty"`
+	Language         string                 `json:"language,omitempty"`
+	Amount           *Amount                `json:"amount,omitempty"`
+	InquiryRequestID string                 `json:"inquiryRequestId"`
+	AdditionalInfo   map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// InquiryData is the bill returned for an inquiry notification
+type InquiryData struct {
+	InquiryStatus      string                 `json:"inquiryStatus,omitempty"`
+	InquiryReason      Bilingual              `json:"inquiryReason"`
+	PartnerServiceID   string                 `json:"partnerServiceId"`
+	CustomerNo         string                 `json:"customerNo"`
+	VirtualAccountNo   string                 `json:"virtualAccountNo"`
+	VirtualAccountName string                 `json:"virtualAccountName"`
+	InquiryRequestID   string                 `json:"inquiryRequestId"`
+	TotalAmount        Amount                 `json:"totalAmount"`
+	AdditionalInfo     map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// InquiryNotificationResponse is the response written for an inquiry notification
+type InquiryNotificationResponse struct {
+	Response
+	VirtualAccountData *InquiryData `json:"virtualAccountData,omitempty"`
+}
+
+// PaymentNotification is Duitku reporting that a virtual account was paid
+type PaymentNotification struct {
+	PartnerServiceID        string                 `json:"partnerServiceId"`
+	CustomerNo              string                 `json:"customerNo"`
+	VirtualAccountNo        string                 `json:"virtualAccountNo"`
+	VirtualAccountName      string                 `json:"virtualAccountName,omitempty"`
+	PaymentRequestID        string                 `json:"paymentRequestId"`
+	ChannelCode             int                    `json:"channelCode,omitempty"`
+	HashedSourceAccountNo   string                 `json:"hashedSourceAccountNo,omitempty"`
+	SourceBankCode          string                 `json:"sourceBankCode,omitempty"`
+	PaidAmount              Amount                 `json:"paidAmount"`
+	CumulativePaymentAmount *Amount                `json:"cumulativePaymentAmount,omitempty"`
+	TotalAmount             *Amount                `json:"totalAmount,omitempty"`
+	TrxDateTime             string                 `json:"trxDateTime,omitempty"`
+	ReferenceNo             string                 `json:"referenceNo,omitempty"`
+	TrxID                   string                 `json:"trxId,omitempty"`
+	FlagAdvise              string                 `json:"flagAdvise,omitempty"`
+	AdditionalInfo          map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// PaymentNotificationResponse is the response written for a payment notification
+type PaymentNotificationResponse struct {
+	Response
+	VirtualAccountData *PaymentNotification `json:"virtualAccountData,omitempty"`
+}
+
+// NewNotificationError returns an error for a notification handler to
+// return when it rejects a notification. The response code is built from
+// the HTTP status, the service code of the notification and caseCode, for
+// example NewNotificationError(http.StatusNotFound, "12", "Invalid Bill")
+// answers an inquiry with 4042412.
+func NewNotificationError(statusCode int, caseCode, message string) *Error {
+	return &Error{StatusCode: statusCode, ResponseMessage: message, caseCode: caseCode}
+}
+
+// DefaultNotificationTimestampWindow is the default of
+// Config.NotificationTimestampWindow
+const DefaultNotificationTimestampWindow = 5 * time.Minute
+
+// ReadNotification verifies the X-SIGNATURE of an inbound notification with
+// the Duitku public key, checks that its X-TIMESTAMP is within
+// Config.NotificationTimestampWindow of now and decodes its body into v
+func (c *Client) ReadNotification(r *http.Request, v interface{}) error {
+	if c.config.DuitkuPublicKey == nil {
+		return errors.New("a Duitku public key is required to verify notifications")
+	}
+
+	timestamp := r.Header.Get("X-TIMESTAMP")
+	signature := r.Header.Get("X-SIGNATURE")
+	if timestamp == "" || signature == "" {
+		return NewNotificationError(http.StatusBadRequest, "02", "Invalid Mandatory Field X-TIMESTAMP or X-SIGNATURE")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotificationBodySize))
+	if err != nil {
+		return fmt.Errorf("error reading notification: %w", err)
+	}
+
+	err = VerifyNotificationSignature(c.config.DuitkuPublicKey, r.Method, pathWithQuery(r.URL), body, timestamp, signature)
+	if err == ErrInvalidSignature {
+		return NewNotificationError(http.StatusUnauthorized, "00", "Unauthorized. Invalid Signature")
+	}
+	if err != nil {
+		return NewNotificationError(http.StatusBadRequest, "01", "Invalid Field Format body")
+	}
+
+	sent, err := time.Parse(TimestampLayout, timestamp)
+	if err != nil {
+		return NewNotificationError(http.StatusBadRequest, "01", "Invalid Field Format X-TIMESTAMP")
+	}
+	window := c.config.NotificationTimestampWindow
+	if window <= 0 {
+		window = DefaultNotificationTimestampWindow
+	}
+	if age := c.now().Sub(sent); age > window || age < -window {
+		return NewNotificationError(http.StatusUnauthorized, "00", "Unauthorized. Invalid Timestamp")
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return NewNotificationError(http.StatusBadRequest, "01", "Invalid Field Format body")
+	}
+	return nil
+}
+
+// ParseInquiryNotification verifies and decodes an inquiry notification
+func (c *Client) ParseInquiryNotification(r *http.Request) (*InquiryNotification, error) {
+	var notification InquiryNotification
+	if err := c.ReadNotification(r, &notification); err != nil {
+		return nil, err
+	}
+	if notification.VirtualAccountNo == "" || notification.InquiryRequestID == "" {
+		return nil, NewNotificationError(http.StatusBadRequest, "02", "Invalid Mandatory Field virtualAccountNo or inquiryRequestId")
+	}
+	return &notification, nil
+}
+
+// ParsePaymentNotification verifies and decodes a payment notification
+func (c *Client) ParsePaymentNotification(r *http.Request) (*PaymentNotification, error) {
+	var notification PaymentNotification
+	if err := c.ReadNotification(r, &notification); err != nil {
+		return nil, err
+	}
+	if notification.VirtualAccountNo == "" || notification.PaymentRequestID == "" {
+		return nil, NewNotificationError(http.StatusBadRequest, "02", "Invalid Mandatory Field virtualAccountNo or paymentRequestId")
+	}
+	return &notification, nil
+}
+
+// HandleInquiry is a helper to answer inquiry notifications. handler
+// returns the bill for the virtual account, or an error created with
+// NewNotificationError to reject it. Other errors are answered with a
+// general error.
+func (c *Client) HandleInquiry(w http.ResponseWriter, r *http.Request, handler func(*InquiryNotification) (*InquiryData, error)) {
+	notification, err := c.ParseInquiryNotification(r)
+	if err != nil {
+		WriteNotificationError(w, InquiryServiceCode, err)
+		return
+	}
+
+	data, err := handler(notification)
+	if err != nil {
+		WriteNotificationError(w, InquiryServiceCode, err)
+		return
+	}
+
+	// Echo the request fields the handler left empty
+	if data == nil {
+		data = &InquiryData{}
+	}
+	if data.PartnerServiceID == "" {
+		data.PartnerServiceID = notification.PartnerServiceID
+	}
+	if data.CustomerNo == "" {
+		data.CustomerNo = notification.CustomerNo
+	}
+	if data.VirtualAccountNo == "" {
+		data.VirtualAccountNo = notification.VirtualAccountNo
+	}
+	if data.InquiryRequestID == "" {
+		data.InquiryRequestID = notification.InquiryRequestID
+	}
+	if data.InquiryStatus == "" {
+		data.InquiryStatus = PaymentFlagSuccess
+	}
+	if data.TotalAmount.Currency == "" {
+		data.TotalAmount.Currency = "IDR"
+	}
+
+	writeNotification(w, http.StatusOK, InquiryNotificationResponse{
+		Response:           Response{ResponseCode: successCode(InquiryServiceCode), ResponseMessage: "Successful"},
+		VirtualAccountData: data,
+	})
+}
+
+// HandlePaymentNotification is a helper to acknowledge payment
+// notifications. handler records the payment, or returns an error created
+// with NewNotificationError to reject it. Other errors are answered with a
+// general error so Duitku retries the notification.
+func (c *Client) HandlePaymentNotification(w http.ResponseWriter, r *http.Request, handler func(*PaymentNotification) error) {
+	notification, err := c.ParsePaymentNotification(r)
+	if err != nil {
+		WriteNotificationError(w, PaymentServiceCode, err)
+		return
+	}
+
+	if err := handler(notification); err != nil {
+		WriteNotificationError(w, PaymentServiceCode, err)
+		return
+	}
+
+	writeNotification(w, http.StatusOK, PaymentNotificationResponse{
+		Response:           Response{ResponseCode: successCode(PaymentServiceCode), ResponseMessage: "Successful"},
+		VirtualAccountData: notification,
+	})
+}
+
+// NotificationHandler is an http.Handler serving the inquiry and payment
+// notification paths. Requests to other paths are answered with 404.
+type NotificationHandler struct {
+	client  *Client
+	inquiry func(*InquiryNotification) (*InquiryData, error)
+	payment func(*PaymentNotification) error
+}
+
+// NewNotificationHandler returns an http.Handler for inbound virtual
+// account notifications. Either handler may be nil when the merchant does
+// not serve that notification.
+func (c *Client) NewNotificationHandler(inquiry func(*InquiryNotification) (*InquiryData, error), payment func(*PaymentNotification) error) *NotificationHandler {
+	return &NotificationHandler{client: c, inquiry: inquiry, payment: payment}
+}
+
+// ServeHTTP routes a notification by the end of its path, so the handler
+// can be mounted under any prefix
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeNotification(w, http.StatusMethodNotAllowed, Response{ResponseCode: "4050000", ResponseMessage: "Method Not Allowed"})
+		return
+	}
+
+	switch {
+	case h.inquiry != nil && strings.HasSuffix(r.URL.Path, InquiryNotificationPath):
+		h.client.HandleInquiry(w, r, h.inquiry)
+	case h.payment != nil && strings.HasSuffix(r.URL.Path, PaymentNotificationPath):
+		h.client.HandlePaymentNotification(w, r, h.payment)
+	default:
+		writeNotification(w, http.StatusNotFound, Response{ResponseCode: "4040000", ResponseMessage: "Not Found"})
+	}
+}
+
+// WriteNotificationError writes err as a SNAP response for the service.
+// An *Error keeps its status and message; when it has no response code, as
+// with NewNotificationError, one is built from the status, the service code
+// and its case code. Any other error is a 500 general error.
+func WriteNotificationError(w http.ResponseWriter, serviceCode string, err error) {
+	snapErr, ok := err.(*Error)
+	if !ok {
+		snapErr = NewNotificationError(http.StatusInternalServerError, "00", "General Error")
+	}
+	responseCode := snapErr.ResponseCode
+	if responseCode == "" {
+		caseCode := snapErr.caseCode
+		if caseCode == "" {
+			caseCode = "00"
+		}
+		responseCode = fmt.Sprintf("%d%s%s", snapErr.StatusCode, serviceCode, caseCode)
+	}
+	writeNotification(w, snapErr.StatusCode, Response{ResponseCode: responseCode, ResponseMessage: snapErr.ResponseMessage})
+}
+
+// successCode returns the 200 response code of a service
+func successCode(serviceCode string) string {
+	return "200" + serviceCode + "00"
+}
+
+// writeNotification writes a JSON notification response
+func writeNotification(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,261 @@
+package snap
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newNotification returns an inbound notification signed with the test key
+func newNotification(t *testing.T, path, body string) *http.Request {
+	t.Helper()
+	return newNotificationAt(t, path, body, Timestamp(time.Now()))
+}
+
+// newNotificationAt returns an inbound notification signed with the test key
+// with the timestamp
+func newNotificationAt(t *testing.T, path, body, timestamp string) *http.Request {
+	t.Helper()
+	signature, err := NotificationSignature(newTestKey(t), "POST", path, []byte(body), timestamp)
+	if err != nil {
+		t.Fatalf("NotificationSignature() error = %v", err)
+	}
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-TIMESTAMP", timestamp)
+	r.Header.Set("X-SIGNATURE", signature)
+	r.Header.Set("X-PARTNER-ID", testPartnerID)
+	r.Header.Set("X-EXTERNAL-ID", "12345678901234567890")
+	return r
+}
+
+func newNotificationClient(t *testing.T) *Client {
+	return NewClient(Config{DuitkuPublicKey: &newTestKey(t).PublicKey})
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response body %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestNotificationSignature(t *testing.T) {
+	key := newTestKey(t)
+	timestamp := "2024-03-01T10:04:05+07:00"
+
+	signature, err := NotificationSignature(key, "post", PaymentNotificationPath, []byte(`{"a": 1}`), timestamp)
+	if err != nil {
+		t.Fatalf("NotificationSignature() error = %v", err)
+	}
+	if err := VerifyNotificationSignature(&key.PublicKey, "POST", PaymentNotificationPath, []byte(`{"a":1}`), timestamp, signature); err != nil {
+		t.Errorf("VerifyNotificationSignature() error = %v", err)
+	}
+	if err := VerifyNotificationSignature(&key.PublicKey, "POST", PaymentNotificationPath, []byte(`{"a":2}`), timestamp, signature); err != ErrInvalidSignature {
+		t.Errorf("VerifyNotificationSignature() of another body error = %v, want ErrInvalidSignature", err)
+	}
+	if err := VerifyNotificationSignature(&key.PublicKey, "POST", PaymentNotificationPath, []byte(`{"a":1}`), timestamp, "%%%"); err != ErrInvalidSignature {
+		t.Errorf("VerifyNotificationSignature() of malformed signature error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestHandlePaymentNotification(t *testing.T) {
+	client := newNotificationClient(t)
+	body := `{"partnerServiceId":"   12345","customerNo":"0001","virtualAccountNo":"   123450001",` +
+		`"paymentRequestId":"PAY-1","paidAmount":{"value":"10000.00","currency":"IDR"},"trxId":"INV-1"}`
+
+	tests := []struct {
+		name        string
+		request     func() *http.Request
+		handlerErr  error
+		wantStatus  int
+		wantCode    string
+		wantHandled bool
+	}{
+		{
+			name:        "Success",
+			request:     func() *http.Request { return newNotification(t, PaymentNotificationPath, body) },
+			wantStatus:  http.StatusOK,
+			wantCode:    "2002500",
+			wantHandled: true,
+		},
+		{
+			name: "Invalid Signature",
+			request: func() *http.Request {
+				r := newNotification(t, PaymentNotificationPath, body)
+				r.Header.Set("X-SIGNATURE", "AAAA")
+				return r
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "4012500",
+		},
+		{
+			name: "Missing Timestamp",
+			request: func() *http.Request {
+				r := newNotification(t, PaymentNotificationPath, body)
+				r.Header.Del("X-TIMESTAMP")
+				return r
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "4002502",
+		},
+		{
+			name: "Replayed",
+			request: func() *http.Request {
+				return newNotificationAt(t, PaymentNotificationPath, body, Timestamp(time.Now().Add(-10*time.Minute)))
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "4012500",
+		},
+		{
+			name: "Timestamp In The Future",
+			request: func() *http.Request {
+				return newNotificationAt(t, PaymentNotificationPath, body, Timestamp(time.Now().Add(10*time.Minute)))
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "4012500",
+		},
+		{
+			name: "Malformed Timestamp",
+			request: func() *http.Request {
+				return newNotificationAt(t, PaymentNotificationPath, body, "yesterday")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "4002501",
+		},
+		{
+			name: "Missing Payment Request ID",
+			request: func() *http.Request {
+				return newNotification(t, PaymentNotificationPath, `{"virtualAccountNo":"   123450001"}`)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "4002502",
+		},
+		{
+			name:        "Rejected By Handler",
+			request:     func() *http.Request { return newNotification(t, PaymentNotificationPath, body) },
+			handlerErr:  NewNotificationError(http.StatusNotFound, "19", "Invalid Bill/Virtual Account"),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "4042519",
+			wantHandled: true,
+		},
+		{
+			name:        "Handler Failure",
+			request:     func() *http.Request { return newNotification(t, PaymentNotificationPath, body) },
+			handlerErr:  errors.New("database unavailable"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    "5002500",
+			wantHandled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled *PaymentNotification
+			w := httptest.NewRecorder()
+			client.HandlePaymentNotification(w, tt.request(), func(n *PaymentNotification) error {
+				handled = n
+				return tt.handlerErr
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			response := decodeResponse(t, w)
+			if response["responseCode"] != tt.wantCode {
+				t.Errorf("responseCode = %v, want %s", response["responseCode"], tt.wantCode)
+			}
+			if (handled != nil) != tt.wantHandled {
+				t.Fatalf("handler called = %v, want %v", handled != nil, tt.wantHandled)
+			}
+			if handled != nil && (handled.PaymentRequestID != "PAY-1" || handled.PaidAmount.Value != "10000.00") {
+				t.Errorf("notification = %+v", handled)
+			}
+		})
+	}
+}
+
+func TestHandleInquiry(t *testing.T) {
+	client := newNotificationClient(t)
+	body := `{"partnerServiceId":"   12345","customerNo":"0001","virtualAccountNo":"   123450001","inquiryRequestId":"INQ-1"}`
+
+	w := httptest.NewRecorder()
+	client.HandleInquiry(w, newNotification(t, InquiryNotificationPath, body), func(n *InquiryNotification) (*InquiryData, error) {
+		return &InquiryData{VirtualAccountName: "John Doe", TotalAmount: Amount{Value: "10000.00"}}, nil
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response InquiryNotificationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	data := response.VirtualAccountData
+	if response.ResponseCode != "2002400" || data == nil {
+		t.Fatalf("response = %+v", response)
+	}
+	if data.InquiryRequestID != "INQ-1" || data.VirtualAccountNo != "   123450001" || data.InquiryStatus != PaymentFlagSuccess {
+		t.Errorf("virtual account = %+v", data)
+	}
+	if data.TotalAmount.Currency != "IDR" || data.VirtualAccountName != "John Doe" {
+		t.Errorf("virtual account = %+v", data)
+	}
+}
+
+func TestNotificationHandler(t *testing.T) {
+	client := newNotificationClient(t)
+	var inquiries, payments int
+	handler := client.NewNotificationHandler(
+		func(*InquiryNotification) (*InquiryData, error) {
+			inquiries++
+			return nil, NewNotificationError(http.StatusNotFound, "12", "Invalid Bill/Virtual Account")
+		},
+		func(*PaymentNotification) error {
+			payments++
+			return nil
+		},
+	)
+
+	inquiry := `{"virtualAccountNo":"   123450001","inquiryRequestId":"INQ-1"}`
+	payment := `{"virtualAccountNo":"   123450001","paymentRequestId":"PAY-1"}`
+	tests := []struct {
+		name       string
+		request    *http.Request
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "Inquiry", request: newNotification(t, "/snap"+InquiryNotificationPath, inquiry), wantStatus: http.StatusNotFound, wantCode: "4042412"},
+		{name: "Payment", request: newNotification(t, "/snap"+PaymentNotificationPath, payment), wantStatus: http.StatusOK, wantCode: "2002500"},
+		{name: "Unknown Path", request: newNotification(t, "/snap/v1.0/other", payment), wantStatus: http.StatusNotFound, wantCode: "4040000"},
+		{name: "Wrong Method", request: httptest.NewRequest("GET", "/snap"+PaymentNotificationPath, nil), wantStatus: http.StatusMethodNotAllowed, wantCode: "4050000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.request)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if code := decodeResponse(t, w)["responseCode"]; code != tt.wantCode {
+				t.Errorf("responseCode = %v, want %s", code, tt.wantCode)
+			}
+		})
+	}
+	if inquiries != 1 || payments != 1 {
+		t.Errorf("inquiries = %d, payments = %d, want 1 and 1", inquiries, payments)
+	}
+}
+
+func TestReadNotificationWithoutPublicKey(t *testing.T) {
+	client := NewClient(Config{})
+	var v map[string]interface{}
+	if err := client.ReadNotification(newNotification(t, PaymentNotificationPath, `{}`), &v); err == nil {
+		t.Error("ReadNotification() error = nil without a public key")
+	}
+}
@@ -0,0 +1,203 @@
+package snap
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimestampLayout is the ISO-8601 layout of the X-TIMESTAMP header
+const TimestampLayout = "2006-01-02T15:04:05-07:00"
+
+// jakarta is the zone SNAP timestamps are usually written in
+var jakarta = time.FixedZone("WIB", 7*60*60)
+
+// Timestamp formats t for the X-TIMESTAMP header, in Western Indonesia Time
+func Timestamp(t time.Time) string {
+	return t.In(jakarta).Format(TimestampLayout)
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8 form
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("error parsing private key: no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("error parsing private key: not an RSA key")
+	}
+	return key, nil
+}
+
+// ParsePublicKey parses a PEM encoded RSA public key in PKIX or PKCS#1 form
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("error parsing public key: no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("error parsing public key: not an RSA key")
+	}
+	return key, nil
+}
+
+// asymmetricStringToSign is the string signed for access token requests
+func asymmetricStringToSign(clientKey, timestamp string) []byte {
+	return []byte(clientKey + "|" + timestamp)
+}
+
+// AsymmetricSignature returns the X-SIGNATURE of an access token request:
+// base64(SHA256withRSA(clientKey + "|" + timestamp))
+func AsymmetricSignature(key *rsa.PrivateKey, clientKey, timestamp string) (string, error) {
+	digest := sha256.Sum256(asymmetricStringToSign(clientKey, timestamp))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing token request: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifyAsymmetricSignature checks an access token request signature
+func VerifyAsymmetricSignature(key *rsa.PublicKey, clientKey, timestamp, signature string) error {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %w", err)
+	}
+	digest := sha256.Sum256(asymmetricStringToSign(clientKey, timestamp))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], decoded); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ErrInvalidSignature is returned when a signature does not match
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// symmetricStringToSign builds the string signed for service requests:
+//
+//	method:path:accessToken:lowercase(hex(SHA256(minify(body)))):timestamp
+func symmetricStringToSign(method, path, accessToken string, body []byte, timestamp string) ([]byte, error) {
+	bodyHash, err := hashBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		accessToken,
+		bodyHash,
+		timestamp,
+	}, ":")), nil
+}
+
+// hashBody returns lowercase(hex(SHA256(minify(body))))
+func hashBody(body []byte) (string, error) {
+	minified := &bytes.Buffer{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Compact(minified, body); err != nil {
+			return "", fmt.Errorf("error minifying body: %w", err)
+		}
+	}
+	sum := sha256.Sum256(minified.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SymmetricSignature returns the X-SIGNATURE of a service request:
+// base64(HMAC_SHA512(clientSecret, stringToSign)). path is the request path
+// with its query string, for example "/v1.0/transfer-va/create-va".
+func SymmetricSignature(clientSecret, method, path, accessToken string, body []byte, timestamp string) (string, error) {
+	stringToSign, err := symmetricStringToSign(method, path, accessToken, body, timestamp)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha512.New, []byte(clientSecret))
+	mac.Write(stringToSign)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifySymmetricSignature checks a service request signature
+func VerifySymmetricSignature(clientSecret, method, path, accessToken string, body []byte, timestamp, signature string) error {
+	expected, err := SymmetricSignature(clientSecret, method, path, accessToken, body, timestamp)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// notificationStringToSign builds the string Duitku signs for inbound
+// notifications, which carry no access token:
+//
+//	method:path:lowercase(hex(SHA256(minify(body)))):timestamp
+func notificationStringToSign(method, path string, body []byte, timestamp string) ([]byte, error) {
+	bodyHash, err := hashBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join([]string{strings.ToUpper(method), path, bodyHash, timestamp}, ":")), nil
+}
+
+// NotificationSignature returns the X-SIGNATURE of an inbound notification:
+// base64(SHA256withRSA(stringToSign)). Duitku signs with its private key;
+// this is mostly useful for testing notification handlers.
+func NotificationSignature(key *rsa.PrivateKey, method, path string, body []byte, timestamp string) (string, error) {
+	stringToSign, err := notificationStringToSign(method, path, body, timestamp)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(stringToSign)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing notification: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifyNotificationSignature checks an inbound notification signature
+// against the Duitku public key
+func VerifyNotificationSignature(key *rsa.PublicKey, method, path string, body []byte, timestamp, signature string) error {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	stringToSign, err := notificationStringToSign(method, path, body, timestamp)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(stringToSign)
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], decoded); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
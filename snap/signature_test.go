@@ -0,0 +1,106 @@
+package snap
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	utc := time.Date(2024, 3, 1, 3, 4, 5, 0, time.UTC)
+	if got := Timestamp(utc); got != "2024-03-01T10:04:05+07:00" {
+		t.Errorf("Timestamp() = %s, want 2024-03-01T10:04:05+07:00", got)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	key := newTestKey(t)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeys := map[string][]byte{
+		"PKCS1": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"PKCS8": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	}
+	for name, data := range privateKeys {
+		parsed, err := ParsePrivateKey(data)
+		if err != nil {
+			t.Errorf("ParsePrivateKey(%s) error = %v", name, err)
+		} else if !parsed.Equal(key) {
+			t.Errorf("ParsePrivateKey(%s) returned a different key", name)
+		}
+	}
+
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeys := map[string][]byte{
+		"PKCS1": pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}),
+		"PKIX":  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}),
+	}
+	for name, data := range publicKeys {
+		parsed, err := ParsePublicKey(data)
+		if err != nil {
+			t.Errorf("ParsePublicKey(%s) error = %v", name, err)
+		} else if !parsed.Equal(&key.PublicKey) {
+			t.Errorf("ParsePublicKey(%s) returned a different key", name)
+		}
+	}
+
+	if _, err := ParsePrivateKey([]byte("not a key")); err == nil {
+		t.Error("ParsePrivateKey() error = nil for invalid input")
+	}
+}
+
+func TestAsymmetricSignature(t *testing.T) {
+	key := newTestKey(t)
+	timestamp := "2024-03-01T10:04:05+07:00"
+
+	signature, err := AsymmetricSignature(key, testClientKey, timestamp)
+	if err != nil {
+		t.Fatalf("AsymmetricSignature() error = %v", err)
+	}
+	if err := VerifyAsymmetricSignature(&key.PublicKey, testClientKey, timestamp, signature); err != nil {
+		t.Errorf("VerifyAsymmetricSignature() error = %v", err)
+	}
+	if err := VerifyAsymmetricSignature(&key.PublicKey, testClientKey, "2024-03-01T10:04:06+07:00", signature); err != ErrInvalidSignature {
+		t.Errorf("VerifyAsymmetricSignature() with another timestamp error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestSymmetricSignature(t *testing.T) {
+	// The string to sign is method:path:token:hex(sha256(minified body)):timestamp
+	stringToSign, err := symmetricStringToSign("post", "/v1.0/transfer-va/create-va", "token",
+		[]byte("{\n  \"a\": 1\n}"), "2024-03-01T10:04:05+07:00")
+	if err != nil {
+		t.Fatalf("symmetricStringToSign() error = %v", err)
+	}
+	want := "POST:/v1.0/transfer-va/create-va:token:" +
+		"015abd7f5cc57a2dd94b7590f04ad8084273905ee33ec5cebeae62276a97f862:2024-03-01T10:04:05+07:00"
+	if string(stringToSign) != want {
+		t.Errorf("stringToSign = %s, want %s", stringToSign, want)
+	}
+
+	// Bodies that differ only in whitespace sign the same
+	signature, err := SymmetricSignature("secret", "POST", "/v1.0/transfer-va/create-va", "token",
+		[]byte(`{"a": 1}`), "2024-03-01T10:04:05+07:00")
+	if err != nil {
+		t.Fatalf("SymmetricSignature() error = %v", err)
+	}
+	if err := VerifySymmetricSignature("secret", "POST", "/v1.0/transfer-va/create-va", "token",
+		[]byte(`{"a":1}`), "2024-03-01T10:04:05+07:00", signature); err != nil {
+		t.Errorf("VerifySymmetricSignature() of the minified body error = %v", err)
+	}
+	if err := VerifySymmetricSignature("other", "POST", "/v1.0/transfer-va/create-va", "token",
+		[]byte(`{"a":1}`), "2024-03-01T10:04:05+07:00", signature); err != ErrInvalidSignature {
+		t.Errorf("VerifySymmetricSignature() with another secret error = %v, want ErrInvalidSignature", err)
+	}
+
+	if _, err := SymmetricSignature("secret", "POST", "/", "token", []byte("{"), "ts"); err == nil {
+		t.Error("SymmetricSignature() error = nil for invalid JSON")
+	}
+}
@@ -0,0 +1,286 @@
+// Package snap is a client for the Duitku SNAP (Standar Nasional Open API
+// Pembayaran) endpoints defined by Bank Indonesia.
+//
+// SNAP requests are authorized with a B2B access token. The token request is
+// signed with the merchant's RSA private key (SHA256withRSA), and every
+// service request is signed with the client secret (HMAC-SHA512) over the
+// method, path, token, body hash and timestamp. The Client acquires and
+// caches tokens and sets the X-TIMESTAMP, X-SIGNATURE, X-PARTNER-ID,
+// X-EXTERNAL-ID and CHANNEL-ID headers:
+//
+//	key, err := snap.ParsePrivateKey(pemBytes)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	client := snap.NewClient(snap.Config{
+//		Environment:  duitku.EnvironmentSandbox,
+//		ClientKey:    "YOUR_CLIENT_KEY",
+//		ClientSecret: "YOUR_CLIENT_SECRET",
+//		PrivateKey:   key,
+//		PartnerID:    "YOUR_PARTNER_ID",
+//		ChannelID:    "95221",
+//	})
+//
+//	va, err := client.CreateVA(snap.CreateVARequest{...})
+//
+// Duitku signs the inquiry and payment notifications it sends to the
+// merchant with its own private key. Set DuitkuPublicKey and mount a
+// NotificationHandler, which verifies X-SIGNATURE, decodes the notification
+// and writes the SNAP response:
+//
+//	http.Handle("/snap/", client.NewNotificationHandler(
+//		func(n *snap.InquiryNotification) (*snap.InquiryData, error) {
+//			bill, ok := findBill(n.VirtualAccountNo)
+//			if !ok {
+//				return nil, snap.NewNotificationError(http.StatusNotFound, "12", "Invalid Bill/Virtual Account")
+//			}
+//			return &snap.InquiryData{VirtualAccountName: bill.Name, TotalAmount: snap.NewAmount(bill.Amount)}, nil
+//		},
+//		func(n *snap.PaymentNotification) error {
+//			return markPaid(n.VirtualAccountNo, n.PaymentRequestID)
+//		},
+//	))
+package snap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// Config holds the configuration of a SNAP client
+type Config struct {
+	// Environment selects the SNAP host, production when empty
+	Environment duitku.Environment
+	// BaseURLs overrides the hosts of the environment; only SNAP is used,
+	// so the BaseURLs of a duitku.Config can be shared
+	BaseURLs duitku.BaseURLs
+	// ClientKey is sent as X-CLIENT-KEY when requesting access tokens
+	ClientKey string
+	// ClientSecret signs service requests
+	ClientSecret string
+	// PrivateKey signs access token requests
+	PrivateKey *rsa.PrivateKey
+	// DuitkuPublicKey verifies the signatures of inbound notifications
+	DuitkuPublicKey *rsa.PublicKey
+	// PartnerID is sent as X-PARTNER-ID
+	PartnerID string
+	// ChannelID is sent as CHANNEL-ID
+	ChannelID string
+	// HTTPClient is an optional custom HTTP client
+	HTTPClient *http.Client
+	// Now is an optional clock, used for timestamps and token expiry
+	Now func() time.Time
+	// ExternalID optionally generates X-EXTERNAL-ID values, which must be
+	// unique per day. Defaults to random 20 digit numbers.
+	ExternalID func() string
+	// NotificationTimestampWindow is how far the X-TIMESTAMP of an inbound
+	// notification may be from the current time, so captured notifications
+	// cannot be replayed later. Defaults to
+	// DefaultNotificationTimestampWindow.
+	NotificationTimestampWindow time.Duration
+}
+
+// Client is a Duitku SNAP API client
+type Client struct {
+	config     Config
+	baseURL    string
+	httpClient *http.Client
+
+	tokens *duitku.TokenManager
+}
+
+// NewClient creates a new SNAP client with the provided configuration
+func NewClient(config Config) *Client {
+	baseURL := config.BaseURLs.SNAP
+	if baseURL == "" {
+		environment := config.Environment
+		if environment == "" {
+			environment = duitku.EnvironmentProduction
+		}
+		baseURL = environment.BaseURLs().SNAP
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: 30 * time.Second,
+		}
+	}
+
+	c := &Client{
+		config:     config,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+	c.tokens = duitku.NewTokenManager(c.fetchToken, duitku.TokenManagerOptions{
+		ExpiryMargin: tokenRefreshMargin,
+		Now:          c.now,
+	})
+	return c
+}
+
+// now returns the current time from the configured clock
+func (c *Client) now() time.Time {
+	if c.config.Now != nil {
+		return c.config.Now()
+	}
+	return time.Now()
+}
+
+// externalID returns a new X-EXTERNAL-ID value
+func (c *Client) externalID() (string, error) {
+	if c.config.ExternalID != nil {
+		return c.config.ExternalID(), nil
+	}
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("error generating external id: %w", err)
+	}
+	return fmt.Sprintf("%020s", n.String()), nil
+}
+
+// Error is a SNAP error response
+type Error struct {
+	// StatusCode is the HTTP status code
+	StatusCode int
+	// ResponseCode is the SNAP response code: HTTP status, service code and case code
+	ResponseCode string
+	// ResponseMessage describes the error
+	ResponseMessage string
+
+	// caseCode completes the response code of notification errors
+	caseCode string
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return fmt.Sprintf("snap error %s: %s", e.ResponseCode, e.ResponseMessage)
+}
+
+// IsUnauthorized returns true if the access token was rejected
+func (e *Error) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || strings.HasPrefix(e.ResponseCode, "401")
+}
+
+// Response holds the fields every SNAP response carries
+type Response struct {
+	ResponseCode    string `json:"responseCode"`
+	ResponseMessage string `json:"responseMessage"`
+}
+
+// IsSuccessful returns true if the response code is a 2xx code
+func (r Response) IsSuccessful() bool {
+	return strings.HasPrefix(r.ResponseCode, "2")
+}
+
+// doService sends a signed service request, fetching an access token first.
+// When the token is rejected it is discarded and the request is sent once
+// more with a new token.
+func (c *Client) doService(method, path string, body interface{}, result interface{}) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshaling request body: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.AccessToken()
+		if err != nil {
+			return err
+		}
+
+		err = c.sendService(method, path, token, jsonBody, result)
+		if snapErr, ok := err.(*Error); ok && snapErr.IsUnauthorized() && attempt == 0 {
+			// Only the rejected token is discarded, not one refreshed meanwhile
+			c.tokens.Invalidate(c.config.ClientKey, token)
+			continue
+		}
+		return err
+	}
+}
+
+// sendService sends one signed service request
+func (c *Client) sendService(method, path, token string, jsonBody []byte, result interface{}) error {
+	// The signature covers the path as the server sees it, including any
+	// prefix of the base URL
+	endpoint, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	timestamp := Timestamp(c.now())
+	signature, err := SymmetricSignature(c.config.ClientSecret, method, pathWithQuery(endpoint), token, jsonBody, timestamp)
+	if err != nil {
+		return err
+	}
+	externalID, err := c.externalID()
+	if err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+	headers.Set("X-TIMESTAMP", timestamp)
+	headers.Set("X-SIGNATURE", signature)
+	headers.Set("X-PARTNER-ID", c.config.PartnerID)
+	headers.Set("X-EXTERNAL-ID", externalID)
+	headers.Set("CHANNEL-ID", c.config.ChannelID)
+
+	return c.do(method, path, headers, jsonBody, result)
+}
+
+// do sends a request and decodes the SNAP response
+func (c *Client) do(method, path string, headers http.Header, jsonBody []byte, result interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header = headers
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	var base Response
+	if err := json.Unmarshal(respBody, &base); err != nil {
+		if resp.StatusCode >= 300 {
+			return &Error{StatusCode: resp.StatusCode, ResponseMessage: strings.TrimSpace(string(respBody))}
+		}
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if resp.StatusCode >= 300 || !base.IsSuccessful() {
+		return &Error{StatusCode: resp.StatusCode, ResponseCode: base.ResponseCode, ResponseMessage: base.ResponseMessage}
+	}
+
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// pathWithQuery returns the path of u including its query, as signed by SNAP
+func pathWithQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.EscapedPath()
+	}
+	return u.EscapedPath() + "?" + u.RawQuery
+}
@@ -0,0 +1,219 @@
+package snap
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+const (
+	testClientKey    = "CLIENT-KEY"
+	testClientSecret = "CLIENT-SECRET"
+	testPartnerID    = "PARTNER"
+	testChannelID    = "95221"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+// newTestKey returns a generated RSA key shared by the tests
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey() error = %v", err)
+		}
+		testKey = key
+	})
+	return testKey
+}
+
+// fakeSNAP is a local stand-in for the Duitku SNAP API that verifies both
+// signature schemes and the required headers
+type fakeSNAP struct {
+	t         *testing.T
+	server    *httptest.Server
+	publicKey *rsa.PublicKey
+
+	mu             sync.Mutex
+	tokens         int
+	revoked        map[string]bool
+	externalIDs    map[string]bool
+	lastBody       map[string]interface{}
+	serviceCalls   int
+	tokenExpiresIn interface{}
+	services       map[string]func(body map[string]interface{}) (int, interface{})
+}
+
+func newFakeSNAP(t *testing.T, prefix string) *fakeSNAP {
+	f := &fakeSNAP{
+		t:              t,
+		publicKey:      &newTestKey(t).PublicKey,
+		revoked:        make(map[string]bool),
+		externalIDs:    make(map[string]bool),
+		tokenExpiresIn: "900",
+		services:       make(map[string]func(map[string]interface{}) (int, interface{})),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+TokenPath, f.handleToken)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		f.handleService(w, r)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeSNAP) client(prefix string) *Client {
+	return NewClient(Config{
+		BaseURLs:     duitku.BaseURLs{SNAP: f.server.URL + prefix},
+		ClientKey:    testClientKey,
+		ClientSecret: testClientSecret,
+		PrivateKey:   newTestKey(f.t),
+		PartnerID:    testPartnerID,
+		ChannelID:    testChannelID,
+		HTTPClient:   f.server.Client(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeSNAP) handleToken(w http.ResponseWriter, r *http.Request) {
+	timestamp := r.Header.Get("X-TIMESTAMP")
+	if _, err := time.Parse(TimestampLayout, timestamp); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{"4007301", "Invalid Field Format X-TIMESTAMP"})
+		return
+	}
+	if r.Header.Get("X-CLIENT-KEY") != testClientKey {
+		writeJSON(w, http.StatusUnauthorized, Response{"4017300", "Unauthorized. Unknown client"})
+		return
+	}
+	if err := VerifyAsymmetricSignature(f.publicKey, testClientKey, timestamp, r.Header.Get("X-SIGNATURE")); err != nil {
+		writeJSON(w, http.StatusUnauthorized, Response{"4017300", "Unauthorized. Signature"})
+		return
+	}
+
+	var request TokenRequest
+	json.NewDecoder(r.Body).Decode(&request)
+	if request.GrantType != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, Response{"4007302", "Invalid Mandatory Field grantType"})
+		return
+	}
+
+	f.mu.Lock()
+	f.tokens++
+	token := fmt.Sprintf("token-%d", f.tokens)
+	expiresIn := f.tokenExpiresIn
+	f.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"responseCode":    "2007300",
+		"responseMessage": "Successful",
+		"accessToken":     token,
+		"tokenType":       "Bearer",
+		"expiresIn":       expiresIn,
+	})
+}
+
+func (f *fakeSNAP) handleService(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.serviceCalls++
+
+	if token == "" || f.revoked[token] {
+		writeJSON(w, http.StatusUnauthorized, Response{"4012701", "Invalid Token (B2B)"})
+		return
+	}
+	for _, header := range []string{"X-TIMESTAMP", "X-PARTNER-ID", "X-EXTERNAL-ID", "CHANNEL-ID"} {
+		if r.Header.Get(header) == "" {
+			writeJSON(w, http.StatusBadRequest, Response{"4002702", "Invalid Mandatory Field " + header})
+			return
+		}
+	}
+	externalID := r.Header.Get("X-EXTERNAL-ID")
+	if f.externalIDs[externalID] {
+		writeJSON(w, http.StatusConflict, Response{"4092700", "Conflict"})
+		return
+	}
+	f.externalIDs[externalID] = true
+
+	err := VerifySymmetricSignature(testClientSecret, r.Method, r.URL.RequestURI(), token, body,
+		r.Header.Get("X-TIMESTAMP"), r.Header.Get("X-SIGNATURE"))
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, Response{"4012700", "Unauthorized. Signature"})
+		return
+	}
+
+	var decoded map[string]interface{}
+	json.Unmarshal(body, &decoded)
+	f.lastBody = decoded
+
+	service, ok := f.services[r.URL.Path]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, Response{"4042700", "Not Found"})
+		return
+	}
+	status, response := service(decoded)
+	writeJSON(w, status, response)
+}
+
+func TestNewClientBaseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "Production Default", config: Config{}, want: "https://snap.duitku.com"},
+		{name: "Sandbox", config: Config{Environment: "sandbox"}, want: "https://snapdev.duitku.com"},
+		{name: "Override", config: Config{Environment: "sandbox", BaseURLs: duitku.BaseURLs{SNAP: "http://localhost:9000/snap/"}}, want: "http://localhost:9000/snap"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewClient(tt.config).baseURL; got != tt.want {
+				t.Errorf("baseURL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+	fake.services[CreateVAPath] = func(map[string]interface{}) (int, interface{}) {
+		return http.StatusConflict, Response{"4092701", "Duplicate trxId"}
+	}
+
+	_, err := fake.client("").CreateVA(CreateVARequest{
+		PartnerServiceID: "12345", CustomerNo: "0001", TrxID: "INV-1", TotalAmount: NewAmount(10000),
+	})
+	snapErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("CreateVA() error = %v, want *Error", err)
+	}
+	if snapErr.StatusCode != http.StatusConflict || snapErr.ResponseCode != "4092701" || snapErr.IsUnauthorized() {
+		t.Errorf("error = %+v", snapErr)
+	}
+	if snapErr.Error() != "snap error 4092701: Duplicate trxId" {
+		t.Errorf("Error() = %s", snapErr.Error())
+	}
+}
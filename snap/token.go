@@ -0,0 +1,125 @@
+package snap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// TokenPath is the B2B access token endpoint
+const TokenPath = "/v1.0/access-token/b2b"
+
+// tokenRefreshMargin is how long before expiry a cached token is no longer
+// used; tokens are refreshed in the background before that
+const tokenRefreshMargin = time.Minute
+
+// TokenRequest is the body of an access token request
+type TokenRequest struct {
+	GrantType      string                 `json:"grantType"`
+	AdditionalInfo map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// TokenResponse is the response of an access token request
+type TokenResponse struct {
+	Response
+	AccessToken string  `json:"accessToken"`
+	TokenType   string  `json:"tokenType"`
+	ExpiresIn   Seconds `json:"expiresIn"`
+}
+
+// Seconds is a number of seconds, encoded as a JSON string or number
+type Seconds int
+
+// UnmarshalJSON accepts "900" as well as 900
+func (s *Seconds) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text == "" {
+			*s = 0
+			return nil
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("invalid seconds %q", text)
+		}
+		*s = Seconds(n)
+		return nil
+	}
+
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid seconds %s", data)
+	}
+	*s = Seconds(n)
+	return nil
+}
+
+// MarshalJSON encodes the seconds as a string, as SNAP responses do
+func (s Seconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.Itoa(int(s)))
+}
+
+// AccessToken returns a cached access token, requesting a new one when there
+// is none or it is about to expire
+func (c *Client) AccessToken() (string, error) {
+	token, err := c.tokens.Token(c.config.ClientKey)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// InvalidateToken discards the cached access token
+func (c *Client) InvalidateToken() {
+	c.tokens.Invalidate(c.config.ClientKey, "")
+}
+
+// fetchToken requests a token for the token manager
+func (c *Client) fetchToken(string) (*duitku.Token, error) {
+	response, err := c.RequestToken()
+	if err != nil {
+		return nil, err
+	}
+	return &duitku.Token{
+		AccessToken: response.AccessToken,
+		TokenType:   response.TokenType,
+		Expiry:      c.now().Add(time.Duration(response.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// RequestToken requests a new B2B access token without caching it
+func (c *Client) RequestToken() (*TokenResponse, error) {
+	if c.config.PrivateKey == nil {
+		return nil, errors.New("a private key is required to request access tokens")
+	}
+
+	timestamp := Timestamp(c.now())
+	signature, err := AsymmetricSignature(c.config.PrivateKey, c.config.ClientKey, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(TokenRequest{GrantType: "client_credentials"})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request body: %w", err)
+	}
+
+	headers := http.Header{}
+	headers.Set("X-TIMESTAMP", timestamp)
+	headers.Set("X-CLIENT-KEY", c.config.ClientKey)
+	headers.Set("X-SIGNATURE", signature)
+
+	var response TokenResponse
+	if err := c.do("POST", TokenPath, headers, body, &response); err != nil {
+		return nil, fmt.Errorf("error requesting access token: %w", err)
+	}
+	if response.AccessToken == "" {
+		return nil, errors.New("error requesting access token: no access token in response")
+	}
+	return &response, nil
+}
@@ -0,0 +1,103 @@
+package snap
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSecondsJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Seconds
+		wantErr bool
+	}{
+		{name: "String", input: `"900"`, want: 900},
+		{name: "Number", input: `900`, want: 900},
+		{name: "Empty", input: `""`, want: 0},
+		{name: "Invalid", input: `"soon"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Seconds
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	data, _ := json.Marshal(Seconds(900))
+	if string(data) != `"900"` {
+		t.Errorf("Marshal() = %s, want \"900\"", data)
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+	fake.tokenExpiresIn = 900
+
+	response, err := fake.client("").RequestToken()
+	if err != nil {
+		t.Fatalf("RequestToken() error = %v", err)
+	}
+	if response.AccessToken != "token-1" || response.TokenType != "Bearer" || response.ExpiresIn != 900 {
+		t.Errorf("RequestToken() = %+v", response)
+	}
+}
+
+func TestRequestTokenErrors(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+
+	client := fake.client("")
+	client.config.ClientKey = "OTHER"
+	if _, err := client.RequestToken(); err == nil {
+		t.Error("RequestToken() with an unknown client key error = nil")
+	}
+
+	client = fake.client("")
+	client.config.PrivateKey = nil
+	if _, err := client.RequestToken(); err == nil {
+		t.Error("RequestToken() without a private key error = nil")
+	}
+}
+
+func TestAccessTokenCaching(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	client := fake.client("")
+	client.config.Now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		token, err := client.AccessToken()
+		if err != nil {
+			t.Fatalf("AccessToken() error = %v", err)
+		}
+		if token != "token-1" {
+			t.Errorf("AccessToken() = %s, want token-1", token)
+		}
+	}
+	if fake.tokens != 1 {
+		t.Errorf("token requests = %d, want 1", fake.tokens)
+	}
+
+	// Within the refresh margin of the 900 second expiry
+	now = now.Add(14*time.Minute + 30*time.Second)
+	token, err := client.AccessToken()
+	if err != nil {
+		t.Fatalf("AccessToken() error = %v", err)
+	}
+	if token != "token-2" {
+		t.Errorf("AccessToken() after expiry = %s, want token-2", token)
+	}
+
+	client.InvalidateToken()
+	if token, _ := client.AccessToken(); token != "token-3" {
+		t.Errorf("AccessToken() after InvalidateToken = %s, want token-3", token)
+	}
+}
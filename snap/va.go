@@ -0,0 +1,202 @@
+package snap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Virtual account service paths
+const (
+	CreateVAPath  = "/v1.0/transfer-va/create-va"
+	InquiryVAPath = "/v1.0/transfer-va/inquiry-va"
+	VAStatusPath  = "/v1.0/transfer-va/status"
+)
+
+// Payment flag statuses of a virtual account payment
+const (
+	PaymentFlagSuccess = "00"
+	PaymentFlagFailed  = "01"
+	PaymentFlagPending = "02"
+)
+
+// Amount is a SNAP monetary amount, with the value written with two decimals
+type Amount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// NewAmount returns an IDR amount for a whole number of rupiah
+func NewAmount(rupiah int) Amount {
+	return Amount{Value: fmt.Sprintf("%d.00", rupiah), Currency: "IDR"}
+}
+
+// PartnerServiceID left pads a partner service ID (the bank's company code)
+// with spaces to the 8 characters SNAP expects
+func PartnerServiceID(id string) string {
+	id = strings.TrimSpace(id)
+	if len(id) >= 8 {
+		return id
+	}
+	return strings.Repeat(" ", 8-len(id)) + id
+}
+
+// VirtualAccountNumber joins a partner service ID and customer number into
+// the virtual account number
+func VirtualAccountNumber(partnerServiceID, customerNo string) string {
+	return PartnerServiceID(partnerServiceID) + customerNo
+}
+
+// Bilingual is a message in English and Indonesian
+type Bilingual struct {
+	English   string `json:"english"`
+	Indonesia string `json:"indonesia"`
+}
+
+// CreateVARequest is the request to create a virtual account
+type CreateVARequest struct {
+	PartnerServiceID      string                 `json:"partnerServiceId"`
+	CustomerNo            string                 `json:"customerNo"`
+	VirtualAccountNo      string                 `json:"virtualAccountNo"`
+	VirtualAccountName    string                 `json:"virtualAccountName"`
+	VirtualAccountEmail   string                 `json:"virtualAccountEmail,omitempty"`
+	VirtualAccountPhone   string                 `json:"virtualAccountPhone,omitempty"`
+	TrxID                 string                 `json:"trxId"`
+	TotalAmount           Amount                 `json:"totalAmount"`
+	VirtualAccountTrxType string                 `json:"virtualAccountTrxType,omitempty"`
+	ExpiredDate           string                 `json:"expiredDate,omitempty"`
+	AdditionalInfo        map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// VirtualAccountData describes a virtual account
+type VirtualAccountData struct {
+	PartnerServiceID      string                 `json:"partnerServiceId"`
+	CustomerNo            string                 `json:"customerNo"`
+	VirtualAccountNo      string                 `json:"virtualAccountNo"`
+	VirtualAccountName    string                 `json:"virtualAccountName"`
+	VirtualAccountEmail   string                 `json:"virtualAccountEmail,omitempty"`
+	VirtualAccountPhone   string                 `json:"virtualAccountPhone,omitempty"`
+	TrxID                 string                 `json:"trxId"`
+	TotalAmount           Amount                 `json:"totalAmount"`
+	VirtualAccountTrxType string                 `json:"virtualAccountTrxType,omitempty"`
+	ExpiredDate           string                 `json:"expiredDate,omitempty"`
+	AdditionalInfo        map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// CreateVAResponse is the response of CreateVA
+type CreateVAResponse struct {
+	Response
+	VirtualAccountData VirtualAccountData `json:"virtualAccountData"`
+}
+
+// InquiryVARequest is the request to look up a virtual account
+type InquiryVARequest struct {
+	PartnerServiceID string                 `json:"partnerServiceId"`
+	CustomerNo       string                 `json:"customerNo"`
+	VirtualAccountNo string                 `json:"virtualAccountNo"`
+	TrxID            string                 `json:"trxId,omitempty"`
+	AdditionalInfo   map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// InquiryVAResponse is the response of InquiryVA
+type InquiryVAResponse struct {
+	Response
+	VirtualAccountData VirtualAccountData `json:"virtualAccountData"`
+}
+
+// VAStatusRequest is the request for the payment status of a virtual account
+type VAStatusRequest struct {
+	PartnerServiceID string                 `json:"partnerServiceId"`
+	CustomerNo       string                 `json:"customerNo"`
+	VirtualAccountNo string                 `json:"virtualAccountNo"`
+	InquiryRequestID string                 `json:"inquiryRequestId,omitempty"`
+	PaymentRequestID string                 `json:"paymentRequestId,omitempty"`
+	AdditionalInfo   map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// VAStatusData is the payment status of a virtual account
+type VAStatusData struct {
+	PaymentFlagReason Bilingual              `json:"paymentFlagReason"`
+	PartnerServiceID  string                 `json:"partnerServiceId"`
+	CustomerNo        string                 `json:"customerNo"`
+	VirtualAccountNo  string                 `json:"virtualAccountNo"`
+	InquiryRequestID  string                 `json:"inquiryRequestId,omitempty"`
+	PaymentRequestID  string                 `json:"paymentRequestId,omitempty"`
+	TrxID             string                 `json:"trxId,omitempty"`
+	PaidAmount        Amount                 `json:"paidAmount"`
+	TotalAmount       Amount                 `json:"totalAmount"`
+	TransactionDate   string                 `json:"transactionDate,omitempty"`
+	ReferenceNo       string                 `json:"referenceNo,omitempty"`
+	PaymentFlagStatus string                 `json:"paymentFlagStatus"`
+	AdditionalInfo    map[string]interface{} `json:"additionalInfo,omitempty"`
+}
+
+// IsPaid returns true if the virtual account has been paid
+func (d *VAStatusData) IsPaid() bool {
+	return d.PaymentFlagStatus == PaymentFlagSuccess
+}
+
+// VAStatusResponse is the response of VAStatus
+type VAStatusResponse struct {
+	Response
+	VirtualAccountData VAStatusData `json:"virtualAccountData"`
+}
+
+// fillVirtualAccount pads the partner service ID and derives the virtual
+// account number when it is empty
+func fillVirtualAccount(partnerServiceID, customerNo, virtualAccountNo *string) error {
+	if strings.TrimSpace(*partnerServiceID) == "" || *customerNo == "" {
+		return errors.New("partnerServiceId and customerNo are required")
+	}
+	*partnerServiceID = PartnerServiceID(*partnerServiceID)
+	if *virtualAccountNo == "" {
+		*virtualAccountNo = *partnerServiceID + *customerNo
+	}
+	return nil
+}
+
+// CreateVA creates a virtual account. VirtualAccountNo is derived from the
+// partner service ID and customer number when empty.
+func (c *Client) CreateVA(request CreateVARequest) (*CreateVAResponse, error) {
+	if err := fillVirtualAccount(&request.PartnerServiceID, &request.CustomerNo, &request.VirtualAccountNo); err != nil {
+		return nil, fmt.Errorf("error creating virtual account: %w", err)
+	}
+	if request.TrxID == "" {
+		return nil, errors.New("error creating virtual account: trxId is required")
+	}
+	if request.TotalAmount.Currency == "" {
+		request.TotalAmount.Currency = "IDR"
+	}
+
+	var response CreateVAResponse
+	if err := c.doService("POST", CreateVAPath, request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// InquiryVA looks up a virtual account
+func (c *Client) InquiryVA(request InquiryVARequest) (*InquiryVAResponse, error) {
+	if err := fillVirtualAccount(&request.PartnerServiceID, &request.CustomerNo, &request.VirtualAccountNo); err != nil {
+		return nil, fmt.Errorf("error inquiring virtual account: %w", err)
+	}
+
+	var response InquiryVAResponse
+	if err := c.doService("POST", InquiryVAPath, request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// VAStatus returns the payment status of a virtual account
+func (c *Client) VAStatus(request VAStatusRequest) (*VAStatusResponse, error) {
+	if err := fillVirtualAccount(&request.PartnerServiceID, &request.CustomerNo, &request.VirtualAccountNo); err != nil {
+		return nil, fmt.Errorf("error checking virtual account status: %w", err)
+	}
+
+	var response VAStatusResponse
+	if err := c.doService("POST", VAStatusPath, request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
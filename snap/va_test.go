@@ -0,0 +1,162 @@
+package snap
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+func TestPartnerServiceID(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "12345", want: "   12345"},
+		{input: " 12345 ", want: "   12345"},
+		{input: "12345678", want: "12345678"},
+	}
+	for _, tt := range tests {
+		if got := PartnerServiceID(tt.input); got != tt.want {
+			t.Errorf("PartnerServiceID(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	if got := VirtualAccountNumber("12345", "0001"); got != "   123450001" {
+		t.Errorf("VirtualAccountNumber() = %q", got)
+	}
+	if got := NewAmount(10000); got.Value != "10000.00" || got.Currency != "IDR" {
+		t.Errorf("NewAmount() = %+v", got)
+	}
+}
+
+func echoVirtualAccount(responseCode string) func(map[string]interface{}) (int, interface{}) {
+	return func(body map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{
+			"responseCode":       responseCode,
+			"responseMessage":    "Successful",
+			"virtualAccountData": body,
+		}
+	}
+}
+
+func TestCreateVA(t *testing.T) {
+	// A base URL with a path prefix checks that the prefix is signed too
+	fake := newFakeSNAP(t, "/merchant")
+	fake.services["/merchant"+CreateVAPath] = echoVirtualAccount("2002700")
+
+	response, err := fake.client("/merchant").CreateVA(CreateVARequest{
+		PartnerServiceID:   "12345",
+		CustomerNo:         "0001",
+		VirtualAccountName: "John Doe",
+		TrxID:              "INV-1",
+		TotalAmount:        Amount{Value: "10000.00"},
+	})
+	if err != nil {
+		t.Fatalf("CreateVA() error = %v", err)
+	}
+	if !response.IsSuccessful() {
+		t.Errorf("IsSuccessful() = false for %s", response.ResponseCode)
+	}
+	data := response.VirtualAccountData
+	if data.PartnerServiceID != "   12345" || data.VirtualAccountNo != "   123450001" {
+		t.Errorf("virtual account = %q, %q", data.PartnerServiceID, data.VirtualAccountNo)
+	}
+	if data.TotalAmount.Currency != "IDR" || data.TrxID != "INV-1" {
+		t.Errorf("virtual account = %+v", data)
+	}
+}
+
+func TestCreateVAValidation(t *testing.T) {
+	client := NewClient(Config{BaseURLs: duitku.BaseURLs{SNAP: "http://127.0.0.1:0"}})
+
+	tests := []struct {
+		name    string
+		request CreateVARequest
+	}{
+		{name: "Missing Partner Service ID", request: CreateVARequest{CustomerNo: "0001", TrxID: "INV-1"}},
+		{name: "Missing Customer Number", request: CreateVARequest{PartnerServiceID: "12345", TrxID: "INV-1"}},
+		{name: "Missing Transaction ID", request: CreateVARequest{PartnerServiceID: "12345", CustomerNo: "0001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.CreateVA(tt.request); err == nil {
+				t.Error("CreateVA() error = nil")
+			}
+		})
+	}
+}
+
+func TestInquiryVA(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+	fake.services[InquiryVAPath] = echoVirtualAccount("2003000")
+
+	response, err := fake.client("").InquiryVA(InquiryVARequest{
+		PartnerServiceID: "12345",
+		CustomerNo:       "0001",
+		TrxID:            "INV-1",
+	})
+	if err != nil {
+		t.Fatalf("InquiryVA() error = %v", err)
+	}
+	if response.ResponseCode != "2003000" || response.VirtualAccountData.VirtualAccountNo != "   123450001" {
+		t.Errorf("InquiryVA() = %+v", response)
+	}
+}
+
+func TestVAStatus(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+	fake.services[VAStatusPath] = func(body map[string]interface{}) (int, interface{}) {
+		body["paymentFlagStatus"] = PaymentFlagSuccess
+		body["paidAmount"] = NewAmount(10000)
+		body["paymentFlagReason"] = Bilingual{English: "Success", Indonesia: "Sukses"}
+		return http.StatusOK, map[string]interface{}{
+			"responseCode":       "2002600",
+			"responseMessage":    "Successful",
+			"virtualAccountData": body,
+		}
+	}
+
+	response, err := fake.client("").VAStatus(VAStatusRequest{
+		PartnerServiceID: "12345",
+		CustomerNo:       "0001",
+		InquiryRequestID: "REQ-1",
+	})
+	if err != nil {
+		t.Fatalf("VAStatus() error = %v", err)
+	}
+	data := response.VirtualAccountData
+	if !data.IsPaid() || data.PaidAmount.Value != "10000.00" || data.PaymentFlagReason.English != "Success" {
+		t.Errorf("VAStatus() = %+v", data)
+	}
+	if fake.lastBody["inquiryRequestId"] != "REQ-1" {
+		t.Errorf("request body = %v", fake.lastBody)
+	}
+}
+
+func TestServiceRetriesAfterUnauthorized(t *testing.T) {
+	fake := newFakeSNAP(t, "")
+	fake.services[InquiryVAPath] = echoVirtualAccount("2003000")
+	client := fake.client("")
+
+	if _, err := client.AccessToken(); err != nil {
+		t.Fatalf("AccessToken() error = %v", err)
+	}
+	fake.revoked["token-1"] = true
+
+	request := InquiryVARequest{PartnerServiceID: "12345", CustomerNo: "0001"}
+	if _, err := client.InquiryVA(request); err != nil {
+		t.Fatalf("InquiryVA() error = %v", err)
+	}
+	if fake.tokens != 2 || fake.serviceCalls != 2 {
+		t.Errorf("token requests = %d, service calls = %d, want 2 and 2", fake.tokens, fake.serviceCalls)
+	}
+
+	// A token rejected twice is returned as an error
+	fake.revoked["token-2"] = true
+	fake.revoked["token-3"] = true
+	_, err := client.InquiryVA(request)
+	snapErr, ok := err.(*Error)
+	if !ok || !snapErr.IsUnauthorized() {
+		t.Errorf("InquiryVA() error = %v, want unauthorized *Error", err)
+	}
+}
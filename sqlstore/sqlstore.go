@@ -0,0 +1,236 @@
+// Package sqlstore is a duitku.TransactionStore on database/sql.
+//
+// The store keeps the audit trail in one table and uses portable SQL, so it
+// works with the PostgreSQL, MySQL and SQLite drivers. Only the placeholder
+// style and, for MySQL, the index definition differ between databases:
+//
+//	db, err := sql.Open("postgres", dsn)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	store, err := sqlstore.New(db, sqlstore.Options{Placeholder: sqlstore.PlaceholderDollar})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := store.CreateTable(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	client := duitku.NewClient(duitku.Config{
+//		MerchantCode:     "YOUR_MERCHANT_CODE",
+//		APIKey:           "YOUR_API_KEY",
+//		TransactionStore: store,
+//	})
+//
+//	// Later, the full history of an order
+//	records, err := store.Records("ORDER-123")
+package sqlstore
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// DefaultTable is the table name used when Options.Table is empty
+const DefaultTable = "duitku_transaction_records"
+
+// Placeholder is the bind parameter style of a database driver
+type Placeholder int
+
+// Placeholder styles
+const (
+	// PlaceholderQuestion binds with ?, as MySQL and SQLite do
+	PlaceholderQuestion Placeholder = iota
+	// PlaceholderDollar binds with $1, $2, as PostgreSQL does
+	PlaceholderDollar
+)
+
+// Dialect selects the schema statements of a database
+type Dialect int
+
+// Dialects
+const (
+	// DialectStandard creates the index with CREATE INDEX IF NOT EXISTS, as
+	// PostgreSQL and SQLite do
+	DialectStandard Dialect = iota
+	// DialectMySQL declares the index in CREATE TABLE, since MySQL has no
+	// CREATE INDEX IF NOT EXISTS
+	DialectMySQL
+)
+
+// tableName limits table names to identifiers, since they are written into the SQL
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Options configures a Store
+type Options struct {
+	// Table is the table name, DefaultTable when empty. It may be
+	// qualified with a schema.
+	Table string
+	// Placeholder is the bind parameter style of the driver
+	Placeholder Placeholder
+	// Dialect selects the schema statements, DialectStandard when zero
+	Dialect Dialect
+}
+
+// Store is a duitku.TransactionStore on a database/sql database
+type Store struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+	dialect     Dialect
+}
+
+// New creates a Store on db. It returns an error when Options.Table is not
+// a valid table name.
+func New(db *sql.DB, options Options) (*Store, error) {
+	table := options.Table
+	if table == "" {
+		table = DefaultTable
+	}
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("sqlstore: invalid table name %q", table)
+	}
+	return &Store{db: db, table: table, placeholder: options.Placeholder, dialect: options.Dialect}, nil
+}
+
+// Schema returns the statements that create the table and its index unless
+// they exist
+func (s *Store) Schema() []string {
+	index := strings.Replace(s.table, ".", "_", -1) + "_order"
+	if s.dialect == DialectMySQL {
+		return []string{s.createTable(",\n\tINDEX " + index + " (merchant_order_id, recorded_at)")}
+	}
+	return []string{
+		s.createTable(""),
+		`CREATE INDEX IF NOT EXISTS ` + index + ` ON ` + s.table + ` (merchant_order_id, recorded_at)`,
+	}
+}
+
+// createTable returns the CREATE TABLE statement with extra definitions
+// after the columns
+func (s *Store) createTable(extra string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+	id VARCHAR(32) NOT NULL PRIMARY KEY,
+	merchant_order_id VARCHAR(255) NOT NULL,
+	event VARCHAR(32) NOT NULL,
+	merchant_code VARCHAR(64) NOT NULL,
+	reference VARCHAR(255) NOT NULL,
+	payment_method VARCHAR(16) NOT NULL,
+	amount VARCHAR(32) NOT NULL,
+	status_code VARCHAR(16) NOT NULL,
+	error_message TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	recorded_at BIGINT NOT NULL` + extra + `
+)`
+}
+
+// CreateTable creates the table and its index unless they exist, so it can
+// run on every start, also by instances starting at the same time
+func (s *Store) CreateTable() error {
+	for _, statement := range s.Schema() {
+		if _, err := s.db.Exec(statement); err != nil {
+			return fmt.Errorf("error creating table %s: %w", s.table, err)
+		}
+	}
+	return nil
+}
+
+// SaveRecord appends a record to the trail of its merchant order ID
+func (s *Store) SaveRecord(record *duitku.TransactionRecord) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO ` + s.table + ` (id, merchant_order_id, event, merchant_code, reference, payment_method, amount, status_code, error_message, payload, recorded_at) VALUES (` + s.placeholders(11) + `)`
+	_, err = s.db.Exec(query,
+		id,
+		record.MerchantOrderID,
+		record.Event,
+		record.MerchantCode,
+		record.Reference,
+		record.PaymentMethod,
+		record.Amount,
+		record.StatusCode,
+		record.Error,
+		string(record.Payload),
+		record.RecordedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting transaction record: %w", err)
+	}
+	return nil
+}
+
+// Records returns the trail of a merchant order ID, oldest first
+func (s *Store) Records(merchantOrderID string) ([]*duitku.TransactionRecord, error) {
+	query := `SELECT merchant_order_id, event, merchant_code, reference, payment_method, amount, status_code, error_message, payload, recorded_at FROM ` + s.table + ` WHERE merchant_order_id = ` + s.placeholders(1) + ` ORDER BY recorded_at, id`
+	rows, err := s.db.Query(query, merchantOrderID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying transaction records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*duitku.TransactionRecord
+	for rows.Next() {
+		var (
+			record     duitku.TransactionRecord
+			payload    string
+			recordedAt int64
+		)
+		err := rows.Scan(
+			&record.MerchantOrderID,
+			&record.Event,
+			&record.MerchantCode,
+			&record.Reference,
+			&record.PaymentMethod,
+			&record.Amount,
+			&record.StatusCode,
+			&record.Error,
+			&payload,
+			&recordedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning transaction record: %w", err)
+		}
+		if payload != "" {
+			record.Payload = []byte(payload)
+		}
+		record.RecordedAt = time.Unix(0, recordedAt)
+		records = append(records, &record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading transaction records: %w", err)
+	}
+	return records, nil
+}
+
+// placeholders returns n comma separated bind parameters
+func (s *Store) placeholders(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		if s.placeholder == PlaceholderDollar {
+			params[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			params[i] = "?"
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+// newID returns a random record ID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating record ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,422 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go"
+)
+
+// fakeDriver is an in-memory database/sql driver that understands the
+// statements the Store issues
+type fakeDriver struct {
+	mu        sync.Mutex
+	databases map[string]*fakeDatabase
+}
+
+// fakeDatabase holds the tables and executed statements of one DSN
+type fakeDatabase struct {
+	mu         sync.Mutex
+	tables     map[string][]map[string]driver.Value
+	indexes    map[string]bool
+	statements []string
+	// createErr fails the CREATE statements when set
+	createErr error
+}
+
+var testDriver = &fakeDriver{databases: make(map[string]*fakeDatabase)}
+
+func init() {
+	sql.Register("sqlstorefake", testDriver)
+}
+
+var databaseCount int32
+
+// openTestDB opens an empty fake database
+func openTestDB(t *testing.T) (*sql.DB, *fakeDatabase) {
+	t.Helper()
+	name := fmt.Sprintf("db%d", atomic.AddInt32(&databaseCount, 1))
+	db, err := sql.Open("sqlstorefake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	testDriver.mu.Lock()
+	defer testDriver.mu.Unlock()
+	database := &fakeDatabase{tables: make(map[string][]map[string]driver.Value), indexes: make(map[string]bool)}
+	testDriver.databases[name] = database
+	return db, database
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	database, ok := d.databases[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database %s", name)
+	}
+	return &fakeConn{db: database}, nil
+}
+
+type fakeConn struct {
+	db *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	db    *fakeDatabase
+	query string
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\S+) \(`)
+	createIndexPattern = regexp.MustCompile(`^CREATE INDEX IF NOT EXISTS (\S+) ON (\S+) \(`)
+	insertPattern      = regexp.MustCompile(`^INSERT INTO (\S+) \(([^)]*)\) VALUES \(([^)]*)\)$`)
+	selectPattern      = regexp.MustCompile(`^SELECT (.*) FROM (\S+) WHERE merchant_order_id = (\S+) ORDER BY recorded_at, id$`)
+)
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.statements = append(s.db.statements, s.query)
+
+	if strings.HasPrefix(s.query, "CREATE") && s.db.createErr != nil {
+		return nil, s.db.createErr
+	}
+	if m := createTablePattern.FindStringSubmatch(s.query); m != nil {
+		if _, ok := s.db.tables[m[1]]; !ok {
+			s.db.tables[m[1]] = nil
+		}
+		return driver.RowsAffected(0), nil
+	}
+	if m := createIndexPattern.FindStringSubmatch(s.query); m != nil {
+		if _, ok := s.db.tables[m[2]]; !ok {
+			return nil, fmt.Errorf("no such table: %s", m[2])
+		}
+		s.db.indexes[m[1]] = true
+		return driver.RowsAffected(0), nil
+	}
+	if m := insertPattern.FindStringSubmatch(s.query); m != nil {
+		rows, ok := s.db.tables[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", m[1])
+		}
+		columns := splitList(m[2])
+		if len(columns) != len(args) || len(splitList(m[3])) != len(args) {
+			return nil, fmt.Errorf("%d columns, %d args", len(columns), len(args))
+		}
+		row := make(map[string]driver.Value)
+		for i, column := range columns {
+			row[column] = args[i]
+		}
+		s.db.tables[m[1]] = append(rows, row)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unsupported statement: %s", s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.statements = append(s.db.statements, s.query)
+
+	if m := selectPattern.FindStringSubmatch(s.query); m != nil {
+		rows, ok := s.db.tables[m[2]]
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", m[2])
+		}
+		var matched []map[string]driver.Value
+		for _, row := range rows {
+			if row["merchant_order_id"] == args[0] {
+				matched = append(matched, row)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := matched[i]["recorded_at"].(int64), matched[j]["recorded_at"].(int64)
+			if a != b {
+				return a < b
+			}
+			return matched[i]["id"].(string) < matched[j]["id"].(string)
+		})
+
+		columns := splitList(m[1])
+		result := &fakeRows{columns: columns}
+		for _, row := range matched {
+			values := make([]driver.Value, len(columns))
+			for i, column := range columns {
+				values[i] = row[column]
+			}
+			result.values = append(result.values, values)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unsupported query: %s", s.query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// splitList splits a comma separated SQL list
+func splitList(list string) []string {
+	parts := strings.Split(list, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+func TestStore(t *testing.T) {
+	db, database := openTestDB(t)
+	store := newTestStore(t, db, Options{})
+
+	for i := 0; i < 2; i++ {
+		if err := store.CreateTable(); err != nil {
+			t.Fatalf("CreateTable() error = %v", err)
+		}
+	}
+	for _, statement := range database.statements {
+		if strings.HasPrefix(statement, "CREATE") && !strings.HasPrefix(statement, "CREATE TABLE IF NOT EXISTS") &&
+			!strings.HasPrefix(statement, "CREATE INDEX IF NOT EXISTS") {
+			t.Errorf("statement %q fails when the table exists", statement)
+		}
+	}
+	if !database.indexes["duitku_transaction_records_order"] {
+		t.Error("index was not created")
+	}
+
+	base := time.Date(2024, 1, 30, 10, 0, 0, 0, time.UTC)
+	records := []*duitku.TransactionRecord{
+		{MerchantOrderID: "ORDER-1", Event: duitku.RecordCallback, StatusCode: "00", Payload: json.RawMessage(`{"resultCode":"00"}`), RecordedAt: base.Add(2 * time.Minute)},
+		{MerchantOrderID: "ORDER-1", Event: duitku.RecordCreated, MerchantCode: "DXXXX", Reference: "REF1", PaymentMethod: "VC", Amount: "40000", StatusCode: "00", RecordedAt: base},
+		{MerchantOrderID: "ORDER-2", Event: duitku.RecordStatus, Error: "API error", RecordedAt: base},
+	}
+	for _, record := range records {
+		if err := store.SaveRecord(record); err != nil {
+			t.Fatalf("SaveRecord() error = %v", err)
+		}
+	}
+
+	got, err := store.Records("ORDER-1")
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Records() = %d records, want 2", len(got))
+	}
+	created, callback := got[0], got[1]
+	if created.Event != duitku.RecordCreated || created.Reference != "REF1" || created.PaymentMethod != "VC" ||
+		created.Amount != "40000" || created.MerchantCode != "DXXXX" || !created.RecordedAt.Equal(base) || created.Payload != nil {
+		t.Errorf("Records()[0] = %+v", created)
+	}
+	if callback.Event != duitku.RecordCallback || string(callback.Payload) != `{"resultCode":"00"}` {
+		t.Errorf("Records()[1] = %+v", callback)
+	}
+
+	if got, err := store.Records("ORDER-2"); err != nil || len(got) != 1 || got[0].Error != "API error" {
+		t.Errorf("Records(ORDER-2) = %+v, %v", got, err)
+	}
+	if got, err := store.Records("ORDER-3"); err != nil || len(got) != 0 {
+		t.Errorf("Records(ORDER-3) = %+v, %v", got, err)
+	}
+}
+
+func TestStoreOptions(t *testing.T) {
+	db, database := openTestDB(t)
+	store := newTestStore(t, db, Options{Table: "payments.audit", Placeholder: PlaceholderDollar})
+
+	if err := store.CreateTable(); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := store.SaveRecord(&duitku.TransactionRecord{MerchantOrderID: "ORDER-1", Event: duitku.RecordCreated}); err != nil {
+		t.Fatalf("SaveRecord() error = %v", err)
+	}
+	if _, err := store.Records("ORDER-1"); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+
+	want := []string{
+		"CREATE INDEX IF NOT EXISTS payments_audit_order ON payments.audit",
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		"WHERE merchant_order_id = $1",
+	}
+	all := strings.Join(database.statements, "\n")
+	for _, fragment := range want {
+		if !strings.Contains(all, fragment) {
+			t.Errorf("statements do not contain %q:\n%s", fragment, all)
+		}
+	}
+
+	if _, err := New(db, Options{Table: "records; DROP TABLE orders"}); err == nil {
+		t.Error("New() error = nil for an invalid table name")
+	}
+}
+
+func TestStoreMySQLSchema(t *testing.T) {
+	db, database := openTestDB(t)
+	store := newTestStore(t, db, Options{Dialect: DialectMySQL})
+
+	schema := store.Schema()
+	if len(schema) != 1 || !strings.Contains(schema[0], "INDEX duitku_transaction_records_order (merchant_order_id, recorded_at)") {
+		t.Errorf("Schema() = %q, want the index in CREATE TABLE", schema)
+	}
+	if err := store.CreateTable(); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if _, ok := database.tables[DefaultTable]; !ok {
+		t.Error("table was not created")
+	}
+}
+
+// newTestStore creates a Store or fails the test
+func newTestStore(t *testing.T, db *sql.DB, options Options) *Store {
+	t.Helper()
+	store, err := New(db, options)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return store
+}
+
+func TestStoreErrors(t *testing.T) {
+	db, _ := openTestDB(t)
+	store := newTestStore(t, db, Options{})
+
+	// The table was never created
+	if err := store.SaveRecord(&duitku.TransactionRecord{MerchantOrderID: "ORDER-1"}); err == nil {
+		t.Error("SaveRecord() error = nil")
+	}
+	if _, err := store.Records("ORDER-1"); err == nil {
+		t.Error("Records() error = nil")
+	}
+}
+
+func TestCreateTableConcurrentStart(t *testing.T) {
+	db, database := openTestDB(t)
+	store := newTestStore(t, db, Options{})
+
+	// Another instance created the table and index meanwhile
+	database.tables[DefaultTable] = nil
+	database.indexes["duitku_transaction_records_order"] = true
+	if err := store.CreateTable(); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+}
+
+func TestCreateTableError(t *testing.T) {
+	db, database := openTestDB(t)
+	store := newTestStore(t, db, Options{})
+
+	database.createErr = errors.New("permission denied for schema public")
+	err := store.CreateTable()
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("CreateTable() error = %v, want the database error", err)
+	}
+}
+
+func TestStoreWithClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "transactionStatus") {
+			w.Write([]byte(`{"merchantOrderId":"ORDER-1","reference":"REF1","amount":"40000","statusCode":"00","statusMessage":"SUCCESS"}`))
+			return
+		}
+		w.Write([]byte(`{"merchantCode":"DXXXX","reference":"REF1","statusCode":"00","statusMessage":"SUCCESS"}`))
+	}))
+	defer server.Close()
+
+	db, _ := openTestDB(t)
+	store := newTestStore(t, db, Options{})
+	if err := store.CreateTable(); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	client := duitku.NewClient(duitku.Config{
+		MerchantCode:     "DXXXX",
+		APIKey:           "DXXXXCX80TZJ85Q70QCI",
+		BaseURLs:         duitku.BaseURLs{Payment: server.URL},
+		HTTPClient:       server.Client(),
+		TransactionStore: store,
+		OnStoreError: func(record *duitku.TransactionRecord, err error) {
+			t.Errorf("store error for %s: %v", record.Event, err)
+		},
+	})
+
+	if _, err := client.CreateTransaction(duitku.TransactionRequest{MerchantOrderID: "ORDER-1", PaymentAmount: 40000, PaymentMethod: "VC"}); err != nil {
+		t.Fatalf("CreateTransaction() error = %v", err)
+	}
+	if _, err := client.CheckTransaction("ORDER-1"); err != nil {
+		t.Fatalf("CheckTransaction() error = %v", err)
+	}
+
+	form := url.Values{
+		"merchantCode":    {"DXXXX"},
+		"amount":          {"40000"},
+		"merchantOrderId": {"ORDER-1"},
+		"paymentCode":     {"VC"},
+		"resultCode":      {"00"},
+		"reference":       {"REF1"},
+		"signature":       {duitku.SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER-1")},
+	}
+	req := httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	client.HandleCallback(w, req, func(*duitku.CallbackData) error { return nil })
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d", w.Code)
+	}
+
+	records, err := store.Records("ORDER-1")
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	events := make([]string, len(records))
+	for i, record := range records {
+		events[i] = record.Event
+		if record.Reference != "REF1" || record.MerchantCode != "DXXXX" {
+			t.Errorf("record %d = %+v", i, record)
+		}
+	}
+	if strings.Join(events, ",") != "created,status,callback" {
+		t.Errorf("events = %v", events)
+	}
+}
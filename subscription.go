@@ -0,0 +1,226 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Subscription represents a credit card subscription created through CreateTransaction
+type Subscription struct {
+	SubscriptionID    string `json:"subscriptionId"`
+	MerchantOrderID   string `json:"merchantOrderId"`
+	Description       string `json:"description"`
+	Amount            string `json:"amount"`
+	FrequencyType     int    `json:"frequencyType"`
+	FrequencyInterval int    `json:"frequencyInterval"`
+	TotalNoOfCycles   int    `json:"totalNoOfCycles"`
+	CompletedCycles   int    `json:"completedCycles"`
+	Status            string `json:"status"`
+	NextRunDate       string `json:"nextRunDate,omitempty"`
+	CreatedDate       string `json:"createdDate"`
+}
+
+// IsActive returns true if the subscription is still charging on schedule
+func (s *Subscription) IsActive() bool {
+	return s.Status == SubscriptionStatusActive
+}
+
+// SubscriptionCycle represents one charge of a subscription
+type SubscriptionCycle struct {
+	CycleNumber     int    `json:"cycleNumber"`
+	MerchantOrderID string `json:"merchantOrderId"`
+	Reference       string `json:"reference"`
+	Amount          string `json:"amount"`
+	RunDate         string `json:"runDate"`
+	StatusCode      string `json:"statusCode"`
+	StatusMessage   string `json:"statusMessage"`
+}
+
+// SubscriptionRequest represents a request that targets a single subscription
+type SubscriptionRequest struct {
+	MerchantCode   string `json:"merchantCode"`
+	SubscriptionID string `json:"subscriptionId"`
+	Signature      string `json:"signature"`
+}
+
+// ListSubscriptionsRequest represents a request to list subscriptions
+type ListSubscriptionsRequest struct {
+	MerchantCode string `json:"merchantCode"`
+	Status       string `json:"status,omitempty"`
+	DateTime     string `json:"datetime"`
+	Signature    string `json:"signature"`
+}
+
+// SubscriptionResponse represents the response for a single subscription
+type SubscriptionResponse struct {
+	Subscription    Subscription `json:"subscription"`
+	ResponseCode    string       `json:"responseCode"`
+	ResponseMessage string       `json:"responseMessage"`
+}
+
+// ListSubscriptionsResponse represents the response from listing subscriptions
+type ListSubscriptionsResponse struct {
+	Subscriptions   []Subscription `json:"subscriptions"`
+	ResponseCode    string         `json:"responseCode"`
+	ResponseMessage string         `json:"responseMessage"`
+}
+
+// SubscriptionCyclesResponse represents the response from listing subscription cycles
+type SubscriptionCyclesResponse struct {
+	SubscriptionID  string              `json:"subscriptionId"`
+	Cycles          []SubscriptionCycle `json:"cycles"`
+	ResponseCode    string              `json:"responseCode"`
+	ResponseMessage string              `json:"responseMessage"`
+}
+
+// ListSubscriptions lists the merchant's subscriptions. Pass an empty status
+// to list all of them, or one of the SubscriptionStatus constants to filter.
+func (c *Client) ListSubscriptions(status string) ([]Subscription, error) {
+	datetime := time.Now().Format("2006-01-02 15:04:05")
+	signature := c.createSignatureSHA256(c.config.MerchantCode, datetime)
+
+	request := ListSubscriptionsRequest{
+		MerchantCode: c.config.MerchantCode,
+		Status:       status,
+		DateTime:     datetime,
+		Signature:    signature,
+	}
+
+	var response ListSubscriptionsResponse
+	err := c.doRequest("POST", "merchant/subscription/list", request, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ResponseCode != "00" {
+		return nil, fmt.Errorf("error listing subscriptions: %s", response.ResponseMessage)
+	}
+
+	return response.Subscriptions, nil
+}
+
+// GetSubscription retrieves a subscription by the ID returned from CreateTransaction
+func (c *Client) GetSubscription(subscriptionID string) (*Subscription, error) {
+	return c.subscriptionAction("merchant/subscription/detail", "getting subscription", subscriptionID)
+}
+
+// PauseSubscription stops charging a subscription until it is resumed
+func (c *Client) PauseSubscription(subscriptionID string) (*Subscription, error) {
+	return c.subscriptionAction("merchant/subscription/pause", "pausing subscription", subscriptionID)
+}
+
+// ResumeSubscription resumes charging a paused subscription
+func (c *Client) ResumeSubscription(subscriptionID string) (*Subscription, error) {
+	return c.subscriptionAction("merchant/subscription/resume", "resuming subscription", subscriptionID)
+}
+
+// CancelSubscription permanently stops a subscription
+func (c *Client) CancelSubscription(subscriptionID string) (*Subscription, error) {
+	return c.subscriptionAction("merchant/subscription/cancel", "cancelling subscription", subscriptionID)
+}
+
+// GetSubscriptionCycles retrieves the charges made so far for a subscription
+func (c *Client) GetSubscriptionCycles(subscriptionID string) ([]SubscriptionCycle, error) {
+	if subscriptionID == "" {
+		return nil, errors.New("subscription ID is required")
+	}
+
+	var response SubscriptionCyclesResponse
+	err := c.doRequest("POST", "merchant/subscription/cycles", c.newSubscriptionRequest(subscriptionID), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ResponseCode != "00" {
+		return nil, fmt.Errorf("error getting subscription cycles: %s", response.ResponseMessage)
+	}
+
+	return response.Cycles, nil
+}
+
+// subscriptionAction posts a single subscription request to the endpoint
+func (c *Client) subscriptionAction(endpoint, action, subscriptionID string) (*Subscription, error) {
+	if subscriptionID == "" {
+		return nil, errors.New("subscription ID is required")
+	}
+
+	var response SubscriptionResponse
+	err := c.doRequest("POST", endpoint, c.newSubscriptionRequest(subscriptionID), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ResponseCode != "00" {
+		return nil, fmt.Errorf("error %s: %s", action, response.ResponseMessage)
+	}
+
+	return &response.Subscription, nil
+}
+
+// newSubscriptionRequest creates a signed request for a subscription
+func (c *Client) newSubscriptionRequest(subscriptionID string) SubscriptionRequest {
+	return SubscriptionRequest{
+		MerchantCode:   c.config.MerchantCode,
+		SubscriptionID: subscriptionID,
+		Signature:      c.createSignatureMD5(c.config.MerchantCode, subscriptionID),
+	}
+}
+
+// SubscriptionChargeEvent represents a recurring charge reported by a callback
+type SubscriptionChargeEvent struct {
+	SubscriptionID  string
+	CycleNumber     int
+	MerchantOrderID string
+	Reference       string
+	Amount          string
+	ResultCode      string
+	Callback        *CallbackData
+}
+
+// IsSuccessful returns true if the recurring charge succeeded
+func (e *SubscriptionChargeEvent) IsSuccessful() bool {
+	return e.ResultCode == CallbackStatusSuccess
+}
+
+// IsSubscriptionCharge returns true if the callback reports a recurring subscription charge
+func (data *CallbackData) IsSubscriptionCharge() bool {
+	return data.SubscriptionID != ""
+}
+
+// SubscriptionCharge converts a recurring charge callback into a SubscriptionChargeEvent
+func (data *CallbackData) SubscriptionCharge() (*SubscriptionChargeEvent, error) {
+	if !data.IsSubscriptionCharge() {
+		return nil, errors.New("callback is not a subscription charge")
+	}
+
+	cycleNumber := 0
+	if data.CycleNumber != "" {
+		n, err := strconv.Atoi(data.CycleNumber)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cycle number %q: %w", data.CycleNumber, err)
+		}
+		cycleNumber = n
+	}
+
+	return &SubscriptionChargeEvent{
+		SubscriptionID:  data.SubscriptionID,
+		CycleNumber:     cycleNumber,
+		MerchantOrderID: data.MerchantOrderID,
+		Reference:       data.Reference,
+		Amount:          data.Amount,
+		ResultCode:      data.ResultCode,
+		Callback:        data,
+	}, nil
+}
+
+// ParseSubscriptionCharge parses and verifies a recurring charge callback
+func (c *Client) ParseSubscriptionCharge(r *http.Request) (*SubscriptionChargeEvent, error) {
+	callbackData, err := c.ParseCallback(r)
+	if err != nil {
+		return nil, err
+	}
+	return callbackData.SubscriptionCharge()
+}
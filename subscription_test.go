@@ -0,0 +1,290 @@
+package duitku
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSubscriptionActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		endpoint   string
+		call       func(c *Client, id string) (*Subscription, error)
+		wantStatus string
+	}{
+		{
+			name:       "Get",
+			endpoint:   "/merchant/subscription/detail",
+			call:       (*Client).GetSubscription,
+			wantStatus: SubscriptionStatusActive,
+		},
+		{
+			name:       "Pause",
+			endpoint:   "/merchant/subscription/pause",
+			call:       (*Client).PauseSubscription,
+			wantStatus: SubscriptionStatusPaused,
+		},
+		{
+			name:       "Resume",
+			endpoint:   "/merchant/subscription/resume",
+			call:       (*Client).ResumeSubscription,
+			wantStatus: SubscriptionStatusActive,
+		},
+		{
+			name:       "Cancel",
+			endpoint:   "/merchant/subscription/cancel",
+			call:       (*Client).CancelSubscription,
+			wantStatus: SubscriptionStatusCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.endpoint {
+					t.Errorf("Expected request path %s, got %s", tt.endpoint, r.URL.Path)
+				}
+
+				var request SubscriptionRequest
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Errorf("Error decoding request body: %v", err)
+				}
+				if request.SubscriptionID != "SUB001" {
+					t.Errorf("Expected SubscriptionID: SUB001, got %s", request.SubscriptionID)
+				}
+				hash := md5.Sum([]byte("DXXXX" + "SUB001" + "DXXXXCX80TZJ85Q70QCI"))
+				if request.Signature != hex.EncodeToString(hash[:]) {
+					t.Errorf("Unexpected signature %s", request.Signature)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, `{
+					"subscription": {
+						"subscriptionId": "SUB001",
+						"merchantOrderId": "ORDER123",
+						"amount": "50000",
+						"frequencyType": 3,
+						"frequencyInterval": 1,
+						"totalNoOfCycles": 12,
+						"completedCycles": 2,
+						"status": %q
+					},
+					"responseCode": "00",
+					"responseMessage": "SUCCESS"
+				}`, tt.wantStatus)
+			}))
+			defer server.Close()
+
+			client := &Client{
+				config: Config{
+					MerchantCode: "DXXXX",
+					APIKey:       "DXXXXCX80TZJ85Q70QCI",
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			subscription, err := tt.call(client, "SUB001")
+			if err != nil {
+				t.Fatalf("%s error = %v, want nil", tt.name, err)
+			}
+			if subscription.Status != tt.wantStatus {
+				t.Errorf("Subscription Status = %s, want %s", subscription.Status, tt.wantStatus)
+			}
+			if subscription.FrequencyType != FrequencyMonthly {
+				t.Errorf("Subscription FrequencyType = %d, want %d", subscription.FrequencyType, FrequencyMonthly)
+			}
+			if subscription.CompletedCycles != 2 {
+				t.Errorf("Subscription CompletedCycles = %d, want 2", subscription.CompletedCycles)
+			}
+		})
+	}
+}
+
+func TestSubscriptionActionErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"responseCode":"01","responseMessage":"Subscription not found"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{
+		config: Config{
+			MerchantCode: "DXXXX",
+			APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		},
+		baseURLs:   BaseURLs{Payment: server.URL},
+		httpClient: server.Client(),
+	}
+
+	_, err := client.PauseSubscription("SUB404")
+	if err == nil || err.Error() != "error pausing subscription: Subscription not found" {
+		t.Errorf("PauseSubscription() error = %v, want not found error", err)
+	}
+
+	if _, err := client.CancelSubscription(""); err == nil {
+		t.Errorf("CancelSubscription() error = nil, want error for empty ID")
+	}
+
+	if _, err := client.GetSubscriptionCycles("SUB404"); err == nil {
+		t.Errorf("GetSubscriptionCycles() error = nil, want error")
+	}
+}
+
+func TestListSubscriptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request ListSubscriptionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Error decoding request body: %v", err)
+		}
+		if request.Status != SubscriptionStatusActive {
+			t.Errorf("Expected Status: ACTIVE, got %s", request.Status)
+		}
+		if request.DateTime == "" || len(request.Signature) != 64 {
+			t.Errorf("Expected datetime and SHA256 signature, got %q %q", request.DateTime, request.Signature)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"subscriptions": [
+				{"subscriptionId": "SUB001", "status": "ACTIVE"},
+				{"subscriptionId": "SUB002", "status": "ACTIVE"}
+			],
+			"responseCode": "00",
+			"responseMessage": "SUCCESS"
+		}`))
+	}))
+	defer server.Close()
+
+	client := &Client{
+		config: Config{
+			MerchantCode: "DXXXX",
+			APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		},
+		baseURLs:   BaseURLs{Payment: server.URL},
+		httpClient: server.Client(),
+	}
+
+	subscriptions, err := client.ListSubscriptions(SubscriptionStatusActive)
+	if err != nil {
+		t.Fatalf("ListSubscriptions() error = %v, want nil", err)
+	}
+	if len(subscriptions) != 2 {
+		t.Fatalf("ListSubscriptions() returned %d subscriptions, want 2", len(subscriptions))
+	}
+	if !subscriptions[1].IsActive() || subscriptions[1].SubscriptionID != "SUB002" {
+		t.Errorf("ListSubscriptions()[1] = %+v, want active SUB002", subscriptions[1])
+	}
+}
+
+func TestGetSubscriptionCycles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/merchant/subscription/cycles" {
+			t.Errorf("Expected request path /merchant/subscription/cycles, got %s", r.URL.Path)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"subscriptionId": "SUB001",
+			"cycles": [
+				{"cycleNumber": 1, "merchantOrderId": "ORDER123", "reference": "REF1", "amount": "50000", "runDate": "2024-01-01", "statusCode": "00", "statusMessage": "SUCCESS"},
+				{"cycleNumber": 2, "merchantOrderId": "ORDER123-2", "reference": "REF2", "amount": "50000", "runDate": "2024-02-01", "statusCode": "01", "statusMessage": "FAILED"}
+			],
+			"responseCode": "00",
+			"responseMessage": "SUCCESS"
+		}`))
+	}))
+	defer server.Close()
+
+	client := &Client{
+		config: Config{
+			MerchantCode: "DXXXX",
+			APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		},
+		baseURLs:   BaseURLs{Payment: server.URL},
+		httpClient: server.Client(),
+	}
+
+	cycles, err := client.GetSubscriptionCycles("SUB001")
+	if err != nil {
+		t.Fatalf("GetSubscriptionCycles() error = %v, want nil", err)
+	}
+	if len(cycles) != 2 {
+		t.Fatalf("GetSubscriptionCycles() returned %d cycles, want 2", len(cycles))
+	}
+	if cycles[1].CycleNumber != 2 || cycles[1].StatusCode != "01" {
+		t.Errorf("GetSubscriptionCycles()[1] = %+v, want failed cycle 2", cycles[1])
+	}
+}
+
+func TestParseSubscriptionCharge(t *testing.T) {
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+	})
+
+	hash := md5.Sum([]byte("DXXXX" + "50000" + "ORDER123-3" + "DXXXXCX80TZJ85Q70QCI"))
+
+	form := url.Values{}
+	form.Add("merchantCode", "DXXXX")
+	form.Add("amount", "50000")
+	form.Add("merchantOrderId", "ORDER123-3")
+	form.Add("paymentCode", PaymentMethodCreditCard)
+	form.Add("resultCode", "00")
+	form.Add("reference", "DEV123456789")
+	form.Add("subscriptionId", "SUB001")
+	form.Add("cycleNumber", "3")
+	form.Add("signature", hex.EncodeToString(hash[:]))
+
+	req, err := http.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	event, err := client.ParseSubscriptionCharge(req)
+	if err != nil {
+		t.Fatalf("ParseSubscriptionCharge() error = %v, want nil", err)
+	}
+	if event.SubscriptionID != "SUB001" {
+		t.Errorf("Event SubscriptionID = %s, want SUB001", event.SubscriptionID)
+	}
+	if event.CycleNumber != 3 {
+		t.Errorf("Event CycleNumber = %d, want 3", event.CycleNumber)
+	}
+	if !event.IsSuccessful() {
+		t.Errorf("Event IsSuccessful() = false, want true")
+	}
+	if event.Callback == nil || event.Callback.Reference != "DEV123456789" {
+		t.Errorf("Event Callback not populated")
+	}
+}
+
+func TestSubscriptionChargeErrors(t *testing.T) {
+	// A regular payment callback is not a subscription charge
+	regular := &CallbackData{MerchantOrderID: "ORDER123", ResultCode: "00"}
+	if regular.IsSubscriptionCharge() {
+		t.Errorf("IsSubscriptionCharge() = true, want false")
+	}
+	if _, err := regular.SubscriptionCharge(); err == nil {
+		t.Errorf("SubscriptionCharge() error = nil, want error")
+	}
+
+	// An unparseable cycle number is rejected
+	invalid := &CallbackData{SubscriptionID: "SUB001", CycleNumber: "three"}
+	if _, err := invalid.SubscriptionCharge(); err == nil {
+		t.Errorf("SubscriptionCharge() error = nil, want error for invalid cycle number")
+	}
+}
@@ -0,0 +1,307 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default refresh windows of a TokenManager
+const (
+	DefaultTokenRefreshAhead = 5 * time.Minute
+	DefaultTokenExpiryMargin = 30 * time.Second
+)
+
+// Limits of the background refresh of a TokenManager. A token is never
+// refreshed sooner than minTokenRefreshDelay after it arrives, and failed
+// refreshes are retried after a delay doubling up to maxTokenRetryDelay. They are variables so tests can shorten them.
+var (
+	minTokenRefreshDelay = 5 * time.Second
+	maxTokenRetryDelay   = 5 * time.Minute
+)
+
+// errNoToken is returned when a TokenFetcher returns neither a token nor an error
+var errNoToken = errors.New("token fetcher returned no token")
+
+// Token is an access token for the token based Duitku APIs
+type Token struct {
+	// AccessToken is sent in the Authorization header
+	AccessToken string
+	// TokenType prefixes the access token, Bearer when empty
+	TokenType string
+	// Expiry is when the token expires. A zero expiry never expires.
+	Expiry time.Time
+}
+
+// authorization returns the Authorization header value of the token
+func (t *Token) authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource provides access tokens per merchant code
+type TokenSource interface {
+	// Token returns a valid access token for the merchant
+	Token(merchantCode string) (*Token, error)
+	// Invalidate discards accessToken after the API rejected it. An empty
+	// accessToken discards whatever token is cached.
+	Invalidate(merchantCode, accessToken string)
+}
+
+// TokenFetcher requests a new access token for a merchant
+type TokenFetcher func(merchantCode string) (*Token, error)
+
+// TokenManagerOptions configures a TokenManager
+type TokenManagerOptions struct {
+	// RefreshAhead is how long before expiry a token is refreshed in the
+	// background while it is still handed out. Defaults to
+	// DefaultTokenRefreshAhead.
+	RefreshAhead time.Duration
+	// ExpiryMargin is how long before expiry a token is no longer handed out,
+	// so callers wait for a new one. Defaults to DefaultTokenExpiryMargin.
+	ExpiryMargin time.Duration
+	// AutoRefresh schedules the background refresh with a timer, so tokens
+	// stay fresh without traffic. Tokens living shorter than RefreshAhead are
+	// refreshed at half their lifetime, and failed refreshes are retried
+	// with backoff. Stop cancels the timers.
+	AutoRefresh bool
+	// Now is an optional clock
+	Now func() time.Time
+	// OnError is called with the errors of background refreshes
+	OnError func(merchantCode string, err error)
+}
+
+// TokenManager is a TokenSource that caches tokens per merchant code. A
+// token close to expiry is refreshed in the background, and concurrent
+// callers needing a token share a single request.
+type TokenManager struct {
+	fetch TokenFetcher
+	opts  TokenManagerOptions
+
+	mu      sync.Mutex
+	entries map[string]*tokenEntry
+	stopped bool
+}
+
+// tokenEntry is the cached token of one merchant
+type tokenEntry struct {
+	token   *Token
+	pending *tokenRefresh
+	timer   *time.Timer
+	// failures counts the refreshes failed in a row; no background refresh
+	// starts before retryAt
+	failures int
+	retryAt  time.Time
+}
+
+// tokenRefresh is a token request shared by every caller waiting on it
+type tokenRefresh struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// NewTokenManager creates a TokenManager requesting tokens with fetch
+func NewTokenManager(fetch TokenFetcher, opts TokenManagerOptions) *TokenManager {
+	if opts.RefreshAhead <= 0 {
+		opts.RefreshAhead = DefaultTokenRefreshAhead
+	}
+	if opts.ExpiryMargin <= 0 {
+		opts.ExpiryMargin = DefaultTokenExpiryMargin
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &TokenManager{
+		fetch:   fetch,
+		opts:    opts,
+		entries: make(map[string]*tokenEntry),
+	}
+}
+
+// Token returns the cached token of the merchant, requesting a new one when
+// there is none or it is within the expiry margin
+func (m *TokenManager) Token(merchantCode string) (*Token, error) {
+	m.mu.Lock()
+	entry := m.entry(merchantCode)
+	now := m.opts.Now()
+
+	if token := entry.token; token != nil && !expiresWithin(token, now, m.opts.ExpiryMargin) {
+		if expiresWithin(token, now, m.opts.RefreshAhead) && !now.Before(entry.retryAt) {
+			m.refresh(merchantCode, entry)
+		}
+		m.mu.Unlock()
+		return token, nil
+	}
+
+	pending := m.refresh(merchantCode, entry)
+	m.mu.Unlock()
+
+	<-pending.done
+	return pending.token, pending.err
+}
+
+// Invalidate discards the cached token of the merchant if it is accessToken
+// or accessToken is empty. A token refreshed since the rejected one was
+// handed out is kept.
+func (m *TokenManager) Invalidate(merchantCode, accessToken string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[merchantCode]
+	if !ok || entry.token == nil {
+		return
+	}
+	if accessToken != "" && entry.token.AccessToken != accessToken {
+		return
+	}
+	entry.token = nil
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+}
+
+// Stop cancels the scheduled refreshes. Tokens are still requested on demand.
+func (m *TokenManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopped = true
+	for _, entry := range m.entries {
+		if entry.timer != nil {
+			entry.timer.Stop()
+			entry.timer = nil
+		}
+	}
+}
+
+// entry returns the entry of the merchant, creating it when needed. The
+// lock must be held.
+func (m *TokenManager) entry(merchantCode string) *tokenEntry {
+	entry, ok := m.entries[merchantCode]
+	if !ok {
+		entry = &tokenEntry{}
+		m.entries[merchantCode] = entry
+	}
+	return entry
+}
+
+// refresh starts a token request for the merchant unless one is already
+// running, and returns the running request. The lock must be held.
+func (m *TokenManager) refresh(merchantCode string, entry *tokenEntry) *tokenRefresh {
+	if entry.pending != nil {
+		return entry.pending
+	}
+
+	pending := &tokenRefresh{done: make(chan struct{})}
+	entry.pending = pending
+	go func() {
+		token, err := m.fetchToken(merchantCode)
+		// Waiters are released even if OnError panics
+		defer func() {
+			pending.token, pending.err = token, err
+			close(pending.done)
+		}()
+
+		m.mu.Lock()
+		entry.pending = nil
+		if err == nil {
+			entry.token = token
+			entry.failures = 0
+			entry.retryAt = time.Time{}
+			m.schedule(merchantCode, entry)
+		} else {
+			m.retry(merchantCode, entry)
+		}
+		m.mu.Unlock()
+
+		if err != nil && m.opts.OnError != nil {
+			m.opts.OnError(merchantCode, err)
+		}
+	}()
+	return pending
+}
+
+// fetchToken calls the TokenFetcher, turning a panic into an error so the
+// refresh still completes
+func (m *TokenManager) fetchToken(merchantCode string) (token *Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			token, err = nil, fmt.Errorf("error fetching token: panic: %v", r)
+		}
+	}()
+
+	token, err = m.fetch(merchantCode)
+	if err == nil && token == nil {
+		err = errNoToken
+	}
+	return token, err
+}
+
+// schedule sets the timer refreshing the merchant's token ahead of expiry.
+// The lock must be held.
+func (m *TokenManager) schedule(merchantCode string, entry *tokenEntry) {
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	if !m.opts.AutoRefresh || m.stopped || entry.token.Expiry.IsZero() {
+		return
+	}
+
+	// A token living shorter than RefreshAhead would otherwise be refreshed
+	// again as soon as it arrives, so it is refreshed at half its lifetime
+	now := m.opts.Now()
+	wait := entry.token.Expiry.Add(-m.opts.RefreshAhead).Sub(now)
+	if wait <= 0 {
+		wait = entry.token.Expiry.Sub(now) / 2
+	}
+	if wait < minTokenRefreshDelay {
+		wait = minTokenRefreshDelay
+	}
+	m.arm(merchantCode, entry, wait)
+}
+
+// retry backs off after a failed refresh and, with AutoRefresh, schedules
+// the next attempt. The lock must be held.
+func (m *TokenManager) retry(merchantCode string, entry *tokenEntry) {
+	entry.failures++
+	delay := minTokenRefreshDelay
+	for i := 1; i < entry.failures && delay < maxTokenRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxTokenRetryDelay {
+		delay = maxTokenRetryDelay
+	}
+	entry.retryAt = m.opts.Now().Add(delay)
+
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	if m.opts.AutoRefresh && !m.stopped && entry.token != nil {
+		m.arm(merchantCode, entry, delay)
+	}
+}
+
+// arm sets the timer refreshing the merchant's token after wait. The lock
+// must be held.
+func (m *TokenManager) arm(merchantCode string, entry *tokenEntry, wait time.Duration) {
+	entry.timer = time.AfterFunc(wait, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if !m.stopped {
+			m.refresh(merchantCode, entry)
+		}
+	})
+}
+
+// expiresWithin returns true if the token expires within d of now
+func expiresWithin(token *Token, now time.Time, d time.Duration) bool {
+	return !token.Expiry.IsZero() && !now.Before(token.Expiry.Add(-d))
+}
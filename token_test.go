@@ -0,0 +1,361 @@
+package duitku
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetcher issues numbered tokens expiring after ttl
+type countingFetcher struct {
+	calls int32
+	ttl   time.Duration
+	now   func() time.Time
+	gate  chan struct{}
+	err   error
+}
+
+func (f *countingFetcher) fetch(merchantCode string) (*Token, error) {
+	n := atomic.AddInt32(&f.calls, 1)
+	if f.gate != nil {
+		<-f.gate
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	now := time.Now
+	if f.now != nil {
+		now = f.now
+	}
+	return &Token{AccessToken: fmt.Sprintf("%s-%d", merchantCode, n), Expiry: now().Add(f.ttl)}, nil
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTokenManagerCachesPerMerchant(t *testing.T) {
+	fetcher := &countingFetcher{ttl: time.Hour}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{})
+
+	for i := 0; i < 3; i++ {
+		for _, merchantCode := range []string{"D0001", "D0002"} {
+			token, err := manager.Token(merchantCode)
+			if err != nil {
+				t.Fatalf("Token() error = %v", err)
+			}
+			if token.AccessToken[:5] != merchantCode {
+				t.Errorf("Token(%s) = %s", merchantCode, token.AccessToken)
+			}
+		}
+	}
+	if calls := atomic.LoadInt32(&fetcher.calls); calls != 2 {
+		t.Errorf("fetches = %d, want 2", calls)
+	}
+}
+
+func TestTokenManagerRefreshWindows(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	fetcher := &countingFetcher{ttl: 10 * time.Minute, now: clock}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{
+		RefreshAhead: 2 * time.Minute,
+		ExpiryMargin: 30 * time.Second,
+		Now:          clock,
+	})
+
+	token, _ := manager.Token("D0001")
+	if token.AccessToken != "D0001-1" {
+		t.Fatalf("Token() = %s, want D0001-1", token.AccessToken)
+	}
+
+	// Inside the refresh window the current token is served while a new one
+	// is requested in the background
+	advance(9 * time.Minute)
+	token, _ = manager.Token("D0001")
+	if token.AccessToken != "D0001-1" {
+		t.Errorf("Token() in refresh window = %s, want D0001-1", token.AccessToken)
+	}
+	waitFor(t, func() bool {
+		token, _ := manager.Token("D0001")
+		return token.AccessToken == "D0001-2"
+	})
+
+	// Inside the expiry margin callers wait for a new token
+	advance(9*time.Minute + 45*time.Second)
+	token, _ = manager.Token("D0001")
+	if token.AccessToken != "D0001-3" {
+		t.Errorf("Token() in expiry margin = %s, want D0001-3", token.AccessToken)
+	}
+}
+
+func TestTokenManagerDeduplicatesRefreshes(t *testing.T) {
+	fetcher := &countingFetcher{ttl: time.Hour, gate: make(chan struct{})}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := manager.Token("D0001")
+			if err != nil {
+				t.Errorf("Token() error = %v", err)
+				return
+			}
+			tokens[i] = token.AccessToken
+		}(i)
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&fetcher.calls) == 1 })
+	close(fetcher.gate)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&fetcher.calls); calls != 1 {
+		t.Errorf("fetches = %d, want 1", calls)
+	}
+	for i, token := range tokens {
+		if token != "D0001-1" {
+			t.Errorf("caller %d token = %s, want D0001-1", i, token)
+		}
+	}
+}
+
+func TestTokenManagerInvalidate(t *testing.T) {
+	fetcher := &countingFetcher{ttl: time.Hour}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{})
+
+	manager.Token("D0001")
+
+	// A stale token does not discard the current one
+	manager.Invalidate("D0001", "D0001-0")
+	if token, _ := manager.Token("D0001"); token.AccessToken != "D0001-1" {
+		t.Errorf("Token() after stale Invalidate = %s, want D0001-1", token.AccessToken)
+	}
+
+	manager.Invalidate("D0001", "D0001-1")
+	if token, _ := manager.Token("D0001"); token.AccessToken != "D0001-2" {
+		t.Errorf("Token() after Invalidate = %s, want D0001-2", token.AccessToken)
+	}
+
+	manager.Invalidate("D0001", "")
+	if token, _ := manager.Token("D0001"); token.AccessToken != "D0001-3" {
+		t.Errorf("Token() after Invalidate all = %s, want D0001-3", token.AccessToken)
+	}
+
+	manager.Invalidate("D0002", "")
+}
+
+// shortenTokenDelays lowers the refresh limits for the duration of a test
+func shortenTokenDelays(t *testing.T, min, max time.Duration) {
+	savedMin, savedMax := minTokenRefreshDelay, maxTokenRetryDelay
+	minTokenRefreshDelay, maxTokenRetryDelay = min, max
+	t.Cleanup(func() { minTokenRefreshDelay, maxTokenRetryDelay = savedMin, savedMax })
+}
+
+func TestTokenManagerAutoRefresh(t *testing.T) {
+	shortenTokenDelays(t, time.Millisecond, 10*time.Millisecond)
+	var errs int32
+	fetcher := &countingFetcher{ttl: time.Minute + 20*time.Millisecond}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{
+		RefreshAhead: time.Minute,
+		ExpiryMargin: time.Millisecond,
+		AutoRefresh:  true,
+		OnError:      func(string, error) { atomic.AddInt32(&errs, 1) },
+	})
+	defer manager.Stop()
+
+	manager.Token("D0001")
+	waitFor(t, func() bool { return atomic.LoadInt32(&fetcher.calls) >= 2 })
+
+	manager.Stop()
+	calls := atomic.LoadInt32(&fetcher.calls)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&fetcher.calls); got > calls+1 {
+		t.Errorf("fetches after Stop = %d, want at most %d", got, calls+1)
+	}
+	if atomic.LoadInt32(&errs) != 0 {
+		t.Errorf("background errors = %d, want 0", errs)
+	}
+}
+
+func TestTokenManagerFetchError(t *testing.T) {
+	fetcher := &countingFetcher{err: errors.New("unauthorized client")}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{})
+
+	if _, err := manager.Token("D0001"); err == nil {
+		t.Error("Token() error = nil")
+	}
+	if _, err := manager.Token("D0001"); err == nil {
+		t.Error("Token() error = nil on second call")
+	}
+	if calls := atomic.LoadInt32(&fetcher.calls); calls != 2 {
+		t.Errorf("fetches = %d, want 2, errors are not cached", calls)
+	}
+}
+
+func TestTokenManagerFetchPanic(t *testing.T) {
+	var calls int32
+	fetch := func(merchantCode string) (*Token, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("token endpoint misconfigured")
+		}
+		return &Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+	}
+	manager := NewTokenManager(fetch, TokenManagerOptions{})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.Token("D0001")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Token() error = nil for a panicking fetcher")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Token() blocked after the fetcher panicked")
+	}
+
+	// The failed refresh is cleared, so the next call fetches again
+	if _, err := manager.Token("D0001"); err != nil {
+		t.Errorf("Token() error = %v after the panic", err)
+	}
+}
+
+func TestTokenManagerShortLivedToken(t *testing.T) {
+	shortenTokenDelays(t, 20*time.Millisecond, 100*time.Millisecond)
+
+	// The token lives shorter than RefreshAhead, so refreshes are spaced by
+	// half its lifetime instead of running back to back
+	fetcher := &countingFetcher{ttl: 100 * time.Millisecond}
+	manager := NewTokenManager(fetcher.fetch, TokenManagerOptions{
+		RefreshAhead: time.Minute,
+		ExpiryMargin: time.Millisecond,
+		AutoRefresh:  true,
+	})
+	defer manager.Stop()
+
+	manager.Token("D0001")
+	time.Sleep(200 * time.Millisecond)
+	manager.Stop()
+	if calls := atomic.LoadInt32(&fetcher.calls); calls > 6 {
+		t.Errorf("fetches = %d, want at most 6", calls)
+	}
+}
+
+func TestTokenManagerRetryBackoff(t *testing.T) {
+	shortenTokenDelays(t, 20*time.Millisecond, 40*time.Millisecond)
+
+	// The first token is refreshed after 20 milliseconds; every refresh fails
+	var calls int32
+	fetch := func(string) (*Token, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return nil, errors.New("service unavailable")
+		}
+		return &Token{AccessToken: "token", Expiry: time.Now().Add(time.Minute + 20*time.Millisecond)}, nil
+	}
+	manager := NewTokenManager(fetch, TokenManagerOptions{
+		RefreshAhead: time.Minute,
+		ExpiryMargin: time.Millisecond,
+		AutoRefresh:  true,
+		OnError:      func(string, error) {},
+	})
+	defer manager.Stop()
+
+	if _, err := manager.Token("D0001"); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	manager.Stop()
+
+	// Retries after 20, 40, 40... milliseconds, not back to back
+	if calls := atomic.LoadInt32(&calls); calls < 3 || calls > 8 {
+		t.Errorf("fetches = %d, want between 3 and 8", calls)
+	}
+}
+
+func TestTokenManagerNilToken(t *testing.T) {
+	manager := NewTokenManager(func(string) (*Token, error) { return nil, nil }, TokenManagerOptions{AutoRefresh: true})
+	defer manager.Stop()
+
+	if _, err := manager.Token("D0001"); err == nil {
+		t.Error("Token() error = nil for a fetcher returning no token")
+	}
+}
+
+func TestDoRequestWithTokenSource(t *testing.T) {
+	tests := []struct {
+		name         string
+		rejected     map[string]bool
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "Accepted", wantRequests: 1},
+		{name: "Revoked Token Retried", rejected: map[string]bool{"Bearer DXXXX-1": true}, wantRequests: 2},
+		{name: "Retried Once", rejected: map[string]bool{"Bearer DXXXX-1": true, "Bearer DXXXX-2": true}, wantRequests: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				authorization := r.Header.Get("Authorization")
+				if authorization == "" || tt.rejected[authorization] {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"responseCode":"401","responseMessage":"invalid token"}`))
+					return
+				}
+				w.Write([]byte(`{"status":"success"}`))
+			}))
+			defer server.Close()
+
+			fetcher := &countingFetcher{ttl: time.Hour}
+			client := &Client{
+				config: Config{
+					MerchantCode: "DXXXX",
+					APIKey:       "DXXXXCX80TZJ85Q70QCI",
+					TokenSource:  NewTokenManager(fetcher.fetch, TokenManagerOptions{}),
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			var response map[string]string
+			err := client.doRequest("POST", "test-endpoint", map[string]string{"key": "value"}, &response)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("doRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package duitku
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Span names started on Config.Tracer
+const (
+	SpanRequest  = "duitku.request"
+	SpanCallback = "duitku.callback"
+)
+
+// Span attribute keys
+const (
+	AttrEndpoint        = "duitku.endpoint"
+	AttrHTTPMethod      = "http.method"
+	AttrHTTPStatusCode  = "http.status_code"
+	AttrMerchantCode    = "duitku.merchant_code"
+	AttrMerchantOrderID = "duitku.merchant_order_id"
+	AttrReference       = "duitku.reference"
+	AttrPaymentMethod   = "duitku.payment_method"
+	AttrResponseCode    = "duitku.response_code"
+	AttrResultCode      = "duitku.result_code"
+	AttrCallbackOutcome = "duitku.callback_outcome"
+	AttrCorrelationID   = "duitku.correlation_id"
+)
+
+// Tracer starts spans around API requests and callbacks, for example by
+// wrapping an OpenTelemetry tracer
+type Tracer interface {
+	// StartSpan starts a span. correlationID is the correlation ID of the
+	// transaction the span belongs to, empty when there is none, so the
+	// tracer can link the span to the trace that created the transaction.
+	StartSpan(name, correlationID string) Span
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	// SetAttribute sets an attribute of the span
+	SetAttribute(key, value string)
+	// RecordError marks the span as failed with err
+	RecordError(err error)
+	// End finishes the span
+	End()
+}
+
+// CorrelationField is the transaction field carrying the correlation ID
+type CorrelationField int
+
+// Correlation fields
+const (
+	// CorrelationAdditionalParam carries the correlation ID in AdditionalParam
+	CorrelationAdditionalParam CorrelationField = iota
+	// CorrelationMerchantUserInfo carries the correlation ID in MerchantUserInfo
+	CorrelationMerchantUserInfo
+	// CorrelationDisabled does not send the correlation ID to Duitku
+	CorrelationDisabled
+)
+
+// correlationPrefix marks the correlation ID in a transaction field, which
+// may follow other values after a separator
+const (
+	correlationPrefix    = "cid:"
+	correlationSeparator = ";"
+)
+
+// CorrelationIDFrom returns the correlation ID carried in a transaction
+// field such as CallbackData.AdditionalParam, or an empty string
+func CorrelationIDFrom(value string) string {
+	parts := strings.Split(value, correlationSeparator)
+	for i := len(parts) - 1; i >= 0; i-- {
+		if strings.HasPrefix(parts[i], correlationPrefix) {
+			return strings.TrimPrefix(parts[i], correlationPrefix)
+		}
+	}
+	return ""
+}
+
+// propagateCorrelationID writes the correlation ID of the request into the
+// configured transaction field when it is empty. A field already holding the
+// merchant's data is left alone, as Duitku echoes it in the callback.
+func (c *Client) propagateCorrelationID(request *TransactionRequest) {
+	if request.CorrelationID == "" {
+		return
+	}
+	var field *string
+	switch c.config.CorrelationField {
+	case CorrelationAdditionalParam:
+		field = &request.AdditionalParam
+	case CorrelationMerchantUserInfo:
+		field = &request.MerchantUserInfo
+	}
+	if field != nil && *field == "" {
+		*field = correlationPrefix + request.CorrelationID
+	}
+}
+
+// callbackCorrelationID returns the correlation ID carried by a callback
+func callbackCorrelationID(data *CallbackData) string {
+	if id := CorrelationIDFrom(data.AdditionalParam); id != "" {
+		return id
+	}
+	return CorrelationIDFrom(data.MerchantUserID)
+}
+
+// requestFields are the fields of a request body reported to metrics and traces
+type requestFields struct {
+	MerchantOrderID  string `json:"merchantOrderId"`
+	PaymentMethod    string `json:"paymentMethod"`
+	AdditionalParam  string `json:"additionalParam"`
+	MerchantUserInfo string `json:"merchantUserInfo"`
+}
+
+// parseRequestFields reads the reported fields of a JSON request body
+func parseRequestFields(body []byte) requestFields {
+	var fields requestFields
+	json.Unmarshal(body, &fields)
+	return fields
+}
+
+// responseFields are the fields of a response body reported to metrics and traces
+type responseFields struct {
+	Reference    string `json:"reference"`
+	ResponseCode string `json:"responseCode"`
+	StatusCode   string `json:"statusCode"`
+}
+
+// parseResponseFields reads the reported fields of a JSON response body
+func parseResponseFields(body []byte) responseFields {
+	var fields responseFields
+	json.Unmarshal(body, &fields)
+	// Duitku answers with responseCode or statusCode depending on the endpoint
+	if fields.ResponseCode == "" {
+		fields.ResponseCode = fields.StatusCode
+	}
+	return fields
+}
+
+// startRequestSpan starts the span of an API request, or returns nil
+// without a Tracer
+func (c *Client) startRequestSpan(method, endpoint string, jsonBody []byte) Span {
+	if c.config.Tracer == nil {
+		return nil
+	}
+
+	fields := parseRequestFields(jsonBody)
+	correlationID := CorrelationIDFrom(fields.AdditionalParam)
+	if correlationID == "" {
+		correlationID = CorrelationIDFrom(fields.MerchantUserInfo)
+	}
+
+	span := c.config.Tracer.StartSpan(SpanRequest, correlationID)
+	span.SetAttribute(AttrEndpoint, endpoint)
+	span.SetAttribute(AttrHTTPMethod, method)
+	span.SetAttribute(AttrMerchantCode, c.config.MerchantCode)
+	setAttributeIfNotEmpty(span, AttrMerchantOrderID, fields.MerchantOrderID)
+	setAttributeIfNotEmpty(span, AttrPaymentMethod, fields.PaymentMethod)
+	setAttributeIfNotEmpty(span, AttrCorrelationID, correlationID)
+	return span
+}
+
+// endRequestSpan records the response and error of an API request and ends its span
+func (c *Client) endRequestSpan(span Span, resp *http.Response, respBody []byte, err error) {
+	if span == nil {
+		return
+	}
+
+	if resp != nil {
+		span.SetAttribute(AttrHTTPStatusCode, strconv.Itoa(resp.StatusCode))
+	}
+	fields := parseResponseFields(respBody)
+	setAttributeIfNotEmpty(span, AttrReference, fields.Reference)
+	setAttributeIfNotEmpty(span, AttrResponseCode, fields.ResponseCode)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// startCallbackSpan starts the span of a callback once its body is parsed,
+// so the correlation ID is known, or returns nil without a Tracer. data is
+// nil for callbacks rejected before they were parsed.
+func (c *Client) startCallbackSpan(data *CallbackData) Span {
+	if c.config.Tracer == nil {
+		return nil
+	}
+
+	correlationID := ""
+	if data != nil {
+		correlationID = data.CorrelationID
+	}
+	span := c.config.Tracer.StartSpan(SpanCallback, correlationID)
+	span.SetAttribute(AttrMerchantCode, c.config.MerchantCode)
+	if data != nil {
+		setAttributeIfNotEmpty(span, AttrMerchantOrderID, data.MerchantOrderID)
+		setAttributeIfNotEmpty(span, AttrReference, data.Reference)
+		setAttributeIfNotEmpty(span, AttrPaymentMethod, data.PaymentCode)
+		setAttributeIfNotEmpty(span, AttrResultCode, data.ResultCode)
+		setAttributeIfNotEmpty(span, AttrCorrelationID, correlationID)
+	}
+	return span
+}
+
+// finishCallback reports the outcome of a callback to the metrics and ends
+// its span
+func (c *Client) finishCallback(start time.Time, span Span, outcome string, data *CallbackData, err error) {
+	c.observeCallback(start, outcome, data)
+	if span == nil {
+		return
+	}
+	span.SetAttribute(AttrCallbackOutcome, outcome)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// rejectCallback reports a callback rejected before it was parsed
+func (c *Client) rejectCallback(start time.Time, outcome string, err error) {
+	c.finishCallback(start, c.startCallbackSpan(nil), outcome, nil, err)
+}
+
+// setAttributeIfNotEmpty sets an attribute that has a value
+func setAttributeIfNotEmpty(span Span, key, value string) {
+	if value != "" {
+		span.SetAttribute(key, value)
+	}
+}
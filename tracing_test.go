@@ -0,0 +1,321 @@
+package duitku
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedSpan is a span started by a recordingTracer
+type recordedSpan struct {
+	name          string
+	correlationID string
+	attributes    map[string]string
+	errs          []error
+	ended         bool
+}
+
+func (s *recordedSpan) SetAttribute(key, value string) { s.attributes[key] = value }
+func (s *recordedSpan) RecordError(err error)          { s.errs = append(s.errs, err) }
+func (s *recordedSpan) End()                           { s.ended = true }
+
+// recordingTracer keeps every span it starts
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(name, correlationID string) Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, correlationID: correlationID, attributes: make(map[string]string)}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestDoRequestTracing(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		closed         bool
+		wantAttributes map[string]string
+		wantErr        bool
+	}{
+		{
+			name:   "Success",
+			status: http.StatusOK,
+			body:   `{"merchantCode":"DXXXX","reference":"REF123","statusCode":"00","statusMessage":"SUCCESS"}`,
+			wantAttributes: map[string]string{
+				AttrEndpoint:        "merchant/v2/inquiry",
+				AttrHTTPMethod:      "POST",
+				AttrMerchantCode:    "DXXXX",
+				AttrMerchantOrderID: "ORDER123",
+				AttrPaymentMethod:   "M2",
+				AttrCorrelationID:   "trace-1",
+				AttrHTTPStatusCode:  "200",
+				AttrReference:       "REF123",
+				AttrResponseCode:    "00",
+			},
+		},
+		{
+			name:   "API Error",
+			status: http.StatusBadRequest,
+			body:   `{"responseCode":"01","responseMessage":"Invalid signature"}`,
+			wantAttributes: map[string]string{
+				AttrMerchantOrderID: "ORDER123",
+				AttrHTTPStatusCode:  "400",
+				AttrResponseCode:    "01",
+			},
+			wantErr: true,
+		},
+		{
+			name:   "Network Error",
+			closed: true,
+			wantAttributes: map[string]string{
+				AttrMerchantOrderID: "ORDER123",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			if tt.closed {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+
+			tracer := &recordingTracer{}
+			client := &Client{
+				config: Config{
+					MerchantCode: "DXXXX",
+					APIKey:       "DXXXXCX80TZJ85Q70QCI",
+					Tracer:       tracer,
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			client.CreateTransaction(TransactionRequest{
+				PaymentAmount:   40000,
+				PaymentMethod:   "M2",
+				MerchantOrderID: "ORDER123",
+				CorrelationID:   "trace-1",
+			})
+
+			// A create failing without a response is followed by a status check
+			want := 1
+			if tt.closed {
+				want = 2
+			}
+			if len(tracer.spans) != want {
+				t.Fatalf("spans = %d, want %d", len(tracer.spans), want)
+			}
+			span := tracer.spans[0]
+			if span.name != SpanRequest || span.correlationID != "trace-1" || !span.ended {
+				t.Errorf("span = %s, correlation ID %q, ended %v", span.name, span.correlationID, span.ended)
+			}
+			for key, want := range tt.wantAttributes {
+				if got := span.attributes[key]; got != want {
+					t.Errorf("attribute %s = %q, want %q", key, got, want)
+				}
+			}
+			if tt.wantErr != (len(span.errs) > 0) {
+				t.Errorf("errors = %v, wantErr %v", span.errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCorrelationPropagation(t *testing.T) {
+	tests := []struct {
+		name                 string
+		field                CorrelationField
+		additionalParam      string
+		merchantUserInfo     string
+		correlationID        string
+		wantAdditionalParam  string
+		wantMerchantUserInfo string
+	}{
+		{
+			name:                "Additional Param",
+			field:               CorrelationAdditionalParam,
+			correlationID:       "trace-1",
+			wantAdditionalParam: "cid:trace-1",
+		},
+		{
+			name:                 "Additional Param In Use",
+			field:                CorrelationAdditionalParam,
+			additionalParam:      "promo=A",
+			merchantUserInfo:     "user@example.com",
+			correlationID:        "trace-1",
+			wantAdditionalParam:  "promo=A",
+			wantMerchantUserInfo: "user@example.com",
+		},
+		{
+			name:                 "Merchant User Info",
+			field:                CorrelationMerchantUserInfo,
+			additionalParam:      "promo=A",
+			correlationID:        "trace-1",
+			wantAdditionalParam:  "promo=A",
+			wantMerchantUserInfo: "cid:trace-1",
+		},
+		{
+			name:                 "Merchant User Info In Use",
+			field:                CorrelationMerchantUserInfo,
+			merchantUserInfo:     "user@example.com",
+			correlationID:        "trace-1",
+			wantMerchantUserInfo: "user@example.com",
+		},
+		{
+			name:                "Disabled",
+			field:               CorrelationDisabled,
+			additionalParam:     "promo=A",
+			correlationID:       "trace-1",
+			wantAdditionalParam: "promo=A",
+		},
+		{
+			name:                "No Correlation ID",
+			field:               CorrelationAdditionalParam,
+			additionalParam:     "promo=A",
+			wantAdditionalParam: "promo=A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&sent)
+				w.Write([]byte(`{"merchantCode":"DXXXX","reference":"REF123","statusCode":"00"}`))
+			}))
+			defer server.Close()
+
+			client := &Client{
+				config: Config{
+					MerchantCode:     "DXXXX",
+					APIKey:           "DXXXXCX80TZJ85Q70QCI",
+					CorrelationField: tt.field,
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			_, err := client.CreateTransaction(TransactionRequest{
+				PaymentAmount:    40000,
+				PaymentMethod:    "M2",
+				MerchantOrderID:  "ORDER123",
+				AdditionalParam:  tt.additionalParam,
+				MerchantUserInfo: tt.merchantUserInfo,
+				CorrelationID:    tt.correlationID,
+			})
+			if err != nil {
+				t.Fatalf("CreateTransaction() error = %v", err)
+			}
+
+			if got, _ := sent["additionalParam"].(string); got != tt.wantAdditionalParam {
+				t.Errorf("additionalParam = %q, want %q", got, tt.wantAdditionalParam)
+			}
+			if got, _ := sent["merchantUserInfo"].(string); got != tt.wantMerchantUserInfo {
+				t.Errorf("merchantUserInfo = %q, want %q", got, tt.wantMerchantUserInfo)
+			}
+			if _, ok := sent["correlationId"]; ok {
+				t.Error("correlationId was sent to Duitku")
+			}
+		})
+	}
+}
+
+func TestCorrelationIDFrom(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: ""},
+		{value: "promo=A", want: ""},
+		{value: "cid:trace-1", want: "trace-1"},
+		{value: "promo=A;cid:trace-1", want: "trace-1"},
+		{value: "cid:old;cid:trace-1", want: "trace-1"},
+	}
+
+	for _, tt := range tests {
+		if got := CorrelationIDFrom(tt.value); got != tt.want {
+			t.Errorf("CorrelationIDFrom(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHandleCallbackTracing(t *testing.T) {
+	signature := SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER123")
+	validForm := url.Values{
+		"merchantCode":    {"DXXXX"},
+		"amount":          {"40000"},
+		"merchantOrderId": {"ORDER123"},
+		"paymentCode":     {"VC"},
+		"resultCode":      {"00"},
+		"reference":       {"REF123"},
+		"additionalParam": {"promo=A;cid:trace-1"},
+		"signature":       {signature},
+	}
+
+	tests := []struct {
+		name              string
+		form              url.Values
+		handlerErr        error
+		wantOutcome       string
+		wantCorrelationID string
+		wantErr           bool
+	}{
+		{name: "OK", form: validForm, wantOutcome: CallbackOutcomeOK, wantCorrelationID: "trace-1"},
+		{name: "Handler Error", form: validForm, handlerErr: errors.New("database down"), wantOutcome: CallbackOutcomeHandlerError, wantCorrelationID: "trace-1", wantErr: true},
+		{name: "Invalid", form: url.Values{"merchantCode": {"DXXXX"}}, wantOutcome: CallbackOutcomeInvalid, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			client := &Client{config: Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", Tracer: tracer}}
+
+			req := httptest.NewRequest("POST", "/callback", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			var received *CallbackData
+			client.HandleCallback(httptest.NewRecorder(), req, func(data *CallbackData) error {
+				received = data
+				return tt.handlerErr
+			})
+
+			if len(tracer.spans) != 1 {
+				t.Fatalf("spans = %d, want 1", len(tracer.spans))
+			}
+			span := tracer.spans[0]
+			if span.name != SpanCallback || span.correlationID != tt.wantCorrelationID || !span.ended {
+				t.Errorf("span = %s, correlation ID %q, ended %v", span.name, span.correlationID, span.ended)
+			}
+			if got := span.attributes[AttrCallbackOutcome]; got != tt.wantOutcome {
+				t.Errorf("outcome = %q, want %q", got, tt.wantOutcome)
+			}
+			if tt.wantErr != (len(span.errs) > 0) {
+				t.Errorf("errors = %v, wantErr %v", span.errs, tt.wantErr)
+			}
+			if tt.wantCorrelationID != "" {
+				if span.attributes[AttrMerchantOrderID] != "ORDER123" || span.attributes[AttrReference] != "REF123" {
+					t.Errorf("attributes = %v", span.attributes)
+				}
+				if received == nil || received.CorrelationID != tt.wantCorrelationID {
+					t.Errorf("CallbackData.CorrelationID = %v, want %s", received, tt.wantCorrelationID)
+				}
+			}
+		})
+	}
+}
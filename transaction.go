@@ -1,7 +1,11 @@
 package duitku
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 )
 
 // TransactionRequest represents a request to create a transaction
@@ -27,6 +31,12 @@ type TransactionRequest struct {
 	CreditCardDetail   *CreditCardDetail   `json:"creditCardDetail,omitempty"`
 	IsSubscription     *bool               `json:"isSubscription,omitempty"`
 	SubscriptionDetail *SubscriptionDetail `json:"subscriptionDetail,omitempty"`
+
+	// CorrelationID links the transaction to the trace that created it. It
+	// is sent as "cid:<CorrelationID>" in the field selected by
+	// Config.CorrelationField, only when that field is empty, and returned in
+	// CallbackData.CorrelationID.
+	CorrelationID string `json:"-"`
 }
 
 // CustomerDetail represents customer details for a transaction
@@ -119,11 +129,15 @@ type TransactionResponse struct {
 	Amount        string `json:"amount"`
 	StatusCode    string `json:"statusCode"`
 	StatusMessage string `json:"statusMessage"`
+	// SubscriptionID is set for subscription transactions, keep it to manage the subscription later
+	SubscriptionID string `json:"subscriptionId,omitempty"`
 }
 
 // CreateTransaction creates a new transaction
 // url: https://docs.duitku.com/api/en/#request-transaction
 func (c *Client) CreateTransaction(request TransactionRequest) (*TransactionResponse, error) {
+	c.propagateCorrelationID(&request)
+
 	// Create signature
 	signature := c.createSignatureMD5(c.config.MerchantCode, request.MerchantOrderID, fmt.Sprintf("%d", request.PaymentAmount))
 
@@ -141,13 +155,124 @@ func (c *Client) CreateTransaction(request TransactionRequest) (*TransactionResp
 	var response TransactionResponse
 	err := c.doRequest("POST", "merchant/v2/inquiry", fullRequest, &response)
 	if err != nil {
+		var unconfirmed *unconfirmedError
+		if errors.As(err, &unconfirmed) {
+			err = c.confirmCreated(request.MerchantOrderID, err)
+		}
+		c.recordCreated(request, nil, err)
 		return nil, err
 	}
 
 	if response.StatusCode != "00" {
-		return nil, fmt.Errorf("error creating transaction: %s", response.StatusMessage)
+		err := fmt.Errorf("error creating transaction: %s", response.StatusMessage)
+		c.recordCreated(request, &response, err)
+		return nil, err
 	}
 
+	c.recordCreated(request, &response, nil)
+	return &response, nil
+}
+
+// TransactionExistsError is returned by CreateTransaction when the request
+// failed without a response, or with a gateway error, yet the order exists at
+// Duitku. The create went through: Status holds the reference and status of
+// the transaction, and the order must not be created again. The payment URL
+// and payment details are not available from the status.
+type TransactionExistsError struct {
+	MerchantOrderID string
+	Status          *TransactionStatusResponse
+	// Err is the error of the create request
+	Err error
+}
+
+// Error returns the error message
+func (e *TransactionExistsError) Error() string {
+	return fmt.Sprintf("transaction %s was created with reference %s despite error: %v", e.MerchantOrderID, e.Status.Reference, e.Err)
+}
+
+// Unwrap returns the error of the create request
+func (e *TransactionExistsError) Unwrap() error {
+	return e.Err
+}
+
+// confirmCreated checks the status of an order whose create request failed
+// without a definite answer. It returns a TransactionExistsError when the
+// order exists, and err otherwise.
+func (c *Client) confirmCreated(merchantOrderID string, err error) error {
+	status, checkErr := c.CheckTransaction(merchantOrderID)
+	if checkErr != nil || status.Reference == "" {
+		return err
+	}
+	return &TransactionExistsError{MerchantOrderID: merchantOrderID, Status: status, Err: err}
+}
+
+// RedirectTransactionResponse represents the response from creating a redirect
+// transaction. The customer picks the payment method on the page at PaymentURL,
+// so no virtual account number or QR string is available yet.
+type RedirectTransactionResponse struct {
+	MerchantCode  string `json:"merchantCode"`
+	Reference     string `json:"reference"`
+	PaymentURL    string `json:"paymentUrl"`
+	Amount        string `json:"amount"`
+	StatusCode    string `json:"statusCode"`
+	StatusMessage string `json:"statusMessage"`
+}
+
+// CreateRedirectTransaction creates a transaction without a payment method
+// with the Duitku POP createInvoice API, at BaseURLs.POP. The customer is sent
+// to PaymentURL to choose one on the Duitku hosted page; the chosen method is
+// reported afterwards in CallbackData.PaymentCode.
+// url: https://docs.duitku.com/pop/en/#request-transaction
+func (c *Client) CreateRedirectTransaction(request TransactionRequest) (*RedirectTransactionResponse, error) {
+	if request.PaymentMethod != "" {
+		return nil, errors.New("payment method must be empty for redirect transactions")
+	}
+
+	c.propagateCorrelationID(&request)
+
+	// POP signs the merchant code and a millisecond timestamp in headers
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	headers := http.Header{}
+	headers.Set("x-duitku-signature", c.createSignatureSHA256(c.config.MerchantCode, timestamp))
+	headers.Set("x-duitku-timestamp", timestamp)
+	headers.Set("x-duitku-merchantcode", c.config.MerchantCode)
+
+	invoice := struct {
+		TransactionRequest
+		PaymentMethod string `json:"paymentMethod,omitempty"`
+	}{TransactionRequest: request}
+
+	var response RedirectTransactionResponse
+	err := c.doRequestTo(c.baseURLs.POP, "POST", "createInvoice", headers, invoice, &response)
+	if err != nil {
+		var unconfirmed *unconfirmedError
+		if errors.As(err, &unconfirmed) {
+			err = c.confirmCreated(request.MerchantOrderID, err)
+		}
+		c.recordCreated(request, nil, err)
+		return nil, err
+	}
+
+	created := &TransactionResponse{
+		MerchantCode:  response.MerchantCode,
+		Reference:     response.Reference,
+		PaymentURL:    response.PaymentURL,
+		Amount:        response.Amount,
+		StatusCode:    response.StatusCode,
+		StatusMessage: response.StatusMessage,
+	}
+	if response.StatusCode != "00" {
+		err := fmt.Errorf("error creating transaction: %s", response.StatusMessage)
+		c.recordCreated(request, created, err)
+		return nil, err
+	}
+	if response.PaymentURL == "" {
+		err := errors.New("error creating transaction: no payment url in response")
+		c.recordCreated(request, created, err)
+		return nil, err
+	}
+
+	c.recordCreated(request, created, nil)
 	return &response, nil
 }
 
@@ -194,8 +319,26 @@ func (c *Client) CheckTransaction(merchantOrderID string) (*TransactionStatusRes
 	var response TransactionStatusResponse
 	err := c.doRequest("POST", "merchant/transactionStatus", request, &response)
 	if err != nil {
+		c.recordStatus(merchantOrderID, nil, err)
 		return nil, err
 	}
 
+	c.recordStatus(merchantOrderID, &response, nil)
 	return &response, nil
 }
+
+// IsSuccessful returns true if the transaction has been paid
+func (r *TransactionStatusResponse) IsSuccessful() bool {
+	return r.StatusCode == CheckTransactionStatusSuccess
+}
+
+// IsPending returns true if the transaction is waiting for payment. For redirect
+// transactions this includes customers who have not chosen a payment method yet.
+func (r *TransactionStatusResponse) IsPending() bool {
+	return r.StatusCode == CheckTransactionStatusPending
+}
+
+// IsCancelled returns true if the transaction was cancelled or expired
+func (r *TransactionStatusResponse) IsCancelled() bool {
+	return r.StatusCode == CheckTransactionStatusCancelled
+}
@@ -0,0 +1,176 @@
+package duitku
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Transaction record events
+const (
+	// RecordCreated is a CreateTransaction call, successful or not
+	RecordCreated = "created"
+	// RecordStatus is a CheckTransaction call, successful or not
+	RecordStatus = "status"
+	// RecordCallback is a verified callback
+	RecordCallback = "callback"
+)
+
+// TransactionRecord is one entry of the audit trail of a merchant order ID
+type TransactionRecord struct {
+	MerchantOrderID string `json:"merchantOrderId"`
+	// Event is one of the Record constants
+	Event         string `json:"event"`
+	MerchantCode  string `json:"merchantCode"`
+	Reference     string `json:"reference,omitempty"`
+	PaymentMethod string `json:"paymentMethod,omitempty"`
+	Amount        string `json:"amount,omitempty"`
+	// StatusCode is the statusCode of a response or the resultCode of a callback
+	StatusCode string `json:"statusCode,omitempty"`
+	// Error is the error of a failed call
+	Error string `json:"error,omitempty"`
+	// Payload is the JSON of the request and response, or of the callback
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// RecordedAt is when the client wrote the record
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// TransactionStore persists the audit trail of transactions. Config.TransactionStore
+// receives a record for every CreateTransaction and CheckTransaction call
+// and every verified callback.
+type TransactionStore interface {
+	// SaveRecord appends a record to the trail of its merchant order ID
+	SaveRecord(record *TransactionRecord) error
+	// Records returns the trail of a merchant order ID, oldest first
+	Records(merchantOrderID string) ([]*TransactionRecord, error)
+}
+
+// MemoryTransactionStore is an in-memory TransactionStore, useful for tests
+// and single process deployments
+type MemoryTransactionStore struct {
+	mu      sync.Mutex
+	records map[string][]*TransactionRecord
+}
+
+// NewMemoryTransactionStore creates an empty MemoryTransactionStore
+func NewMemoryTransactionStore() *MemoryTransactionStore {
+	return &MemoryTransactionStore{records: make(map[string][]*TransactionRecord)}
+}
+
+// SaveRecord appends a record to the trail of its merchant order ID
+func (s *MemoryTransactionStore) SaveRecord(record *TransactionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := *record
+	r.Payload = append(json.RawMessage(nil), record.Payload...)
+	s.records[r.MerchantOrderID] = append(s.records[r.MerchantOrderID], &r)
+	return nil
+}
+
+// Records returns the trail of a merchant order ID, oldest first
+func (s *MemoryTransactionStore) Records(merchantOrderID string) ([]*TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*TransactionRecord, 0, len(s.records[merchantOrderID]))
+	for _, record := range s.records[merchantOrderID] {
+		r := *record
+		records = append(records, &r)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].RecordedAt.Before(records[j].RecordedAt) })
+	return records, nil
+}
+
+// recordCreated writes the record of a CreateTransaction call
+func (c *Client) recordCreated(request TransactionRequest, response *TransactionResponse, err error) {
+	if c.config.TransactionStore == nil {
+		return
+	}
+
+	record := &TransactionRecord{
+		MerchantOrderID: request.MerchantOrderID,
+		Event:           RecordCreated,
+		PaymentMethod:   request.PaymentMethod,
+		Amount:          fmt.Sprintf("%d", request.PaymentAmount),
+	}
+	if response != nil {
+		record.Reference = response.Reference
+		record.StatusCode = response.StatusCode
+	}
+	payload := struct {
+		Request  TransactionRequest   `json:"request"`
+		Response *TransactionResponse `json:"response,omitempty"`
+	}{request, response}
+	c.saveRecord(record, payload, err)
+}
+
+// recordStatus writes the record of a CheckTransaction call
+func (c *Client) recordStatus(merchantOrderID string, response *TransactionStatusResponse, err error) {
+	if c.config.TransactionStore == nil {
+		return
+	}
+
+	record := &TransactionRecord{MerchantOrderID: merchantOrderID, Event: RecordStatus}
+	var payload interface{}
+	if response != nil {
+		record.Reference = response.Reference
+		record.Amount = response.Amount
+		record.StatusCode = response.StatusCode
+		payload = response
+	}
+	c.saveRecord(record, payload, err)
+}
+
+// recordCallback writes the record of a verified callback accepted by its handler
+func (c *Client) recordCallback(data *CallbackData) {
+	if c.config.TransactionStore == nil {
+		return
+	}
+
+	record := &TransactionRecord{
+		MerchantOrderID: data.MerchantOrderID,
+		Event:           RecordCallback,
+		Reference:       data.Reference,
+		PaymentMethod:   data.PaymentCode,
+		Amount:          data.Amount,
+		StatusCode:      data.ResultCode,
+	}
+	c.saveRecord(record, data, nil)
+}
+
+// saveRecord completes and saves a record. Store errors do not fail the
+// call being recorded; they are passed to Config.OnStoreError or logged.
+func (c *Client) saveRecord(record *TransactionRecord, payload interface{}, err error) {
+	record.MerchantCode = c.config.MerchantCode
+	record.RecordedAt = time.Now()
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			c.storeError(record, fmt.Errorf("error marshaling record payload: %w", err))
+			return
+		}
+		record.Payload = data
+	}
+
+	if err := c.config.TransactionStore.SaveRecord(record); err != nil {
+		c.storeError(record, fmt.Errorf("error saving transaction record: %w", err))
+	}
+}
+
+// storeError reports a record that could not be saved
+func (c *Client) storeError(record *TransactionRecord, err error) {
+	if c.config.OnStoreError != nil {
+		c.config.OnStoreError(record, err)
+		return
+	}
+	if c.logger != nil {
+		c.logger.Printf("%s record of %s: %v", record.Event, record.MerchantOrderID, err)
+	}
+}
@@ -0,0 +1,197 @@
+package duitku
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// failingTransactionStore rejects every record
+type failingTransactionStore struct{}
+
+func (failingTransactionStore) SaveRecord(*TransactionRecord) error {
+	return errors.New("database down")
+}
+
+func (failingTransactionStore) Records(string) ([]*TransactionRecord, error) {
+	return nil, errors.New("database down")
+}
+
+func TestTransactionStoreRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		call       func(c *Client) error
+		wantEvent  string
+		wantStatus string
+		wantErr    bool
+	}{
+		{
+			name:   "Created",
+			status: http.StatusOK,
+			body:   `{"merchantCode":"DXXXX","reference":"REF123","statusCode":"00","statusMessage":"SUCCESS"}`,
+			call: func(c *Client) error {
+				_, err := c.CreateTransaction(TransactionRequest{MerchantOrderID: "ORDER123", PaymentAmount: 40000, PaymentMethod: "VC"})
+				return err
+			},
+			wantEvent:  RecordCreated,
+			wantStatus: "00",
+		},
+		{
+			name:   "Create Failed",
+			status: http.StatusBadRequest,
+			body:   `{"responseCode":"01","responseMessage":"Invalid signature"}`,
+			call: func(c *Client) error {
+				_, err := c.CreateTransaction(TransactionRequest{MerchantOrderID: "ORDER123", PaymentAmount: 40000, PaymentMethod: "VC"})
+				return err
+			},
+			wantEvent: RecordCreated,
+			wantErr:   true,
+		},
+		{
+			name:   "Status",
+			status: http.StatusOK,
+			body:   `{"merchantOrderId":"ORDER123","reference":"REF123","amount":"40000","statusCode":"01","statusMessage":"PENDING"}`,
+			call: func(c *Client) error {
+				_, err := c.CheckTransaction("ORDER123")
+				return err
+			},
+			wantEvent:  RecordStatus,
+			wantStatus: "01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			store := NewMemoryTransactionStore()
+			client := &Client{
+				config: Config{
+					MerchantCode:     "DXXXX",
+					APIKey:           "DXXXXCX80TZJ85Q70QCI",
+					TransactionStore: store,
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			if err := tt.call(client); (err != nil) != tt.wantErr {
+				t.Fatalf("call error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			records, err := store.Records("ORDER123")
+			if err != nil {
+				t.Fatalf("Records() error = %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("records = %d, want 1", len(records))
+			}
+			record := records[0]
+			if record.Event != tt.wantEvent || record.StatusCode != tt.wantStatus || record.MerchantCode != "DXXXX" {
+				t.Errorf("record = %+v", record)
+			}
+			if tt.wantErr != (record.Error != "") {
+				t.Errorf("record error = %q, wantErr %v", record.Error, tt.wantErr)
+			}
+			if record.RecordedAt.IsZero() {
+				t.Error("RecordedAt is zero")
+			}
+			if !tt.wantErr && !json.Valid(record.Payload) {
+				t.Errorf("payload = %s", record.Payload)
+			}
+		})
+	}
+}
+
+func TestTransactionStoreCallback(t *testing.T) {
+	store := NewMemoryTransactionStore()
+	client := &Client{config: Config{MerchantCode: "DXXXX", APIKey: "DXXXXCX80TZJ85Q70QCI", TransactionStore: store}}
+
+	form := url.Values{
+		"merchantCode":    {"DXXXX"},
+		"amount":          {"40000"},
+		"merchantOrderId": {"ORDER123"},
+		"paymentCode":     {"VC"},
+		"resultCode":      {"00"},
+		"reference":       {"REF123"},
+		"signature":       {SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER123")},
+	}
+	req := httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client.HandleCallback(httptest.NewRecorder(), req, func(*CallbackData) error { return nil })
+
+	// Callbacks with an invalid signature are not recorded
+	form.Set("signature", "invalid")
+	req = httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client.HandleCallback(httptest.NewRecorder(), req, func(*CallbackData) error { return nil })
+
+	// Nor are callbacks only parsed, or rejected by the handler
+	form.Set("signature", SignatureMD5("DXXXXCX80TZJ85Q70QCI", "DXXXX", "40000", "ORDER123"))
+	req = httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := client.ParseCallback(req); err != nil {
+		t.Fatalf("ParseCallback() error = %v", err)
+	}
+	req = httptest.NewRequest("POST", "/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client.HandleCallback(httptest.NewRecorder(), req, func(*CallbackData) error { return errors.New("database down") })
+
+	records, err := store.Records("ORDER123")
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("records = %d, want 1", len(records))
+	}
+	record := records[0]
+	if record.Event != RecordCallback || record.Reference != "REF123" || record.PaymentMethod != "VC" || record.Amount != "40000" || record.StatusCode != "00" {
+		t.Errorf("record = %+v", record)
+	}
+	var data CallbackData
+	if err := json.Unmarshal(record.Payload, &data); err != nil || data.MerchantOrderID != "ORDER123" {
+		t.Errorf("payload = %s, %v", record.Payload, err)
+	}
+}
+
+func TestTransactionStoreErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"merchantCode":"DXXXX","reference":"REF123","statusCode":"00","statusMessage":"SUCCESS"}`))
+	}))
+	defer server.Close()
+
+	var storeErrs []error
+	client := &Client{
+		config: Config{
+			MerchantCode:     "DXXXX",
+			APIKey:           "DXXXXCX80TZJ85Q70QCI",
+			TransactionStore: failingTransactionStore{},
+			OnStoreError: func(record *TransactionRecord, err error) {
+				if record.MerchantOrderID != "ORDER123" {
+					t.Errorf("record = %+v", record)
+				}
+				storeErrs = append(storeErrs, err)
+			},
+		},
+		baseURLs:   BaseURLs{Payment: server.URL},
+		httpClient: server.Client(),
+	}
+
+	// A store error does not fail the call
+	if _, err := client.CreateTransaction(TransactionRequest{MerchantOrderID: "ORDER123", PaymentAmount: 40000, PaymentMethod: "VC"}); err != nil {
+		t.Fatalf("CreateTransaction() error = %v", err)
+	}
+	if len(storeErrs) != 1 || !strings.Contains(storeErrs[0].Error(), "database down") {
+		t.Errorf("store errors = %v", storeErrs)
+	}
+}
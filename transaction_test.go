@@ -2,10 +2,14 @@ package duitku
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/fatkulnurk/duitku-go/cassette"
 )
 
 func TestCreateTransaction(t *testing.T) {
@@ -81,7 +85,7 @@ func TestCreateTransaction(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -150,7 +154,7 @@ func TestCreateTransactionError(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -226,7 +230,7 @@ func TestCheckTransaction(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -280,7 +284,7 @@ func TestCreateTransactionWithError(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -327,7 +331,7 @@ func TestCreateTransactionWithServerError(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -351,6 +355,60 @@ func TestCreateTransactionWithServerError(t *testing.T) {
 	}
 }
 
+func TestCreateTransactionUnconfirmed(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		wantExists bool
+	}{
+		{name: "Created Despite Gateway Error", status: `{"merchantOrderId":"ORDER123","reference":"REF123","amount":"40000","statusCode":"01","statusMessage":"PENDING"}`, wantExists: true},
+		{name: "Not Created", status: `{"merchantOrderId":"ORDER123","reference":"","amount":"","statusCode":"02","statusMessage":"NOT FOUND"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var creates int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/merchant/transactionStatus" {
+					w.Write([]byte(tt.status))
+					return
+				}
+				creates++
+				w.WriteHeader(http.StatusGatewayTimeout)
+				w.Write([]byte(`{"responseCode":"504","responseMessage":"Gateway Timeout"}`))
+			}))
+			defer server.Close()
+
+			client := &Client{
+				config: Config{
+					MerchantCode: "DXXXX",
+					APIKey:       "DXXXXCX80TZJ85Q70QCI",
+					MaxRetries:   3,
+					RetryWait:    time.Millisecond,
+				},
+				baseURLs:   BaseURLs{Payment: server.URL},
+				httpClient: server.Client(),
+			}
+
+			_, err := client.CreateTransaction(TransactionRequest{MerchantOrderID: "ORDER123", PaymentAmount: 40000, PaymentMethod: "VC"})
+			if err == nil {
+				t.Fatal("CreateTransaction() error = nil")
+			}
+			if creates != 1 {
+				t.Errorf("create requests = %d, want 1", creates)
+			}
+
+			var exists *TransactionExistsError
+			if errors.As(err, &exists) != tt.wantExists {
+				t.Fatalf("error = %v, want TransactionExistsError %v", err, tt.wantExists)
+			}
+			if tt.wantExists && (exists.Status.Reference != "REF123" || !strings.Contains(err.Error(), "Gateway Timeout")) {
+				t.Errorf("error = %v, status = %+v", err, exists.Status)
+			}
+		})
+	}
+}
+
 func TestCheckTransactionWithError(t *testing.T) {
 	// Create a test server that returns an error response
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -374,7 +432,7 @@ func TestCheckTransactionWithError(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -423,7 +481,7 @@ func TestCheckTransactionWithServerError(t *testing.T) {
 		IsSandbox:    true,
 	})
 	// Override the base URL to use the test server
-	client.baseURL = server.URL
+	client.baseURLs.Payment = server.URL
 
 	// Test checking a transaction with server error
 	_, err := client.CheckTransaction("ORDER123")
@@ -453,7 +511,7 @@ func TestCheckTransactionWithInvalidJSON(t *testing.T) {
 		IsSandbox:    true,
 	})
 	// Override the base URL to use the test server
-	client.baseURL = server.URL
+	client.baseURLs.Payment = server.URL
 
 	// Test checking a transaction with invalid JSON response
 	_, err := client.CheckTransaction("ORDER123")
@@ -530,7 +588,7 @@ func TestCreateTransactionWithOVOLink(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -627,7 +685,7 @@ func TestCreateTransactionWithShopeeLink(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -766,7 +824,7 @@ func TestCreateTransactionWithCreditCardDetails(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -879,7 +937,7 @@ func TestCreateTransactionWithItemDetails(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -995,7 +1053,7 @@ func TestCreateSubscriptionTransaction(t *testing.T) {
 			MerchantCode: "DXXXX",
 			APIKey:       "DXXXXCX80TZJ85Q70QCI",
 		},
-		baseURL:    server.URL,
+		baseURLs:   BaseURLs{Payment: server.URL},
 		httpClient: server.Client(),
 	}
 
@@ -1046,3 +1104,174 @@ func TestCreateSubscriptionTransaction(t *testing.T) {
 		t.Errorf("Response StatusMessage = %s, want SUCCESS", response.StatusMessage)
 	}
 }
+
+func TestCreateRedirectTransaction(t *testing.T) {
+	// Create a test server standing in for POP that checks the signed
+	// headers and that the payment method is omitted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/createInvoice" {
+			t.Errorf("path = %s, want /createInvoice", r.URL.Path)
+		}
+		timestamp := r.Header.Get("x-duitku-timestamp")
+		if timestamp == "" || r.Header.Get("x-duitku-merchantcode") != "DXXXX" {
+			t.Errorf("headers = %v, want the merchant code and timestamp", r.Header)
+		}
+		if got, want := r.Header.Get("x-duitku-signature"), SignatureSHA256("DXXXXCX80TZJ85Q70QCI", "DXXXX", timestamp); got != want {
+			t.Errorf("x-duitku-signature = %s, want %s", got, want)
+		}
+
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Error decoding request body: %v", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := request["paymentMethod"]; ok {
+			t.Errorf("Expected paymentMethod to be omitted, got %v", request["paymentMethod"])
+		}
+		if request["merchantOrderId"] != "ORDER123" {
+			t.Errorf("merchantOrderId = %v, want ORDER123", request["merchantOrderId"])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"merchantCode": "DXXXX",
+			"reference": "DEV123456789",
+			"paymentUrl": "https://sandbox.duitku.com/topup/topupdirectv2.aspx?ref=DEV123456789",
+			"amount": "40000",
+			"statusCode": "00",
+			"statusMessage": "SUCCESS"
+		}`))
+	}))
+	defer server.Close()
+
+	// Create a client that uses the test server
+	client := &Client{
+		config: Config{
+			MerchantCode: "DXXXX",
+			APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		},
+		baseURLs:   BaseURLs{POP: server.URL},
+		httpClient: server.Client(),
+	}
+
+	request := TransactionRequest{
+		PaymentAmount:   40000,
+		MerchantOrderID: "ORDER123",
+		ProductDetails:  "Test Product",
+		CustomerVaName:  "John Doe",
+		Email:           "customer@example.com",
+		CallbackURL:     "https://example.com/callback",
+		ReturnURL:       "https://example.com/return",
+		ExpiryPeriod:    10,
+	}
+
+	response, err := client.CreateRedirectTransaction(request)
+	if err != nil {
+		t.Fatalf("CreateRedirectTransaction() error = %v, want nil", err)
+	}
+	if response.PaymentURL != "https://sandbox.duitku.com/topup/topupdirectv2.aspx?ref=DEV123456789" {
+		t.Errorf("Response PaymentURL = %s, want hosted page URL", response.PaymentURL)
+	}
+	if response.Reference != "DEV123456789" {
+		t.Errorf("Response Reference = %s, want DEV123456789", response.Reference)
+	}
+}
+
+func TestCreateRedirectTransactionErrors(t *testing.T) {
+	// Create a test server that returns a response without a payment URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"merchantCode":"DXXXX","reference":"DEV123456789","amount":"40000","statusCode":"00","statusMessage":"SUCCESS"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{
+		config: Config{
+			MerchantCode: "DXXXX",
+			APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		},
+		baseURLs:   BaseURLs{POP: server.URL},
+		httpClient: server.Client(),
+	}
+
+	// A payment method is not allowed in redirect mode
+	_, err := client.CreateRedirectTransaction(TransactionRequest{PaymentAmount: 40000, PaymentMethod: PaymentMethodBCA, MerchantOrderID: "ORDER123"})
+	if err == nil || !strings.Contains(err.Error(), "payment method must be empty") {
+		t.Errorf("CreateRedirectTransaction() error = %v, want payment method error", err)
+	}
+
+	// A response without a payment URL is unusable
+	_, err = client.CreateRedirectTransaction(TransactionRequest{PaymentAmount: 40000, MerchantOrderID: "ORDER123"})
+	if err == nil || !strings.Contains(err.Error(), "no payment url") {
+		t.Errorf("CreateRedirectTransaction() error = %v, want missing payment url error", err)
+	}
+}
+
+func TestTransactionStatusResponseHelpers(t *testing.T) {
+	tests := []struct {
+		statusCode    string
+		wantSuccess   bool
+		wantPending   bool
+		wantCancelled bool
+	}{
+		{CheckTransactionStatusSuccess, true, false, false},
+		{CheckTransactionStatusPending, false, true, false},
+		{CheckTransactionStatusCancelled, false, false, true},
+	}
+
+	for _, tt := range tests {
+		response := &TransactionStatusResponse{StatusCode: tt.statusCode}
+		if response.IsSuccessful() != tt.wantSuccess {
+			t.Errorf("IsSuccessful() for %s = %v, want %v", tt.statusCode, response.IsSuccessful(), tt.wantSuccess)
+		}
+		if response.IsPending() != tt.wantPending {
+			t.Errorf("IsPending() for %s = %v, want %v", tt.statusCode, response.IsPending(), tt.wantPending)
+		}
+		if response.IsCancelled() != tt.wantCancelled {
+			t.Errorf("IsCancelled() for %s = %v, want %v", tt.statusCode, response.IsCancelled(), tt.wantCancelled)
+		}
+	}
+}
+
+func TestCreateTransactionReplay(t *testing.T) {
+	recorder, err := cassette.New("testdata/cassettes/create_transaction.json", cassette.Options{})
+	if err != nil {
+		t.Fatalf("cassette.New() error = %v", err)
+	}
+	client := NewClient(Config{
+		MerchantCode: "DXXXX",
+		APIKey:       "DXXXXCX80TZJ85Q70QCI",
+		IsSandbox:    true,
+		HTTPClient:   recorder.Client(),
+	})
+
+	request := TransactionRequest{
+		PaymentAmount:   40000,
+		PaymentMethod:   "M2",
+		MerchantOrderID: "ORDER-1001",
+		ProductDetails:  "Test payment",
+		CustomerVaName:  "John Doe",
+		Email:           "customer@example.com",
+		PhoneNumber:     "08123456789",
+		CallbackURL:     "https://example.com/callback",
+		ReturnURL:       "https://example.com/return",
+		ExpiryPeriod:    60,
+	}
+	response, err := client.CreateTransaction(request)
+	if err != nil {
+		t.Fatalf("CreateTransaction() error = %v", err)
+	}
+	if response.Reference != "DXXXXM2XXXXG2HSQY1EY9NUV" || response.VANumber != "7007014006271513" {
+		t.Errorf("CreateTransaction() = %+v", response)
+	}
+
+	request.MerchantOrderID = "ORDER-1002"
+	request.PaymentMethod = "XX"
+	if _, err := client.CreateTransaction(request); err == nil {
+		t.Error("CreateTransaction() with an unavailable channel error = nil")
+	}
+}
@@ -0,0 +1,571 @@
+package duitku
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// Language selects the language of payment instructions
+type Language string
+
+// Supported instruction languages
+const (
+	LanguageIndonesian Language = "id"
+	LanguageEnglish    Language = "en"
+)
+
+// InstructionChannel is the banking channel a set of payment steps applies to
+type InstructionChannel string
+
+// Supported instruction channels
+const (
+	ChannelATM             InstructionChannel = "atm"
+	ChannelMobileBanking   InstructionChannel = "mobile_banking"
+	ChannelInternetBanking InstructionChannel = "internet_banking"
+)
+
+// virtualAccountBank describes how a bank presents its virtual accounts
+type virtualAccountBank struct {
+	// Name is the display name of the bank
+	Name string
+	// Groups are the leading digit group sizes, remaining digits are grouped by four
+	Groups []int
+	// Text holds the channel names and menu paths per language
+	Text map[Language]bankText
+}
+
+// bankText holds the localized channel names and menu paths of a bank
+type bankText struct {
+	// ATMMenu is the ATM menu path to the virtual account payment
+	ATMMenu string
+	// MobileApp is the name of the mobile banking application
+	MobileApp string
+	// MobileMenu is the mobile banking menu path to the virtual account payment
+	MobileMenu string
+	// InternetBanking is the internet banking site
+	InternetBanking string
+	// InternetBankingMenu is the internet banking menu path to the virtual account payment
+	InternetBankingMenu string
+}
+
+// virtualAccountBanks maps virtual account payment method codes to their bank
+var virtualAccountBanks = map[string]virtualAccountBank{
+	PaymentMethodBCA: {
+		Name:   "BCA",
+		Groups: []int{5},
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Transaksi Lainnya > Transfer > ke Rek BCA Virtual Account",
+				MobileApp:           "BCA mobile",
+				MobileMenu:          "m-Transfer > BCA Virtual Account",
+				InternetBanking:     "KlikBCA (klikbca.com)",
+				InternetBankingMenu: "Transfer Dana > Transfer ke BCA Virtual Account",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Other Transactions > Transfer > To BCA Virtual Account",
+				MobileApp:           "BCA mobile",
+				MobileMenu:          "m-Transfer > BCA Virtual Account",
+				InternetBanking:     "KlikBCA (klikbca.com)",
+				InternetBankingMenu: "Fund Transfer > Transfer to BCA Virtual Account",
+			},
+		},
+	},
+	PaymentMethodMandiri: {
+		Name:   "Mandiri",
+		Groups: []int{5},
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Bayar/Beli > Lainnya > Multi Payment",
+				MobileApp:           "Livin' by Mandiri",
+				MobileMenu:          "Bayar > Buat Pembayaran Baru > Multipayment",
+				InternetBanking:     "Mandiri Internet Banking (ibank.bankmandiri.co.id)",
+				InternetBankingMenu: "Bayar > Multi Payment",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Pay/Buy > Others > Multi Payment",
+				MobileApp:           "Livin' by Mandiri",
+				MobileMenu:          "Pay > Create New Payment > Multipayment",
+				InternetBanking:     "Mandiri Internet Banking (ibank.bankmandiri.co.id)",
+				InternetBankingMenu: "Payment > Multi Payment",
+			},
+		},
+	},
+	PaymentMethodMaybank: {
+		Name: "Maybank",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Pembayaran/Top Up Pulsa > Virtual Account",
+				MobileApp:           "M2U ID App",
+				MobileMenu:          "Transfer > Virtual Account",
+				InternetBanking:     "Maybank2u (m2u.maybank.co.id)",
+				InternetBankingMenu: "Transfer > Maybank Virtual Account",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Payment/Top Up > Virtual Account",
+				MobileApp:           "M2U ID App",
+				MobileMenu:          "Transfer > Virtual Account",
+				InternetBanking:     "Maybank2u (m2u.maybank.co.id)",
+				InternetBankingMenu: "Transfer > Maybank Virtual Account",
+			},
+		},
+	},
+	PaymentMethodBNI: {
+		Name: "BNI",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Menu Lainnya > Transfer > Virtual Account Billing",
+				MobileApp:           "BNI Mobile Banking",
+				MobileMenu:          "Transfer > Virtual Account Billing",
+				InternetBanking:     "BNI Internet Banking (ibank.bni.co.id)",
+				InternetBankingMenu: "Transfer > Virtual Account Billing",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Other Menu > Transfer > Virtual Account Billing",
+				MobileApp:           "BNI Mobile Banking",
+				MobileMenu:          "Transfer > Virtual Account Billing",
+				InternetBanking:     "BNI Internet Banking (ibank.bni.co.id)",
+				InternetBankingMenu: "Transfer > Virtual Account Billing",
+			},
+		},
+	},
+	PaymentMethodCIMB: {
+		Name:   "CIMB Niaga",
+		Groups: []int{4},
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Transfer > Rekening CIMB Niaga/Rekening Ponsel",
+				MobileApp:           "OCTO Mobile",
+				MobileMenu:          "Transfer > Rekening CIMB Niaga",
+				InternetBanking:     "OCTO Clicks (octoclicks.co.id)",
+				InternetBankingMenu: "Bayar Tagihan > Virtual Account",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Transfer > CIMB Niaga Account/Mobile Number Account",
+				MobileApp:           "OCTO Mobile",
+				MobileMenu:          "Transfer > CIMB Niaga Account",
+				InternetBanking:     "OCTO Clicks (octoclicks.co.id)",
+				InternetBankingMenu: "Bill Payment > Virtual Account",
+			},
+		},
+	},
+	PaymentMethodPermata: {
+		Name: "Permata Bank",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Transaksi Lainnya > Pembayaran > Pembayaran Lainnya > Virtual Account",
+				MobileApp:           "PermataMobile X",
+				MobileMenu:          "Pembayaran Tagihan > Virtual Account",
+				InternetBanking:     "PermataNet (permatanet.com)",
+				InternetBankingMenu: "Pembayaran Tagihan > Virtual Account",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Other Transactions > Payment > Other Payments > Virtual Account",
+				MobileApp:           "PermataMobile X",
+				MobileMenu:          "Bill Payment > Virtual Account",
+				InternetBanking:     "PermataNet (permatanet.com)",
+				InternetBankingMenu: "Bill Payment > Virtual Account",
+			},
+		},
+	},
+	PaymentMethodATMBersama: {
+		Name: "ATM Bersama",
+		Text: map[Language]bankText{
+			LanguageIndonesian: otherBankIndonesian,
+			LanguageEnglish:    otherBankEnglish,
+		},
+	},
+	PaymentMethodArthaGraha: {
+		Name: "Bank Artha Graha",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Transaksi Lainnya > Pembayaran > Virtual Account",
+				MobileApp:           "AG Mobile",
+				MobileMenu:          "Pembayaran > Virtual Account",
+				InternetBanking:     "AG Internet Banking",
+				InternetBankingMenu: "Pembayaran > Virtual Account",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Other Transactions > Payment > Virtual Account",
+				MobileApp:           "AG Mobile",
+				MobileMenu:          "Payment > Virtual Account",
+				InternetBanking:     "AG Internet Banking",
+				InternetBankingMenu: "Payment > Virtual Account",
+			},
+		},
+	},
+	PaymentMethodNeoCommerce: {
+		Name: "Bank Neo Commerce",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             otherBankIndonesian.ATMMenu,
+				MobileApp:           "neobank",
+				MobileMenu:          "Transfer > Virtual Account",
+				InternetBanking:     otherBankIndonesian.InternetBanking,
+				InternetBankingMenu: otherBankIndonesian.InternetBankingMenu,
+			},
+			LanguageEnglish: {
+				ATMMenu:             otherBankEnglish.ATMMenu,
+				MobileApp:           "neobank",
+				MobileMenu:          "Transfer > Virtual Account",
+				InternetBanking:     otherBankEnglish.InternetBanking,
+				InternetBankingMenu: otherBankEnglish.InternetBankingMenu,
+			},
+		},
+	},
+	PaymentMethodBRI: {
+		Name:   "BRI",
+		Groups: []int{5},
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Transaksi Lain > Pembayaran > Lainnya > BRIVA",
+				MobileApp:           "BRImo",
+				MobileMenu:          "BRIVA",
+				InternetBanking:     "Internet Banking BRI (ib.bri.co.id)",
+				InternetBankingMenu: "Pembayaran > BRIVA",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Other Transactions > Payment > Others > BRIVA",
+				MobileApp:           "BRImo",
+				MobileMenu:          "BRIVA",
+				InternetBanking:     "BRI Internet Banking (ib.bri.co.id)",
+				InternetBankingMenu: "Payment > BRIVA",
+			},
+		},
+	},
+	PaymentMethodSahabat: {
+		Name: "Bank Sahabat Sampoerna",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             otherBankIndonesian.ATMMenu,
+				MobileApp:           "Sampoerna Mobile",
+				MobileMenu:          "Transfer > Virtual Account",
+				InternetBanking:     otherBankIndonesian.InternetBanking,
+				InternetBankingMenu: otherBankIndonesian.InternetBankingMenu,
+			},
+			LanguageEnglish: {
+				ATMMenu:             otherBankEnglish.ATMMenu,
+				MobileApp:           "Sampoerna Mobile",
+				MobileMenu:          "Transfer > Virtual Account",
+				InternetBanking:     otherBankEnglish.InternetBanking,
+				InternetBankingMenu: otherBankEnglish.InternetBankingMenu,
+			},
+		},
+	},
+	PaymentMethodDanamon: {
+		Name: "Danamon",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Pembayaran > Virtual Account",
+				MobileApp:           "D-Bank PRO",
+				MobileMenu:          "Bayar > Virtual Account",
+				InternetBanking:     "Danamon Online Banking",
+				InternetBankingMenu: "Pembayaran > Virtual Account",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Payment > Virtual Account",
+				MobileApp:           "D-Bank PRO",
+				MobileMenu:          "Pay > Virtual Account",
+				InternetBanking:     "Danamon Online Banking",
+				InternetBankingMenu: "Payment > Virtual Account",
+			},
+		},
+	},
+	PaymentMethodBSI: {
+		Name: "BSI",
+		Text: map[Language]bankText{
+			LanguageIndonesian: {
+				ATMMenu:             "Pembayaran/Pembelian > Institusi",
+				MobileApp:           "BSI Mobile",
+				MobileMenu:          "Pembayaran > E-Commerce",
+				InternetBanking:     "BSI Net Banking (bsinet.bankbsi.co.id)",
+				InternetBankingMenu: "Pembayaran > E-Commerce",
+			},
+			LanguageEnglish: {
+				ATMMenu:             "Payment/Purchase > Institution",
+				MobileApp:           "BSI Mobile",
+				MobileMenu:          "Payment > E-Commerce",
+				InternetBanking:     "BSI Net Banking (bsinet.bankbsi.co.id)",
+				InternetBankingMenu: "Payment > E-Commerce",
+			},
+		},
+	},
+}
+
+// otherBankIndonesian and otherBankEnglish are the steps of an interbank
+// transfer, for virtual accounts paid from any bank
+var (
+	otherBankIndonesian = bankText{
+		ATMMenu:             "Transaksi Lainnya > Transfer > Transfer ke Bank Lain",
+		MobileApp:           "mobile banking bank Anda",
+		MobileMenu:          "Transfer > Antar Bank",
+		InternetBanking:     "internet banking bank Anda",
+		InternetBankingMenu: "Transfer > Antar Bank",
+	}
+	otherBankEnglish = bankText{
+		ATMMenu:             "Other Transactions > Transfer > Transfer to Other Bank",
+		MobileApp:           "mobile banking",
+		MobileMenu:          "Transfer > Interbank",
+		InternetBanking:     "your bank's internet banking",
+		InternetBankingMenu: "Transfer > Interbank",
+	}
+)
+
+// instructionTemplates holds the localized step templates per channel.
+// Placeholders: {bank}, {va}, {amount}, {menu}, {app}, {site}.
+var instructionTemplates = map[Language]map[InstructionChannel][]string{
+	LanguageIndonesian: {
+		ChannelATM: {
+			"Masukkan kartu ATM dan PIN Anda",
+			"Pilih menu {menu}",
+			"Masukkan nomor virtual account {va}",
+			"Periksa nama dan jumlah tagihan {amount}, lalu pilih Benar/Ya",
+			"Simpan struk sebagai bukti pembayaran",
+		},
+		ChannelMobileBanking: {
+			"Buka aplikasi {app} dan masuk ke akun Anda",
+			"Pilih menu {menu}",
+			"Masukkan nomor virtual account {va}",
+			"Periksa nama dan jumlah tagihan {amount}",
+			"Masukkan PIN atau kata sandi transaksi untuk menyelesaikan pembayaran",
+		},
+		ChannelInternetBanking: {
+			"Masuk ke {site}",
+			"Pilih menu {menu}",
+			"Masukkan nomor virtual account {va}",
+			"Periksa nama dan jumlah tagihan {amount}",
+			"Masukkan token atau kode OTP untuk menyelesaikan pembayaran",
+		},
+	},
+	LanguageEnglish: {
+		ChannelATM: {
+			"Insert your ATM card and enter your PIN",
+			"Select {menu}",
+			"Enter the virtual account number {va}",
+			"Check the name and the amount {amount}, then confirm",
+			"Keep the receipt as proof of payment",
+		},
+		ChannelMobileBanking: {
+			"Open the {app} app and log in",
+			"Select {menu}",
+			"Enter the virtual account number {va}",
+			"Check the name and the amount {amount}",
+			"Enter your PIN or transaction password to complete the payment",
+		},
+		ChannelInternetBanking: {
+			"Log in to {site}",
+			"Select {menu}",
+			"Enter the virtual account number {va}",
+			"Check the name and the amount {amount}",
+			"Enter the token or OTP code to complete the payment",
+		},
+	},
+}
+
+// instructionTitles holds the localized section titles
+var instructionTitles = map[Language]map[InstructionChannel]string{
+	LanguageIndonesian: {
+		ChannelATM:             "ATM {bank}",
+		ChannelMobileBanking:   "Mobile Banking {bank}",
+		ChannelInternetBanking: "Internet Banking {bank}",
+	},
+	LanguageEnglish: {
+		ChannelATM:             "{bank} ATM",
+		ChannelMobileBanking:   "{bank} Mobile Banking",
+		ChannelInternetBanking: "{bank} Internet Banking",
+	},
+}
+
+// instructionLabels holds the localized labels used when rendering
+var instructionLabels = map[Language]struct{ VirtualAccount, Amount string }{
+	LanguageIndonesian: {VirtualAccount: "Nomor Virtual Account", Amount: "Jumlah"},
+	LanguageEnglish:    {VirtualAccount: "Virtual Account Number", Amount: "Amount"},
+}
+
+// instructionChannels is the order in which sections are returned
+var instructionChannels = []InstructionChannel{ChannelATM, ChannelMobileBanking, ChannelInternetBanking}
+
+// PaymentInstruction is the list of steps to pay through one channel
+type PaymentInstruction struct {
+	Channel InstructionChannel `json:"channel"`
+	Title   string             `json:"title"`
+	Steps   []string           `json:"steps"`
+}
+
+// PaymentInstructions are the localized steps to pay a virtual account
+type PaymentInstructions struct {
+	PaymentMethod   string               `json:"paymentMethod"`
+	BankName        string               `json:"bankName"`
+	VANumber        string               `json:"vaNumber"`
+	FormattedNumber string               `json:"formattedNumber"`
+	Amount          int                  `json:"amount"`
+	Language        Language             `json:"language"`
+	Instructions    []PaymentInstruction `json:"instructions"`
+}
+
+// IsVirtualAccountMethod returns true if the payment method code is a virtual account
+func IsVirtualAccountMethod(paymentMethod string) bool {
+	_, ok := virtualAccountBanks[paymentMethod]
+	return ok
+}
+
+// FormatVANumber groups the digits of a virtual account number the way the bank
+// prints them, e.g. "12345 6789 0123 4567" for BCA. Unknown payment methods are
+// grouped by four.
+func FormatVANumber(paymentMethod, vaNumber string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, vaNumber)
+
+	var groups []string
+	for _, size := range virtualAccountBanks[paymentMethod].Groups {
+		if len(digits) <= size {
+			break
+		}
+		groups = append(groups, digits[:size])
+		digits = digits[size:]
+	}
+	for len(digits) > 4 {
+		groups = append(groups, digits[:4])
+		digits = digits[4:]
+	}
+	if digits != "" {
+		groups = append(groups, digits)
+	}
+
+	return strings.Join(groups, " ")
+}
+
+// FormatRupiah formats an amount in Indonesian style, e.g. "Rp 40.000"
+func FormatRupiah(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	s := strconv.Itoa(amount)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	return sign + "Rp " + s
+}
+
+// GetPaymentInstructions returns step by step instructions to pay a virtual
+// account through ATM, mobile banking and internet banking
+func GetPaymentInstructions(paymentMethod, vaNumber string, amount int, lang Language) (*PaymentInstructions, error) {
+	bank, ok := virtualAccountBanks[paymentMethod]
+	if !ok {
+		return nil, fmt.Errorf("payment method %s is not a virtual account", paymentMethod)
+	}
+	templates, ok := instructionTemplates[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", lang)
+	}
+
+	formatted := FormatVANumber(paymentMethod, vaNumber)
+	instructions := &PaymentInstructions{
+		PaymentMethod:   paymentMethod,
+		BankName:        bank.Name,
+		VANumber:        vaNumber,
+		FormattedNumber: formatted,
+		Amount:          amount,
+		Language:        lang,
+	}
+
+	text := bank.Text[lang]
+	for _, channel := range instructionChannels {
+		menu, app, site := text.ATMMenu, text.MobileApp, text.InternetBanking
+		switch channel {
+		case ChannelMobileBanking:
+			menu = text.MobileMenu
+		case ChannelInternetBanking:
+			menu = text.InternetBankingMenu
+		}
+		replacer := strings.NewReplacer(
+			"{bank}", bank.Name,
+			"{va}", formatted,
+			"{amount}", FormatRupiah(amount),
+			"{menu}", menu,
+			"{app}", app,
+			"{site}", site,
+		)
+
+		steps := make([]string, len(templates[channel]))
+		for i, step := range templates[channel] {
+			steps[i] = replacer.Replace(step)
+		}
+		instructions.Instructions = append(instructions.Instructions, PaymentInstruction{
+			Channel: channel,
+			Title:   replacer.Replace(instructionTitles[lang][channel]),
+			Steps:   steps,
+		})
+	}
+
+	return instructions, nil
+}
+
+// PaymentInstructions returns the instructions to pay the virtual account of
+// the response. The payment method is the one sent in the TransactionRequest.
+func (r *TransactionResponse) PaymentInstructions(paymentMethod string, lang Language) (*PaymentInstructions, error) {
+	if r.VANumber == "" {
+		return nil, fmt.Errorf("transaction response has no virtual account number")
+	}
+	amount, err := strconv.Atoi(r.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %w", r.Amount, err)
+	}
+	return GetPaymentInstructions(paymentMethod, r.VANumber, amount, lang)
+}
+
+// Text renders the instructions as plain text with numbered steps
+func (p *PaymentInstructions) Text() string {
+	labels := instructionLabels[p.Language]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: %s\n", p.BankName, labels.VirtualAccount, p.FormattedNumber)
+	fmt.Fprintf(&b, "%s: %s\n", labels.Amount, FormatRupiah(p.Amount))
+	for _, instruction := range p.Instructions {
+		fmt.Fprintf(&b, "\n%s\n", instruction.Title)
+		for i, step := range instruction.Steps {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+		}
+	}
+	return b.String()
+}
+
+var instructionsHTML = template.Must(template.New("instructions").Parse(
+	`<div class="duitku-va-instructions" lang="{{.Language}}">
+<p class="duitku-va-number">{{.BankName}} {{.Labels.VirtualAccount}}: <strong>{{.FormattedNumber}}</strong></p>
+<p class="duitku-va-amount">{{.Labels.Amount}}: <strong>{{.Amount}}</strong></p>
+{{range .Instructions}}<section class="duitku-va-channel" data-channel="{{.Channel}}">
+<h3>{{.Title}}</h3>
+<ol>
+{{range .Steps}}<li>{{.}}</li>
+{{end}}</ol>
+</section>
+{{end}}</div>
+`))
+
+// HTML renders the instructions as an HTML fragment with one ordered list per channel
+func (p *PaymentInstructions) HTML() (string, error) {
+	data := struct {
+		*PaymentInstructions
+		Amount string
+		Labels struct{ VirtualAccount, Amount string }
+	}{
+		PaymentInstructions: p,
+		Amount:              FormatRupiah(p.Amount),
+		Labels:              instructionLabels[p.Language],
+	}
+
+	var buf bytes.Buffer
+	if err := instructionsHTML.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering instructions: %w", err)
+	}
+	return buf.String(), nil
+}
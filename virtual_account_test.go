@@ -0,0 +1,223 @@
+package duitku
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatVANumber(t *testing.T) {
+	tests := []struct {
+		name          string
+		paymentMethod string
+		vaNumber      string
+		want          string
+	}{
+		{
+			name:          "BCA Company Prefix",
+			paymentMethod: PaymentMethodBCA,
+			vaNumber:      "7007014001444348",
+			want:          "70070 1400 1444 348",
+		},
+		{
+			name:          "BNI Groups Of Four",
+			paymentMethod: PaymentMethodBNI,
+			vaNumber:      "8808123456789012",
+			want:          "8808 1234 5678 9012",
+		},
+		{
+			name:          "Already Formatted",
+			paymentMethod: PaymentMethodPermata,
+			vaNumber:      "8625-1234-5678-9012",
+			want:          "8625 1234 5678 9012",
+		},
+		{
+			name:          "Unknown Method",
+			paymentMethod: "XX",
+			vaNumber:      "123456",
+			want:          "1234 56",
+		},
+		{
+			name:          "Shorter Than Prefix",
+			paymentMethod: PaymentMethodBRI,
+			vaNumber:      "1234",
+			want:          "1234",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatVANumber(tt.paymentMethod, tt.vaNumber); got != tt.want {
+				t.Errorf("FormatVANumber() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRupiah(t *testing.T) {
+	tests := []struct {
+		amount int
+		want   string
+	}{
+		{0, "Rp 0"},
+		{500, "Rp 500"},
+		{40000, "Rp 40.000"},
+		{1234567, "Rp 1.234.567"},
+		{-15000, "-Rp 15.000"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatRupiah(tt.amount); got != tt.want {
+			t.Errorf("FormatRupiah(%d) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestGetPaymentInstructions(t *testing.T) {
+	tests := []struct {
+		name      string
+		lang      Language
+		wantTitle string
+		wantStep  string
+	}{
+		{
+			name:      "Indonesian",
+			lang:      LanguageIndonesian,
+			wantTitle: "ATM BCA",
+			wantStep:  "Masukkan nomor virtual account 70070 1400 1444 348",
+		},
+		{
+			name:      "English",
+			lang:      LanguageEnglish,
+			wantTitle: "BCA ATM",
+			wantStep:  "Enter the virtual account number 70070 1400 1444 348",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instructions, err := GetPaymentInstructions(PaymentMethodBCA, "7007014001444348", 40000, tt.lang)
+			if err != nil {
+				t.Fatalf("GetPaymentInstructions() error = %v, want nil", err)
+			}
+
+			if len(instructions.Instructions) != 3 {
+				t.Fatalf("GetPaymentInstructions() sections = %d, want 3", len(instructions.Instructions))
+			}
+			atm := instructions.Instructions[0]
+			if atm.Channel != ChannelATM {
+				t.Errorf("first channel = %s, want %s", atm.Channel, ChannelATM)
+			}
+			if atm.Title != tt.wantTitle {
+				t.Errorf("ATM title = %q, want %q", atm.Title, tt.wantTitle)
+			}
+			if atm.Steps[2] != tt.wantStep {
+				t.Errorf("ATM step 3 = %q, want %q", atm.Steps[2], tt.wantStep)
+			}
+			if !strings.Contains(instructions.Instructions[1].Steps[0], "BCA mobile") {
+				t.Errorf("mobile banking step should name the app, got %q", instructions.Instructions[1].Steps[0])
+			}
+			for _, section := range instructions.Instructions {
+				for _, step := range section.Steps {
+					if strings.Contains(step, "{") {
+						t.Errorf("unreplaced placeholder in %q", step)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentInstructionsLanguage(t *testing.T) {
+	indonesian := []string{
+		"anda", "aplikasi", "antar", "bank lain", "bayar", "beli", "baru", "buat", "dana", "institusi", "ke",
+		"lain", "lainnya", "masukkan", "pembayaran", "pembelian", "pilih", "rekening", "tagihan", "transaksi",
+	}
+
+	for method := range virtualAccountBanks {
+		instructions, err := GetPaymentInstructions(method, "7007014001444348", 40000, LanguageEnglish)
+		if err != nil {
+			t.Fatalf("GetPaymentInstructions(%s) error = %v", method, err)
+		}
+		// Pad the words with spaces to match whole words only
+		words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(instructions.Text()), func(r rune) bool {
+			return !('a' <= r && r <= 'z')
+		}), " ") + " "
+		for _, word := range indonesian {
+			if strings.Contains(words, " "+word+" ") {
+				t.Errorf("English instructions of %s contain %q:\n%s", method, word, instructions.Text())
+			}
+		}
+	}
+}
+
+func TestGetPaymentInstructionsErrors(t *testing.T) {
+	if _, err := GetPaymentInstructions(PaymentMethodOVO, "123", 10000, LanguageEnglish); err == nil {
+		t.Errorf("GetPaymentInstructions() error = nil, want error for non VA method")
+	}
+	if _, err := GetPaymentInstructions(PaymentMethodBCA, "123", 10000, Language("fr")); err == nil {
+		t.Errorf("GetPaymentInstructions() error = nil, want error for unsupported language")
+	}
+	if IsVirtualAccountMethod(PaymentMethodQrisDana) {
+		t.Errorf("IsVirtualAccountMethod(%s) = true, want false", PaymentMethodQrisDana)
+	}
+}
+
+func TestTransactionResponsePaymentInstructions(t *testing.T) {
+	response := &TransactionResponse{VANumber: "8808123456789012", Amount: "150000"}
+
+	instructions, err := response.PaymentInstructions(PaymentMethodBNI, LanguageEnglish)
+	if err != nil {
+		t.Fatalf("PaymentInstructions() error = %v, want nil", err)
+	}
+	if instructions.Amount != 150000 {
+		t.Errorf("PaymentInstructions() amount = %d, want 150000", instructions.Amount)
+	}
+
+	if _, err := (&TransactionResponse{Amount: "10000"}).PaymentInstructions(PaymentMethodBNI, LanguageEnglish); err == nil {
+		t.Errorf("PaymentInstructions() error = nil, want error without VA number")
+	}
+}
+
+func TestPaymentInstructionsText(t *testing.T) {
+	instructions, err := GetPaymentInstructions(PaymentMethodMandiri, "8860812345678901", 25000, LanguageIndonesian)
+	if err != nil {
+		t.Fatalf("GetPaymentInstructions() error = %v, want nil", err)
+	}
+
+	text := instructions.Text()
+	for _, want := range []string{
+		"Mandiri Nomor Virtual Account: 88608 1234 5678 901",
+		"Jumlah: Rp 25.000",
+		"Mobile Banking Mandiri\n1. Buka aplikasi Livin' by Mandiri",
+		"5. Masukkan token atau kode OTP",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text() missing %q, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestPaymentInstructionsHTML(t *testing.T) {
+	instructions, err := GetPaymentInstructions(PaymentMethodMandiri, "8860812345678901", 25000, LanguageEnglish)
+	if err != nil {
+		t.Fatalf("GetPaymentInstructions() error = %v, want nil", err)
+	}
+
+	html, err := instructions.HTML()
+	if err != nil {
+		t.Fatalf("HTML() error = %v, want nil", err)
+	}
+	for _, want := range []string{
+		`lang="en"`,
+		`<strong>88608 1234 5678 901</strong>`,
+		`data-channel="mobile_banking"`,
+		`<li>Open the Livin&#39; by Mandiri app and log in</li>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML() missing %q, got:\n%s", want, html)
+		}
+	}
+	if strings.Count(html, "<ol>") != 3 {
+		t.Errorf("HTML() should render three ordered lists")
+	}
+}